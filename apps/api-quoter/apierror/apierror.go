@@ -0,0 +1,157 @@
+// Package apierror writes the JSON error envelope shared by every endpoint:
+//
+//	{"success":false,"code":"VALIDATION_FAILED","message":"...","details":[...],"requestId":"..."}
+//
+// Codes are stable identifiers clients can branch on; messages come from the
+// i18n catalog ("error.<CODE>", "field.<code>") when the response is written.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/joledev/api-quoter/i18n"
+	"github.com/joledev/api-quoter/models"
+)
+
+type Code string
+
+const (
+	InvalidBody       Code = "INVALID_BODY"
+	BodyTooLarge      Code = "BODY_TOO_LARGE"
+	ValidationFailed  Code = "VALIDATION_FAILED"
+	RateLimited       Code = "RATE_LIMITED"
+	CaptchaRequired   Code = "CAPTCHA_REQUIRED"
+	CaptchaFailed     Code = "CAPTCHA_FAILED"
+	Unauthorized      Code = "UNAUTHORIZED"
+	InsufficientScope Code = "INSUFFICIENT_SCOPE"
+	NotFound          Code = "NOT_FOUND"
+	MethodNotAllowed  Code = "METHOD_NOT_ALLOWED"
+	Internal          Code = "INTERNAL"
+)
+
+var statuses = map[Code]int{
+	InvalidBody:       http.StatusBadRequest,
+	BodyTooLarge:      http.StatusRequestEntityTooLarge,
+	ValidationFailed:  http.StatusBadRequest,
+	RateLimited:       http.StatusTooManyRequests,
+	CaptchaRequired:   http.StatusForbidden,
+	CaptchaFailed:     http.StatusForbidden,
+	Unauthorized:      http.StatusUnauthorized,
+	InsufficientScope: http.StatusForbidden,
+	NotFound:          http.StatusNotFound,
+	MethodNotAllowed:  http.StatusMethodNotAllowed,
+	Internal:          http.StatusInternalServerError,
+}
+
+// Error is an API error ready to be written. Build it with New or
+// Validation.
+type Error struct {
+	Code   Code
+	fields []field
+}
+
+type field struct {
+	name, code, param string
+}
+
+func New(code Code) *Error {
+	return &Error{Code: code}
+}
+
+// Validation collects invalid fields. Add fields with Required, TooLong,
+// Format, OneOf, Count or Invalid, then check Empty before writing.
+func Validation() *Error {
+	return &Error{Code: ValidationFailed}
+}
+
+func (e *Error) Required(name string) *Error { return e.add(name, "required", "") }
+func (e *Error) Invalid(name string) *Error  { return e.add(name, "invalid", "") }
+func (e *Error) TooLong(name string, max int) *Error {
+	return e.add(name, "too_long", strconv.Itoa(max))
+}
+func (e *Error) Format(name, format string) *Error { return e.add(name, "format", format) }
+func (e *Error) OneOf(name string, values ...string) *Error {
+	return e.add(name, "one_of", strings.Join(values, ", "))
+}
+
+func (e *Error) Count(name string, min, max int) *Error {
+	return e.add(name, "count", strconv.Itoa(min)+"-"+strconv.Itoa(max))
+}
+
+func (e *Error) add(name, code, param string) *Error {
+	e.fields = append(e.fields, field{name: name, code: code, param: param})
+	return e
+}
+
+// Empty reports whether a validation error has no fields.
+func (e *Error) Empty() bool {
+	return len(e.fields) == 0
+}
+
+func (e *Error) Status() int {
+	if s, ok := statuses[e.Code]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+func (e *Error) Error() string {
+	return string(e.Code)
+}
+
+// Response renders e in lang.
+func (e *Error) Response(lang string) models.ErrorResponse {
+	resp := models.ErrorResponse{Code: string(e.Code), Message: i18n.T(lang, "error."+string(e.Code))}
+	for _, f := range e.fields {
+		msg := i18n.T(lang, "field."+f.code, "field", f.name, "param", f.param)
+		resp.Details = append(resp.Details, models.FieldError{Field: f.name, Code: f.code, Message: msg})
+	}
+	// A single invalid field is more useful than the generic summary.
+	if len(resp.Details) == 1 {
+		resp.Message = resp.Details[0].Message
+	}
+	return resp
+}
+
+// Write sends e as JSON. lang is the language the client asked for in its
+// body; when empty or unsupported the Accept-Language header decides.
+func Write(w http.ResponseWriter, r *http.Request, lang string, e *Error) {
+	lang = i18n.FromRequest(r, lang)
+	resp := e.Response(lang)
+	resp.RequestID = chimw.GetReqID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Language", lang)
+	w.WriteHeader(e.Status())
+	json.NewEncoder(w).Encode(resp)
+}
+
+// NotFoundHandler and MethodNotAllowedHandler replace chi's plain-text
+// defaults so unknown routes also get the JSON envelope.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, "", New(NotFound))
+}
+
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, "", New(MethodNotAllowed))
+}
+
+// Decode reads a JSON body of at most max bytes into v. The returned error,
+// if any, is ready to Write.
+func Decode(w http.ResponseWriter, r *http.Request, max int64, v any) *Error {
+	r.Body = http.MaxBytesReader(w, r.Body, max)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return New(BodyTooLarge)
+		}
+		return New(InvalidBody)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/joledev/api-quoter/models"
+)
+
+func TestWriteEnvelope(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(chimw.RequestID)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, "", New(RateLimited))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var resp models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.Code != "RATE_LIMITED" || resp.RequestID == "" {
+		t.Errorf("unexpected envelope: %+v", resp)
+	}
+	if !strings.HasPrefix(resp.Message, "Too many requests") {
+		t.Errorf("message = %q, want English", resp.Message)
+	}
+}
+
+func TestWriteBodyLangWinsOverHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	Write(w, req, "es", New(RateLimited))
+
+	if got := w.Header().Get("Content-Language"); got != "es" {
+		t.Errorf("Content-Language = %q, want es", got)
+	}
+}
+
+func TestValidationDetails(t *testing.T) {
+	e := Validation().TooLong("notes", 2000)
+	if e.Empty() || e.Status() != http.StatusBadRequest {
+		t.Fatalf("Empty() = %v, Status() = %d", e.Empty(), e.Status())
+	}
+	resp := e.Response("es")
+	if len(resp.Details) != 1 || resp.Details[0].Code != "too_long" {
+		t.Fatalf("details = %+v", resp.Details)
+	}
+	// A lone field error replaces the generic summary.
+	if want := "notes admite como máximo 2000 caracteres"; resp.Message != want {
+		t.Errorf("message = %q, want %q", resp.Message, want)
+	}
+
+	resp = Validation().Required("a").Format("b", "HH:MM").Response("en")
+	if resp.Message != "Some fields are invalid." || resp.Details[1].Message != "b must use the format HH:MM" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var v struct{ Name string }
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":`))
+	if e := Decode(httptest.NewRecorder(), req, 1024, &v); e == nil || e.Code != InvalidBody {
+		t.Errorf("truncated body: got %v, want INVALID_BODY", e)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"`+strings.Repeat("x", 100)+`"}`))
+	if e := Decode(httptest.NewRecorder(), req, 16, &v); e == nil || e.Code != BodyTooLarge {
+		t.Errorf("oversized body: got %v, want BODY_TOO_LARGE", e)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"ok"}`))
+	if e := Decode(httptest.NewRecorder(), req, 1024, &v); e != nil || v.Name != "ok" {
+		t.Errorf("valid body: got %v, name %q", e, v.Name)
+	}
+}
+
+func TestRouterFallbacks(t *testing.T) {
+	r := chi.NewRouter()
+	r.NotFound(NotFoundHandler)
+	r.MethodNotAllowed(MethodNotAllowedHandler)
+	r.Get("/thing", func(http.ResponseWriter, *http.Request) {})
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/missing", http.StatusNotFound},
+		{http.MethodDelete, "/thing", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("%s %s: status %d, Content-Type %q", tt.method, tt.path, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+}
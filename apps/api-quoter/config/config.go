@@ -0,0 +1,265 @@
+// Package config loads the quoter's settings once at startup.
+//
+// Values come from, in increasing precedence: built-in defaults, the YAML
+// file named by CONFIG_FILE, and environment variables. Any variable can
+// instead be read from a file by setting NAME_FILE to its path, which is how
+// Kubernetes secret volumes are consumed (e.g. SMTP_PASS_FILE).
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Port            string        `yaml:"port"`
+	DBPath          string        `yaml:"db_path"`
+	LogLevel        string        `yaml:"log_level"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// CORSOrigins are the allowed browser origins; see middleware.CORSOptions
+	// for the wildcard syntax. CORS_ORIGIN takes a comma-separated list.
+	CORSOrigins []string `yaml:"cors_origins"`
+	// ContactEmail receives the new-quote notifications.
+	ContactEmail string `yaml:"contact_email"`
+	// TurnstileSecret enables CAPTCHA verification; empty skips it (dev).
+	TurnstileSecret string `yaml:"turnstile_secret_key"`
+	ReadyzCheckSMTP bool   `yaml:"readyz_check_smtp"`
+	// AdminAuthURL is the scheduler's /scheduler/admin/me, which checks the
+	// admin credentials (API keys included) sent to the quoter's admin
+	// routes. Empty leaves those routes off.
+	AdminAuthURL string `yaml:"admin_auth_url"`
+	// StatsTTL is how long the admin statistics are cached.
+	StatsTTL time.Duration `yaml:"stats_ttl"`
+	SMTP     SMTP          `yaml:"smtp"`
+}
+
+type SMTP struct {
+	Host string `yaml:"host"`
+	Port string `yaml:"port"`
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+	From string `yaml:"from"`
+	// Disabled drops outgoing email instead of requiring SMTP settings,
+	// for local development.
+	Disabled bool `yaml:"disabled"`
+}
+
+// Defaults returns the configuration used when nothing is set. It is not
+// valid on its own: SMTP must be configured or disabled.
+func Defaults() *Config {
+	return &Config{
+		Port:            "8081",
+		DBPath:          "./data/quotes.db",
+		LogLevel:        "info",
+		ShutdownTimeout: 25 * time.Second,
+		StatsTTL:        5 * time.Minute,
+		CORSOrigins:     []string{"https://joledev.com", "https://www.joledev.com"},
+		ContactEmail:    "contacto@joledev.com",
+		SMTP:            SMTP{Port: "465"},
+	}
+}
+
+// Load reads and validates the configuration. The error lists every
+// problem found, not just the first.
+func Load() (*Config, error) {
+	cfg := Defaults()
+
+	path, err := lookup("CONFIG_FILE")
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	strs := map[string]*string{
+		"PORT":                 &c.Port,
+		"DB_PATH":              &c.DBPath,
+		"LOG_LEVEL":            &c.LogLevel,
+		"CONTACT_EMAIL":        &c.ContactEmail,
+		"TURNSTILE_SECRET_KEY": &c.TurnstileSecret,
+		"ADMIN_AUTH_URL":       &c.AdminAuthURL,
+		"SMTP_HOST":            &c.SMTP.Host,
+		"SMTP_PORT":            &c.SMTP.Port,
+		"SMTP_USER":            &c.SMTP.User,
+		"SMTP_PASS":            &c.SMTP.Pass,
+		"SMTP_FROM":            &c.SMTP.From,
+	}
+	for name, dst := range strs {
+		v, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			*dst = v
+		}
+	}
+
+	bools := map[string]*bool{
+		"READYZ_CHECK_SMTP": &c.ReadyzCheckSMTP,
+		"SMTP_DISABLED":     &c.SMTP.Disabled,
+	}
+	for name, dst := range bools {
+		v, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", name, v)
+		}
+		*dst = b
+	}
+
+	v, err := lookup("CORS_ORIGIN")
+	if err != nil {
+		return err
+	}
+	if v != "" {
+		c.CORSOrigins = nil
+		for _, o := range strings.Split(v, ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				c.CORSOrigins = append(c.CORSOrigins, o)
+			}
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT": &c.ShutdownTimeout,
+		"STATS_TTL":        &c.StatsTTL,
+	}
+	for name, dst := range durations {
+		v, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration (e.g. 25s)", name, v)
+		}
+		*dst = d
+	}
+	return nil
+}
+
+// lookup returns the variable name, or the trimmed contents of the file
+// named by name_FILE when that is set.
+func lookup(name string) (string, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return os.Getenv(name), nil
+}
+
+// Validate checks every setting and reports all problems together.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if p, err := strconv.Atoi(c.Port); err != nil || p < 1 || p > 65535 {
+		add("PORT: %q is not a valid port", c.Port)
+	}
+	if c.DBPath == "" {
+		add("DB_PATH is required")
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		add("LOG_LEVEL: %q is not one of debug, info, warn, error", c.LogLevel)
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if len(c.CORSOrigins) == 0 {
+		add("CORS_ORIGIN needs at least one origin")
+	}
+	if c.AdminAuthURL != "" {
+		if u, err := url.Parse(c.AdminAuthURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("ADMIN_AUTH_URL: %q is not an http(s) URL", c.AdminAuthURL)
+		}
+	}
+	if _, err := mail.ParseAddress(c.ContactEmail); err != nil {
+		add("CONTACT_EMAIL: %q is not an email address", c.ContactEmail)
+	}
+	if c.StatsTTL < 0 {
+		add("STATS_TTL must not be negative")
+	}
+	errs = append(errs, c.SMTP.validate()...)
+
+	return errors.Join(errs...)
+}
+
+func (s SMTP) validate() []error {
+	if s.Disabled {
+		return nil
+	}
+	var errs []error
+	for _, req := range []struct{ name, value string }{
+		{"SMTP_HOST", s.Host}, {"SMTP_USER", s.User}, {"SMTP_PASS", s.Pass},
+	} {
+		if req.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required (or set SMTP_DISABLED=true)", req.name))
+		}
+	}
+	if p, err := strconv.Atoi(s.Port); err != nil || p < 1 || p > 65535 {
+		errs = append(errs, fmt.Errorf("SMTP_PORT: %q is not a valid port", s.Port))
+	}
+	if s.From != "" {
+		if _, err := mail.ParseAddress(s.From); err != nil {
+			errs = append(errs, fmt.Errorf("SMTP_FROM: %q is not an address like Name <user@host>", s.From))
+		}
+	}
+	return errs
+}
+
+// Sender returns the From header, defaulting to the login user.
+func (s SMTP) Sender() string {
+	if s.From != "" {
+		return s.From
+	}
+	return s.User
+}
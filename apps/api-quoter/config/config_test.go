@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setValidEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_USER", "bot@example.com")
+	t.Setenv("SMTP_PASS", "secret")
+}
+
+func TestLoadSecretFromFile(t *testing.T) {
+	setValidEnv(t)
+	path := filepath.Join(t.TempDir(), "smtp_pass")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SMTP_PASS_FILE", path)
+	t.Setenv("CORS_ORIGIN", "http://localhost:4321, https://*.joledev.com")
+	t.Setenv("STATS_TTL", "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.SMTP.Pass != "from-file" {
+		t.Errorf("Expected SMTP password from file, got %q", cfg.SMTP.Pass)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.CORSOrigins[1] != "https://*.joledev.com" || cfg.Port != "8081" || cfg.StatsTTL != 30*time.Second {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := Defaults()
+	cfg.CORSOrigins = nil
+	cfg.ContactEmail = "not-an-email"
+	cfg.AdminAuthURL = "api-scheduler:8082/scheduler/admin/me"
+	cfg.StatsTTL = -time.Second
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{"CORS_ORIGIN", "CONTACT_EMAIL", "ADMIN_AUTH_URL", "STATS_TTL", "SMTP_HOST", "SMTP_USER", "SMTP_PASS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write("Nombre", "Teléfono", "Monto")
+	w.Write("José, \"Pepe\"", "+52 664 000 0000", 1500)
+	w.Write("=HYPERLINK(\"http://evil\")", "-1", -20)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "\ufeff") {
+		t.Error("missing byte order mark")
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(out, "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Nombre", "Teléfono", "Monto"},
+		{`José, "Pepe"`, "'+52 664 000 0000", "1500"},
+		{`'=HYPERLINK("http://evil")`, "'-1", "-20"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSX(&buf, "Reservaciones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write("Cliente", "Monto")
+	w.Write("Ana <Ñ> & \x01", 1500)
+	cols := make([]any, 28)
+	for i := range cols {
+		cols[i] = "x"
+	}
+	w.Write(cols...)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+		// Every part must be well-formed XML.
+		d := xml.NewDecoder(bytes.NewReader(parts[f.Name]))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if parts[name] == nil {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R      string `xml:"r,attr"`
+				T      string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(sheet.Rows))
+	}
+	row := sheet.Rows[1]
+	if c := row.Cells[0]; c.R != "A2" || c.T != "inlineStr" || c.Inline != "Ana <Ñ> & \ufffd" {
+		t.Errorf("text cell = %+v", c)
+	}
+	if c := row.Cells[1]; c.R != "B2" || c.T != "" || c.Value != "1500" {
+		t.Errorf("number cell = %+v", c)
+	}
+	if c := sheet.Rows[2].Cells[27]; c.R != "AB3" {
+		t.Errorf("28th column is %s, want AB3", c.R)
+	}
+	if !bytes.Contains(parts["xl/workbook.xml"], []byte(`name="Reservaciones"`)) {
+		t.Error("sheet name not set")
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-quoter/apierror"
+	"github.com/joledev/api-quoter/export"
+	"github.com/joledev/api-quoter/i18n"
+	"github.com/joledev/api-quoter/metrics"
+	"github.com/joledev/api-quoter/middleware"
+	"github.com/joledev/api-quoter/models"
+	"github.com/joledev/api-quoter/services"
+)
+
+// exportTimeout replaces the server's write timeout for downloads, which
+// may take longer than an ordinary response.
+const exportTimeout = 5 * time.Minute
+
+// quoteExportColumns are the message IDs of the export's headers, in the
+// order quoteExportRow fills them.
+var quoteExportColumns = []string{
+	"export.quote_id", "export.created_at", "export.contact_name", "export.contact_email",
+	"export.contact_phone", "export.contact_company", "export.project_types", "export.features",
+	"export.business_size", "export.current_state", "export.timeline", "export.currency",
+	"export.estimated_min", "export.estimated_max", "export.payment_plan", "export.source_code",
+	"export.contact_notes", "export.lang",
+}
+
+func quoteExportRow(lang string, q *models.Quote) []any {
+	created := q.CreatedAt
+	if t, err := time.Parse(time.RFC3339, created); err == nil {
+		created = t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return []any{
+		q.QuoteID, created, q.ContactName, q.ContactEmail,
+		q.ContactPhone, q.ContactCo, strings.Join(q.ProjectTypes, ", "), strings.Join(q.Features, ", "),
+		q.BusinessSize, q.CurrentState, q.Timeline, q.Currency,
+		q.EstimatedMin, q.EstimatedMax, services.PlanLabel(lang, q.PaymentPlan),
+		i18n.T(lang, fmt.Sprintf("source_code.%t", q.IncludeSourceCode)),
+		q.ContactNotes, q.Lang,
+	}
+}
+
+// ExportQuotes downloads the quotes created between the from and to query
+// dates (UTC, inclusive), newest first, as CSV or XLSX with headers in the
+// requested language.
+func (h *QuoteHandler) ExportQuotes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	format := query.Get("format")
+	if format == "" {
+		format = export.Formats[0]
+	} else if format != "csv" && format != "xlsx" {
+		apierror.Write(w, r, "", apierror.Validation().OneOf("format", export.Formats...))
+		return
+	}
+	lang := i18n.FromRequest(r, query.Get("lang"))
+
+	defer metrics.TimeQuery("export_quotes")()
+	rows, err := h.db.QueryContext(r.Context(),
+		`SELECT `+quoteColumns+` FROM quotes WHERE date(created_at) BETWEEN ? AND ? ORDER BY created_at DESC, id DESC`, from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "exporting quotes", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	defer rows.Close()
+
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportTimeout))
+	out, err := export.New(w, format, fmt.Sprintf("quotes-%s_%s", from, to), i18n.T(lang, "export.quotes"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "starting quotes export", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	header := make([]any, len(quoteExportColumns))
+	for i, id := range quoteExportColumns {
+		header[i] = i18n.T(lang, id)
+	}
+	n := 0
+	err = out.Write(header...)
+	var q models.Quote
+	for err == nil && rows.Next() {
+		if err = scanQuote(rows, &q); err == nil {
+			n++
+			err = out.Write(quoteExportRow(lang, &q)...)
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		// The headers are gone; cut the download short so it cannot pass
+		// for a complete file.
+		slog.ErrorContext(r.Context(), "exporting quotes", "rows", n, "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	slog.InfoContext(r.Context(), "quotes exported", "admin", middleware.Admin(r.Context()), "format", format, "count", n)
+}
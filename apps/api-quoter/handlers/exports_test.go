@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportQuotes(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	for _, q := range []struct{ id, created, plan string }{
+		{"QT-2037-001", "2037-06-01 10:00:00", "msi3"},
+		{"QT-2037-002", "2037-06-30 23:59:59", ""},
+		{"QT-2037-003", "2037-07-01 00:00:00", ""},
+	} {
+		_, err := db.Exec(`INSERT INTO quotes (quote_id, project_types, features, business_size, current_state, timeline,
+			currency, estimated_min, estimated_max, payment_plan, include_source_code, contact_name, contact_email, created_at)
+			VALUES (?, '["websites","ecommerce"]', '["auth"]', 'small', 'fromScratch', '1-3months', 'MXN', 15000, 30000, ?, 1, 'Ana', 'ana@example.com', ?)`,
+			q.id, q.plan, q.created)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := newTestQuoteHandler(db)
+
+	w := httptest.NewRecorder()
+	h.ExportQuotes(w, httptest.NewRequest(http.MethodGet, "/quotes/admin/export?from=2037-06-01&to=2037-06-30&lang=en", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Disposition") != `attachment; filename="quotes-2037-06-01_2037-06-30.csv"` {
+		t.Fatalf("csv: status %d, Content-Disposition %q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(w.Body.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want header and 2 quotes: %q", len(records), records)
+	}
+	if records[0][0] != "Quote ID" || records[0][6] != "Project types" {
+		t.Errorf("header = %q", records[0])
+	}
+	want := "QT-2037-001|2037-06-01 10:00:00|Ana|ana@example.com|||websites, ecommerce|auth|small|fromScratch|1-3months|MXN|15000|30000|3 interest-free installments|Yes||es"
+	if got := strings.Join(records[2], "|"); got != want {
+		t.Errorf("row = %s\nwant  %s", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ExportQuotes(w, httptest.NewRequest(http.MethodGet, "/quotes/admin/export?from=2037-06-01&to=2037-07-31&format=xlsx", nil))
+	z, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if w.Code != http.StatusOK || err != nil {
+		t.Fatalf("xlsx: status %d, %v", w.Code, err)
+	}
+	var sheet []byte
+	for _, f := range z.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			sheet, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	// Spanish by default, amounts as numbers.
+	if !bytes.Contains(sheet, []byte(">Folio<")) || !bytes.Contains(sheet, []byte("<v>30000</v>")) ||
+		bytes.Count(sheet, []byte("<row ")) != 4 {
+		t.Errorf("unexpected sheet:\n%s", sheet)
+	}
+
+	w = httptest.NewRecorder()
+	h.ExportQuotes(w, httptest.NewRequest(http.MethodGet, "/quotes/admin/export?from=2037-06-01&to=2037-06-30&format=ods", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("format=ods: status %d", w.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joledev/api-quoter/models"
+	"github.com/joledev/api-quoter/services"
+)
+
+const (
+	healthCheckTimeout = 2 * time.Second
+	smtpCheckTTL       = time.Minute
+)
+
+// healthCheck is one readiness component. A failing optional component
+// degrades the report but keeps the service ready.
+type healthCheck struct {
+	name     string
+	optional bool
+	run      func(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	checks   []healthCheck
+	draining atomic.Bool
+}
+
+// NewHealthHandler builds the readiness checks for db. A non-nil checkSMTP
+// (normally Mailer.Check) logs in to the mail server, so its result is cached
+// for a minute to avoid hammering the server from probes.
+func NewHealthHandler(db *sql.DB, checkSMTP func(ctx context.Context) error) *HealthHandler {
+	h := &HealthHandler{checks: []healthCheck{
+		{name: "database", run: db.PingContext},
+		{name: "database_writable", run: func(ctx context.Context) error { return services.CheckDBWritable(ctx, db) }},
+		{name: "schema", run: func(ctx context.Context) error { return services.CheckSchema(ctx, db) }},
+	}}
+	if checkSMTP != nil {
+		h.checks = append(h.checks, healthCheck{name: "smtp", optional: true, run: cached(smtpCheckTTL, checkSMTP)})
+	}
+	return h
+}
+
+// Livez reports that the process is up and serving HTTP. It never touches
+// dependencies, so a slow database cannot get the pod restarted.
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Drain makes Readyz report the service as unready from now on, so it is
+// taken out of rotation while shutdown drains in-flight requests.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Readyz runs every check and returns per-component results. The response is
+// 503 when a required component fails or the server is shutting down.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if h.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(models.HealthResponse{Status: "draining", Checks: map[string]models.HealthCheck{}})
+		return
+	}
+
+	resp := models.HealthResponse{Status: "ok", Checks: make(map[string]models.HealthCheck, len(h.checks))}
+
+	for _, c := range h.checks {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		start := time.Now()
+		err := c.run(ctx)
+		cancel()
+
+		check := models.HealthCheck{Status: "ok", DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			check.Status = "fail"
+			check.Error = err.Error()
+			slog.WarnContext(r.Context(), "readiness check failed", "check", c.name, "err", err)
+			if c.optional {
+				if resp.Status == "ok" {
+					resp.Status = "degraded"
+				}
+			} else {
+				resp.Status = "fail"
+			}
+		}
+		resp.Checks[c.name] = check
+	}
+
+	if resp.Status == "fail" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// cached wraps check so it runs at most once per ttl, returning the last
+// result in between.
+func cached(ttl time.Duration, check func(ctx context.Context) error) func(ctx context.Context) error {
+	var (
+		mu      sync.Mutex
+		lastRun time.Time
+		lastErr error
+	)
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !lastRun.IsZero() && time.Since(lastRun) < ttl {
+			return lastErr
+		}
+		lastErr = check(ctx)
+		lastRun = time.Now()
+		return lastErr
+	}
+}
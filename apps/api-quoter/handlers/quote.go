@@ -1,16 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/joledev/api-quoter/apierror"
+	"github.com/joledev/api-quoter/config"
+	"github.com/joledev/api-quoter/i18n"
+	"github.com/joledev/api-quoter/metrics"
+	"github.com/joledev/api-quoter/middleware"
 	"github.com/joledev/api-quoter/models"
 	"github.com/joledev/api-quoter/services"
 )
@@ -50,11 +57,21 @@ func (rl *rateLimiter) allow(ip string) bool {
 }
 
 type QuoteHandler struct {
-	db *sql.DB
+	db           *sql.DB
+	outbox       *services.Outbox
+	turnstile    *services.Turnstile
+	stats        *services.Stats
+	contactEmail string
 }
 
-func NewQuoteHandler(db *sql.DB) *QuoteHandler {
-	return &QuoteHandler{db: db}
+func NewQuoteHandler(db *sql.DB, outbox *services.Outbox, cfg *config.Config) *QuoteHandler {
+	return &QuoteHandler{
+		db:           db,
+		outbox:       outbox,
+		turnstile:    services.NewTurnstile(cfg.TurnstileSecret),
+		stats:        services.NewStats(db, cfg.StatsTTL),
+		contactEmail: cfg.ContactEmail,
+	}
 }
 
 func (h *QuoteHandler) CreateQuote(w http.ResponseWriter, r *http.Request) {
@@ -64,44 +81,68 @@ func (h *QuoteHandler) CreateQuote(w http.ResponseWriter, r *http.Request) {
 		ip = strings.Split(fwd, ",")[0]
 	}
 	if !limiter.allow(strings.TrimSpace(ip)) {
-		http.Error(w, `{"success":false,"message":"Too many requests. Please try again later."}`, http.StatusTooManyRequests)
+		slog.WarnContext(r.Context(), "rate limit exceeded", "ip", strings.TrimSpace(ip))
+		metrics.RateLimited.WithLabelValues("create_quote").Inc()
+		apierror.Write(w, r, "", apierror.New(apierror.RateLimited))
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 64*1024) // 64KB max
-
 	var req models.QuoteRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"success":false,"message":"Invalid request body"}`, http.StatusBadRequest)
+	if e := apierror.Decode(w, r, 64*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
 		return
 	}
 
 	// Verify Turnstile CAPTCHA
-	if err := services.VerifyTurnstile(req.TurnstileToken, strings.TrimSpace(ip)); err != nil {
-		http.Error(w, `{"success":false,"message":"`+err.Error()+`"}`, http.StatusForbidden)
+	if err := h.turnstile.Verify(req.TurnstileToken, strings.TrimSpace(ip)); err != nil {
+		slog.WarnContext(r.Context(), "captcha verification failed", "ip", strings.TrimSpace(ip), "err", err)
+		metrics.TurnstileFailures.Inc()
+		code := apierror.CaptchaFailed
+		if errors.Is(err, services.ErrCaptchaRequired) {
+			code = apierror.CaptchaRequired
+		}
+		apierror.Write(w, r, req.Lang, apierror.New(code))
 		return
 	}
 
-	// Validate required fields
+	// Validate fields, reporting every problem at once
+	v := apierror.Validation()
 	name := strings.TrimSpace(req.Contact.Name)
 	email := strings.TrimSpace(req.Contact.Email)
-	if name == "" || len(name) > 200 {
-		http.Error(w, `{"success":false,"message":"Name is required (max 200 chars)"}`, http.StatusBadRequest)
-		return
+	if name == "" {
+		v.Required("contact.name")
+	} else if len(name) > 200 {
+		v.TooLong("contact.name", 200)
 	}
-	if !emailRegex.MatchString(email) || len(email) > 254 {
-		http.Error(w, `{"success":false,"message":"Valid email is required"}`, http.StatusBadRequest)
-		return
+	if email == "" {
+		v.Required("contact.email")
+	} else if !emailRegex.MatchString(email) || len(email) > 254 {
+		v.Invalid("contact.email")
 	}
 	if len(req.ProjectTypes) == 0 || len(req.ProjectTypes) > 20 {
-		http.Error(w, `{"success":false,"message":"At least one project type is required"}`, http.StatusBadRequest)
-		return
+		v.Count("projectTypes", 1, 20)
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"contact.phone", req.Contact.Phone, 30},
+		{"contact.company", req.Contact.Company, 200},
+		{"contact.notes", req.Contact.Notes, 2000},
+	} {
+		if len(f.value) > f.max {
+			v.TooLong(f.name, f.max)
+		}
 	}
-	if len(req.Contact.Phone) > 30 || len(req.Contact.Company) > 200 || len(req.Contact.Notes) > 2000 {
-		http.Error(w, `{"success":false,"message":"Field too long"}`, http.StatusBadRequest)
+	if !v.Empty() {
+		apierror.Write(w, r, req.Lang, v)
 		return
 	}
 
+	// Stored with the quote so the confirmation email uses the same language.
+	req.Lang = i18n.FromRequest(r, req.Lang)
+
 	// Generate quote ID
 	quoteID := h.generateQuoteID()
 
@@ -114,6 +155,7 @@ func (h *QuoteHandler) CreateQuote(w http.ResponseWriter, r *http.Request) {
 		includeSourceCodeInt = 1
 	}
 
+	done := metrics.TimeQuery("insert_quote")
 	_, err := h.db.Exec(`INSERT INTO quotes (quote_id, project_types, features, business_size, current_state, timeline, currency, estimated_min, estimated_max, payment_plan, include_source_code, contact_name, contact_email, contact_phone, contact_company, contact_notes, lang) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		quoteID, string(projectTypesJSON), string(featuresJSON),
 		req.BusinessSize, req.CurrentState, req.Timeline, req.Currency,
@@ -121,38 +163,113 @@ func (h *QuoteHandler) CreateQuote(w http.ResponseWriter, r *http.Request) {
 		req.PaymentPlan, includeSourceCodeInt,
 		strings.TrimSpace(req.Contact.Name), strings.TrimSpace(req.Contact.Email),
 		req.Contact.Phone, req.Contact.Company, req.Contact.Notes, req.Lang)
+	done()
 	if err != nil {
-		log.Printf("Error saving quote: %v", err)
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "saving quote", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
 		return
 	}
 
-	// Send emails (non-blocking, log errors)
-	go func() {
-		if err := services.SendQuoteNotification(&req, quoteID); err != nil {
-			log.Printf("Error sending notification email: %v", err)
-		}
-		if err := services.SendQuoteConfirmation(&req, quoteID); err != nil {
-			log.Printf("Error sending confirmation email: %v", err)
-		}
-	}()
+	slog.InfoContext(r.Context(), "quote created", "quote_id", quoteID, "currency", req.Currency)
+	recordQuoteCreated(&req)
 
-	msg := "Cotización enviada correctamente"
-	if req.Lang == "en" {
-		msg = "Quote sent successfully"
-	}
+	// Send emails in the background. The request context is detached from
+	// cancellation so delivery keeps the request ID for its logs.
+	h.outbox.Enqueue(context.WithoutCancel(r.Context()),
+		services.QuoteNotificationEmail(&req, quoteID, h.contactEmail),
+		services.QuoteConfirmationEmail(&req, quoteID))
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", req.Lang)
 	json.NewEncoder(w).Encode(models.QuoteResponse{
 		Success: true,
-		Message: msg,
+		Message: i18n.T(req.Lang, "quote.created"),
 		QuoteID: quoteID,
 	})
 }
 
+// ListQuotes returns the quotes created between the from and to query dates
+// (UTC, inclusive), newest first, for admins and API keys with quotes:read.
+func (h *QuoteHandler) ListQuotes(w http.ResponseWriter, r *http.Request) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+
+	done := metrics.TimeQuery("list_quotes")
+	rows, err := h.db.QueryContext(r.Context(),
+		`SELECT `+quoteColumns+` FROM quotes WHERE date(created_at) BETWEEN ? AND ? ORDER BY created_at DESC, id DESC`, from, to)
+	done()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing quotes", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	defer rows.Close()
+
+	quotes := []models.Quote{}
+	for rows.Next() {
+		var q models.Quote
+		if err := scanQuote(rows, &q); err != nil {
+			slog.ErrorContext(r.Context(), "reading quote", "err", err)
+			apierror.Write(w, r, "", apierror.New(apierror.Internal))
+			return
+		}
+		quotes = append(quotes, q)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "listing quotes", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	slog.InfoContext(r.Context(), "quotes listed", "admin", middleware.Admin(r.Context()), "count", len(quotes))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.QuotesResponse{Success: true, Quotes: quotes})
+}
+
+// quoteColumns are the columns scanQuote reads.
+const quoteColumns = `id, quote_id, project_types, features, business_size, current_state, timeline, currency,
+	estimated_min, estimated_max, COALESCE(payment_plan, ''), COALESCE(include_source_code, 0),
+	contact_name, contact_email, COALESCE(contact_phone, ''), COALESCE(contact_company, ''),
+	COALESCE(contact_notes, ''), COALESCE(lang, ''), created_at`
+
+// scanQuote reads a row of quoteColumns into q, decoding the JSON arrays.
+func scanQuote(rows *sql.Rows, q *models.Quote) error {
+	var (
+		projectTypes, features string
+		createdAt              time.Time
+	)
+	if err := rows.Scan(&q.ID, &q.QuoteID, &projectTypes, &features, &q.BusinessSize, &q.CurrentState,
+		&q.Timeline, &q.Currency, &q.EstimatedMin, &q.EstimatedMax, &q.PaymentPlan, &q.IncludeSourceCode,
+		&q.ContactName, &q.ContactEmail, &q.ContactPhone, &q.ContactCo, &q.ContactNotes, &q.Lang,
+		&createdAt); err != nil {
+		return err
+	}
+	q.ProjectTypes, q.Features = nil, nil
+	json.Unmarshal([]byte(projectTypes), &q.ProjectTypes)
+	json.Unmarshal([]byte(features), &q.Features)
+	q.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	return nil
+}
+
+// recordQuoteCreated counts the quote once per project type. Values outside the
+// known sets are reported as "other" to keep metric cardinality bounded.
+func recordQuoteCreated(req *models.QuoteRequest) {
+	currency := req.Currency
+	if currency != "MXN" && currency != "USD" {
+		currency = "other"
+	}
+	for _, pt := range req.ProjectTypes {
+		if !models.IsKnownProjectType(pt) {
+			pt = "other"
+		}
+		metrics.QuotesCreated.WithLabelValues(currency, pt).Inc()
+	}
+}
+
 func (h *QuoteHandler) generateQuoteID() string {
 	year := time.Now().Year()
 	var count int
+	defer metrics.TimeQuery("count_quotes_by_year")()
 	h.db.QueryRow("SELECT COUNT(*) FROM quotes WHERE quote_id LIKE ?", fmt.Sprintf("QT-%d-%%", year)).Scan(&count)
 	return fmt.Sprintf("QT-%d-%03d", year, count+1)
 }
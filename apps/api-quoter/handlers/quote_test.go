@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
@@ -9,7 +10,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/joledev/api-quoter/config"
+	"github.com/joledev/api-quoter/metrics"
+	"github.com/joledev/api-quoter/migrations"
 	"github.com/joledev/api-quoter/models"
+	"github.com/joledev/api-quoter/services"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -19,40 +24,25 @@ func setupTestDB(t *testing.T) *sql.DB {
 	if err != nil {
 		t.Fatalf("Failed to open test db: %v", err)
 	}
+	// Every connection to :memory: is a separate database, so keep one.
+	db.SetMaxOpenConns(1)
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS quotes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		quote_id TEXT UNIQUE NOT NULL,
-		project_types TEXT NOT NULL,
-		features TEXT NOT NULL,
-		business_size TEXT NOT NULL,
-		current_state TEXT NOT NULL,
-		timeline TEXT NOT NULL,
-		currency TEXT NOT NULL,
-		estimated_min INTEGER NOT NULL,
-		estimated_max INTEGER NOT NULL,
-		payment_plan TEXT DEFAULT '',
-		include_source_code INTEGER DEFAULT 0,
-		contact_name TEXT NOT NULL,
-		contact_email TEXT NOT NULL,
-		contact_phone TEXT,
-		contact_company TEXT,
-		contact_notes TEXT,
-		lang TEXT DEFAULT 'es',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`)
-	if err != nil {
-		t.Fatalf("Failed to create table: %v", err)
+	if _, err := migrations.Up(context.Background(), db, migrations.Options{}); err != nil {
+		t.Fatalf("Failed to migrate test db: %v", err)
 	}
-
 	return db
 }
 
+func newTestQuoteHandler(db *sql.DB) *QuoteHandler {
+	cfg := config.Defaults()
+	return NewQuoteHandler(db, services.NewOutbox(db, services.NewMailer(cfg.SMTP)), cfg)
+}
+
 func TestCreateQuote_ValidRequest(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewQuoteHandler(db)
+	handler := newTestQuoteHandler(db)
 
 	req := models.QuoteRequest{
 		ProjectTypes: []string{"web"},
@@ -93,11 +83,23 @@ func TestCreateQuote_ValidRequest(t *testing.T) {
 	}
 }
 
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) models.ErrorResponse {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var resp models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	return resp
+}
+
 func TestCreateQuote_MissingEmail(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewQuoteHandler(db)
+	handler := newTestQuoteHandler(db)
 
 	req := models.QuoteRequest{
 		ProjectTypes: []string{"web"},
@@ -125,13 +127,17 @@ func TestCreateQuote_MissingEmail(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d: %s", w.Code, w.Body.String())
 	}
+	resp := decodeError(t, w)
+	if resp.Code != "VALIDATION_FAILED" || len(resp.Details) != 1 || resp.Details[0].Field != "contact.email" {
+		t.Errorf("unexpected error response: %+v", resp)
+	}
 }
 
 func TestCreateQuote_MissingName(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewQuoteHandler(db)
+	handler := newTestQuoteHandler(db)
 	req := models.QuoteRequest{
 		ProjectTypes: []string{"web"},
 		Features:     []string{"auth"},
@@ -163,7 +169,7 @@ func TestCreateQuote_EmptyProjectTypes(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewQuoteHandler(db)
+	handler := newTestQuoteHandler(db)
 	req := models.QuoteRequest{
 		ProjectTypes: []string{},
 		Features:     []string{"auth"},
@@ -189,13 +195,16 @@ func TestCreateQuote_EmptyProjectTypes(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected 400 for empty project types, got %d", w.Code)
 	}
+	if resp := decodeError(t, w); len(resp.Details) != 1 || resp.Details[0].Code != "count" {
+		t.Errorf("unexpected error response: %+v", resp)
+	}
 }
 
 func TestCreateQuote_NotesTooLong(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewQuoteHandler(db)
+	handler := newTestQuoteHandler(db)
 	req := models.QuoteRequest{
 		ProjectTypes: []string{"web"},
 		Features:     []string{"auth"},
@@ -228,7 +237,7 @@ func TestCreateQuote_NameTooLong(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewQuoteHandler(db)
+	handler := newTestQuoteHandler(db)
 	req := models.QuoteRequest{
 		ProjectTypes: []string{"web"},
 		Features:     []string{"auth"},
@@ -256,3 +265,74 @@ func TestCreateQuote_NameTooLong(t *testing.T) {
 		t.Errorf("Expected 400 for name too long, got %d", w.Code)
 	}
 }
+
+func TestCreateQuote_RecordsMetrics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := newTestQuoteHandler(db)
+	req := models.QuoteRequest{
+		ProjectTypes: []string{"ecommerce", "not-a-real-type"},
+		Features:     []string{"auth"},
+		BusinessSize: "small",
+		CurrentState: "fromScratch",
+		Timeline:     "1-3months",
+		Currency:     "USD",
+		EstimatedMin: 2000,
+		EstimatedMax: 4000,
+		Contact: models.QuoteContact{
+			Name:  "Test User",
+			Email: "test@example.com",
+		},
+	}
+
+	body, _ := json.Marshal(req)
+	httpReq := httptest.NewRequest(http.MethodPost, "/quotes", bytes.NewBuffer(body))
+	httpReq.Header.Set("X-Forwarded-For", "10.0.0.50")
+	handler.CreateQuote(httptest.NewRecorder(), httpReq)
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	scraped := w.Body.String()
+
+	for _, want := range []string{
+		`quoter_quotes_created_total{currency="USD",project_type="ecommerce"} 1`,
+		`quoter_quotes_created_total{currency="USD",project_type="other"} 1`,
+		`quoter_db_query_duration_seconds_count{query="insert_quote"}`,
+	} {
+		if !strings.Contains(scraped, want) {
+			t.Errorf("Expected scrape to contain %s", want)
+		}
+	}
+}
+
+func TestListQuotes(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	for _, q := range []struct{ id, created string }{
+		{"QT-2037-001", "2037-06-01 10:00:00"},
+		{"QT-2037-002", "2037-06-30 23:59:59"},
+		{"QT-2037-003", "2037-07-01 00:00:00"},
+	} {
+		_, err := db.Exec(`INSERT INTO quotes (quote_id, project_types, features, business_size, current_state, timeline,
+			currency, estimated_min, estimated_max, contact_name, contact_email, created_at)
+			VALUES (?, '["websites"]', '["auth"]', 'small', 'fromScratch', '1-3months', 'MXN', 1, 2, 'Ana', 'ana@example.com', ?)`,
+			q.id, q.created)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	newTestQuoteHandler(db).ListQuotes(w, httptest.NewRequest(http.MethodGet, "/quotes/admin?from=2037-06-01&to=2037-06-30", nil))
+	var resp models.QuotesResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Quotes) != 2 {
+		t.Fatalf("status %d, %+v", w.Code, resp)
+	}
+	q := resp.Quotes[0]
+	if q.QuoteID != "QT-2037-002" || q.CreatedAt != "2037-06-30T23:59:59Z" ||
+		len(q.ProjectTypes) != 1 || q.ProjectTypes[0] != "websites" {
+		t.Errorf("first quote = %+v", q)
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/joledev/api-quoter/apierror"
+)
+
+// GetQuoteStats returns the quote statistics for the from and to query
+// dates (UTC, inclusive), which the spec requires. Results are cached for
+// the configured TTL; generatedAt says when they were computed.
+func (h *QuoteHandler) GetQuoteStats(w http.ResponseWriter, r *http.Request) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+
+	stats, err := h.stats.Quotes(r.Context(), from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "computing quote stats", "from", from, "to", to, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joledev/api-quoter/models"
+)
+
+func TestGetQuoteStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	for _, q := range []struct {
+		types, features, currency string
+		min, max                  int
+		created                   string
+	}{
+		{`["websites","ecommerce"]`, `["auth","payments"]`, "MXN", 15000, 30000, "2037-06-01 10:00:00"},
+		{`["websites"]`, `["auth"]`, "MXN", 10000, 20001, "2037-06-15 10:00:00"},
+		{`["mobile"]`, `[]`, "USD", 2000, 5000, "2037-06-30 23:59:59"},
+		{`["websites"]`, `["auth"]`, "USD", 9000, 9000, "2037-07-01 00:00:00"},
+	} {
+		_, err := db.Exec(`INSERT INTO quotes (quote_id, project_types, features, business_size, current_state, timeline,
+			currency, estimated_min, estimated_max, contact_name, contact_email, created_at)
+			VALUES (?, ?, ?, 'small', 'fromScratch', '1-3months', ?, ?, ?, 'Ana', 'ana@example.com', ?)`,
+			"QT-"+q.created, q.types, q.features, q.currency, q.min, q.max, q.created)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := newTestQuoteHandler(db)
+
+	w := httptest.NewRecorder()
+	h.GetQuoteStats(w, httptest.NewRequest(http.MethodGet, "/quotes/admin/stats?from=2037-06-01&to=2037-06-30", nil))
+	var stats models.QuoteStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, %v", w.Code, err)
+	}
+	if stats.Total != 3 {
+		t.Errorf("total %d, want 3", stats.Total)
+	}
+	for want, got := range map[string]string{
+		"[{websites 2} {ecommerce 1} {mobile 1}]": fmt.Sprint(stats.ProjectTypes),
+		"[{auth 2} {payments 1}]":                 fmt.Sprint(stats.Features),
+		"[{MXN 2 12500 25001} {USD 1 2000 5000}]": fmt.Sprint(stats.Currencies),
+	} {
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+
+	// The result is cached, so changes only show up after STATS_TTL.
+	db.Exec(`DELETE FROM quotes`)
+	w = httptest.NewRecorder()
+	h.GetQuoteStats(w, httptest.NewRequest(http.MethodGet, "/quotes/admin/stats?from=2037-06-01&to=2037-06-30", nil))
+	json.NewDecoder(w.Body).Decode(&stats)
+	if stats.Total != 3 {
+		t.Errorf("second request: total %d, want the cached 3", stats.Total)
+	}
+}
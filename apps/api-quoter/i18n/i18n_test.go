@@ -0,0 +1,133 @@
+package i18n
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var placeholder = regexp.MustCompile(`\{[a-z_]+\}`)
+
+func placeholders(m message) string {
+	text := m.text
+	if m.plural != nil {
+		text = m.plural["other"]
+	}
+	found := placeholder.FindAllString(text, -1)
+	sort.Strings(found)
+	return strings.Join(found, " ")
+}
+
+// TestCatalogsComplete keeps every language in step with the default: same
+// message IDs and the same placeholders in each message.
+func TestCatalogsComplete(t *testing.T) {
+	base := catalogs[Default]
+	for lang, cat := range catalogs {
+		for id, m := range base {
+			tm, ok := cat[id]
+			if !ok {
+				t.Errorf("%s: missing %s", lang, id)
+				continue
+			}
+			if got, want := placeholders(tm), placeholders(m); got != want {
+				t.Errorf("%s: %s uses placeholders %q, %s uses %q", lang, id, got, Default, want)
+			}
+		}
+		for id := range cat {
+			if _, ok := base[id]; !ok {
+				t.Errorf("%s: %s is not in the %s catalog", lang, id, Default)
+			}
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	if got := strings.Join(Supported(), ","); got != "es,en,pt-BR" {
+		t.Errorf("Supported() = %s", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		lang, header, want string
+	}{
+		{"", "", "es"},
+		{"en", "es", "en"},
+		{"pt-br", "", "pt-BR"},
+		{"pt_BR", "", "pt-BR"},
+		{"fr", "", "es"},
+		{"", "en-US,en;q=0.9", "en"},
+		{"", "es-MX,es;q=0.9,en;q=0.8", "es"},
+		{"", "en;q=0.4,es;q=0.6", "es"},
+		{"", "fr-FR,fr;q=0.9,en;q=0.5", "en"},
+		{"", "pt-PT,pt;q=0.9", "pt-BR"},
+		{"", "de", "es"},
+		{"", "EN-gb", "en"},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.lang, tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q, %q) = %q, want %q", tt.lang, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("en", "email.greeting", "name", "Ana"); got != "Hi Ana," {
+		t.Errorf("got %q", got)
+	}
+	// Values are not expanded again.
+	if got := T("es", "email.greeting", "name", "{name}"); got != "Hola {name}," {
+		t.Errorf("got %q", got)
+	}
+	if got := T("xx", "email.greeting", "name", "Ana"); got != "Hola Ana," {
+		t.Errorf("unknown language should fall back to %s, got %q", Default, got)
+	}
+	if got := T("en", "no.such.message"); got != "no.such.message" {
+		t.Errorf("missing message should return its ID, got %q", got)
+	}
+}
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{"es", 1, "one"},
+		{"es", 0, "other"},
+		{"en", 2, "other"},
+		{"pt-BR", 0, "one"},
+		{"pt-BR", 1, "one"},
+		{"pt-BR", 2, "other"},
+	}
+	for _, tt := range tests {
+		if got := pluralCategory(tt.lang, tt.n); got != tt.want {
+			t.Errorf("pluralCategory(%s, %d) = %s, want %s", tt.lang, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestDateAndTime(t *testing.T) {
+	tests := []struct {
+		lang, date, clock string
+	}{
+		{"es", "15 de junio, 2037", "2:05 PM"},
+		{"en", "June 15, 2037", "2:05 PM"},
+		{"pt-BR", "15 de junho de 2037", "14:05"},
+	}
+	for _, tt := range tests {
+		if got := Date(tt.lang, "2037-06-15"); got != tt.date {
+			t.Errorf("Date(%s) = %q, want %q", tt.lang, got, tt.date)
+		}
+		if got := Time(tt.lang, "14:05"); got != tt.clock {
+			t.Errorf("Time(%s) = %q, want %q", tt.lang, got, tt.clock)
+		}
+	}
+	if got := Date("en", "soon"); got != "soon" {
+		t.Errorf("unparseable date changed: %q", got)
+	}
+	if got := Date("en", "2037-03-01"); got != "March 1, 2037" {
+		t.Errorf("got %q", got)
+	}
+}
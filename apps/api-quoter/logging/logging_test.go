@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+func TestRedactEmail(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"maria@example.com", "m***@example.com"},
+		{"a@b.co", "a***@b.co"},
+		{"", ""},
+		{"not-an-email", "***"},
+	}
+
+	for _, tt := range tests {
+		if got := RedactEmail(tt.input); got != tt.expected {
+			t.Errorf("RedactEmail(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestRedactPhone(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"+52 664 123 4567", "***67"},
+		{"12", "***"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := RedactPhone(tt.input); got != tt.expected {
+			t.Errorf("RedactPhone(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestLoggerAddsRequestIDAndRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "info")
+
+	ctx := context.WithValue(context.Background(), chimw.RequestIDKey, "req-123")
+	logger.ErrorContext(ctx, "sending email",
+		"contact_email", "maria@example.com",
+		"contact_phone", "6641234567",
+		"err", errors.New("550 mailbox <maria@example.com> unavailable"))
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected JSON log line, got %q: %v", buf.String(), err)
+	}
+	if entry["request_id"] != "req-123" {
+		t.Errorf("Expected request_id req-123, got %v", entry["request_id"])
+	}
+	if strings.Contains(buf.String(), "maria@example.com") {
+		t.Errorf("Expected email to be redacted, got %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "6641234567") {
+		t.Errorf("Expected phone to be redacted, got %s", buf.String())
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "warn")
+
+	logger.Info("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("Expected info to be filtered at warn level, got %s", buf.String())
+	}
+	logger.Warn("kept")
+	if buf.Len() == 0 {
+		t.Error("Expected warn to be logged at warn level")
+	}
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/joledev/api-quoter/apierror"
+	"github.com/joledev/api-quoter/config"
 	"github.com/joledev/api-quoter/handlers"
+	"github.com/joledev/api-quoter/logging"
+	"github.com/joledev/api-quoter/metrics"
+	"github.com/joledev/api-quoter/middleware"
+	"github.com/joledev/api-quoter/migrations"
+	"github.com/joledev/api-quoter/openapi"
+	"github.com/joledev/api-quoter/services"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -22,90 +34,143 @@ func securityHeaders(next http.Handler) http.Handler {
 	})
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := os.Getenv("CORS_ORIGIN")
-		if origin == "" {
-			origin = "https://joledev.com"
-		}
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+	if cfg.TurnstileSecret == "" {
+		slog.Warn("TURNSTILE_SECRET_KEY not set, CAPTCHA verification disabled")
+	}
 
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	// Database setup
+	os.MkdirAll(filepath.Dir(cfg.DBPath), 0755)
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		slog.Error("failed to open database", "err", err)
+		os.Exit(1)
+	}
+	defer db.Close()
 
-		next.ServeHTTP(w, r)
-	})
-}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(db, os.Args[2:], os.Stdout))
+	}
 
-func main() {
-	// Database setup
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/quotes.db"
+	// Apply pending schema migrations. Destructive ones stop startup until
+	// they are applied explicitly with `migrate -allow-destructive`.
+	if _, err := migrations.Up(context.Background(), db, migrations.Options{}); err != nil {
+		slog.Error("migrating database", "err", err)
+		os.Exit(1)
 	}
 
-	// Ensure data directory exists
-	os.MkdirAll("./data", 0755)
+	mailer := services.NewMailer(cfg.SMTP)
+	outbox := services.NewOutbox(db, mailer)
+	if err := outbox.Resume(context.Background()); err != nil {
+		slog.Error("resuming email outbox", "err", err)
+	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	spec, err := openapi.Load()
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		slog.Error("loading OpenAPI document", "err", err)
+		os.Exit(1)
 	}
-	defer db.Close()
 
-	// Create table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS quotes (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		quote_id TEXT UNIQUE NOT NULL,
-		project_types TEXT NOT NULL,
-		features TEXT NOT NULL,
-		business_size TEXT NOT NULL,
-		current_state TEXT NOT NULL,
-		timeline TEXT NOT NULL,
-		currency TEXT NOT NULL,
-		estimated_min INTEGER NOT NULL,
-		estimated_max INTEGER NOT NULL,
-		contact_name TEXT NOT NULL,
-		contact_email TEXT NOT NULL,
-		contact_phone TEXT,
-		contact_company TEXT,
-		contact_notes TEXT,
-		lang TEXT DEFAULT 'es',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`)
+	cors, err := middleware.NewCORS(middleware.CORSOptions{
+		Origins:         cfg.CORSOrigins,
+		Headers:         []string{"Content-Type", "Authorization"},
+		CredentialPaths: []string{"/quotes/admin"},
+	})
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
 	}
 
-	// Migrations: add new columns (ignore errors if columns already exist)
-	db.Exec(`ALTER TABLE quotes ADD COLUMN payment_plan TEXT DEFAULT ''`)
-	db.Exec(`ALTER TABLE quotes ADD COLUMN include_source_code INTEGER DEFAULT 0`)
-
 	// Router
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RequestLogger)
+	r.Use(metrics.Middleware)
+	r.Use(chimw.Recoverer)
 	r.Use(securityHeaders)
-	r.Use(corsMiddleware)
-
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-	})
+	r.Use(cors.Handler(r))
+	r.NotFound(apierror.NotFoundHandler)
+	r.MethodNotAllowed(apierror.MethodNotAllowedHandler)
+
+	// Probes: /livez only proves the process serves HTTP, /readyz checks the
+	// database and (with READYZ_CHECK_SMTP=true) the mail server.
+	var smtpCheck func(context.Context) error
+	if cfg.ReadyzCheckSMTP {
+		smtpCheck = mailer.Check
+	}
+	healthHandler := handlers.NewHealthHandler(db, smtpCheck)
+	r.Get("/livez", healthHandler.Livez)
+	r.Get("/readyz", healthHandler.Readyz)
+	r.Get("/health", healthHandler.Livez)
+
+	r.Handle("/metrics", metrics.Handler())
+
+	// API contract; the /quotes alias is what the ingress exposes.
+	r.Get("/openapi.json", openapi.ServeDocument)
+	r.Get("/quotes/openapi.json", openapi.ServeDocument)
+
+	quoteHandler := handlers.NewQuoteHandler(db, outbox, cfg)
+	r.With(spec.Validate("createQuote")).Post("/quotes", quoteHandler.CreateQuote)
+
+	// Admin accounts and API keys belong to the scheduler, which checks
+	// the credentials sent here.
+	if cfg.AdminAuthURL != "" {
+		r.With(middleware.ForwardAuth(cfg.AdminAuthURL, "quotes:read"), spec.Validate("listQuotes")).
+			Get("/quotes/admin", quoteHandler.ListQuotes)
+		r.With(middleware.ForwardAuth(cfg.AdminAuthURL, "quotes:read"), spec.Validate("exportQuotes")).
+			Get("/quotes/admin/export", quoteHandler.ExportQuotes)
+		r.With(middleware.ForwardAuth(cfg.AdminAuthURL, "quotes:read"), spec.Validate("getQuoteStats")).
+			Get("/quotes/admin/stats", quoteHandler.GetQuoteStats)
+	} else {
+		slog.Info("ADMIN_AUTH_URL not set, admin quote routes disabled")
+	}
 
-	quoteHandler := handlers.NewQuoteHandler(db)
-	r.Post("/quotes", quoteHandler.CreateQuote)
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("api-quoter listening", "port", cfg.Port)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("server stopped", "err", err)
+		os.Exit(1)
+	case <-ctx.Done():
+		stop()
 	}
 
-	log.Printf("api-quoter listening on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	// Stop accepting requests, let in-flight ones finish (they may still
+	// enqueue emails), then wait for the outbox. Whatever misses the deadline
+	// stays in email_outbox and is resent on the next start.
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout.String())
+	healthHandler.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("draining HTTP requests", "err", err)
+	}
+	if err := outbox.Wait(shutdownCtx); err != nil {
+		slog.Warn("emails still sending at shutdown, left in outbox", "err", err)
+	}
+	slog.Info("shutdown complete")
 }
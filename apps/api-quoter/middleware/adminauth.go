@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/joledev/api-quoter/apierror"
+)
+
+type adminKey struct{}
+
+// Admin returns the scheduler admin that authenticated the request, or ""
+// outside ForwardAuth.
+func Admin(ctx context.Context) string {
+	u, _ := ctx.Value(adminKey{}).(string)
+	return u
+}
+
+// adminIdentity is the part of the scheduler's /scheduler/admin/me response
+// ForwardAuth needs. Scopes is only set for API keys; accounts have every
+// scope.
+type adminIdentity struct {
+	Username string   `json:"username"`
+	Scopes   []string `json:"scopes"`
+}
+
+var forwardAuthClient = &http.Client{Timeout: 5 * time.Second}
+
+// ForwardAuth checks the request's Authorization header (admin Basic
+// credentials or an API key) against the scheduler, which owns the admin
+// accounts, and requires scope of API keys. Accounts and keys live in the
+// scheduler's database; the quoter keeps no copy.
+func ForwardAuth(authURL, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			auth := r.Header.Get("Authorization")
+			if auth == "" {
+				apierror.Write(w, r, "", apierror.New(apierror.Unauthorized))
+				return
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, authURL, nil)
+			if err != nil {
+				slog.ErrorContext(ctx, "building admin auth request", "err", err)
+				apierror.Write(w, r, "", apierror.New(apierror.Internal))
+				return
+			}
+			req.Header.Set("Authorization", auth)
+			req.Header.Set("X-Request-Id", chimw.GetReqID(ctx))
+			// The scheduler rate-limits and logs by client address.
+			if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+				req.Header.Set("X-Forwarded-For", fwd)
+			}
+
+			resp, err := forwardAuthClient.Do(req)
+			if err != nil {
+				slog.ErrorContext(ctx, "checking admin credentials", "err", err)
+				apierror.Write(w, r, "", apierror.New(apierror.Internal))
+				return
+			}
+			defer resp.Body.Close()
+
+			switch resp.StatusCode {
+			case http.StatusOK:
+			case http.StatusUnauthorized, http.StatusForbidden:
+				apierror.Write(w, r, "", apierror.New(apierror.Unauthorized))
+				return
+			case http.StatusTooManyRequests:
+				if ra := resp.Header.Get("Retry-After"); ra != "" {
+					w.Header().Set("Retry-After", ra)
+				}
+				apierror.Write(w, r, "", apierror.New(apierror.RateLimited))
+				return
+			default:
+				slog.ErrorContext(ctx, "checking admin credentials", "status", resp.StatusCode)
+				apierror.Write(w, r, "", apierror.New(apierror.Internal))
+				return
+			}
+
+			var id adminIdentity
+			if err := json.NewDecoder(resp.Body).Decode(&id); err != nil || id.Username == "" {
+				slog.ErrorContext(ctx, "decoding admin identity", "err", err)
+				apierror.Write(w, r, "", apierror.New(apierror.Internal))
+				return
+			}
+			if id.Scopes != nil && !hasScope(id.Scopes, scope) {
+				slog.WarnContext(ctx, "API key lacks scope", "admin", id.Username, "scope", scope)
+				apierror.Write(w, r, "", apierror.New(apierror.InsufficientScope))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, adminKey{}, id.Username)))
+		})
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
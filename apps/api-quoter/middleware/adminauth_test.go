@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joledev/api-quoter/models"
+)
+
+func TestForwardAuth(t *testing.T) {
+	// A stand-in for the scheduler's /scheduler/admin/me.
+	scheduler := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer jdk_quotes":
+			w.Write([]byte(`{"success":true,"username":"ana","scopes":["quotes:read"]}`))
+		case "Bearer jdk_bookings":
+			w.Write([]byte(`{"success":true,"username":"ana","scopes":["bookings:read"]}`))
+		case "Basic YW5hOnBhc3N3b3Jk":
+			w.Write([]byte(`{"success":true,"username":"ana"}`))
+		case "Basic bG9ja2VkOnBhc3N3b3Jk":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer scheduler.Close()
+
+	var seen string
+	h := ForwardAuth(scheduler.URL, "quotes:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = Admin(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+		code   string
+	}{
+		{"no credentials", "", 401, "UNAUTHORIZED"},
+		{"key with scope", "Bearer jdk_quotes", 200, ""},
+		{"key without scope", "Bearer jdk_bookings", 403, "INSUFFICIENT_SCOPE"},
+		{"account", "Basic YW5hOnBhc3N3b3Jk", 200, ""},
+		{"locked account", "Basic bG9ja2VkOnBhc3N3b3Jk", 429, "RATE_LIMITED"},
+		{"unknown key", "Bearer jdk_nope", 401, "UNAUTHORIZED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = ""
+			req := httptest.NewRequest(http.MethodGet, "/quotes/admin", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				if seen != "ana" {
+					t.Errorf("handler saw admin %q, want ana", seen)
+				}
+				return
+			}
+			var resp models.ErrorResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Code != tt.code {
+				t.Errorf("code = %s, want %s", resp.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestForwardAuthSchedulerDown(t *testing.T) {
+	scheduler := httptest.NewServer(http.NotFoundHandler())
+	scheduler.Close()
+
+	h := ForwardAuth(scheduler.URL, "quotes:read")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("request let through without a check")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/quotes/admin", nil)
+	req.Header.Set("Authorization", "Bearer jdk_quotes")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
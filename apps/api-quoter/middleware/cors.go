@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response (Chrome
+// caps it at two hours).
+const corsMaxAge = 2 * time.Hour
+
+// corsMethods are the methods a preflight may ask about; the response lists
+// the ones actually routed for the requested path.
+var corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type CORSOptions struct {
+	// Origins lists allowed origins. A host may start with "*." to allow any
+	// subdomain (https://*.joledev.com) and the port may be "*"
+	// (http://localhost:*).
+	Origins []string
+	// Headers lists the request headers browsers may send.
+	Headers []string
+	// CredentialPaths are path prefixes (admin routes) where cookies and
+	// Authorization may be sent cross-origin.
+	CredentialPaths []string
+}
+
+type CORS struct {
+	origins         []originPattern
+	headers         string
+	credentialPaths []string
+}
+
+type originPattern struct {
+	scheme string
+	host   string // without the "*." for wildcard patterns
+	port   string // "" for the scheme default, "*" for any
+	wild   bool
+}
+
+// NewCORS validates the origin patterns in opts.
+func NewCORS(opts CORSOptions) (*CORS, error) {
+	c := &CORS{headers: strings.Join(opts.Headers, ", "), credentialPaths: opts.CredentialPaths}
+	for _, o := range opts.Origins {
+		p, err := parseOriginPattern(o)
+		if err != nil {
+			return nil, err
+		}
+		c.origins = append(c.origins, p)
+	}
+	return c, nil
+}
+
+func parseOriginPattern(s string) (originPattern, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || (scheme != "http" && scheme != "https") || rest == "" || strings.ContainsAny(rest, "/?#") {
+		return originPattern{}, fmt.Errorf("CORS origin %q must look like https://host[:port]", s)
+	}
+	p := originPattern{scheme: scheme}
+
+	host, port, hasPort := strings.Cut(rest, ":")
+	if hasPort {
+		if _, err := strconv.Atoi(port); err != nil && port != "*" {
+			return originPattern{}, fmt.Errorf("CORS origin %q has an invalid port", s)
+		}
+		p.port = port
+	}
+	if after, ok := strings.CutPrefix(host, "*."); ok {
+		p.wild = true
+		host = after
+	}
+	if host == "" || strings.Contains(host, "*") {
+		return originPattern{}, fmt.Errorf("CORS origin %q: only a leading *. wildcard is supported", s)
+	}
+	p.host = strings.ToLower(host)
+	return p, nil
+}
+
+func (p originPattern) matches(u *url.URL) bool {
+	if u.Scheme != p.scheme {
+		return false
+	}
+	if p.port != "*" && u.Port() != p.port {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if p.wild {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// allowed reports whether origin matches one of the patterns.
+func (c *CORS) allowed(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || u.Path != "" {
+		return false
+	}
+	for _, p := range c.origins {
+		if p.matches(u) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORS) credentialed(path string) bool {
+	for _, prefix := range c.credentialPaths {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns the middleware. routes is the router it is mounted on; a
+// preflight is only answered for paths routes would serve, so unknown paths
+// still get chi's 404/405.
+func (c *CORS) Handler(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				if c.allowed(origin) {
+					c.setOrigin(w, r, origin)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			methods := routedMethods(routes, r.URL.Path)
+			if len(methods) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !c.allowed(origin) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			c.setOrigin(w, r, origin)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if c.headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", c.headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func (c *CORS) setOrigin(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.credentialed(r.URL.Path) {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func routedMethods(routes chi.Routes, path string) []string {
+	var methods []string
+	for _, m := range corsMethods {
+		if routes.Match(chi.NewRouteContext(), m, path) {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
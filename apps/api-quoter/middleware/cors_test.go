@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func newCORSRouter(t *testing.T) http.Handler {
+	t.Helper()
+	cors, err := NewCORS(CORSOptions{
+		Origins: []string{"https://joledev.com", "https://*.joledev.com", "http://localhost:*"},
+		Headers: []string{"Content-Type"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.Use(cors.Handler(r))
+	r.Post("/quotes", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) })
+	return r
+}
+
+func preflight(path, origin string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	return req
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSRouter(t)
+	for _, origin := range []string{"https://joledev.com", "https://www.joledev.com", "http://localhost:4321"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, preflight("/quotes", origin))
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected 204, got %d", origin, w.Code)
+		}
+		h := w.Header()
+		if h.Get("Access-Control-Allow-Origin") != origin || h.Get("Access-Control-Allow-Methods") != "POST" {
+			t.Errorf("%s: unexpected headers %v", origin, h)
+		}
+		if h.Get("Access-Control-Max-Age") == "" || h.Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("%s: unexpected headers %v", origin, h)
+		}
+	}
+}
+
+func TestCORSRejectsOtherOrigins(t *testing.T) {
+	router := newCORSRouter(t)
+	for _, origin := range []string{"https://evil.com", "https://joledev.com.evil.com", "http://joledev.com"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, preflight("/quotes", origin))
+		if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected 403 without CORS headers, got %d %v", origin, w.Code, w.Header())
+		}
+	}
+}
+
+func TestCORSPreflightUnknownRoute(t *testing.T) {
+	router := newCORSRouter(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight("/nope", "https://joledev.com"))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown route, got %d", w.Code)
+	}
+}
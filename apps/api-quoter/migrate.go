@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/joledev/api-quoter/migrations"
+)
+
+// runMigrate implements the migrate subcommand:
+//
+//	server migrate [-dry-run] [-allow-destructive] [-backup-dir DIR]
+//	server migrate status
+//
+// It returns the process exit code.
+func runMigrate(db *sql.DB, args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dryRun := fs.Bool("dry-run", false, "run pending migrations in a transaction that is rolled back")
+	allowDestructive := fs.Bool("allow-destructive", false, "apply migrations that drop data, after backing up the database")
+	backupDir := fs.String("backup-dir", "", "where to write backups (default: next to the database)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	if fs.Arg(0) == "status" {
+		return migrateStatus(ctx, db, out)
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(out, "unknown migrate command %q\n", fs.Arg(0))
+		return 2
+	}
+
+	results, err := migrations.Up(ctx, db, migrations.Options{
+		DryRun:           *dryRun,
+		AllowDestructive: *allowDestructive,
+		BackupDir:        *backupDir,
+	})
+	for _, res := range results {
+		line := fmt.Sprintf("%04d_%s: %s", res.Version, res.Name, res.Action)
+		if res.Destructive {
+			line += " (destructive)"
+		}
+		if res.Backup != "" {
+			line += ", backup at " + res.Backup
+		}
+		fmt.Fprintln(out, line)
+	}
+	if err != nil {
+		fmt.Fprintln(out, "error:", err)
+		return 1
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(out, "database is up to date")
+	}
+	return 0
+}
+
+func migrateStatus(ctx context.Context, db *sql.DB, out io.Writer) int {
+	current, err := migrations.CurrentVersion(ctx, db)
+	if err != nil {
+		fmt.Fprintln(out, "error:", err)
+		return 1
+	}
+	pending, err := migrations.Pending(ctx, db)
+	if err != nil {
+		fmt.Fprintln(out, "error:", err)
+		return 1
+	}
+
+	fmt.Fprintf(out, "current version: %d, latest: %d\n", current, migrations.Latest())
+	for _, m := range pending {
+		line := fmt.Sprintf("pending %04d_%s", m.Version, m.Name)
+		if m.Destructive {
+			line += " (destructive)"
+		}
+		fmt.Fprintln(out, line)
+	}
+	return 0
+}
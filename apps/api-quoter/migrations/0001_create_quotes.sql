@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS quotes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	quote_id TEXT UNIQUE NOT NULL,
+	project_types TEXT NOT NULL,
+	features TEXT NOT NULL,
+	business_size TEXT NOT NULL,
+	current_state TEXT NOT NULL,
+	timeline TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	estimated_min INTEGER NOT NULL,
+	estimated_max INTEGER NOT NULL,
+	contact_name TEXT NOT NULL,
+	contact_email TEXT NOT NULL,
+	contact_phone TEXT,
+	contact_company TEXT,
+	contact_notes TEXT,
+	lang TEXT DEFAULT 'es',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- Databases created before migrations already got this column from an
+-- ad-hoc ALTER at startup.
+-- +migrate only-if: SELECT COUNT(*) = 0 FROM pragma_table_info('quotes') WHERE name = 'payment_plan'
+ALTER TABLE quotes ADD COLUMN payment_plan TEXT DEFAULT '';
@@ -0,0 +1,12 @@
+-- Emails waiting for delivery, kept across restarts.
+CREATE TABLE IF NOT EXISTS email_outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	template TEXT NOT NULL,
+	ref TEXT,
+	recipient TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	html TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
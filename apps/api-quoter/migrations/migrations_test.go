@@ -0,0 +1,98 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openFileDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "quotes.db"))
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpFreshDatabase(t *testing.T) {
+	db := openFileDB(t)
+	ctx := context.Background()
+
+	results, err := Up(ctx, db, Options{})
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	for _, res := range results {
+		if res.Action != "applied" {
+			t.Errorf("Expected every migration applied on a fresh db, got %+v", res)
+		}
+	}
+	if v, _ := CurrentVersion(ctx, db); v != Latest() {
+		t.Errorf("Expected version %d, got %d", Latest(), v)
+	}
+
+	again, err := Up(ctx, db, Options{})
+	if err != nil || len(again) != 0 {
+		t.Errorf("Expected second Up to be a no-op, got %+v, %v", again, err)
+	}
+}
+
+// Databases from before migrations got their columns from ad-hoc ALTERs;
+// the guarded migrations must adopt them instead of failing.
+func TestUpAdoptsLegacyColumns(t *testing.T) {
+	db := openFileDB(t)
+	ctx := context.Background()
+	if _, err := db.Exec(`CREATE TABLE quotes (id INTEGER PRIMARY KEY, quote_id TEXT, payment_plan TEXT DEFAULT '')`); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Up(ctx, db, Options{})
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	actions := make(map[string]string)
+	for _, res := range results {
+		actions[res.Name] = res.Action
+	}
+	if actions["quotes_payment_plan"] != "skipped" {
+		t.Errorf("Expected existing payment_plan to be skipped, got %q", actions["quotes_payment_plan"])
+	}
+	if actions["quotes_include_source_code"] != "applied" {
+		t.Errorf("Expected include_source_code to be added, got %q", actions["quotes_include_source_code"])
+	}
+}
+
+func TestUpDryRunChangesNothing(t *testing.T) {
+	db := openFileDB(t)
+	ctx := context.Background()
+
+	results, err := Up(ctx, db, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if len(results) != Latest() || results[0].Action != "would apply" {
+		t.Errorf("Unexpected dry run results: %+v", results)
+	}
+	if v, _ := CurrentVersion(ctx, db); v != 0 {
+		t.Errorf("Expected version 0 after dry run, got %d", v)
+	}
+}
+
+func TestPendingDetectsModifiedMigration(t *testing.T) {
+	db := openFileDB(t)
+	ctx := context.Background()
+	if _, err := Up(ctx, db, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE schema_migrations SET checksum = 'x' WHERE version = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Pending(ctx, db); err == nil {
+		t.Error("Expected an error for a migration changed after it was applied")
+	}
+}
@@ -1,6 +1,22 @@
 package models
 
-import "time"
+// ProjectTypes lists the project type keys offered by the web quoter
+// (apps/web/src/lib/quoter-config.ts).
+var ProjectTypes = []string{
+	"websites", "ecommerce", "mobileApp", "systems", "saas", "inventory",
+	"pos", "billing", "booking", "apiIntegration", "cloudDevOps", "techUpdate",
+	"ai", "consulting", "teamTraining", "migration",
+}
+
+// IsKnownProjectType reports whether key is one of ProjectTypes.
+func IsKnownProjectType(key string) bool {
+	for _, pt := range ProjectTypes {
+		if pt == key {
+			return true
+		}
+	}
+	return false
+}
 
 type QuoteContact struct {
 	Name    string `json:"name"`
@@ -32,24 +48,30 @@ type QuoteResponse struct {
 	QuoteID string `json:"quoteId"`
 }
 
+// Quote is a stored quote request as the admin API returns it.
 type Quote struct {
-	ID                int       `json:"id"`
-	QuoteID           string    `json:"quoteId"`
-	ProjectTypes      string    `json:"projectTypes"`
-	Features          string    `json:"features"`
-	BusinessSize      string    `json:"businessSize"`
-	CurrentState      string    `json:"currentState"`
-	Timeline          string    `json:"timeline"`
-	Currency          string    `json:"currency"`
-	EstimatedMin      int       `json:"estimatedMin"`
-	EstimatedMax      int       `json:"estimatedMax"`
-	PaymentPlan       string    `json:"paymentPlan"`
-	IncludeSourceCode bool      `json:"includeSourceCode"`
-	ContactName       string    `json:"contactName"`
-	ContactEmail      string    `json:"contactEmail"`
-	ContactPhone      string    `json:"contactPhone"`
-	ContactCo         string    `json:"contactCompany"`
-	ContactNotes      string    `json:"contactNotes"`
-	Lang              string    `json:"lang"`
-	CreatedAt         time.Time `json:"createdAt"`
+	ID                int      `json:"id"`
+	QuoteID           string   `json:"quoteId"`
+	ProjectTypes      []string `json:"projectTypes"`
+	Features          []string `json:"features"`
+	BusinessSize      string   `json:"businessSize"`
+	CurrentState      string   `json:"currentState"`
+	Timeline          string   `json:"timeline"`
+	Currency          string   `json:"currency"`
+	EstimatedMin      int      `json:"estimatedMin"`
+	EstimatedMax      int      `json:"estimatedMax"`
+	PaymentPlan       string   `json:"paymentPlan"`
+	IncludeSourceCode bool     `json:"includeSourceCode"`
+	ContactName       string   `json:"contactName"`
+	ContactEmail      string   `json:"contactEmail"`
+	ContactPhone      string   `json:"contactPhone"`
+	ContactCo         string   `json:"contactCompany"`
+	ContactNotes      string   `json:"contactNotes"`
+	Lang              string   `json:"lang"`
+	CreatedAt         string   `json:"createdAt"`
+}
+
+type QuotesResponse struct {
+	Success bool    `json:"success"`
+	Quotes  []Quote `json:"quotes"`
 }
@@ -0,0 +1,28 @@
+package models
+
+// QuoteStats summarises the quotes created between From and To (UTC dates).
+// Lists are ordered by count, largest first.
+type QuoteStats struct {
+	From         string          `json:"from"`
+	To           string          `json:"to"`
+	Total        int             `json:"total"`
+	ProjectTypes []KeyCount      `json:"projectTypes"`
+	Features     []KeyCount      `json:"features"`
+	Currencies   []CurrencyStats `json:"currencies"`
+	GeneratedAt  string          `json:"generatedAt"`
+}
+
+// KeyCount is how many quotes asked for a project type or feature.
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// CurrencyStats averages the estimates of the quotes in one currency;
+// amounts in different currencies are never mixed.
+type CurrencyStats struct {
+	Currency        string `json:"currency"`
+	Count           int    `json:"count"`
+	AvgEstimatedMin int    `json:"avgEstimatedMin"`
+	AvgEstimatedMax int    `json:"avgEstimatedMax"`
+}
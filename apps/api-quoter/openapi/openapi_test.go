@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joledev/api-quoter/models"
+)
+
+func loadSpec(t *testing.T) *Spec {
+	t.Helper()
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestModelsMatchSpec fails when a model gains, loses or retypes a JSON field
+// without the document being updated, or the other way round.
+func TestModelsMatchSpec(t *testing.T) {
+	s := loadSpec(t)
+	for name, model := range map[string]any{
+		"QuoteRequest":   models.QuoteRequest{},
+		"QuoteContact":   models.QuoteContact{},
+		"QuoteResponse":  models.QuoteResponse{},
+		"Quote":          models.Quote{},
+		"QuotesResponse": models.QuotesResponse{},
+		"QuoteStats":     models.QuoteStats{},
+		"HealthResponse": models.HealthResponse{},
+		"HealthCheck":    models.HealthCheck{},
+		"ErrorResponse":  models.ErrorResponse{},
+		"FieldError":     models.FieldError{},
+	} {
+		sc := s.Schema(name)
+		if sc == nil {
+			t.Errorf("schema %s missing from openapi.json", name)
+			continue
+		}
+		compareStruct(t, s, name, reflect.TypeOf(model), sc)
+	}
+}
+
+func compareStruct(t *testing.T, s *Spec, path string, typ reflect.Type, sc *Schema) {
+	t.Helper()
+	fields := map[string]reflect.Type{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	for name, ft := range fields {
+		prop, ok := sc.Properties[name]
+		if !ok {
+			t.Errorf("%s.%s is in the model but not in the spec", path, name)
+			continue
+		}
+		compareType(t, s, path+"."+name, ft, prop)
+	}
+	for name := range sc.Properties {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("%s.%s is in the spec but not in the model", path, name)
+		}
+	}
+	for _, req := range sc.Required {
+		if _, ok := fields[req]; !ok {
+			t.Errorf("%s requires %s, which the model lacks", path, req)
+		}
+	}
+}
+
+func compareType(t *testing.T, s *Spec, path string, typ reflect.Type, sc *Schema) {
+	t.Helper()
+	sc = s.resolve(sc)
+	want := map[reflect.Kind]string{
+		reflect.String: "string", reflect.Bool: "boolean",
+		reflect.Int: "integer", reflect.Int64: "integer",
+		reflect.Float64: "number",
+		reflect.Slice:   "array", reflect.Struct: "object", reflect.Map: "object",
+	}[typ.Kind()]
+	if sc.Type != want {
+		t.Errorf("%s: spec type %q, model %s (want %q)", path, sc.Type, typ, want)
+		return
+	}
+	switch typ.Kind() {
+	case reflect.Slice:
+		compareType(t, s, path+"[]", typ.Elem(), sc.Items)
+	case reflect.Struct:
+		compareStruct(t, s, path, typ, sc)
+	case reflect.Map:
+		if sc.AdditionalProperties != nil {
+			compareType(t, s, path+"{}", typ.Elem(), sc.AdditionalProperties)
+		}
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	s := loadSpec(t)
+	var reached string
+	h := s.Validate("createQuote")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.QuoteRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		reached = req.Contact.Name
+	}))
+
+	tests := []struct {
+		name, body string
+		status     int
+		details    string
+	}{
+		{
+			name:   "valid",
+			body:   `{"projectTypes":["websites"],"estimatedMin":25000,"contact":{"name":"Ana","email":"ana@example.com"},"lang":"es"}`,
+			status: http.StatusOK,
+		},
+		{
+			name:    "nested fields",
+			body:    `{"projectTypes":[],"estimatedMin":1.5,"contact":{"email":"ana@example.com","notes":"` + strings.Repeat("x", 2001) + `"}}`,
+			status:  http.StatusBadRequest,
+			details: "contact.name:required contact.notes:too_long estimatedMin:invalid projectTypes:count",
+		},
+		{
+			name:    "wrong item type",
+			body:    `{"projectTypes":["websites",3],"contact":{"name":"Ana","email":"ana@example.com"}}`,
+			status:  http.StatusBadRequest,
+			details: "projectTypes[1]:invalid",
+		},
+		{
+			name:   "not JSON",
+			body:   `{"projectTypes":`,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = ""
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/quotes", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				if reached != "Ana" {
+					t.Error("handler did not receive the body")
+				}
+				return
+			}
+			var resp models.ErrorResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			var got []string
+			for _, d := range resp.Details {
+				got = append(got, d.Field+":"+d.Code)
+			}
+			if strings.Join(got, " ") != tt.details {
+				t.Errorf("details = %v, want %s", got, tt.details)
+			}
+		})
+	}
+}
+
+func TestServeDocument(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServeDocument(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil || doc["openapi"] != "3.0.3" {
+		t.Errorf("document not served: %v", err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
@@ -1,30 +1,56 @@
 package services
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/smtp"
-	"os"
 	"strings"
+	"time"
 
+	"github.com/joledev/api-quoter/config"
+	"github.com/joledev/api-quoter/i18n"
+	"github.com/joledev/api-quoter/metrics"
 	"github.com/joledev/api-quoter/models"
 )
 
-func sendEmail(to, subject, html string) error {
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-	user := os.Getenv("SMTP_USER")
-	pass := os.Getenv("SMTP_PASS")
-	from := os.Getenv("SMTP_FROM")
+// smtpTimeout bounds a whole SMTP delivery so a stalled server cannot hold
+// up shutdown.
+const smtpTimeout = 30 * time.Second
 
-	if host == "" || user == "" || pass == "" {
-		return fmt.Errorf("SMTP not configured (SMTP_HOST, SMTP_USER, SMTP_PASS required)")
+// Mailer delivers email over implicit-TLS SMTP (port 465).
+type Mailer struct {
+	cfg config.SMTP
+}
+
+func NewMailer(cfg config.SMTP) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Send delivers e and records the outcome under its template name in the
+// emails metric. With SMTP disabled the email is logged and dropped.
+func (m *Mailer) Send(ctx context.Context, e Email) error {
+	if m.cfg.Disabled {
+		slog.WarnContext(ctx, "SMTP disabled, dropping email", "template", e.Template, "ref", e.Ref, "to", e.To)
+		return nil
 	}
-	if port == "" {
-		port = "465"
+	err := m.deliver(e.To, e.Subject, e.HTML)
+	metrics.EmailsSent.WithLabelValues(e.Template, metrics.EmailResult(err)).Inc()
+	if err != nil {
+		return err
 	}
-	if from == "" {
-		from = user
+	slog.InfoContext(ctx, "email sent", "template", e.Template, "ref", e.Ref, "to", e.To)
+	return nil
+}
+
+func (m *Mailer) deliver(to, subject, html string) error {
+	host, port, user, pass := m.cfg.Host, m.cfg.Port, m.cfg.User, m.cfg.Pass
+	from := m.cfg.Sender()
+
+	if host == "" || user == "" || pass == "" {
+		return fmt.Errorf("SMTP not configured (SMTP_HOST, SMTP_USER, SMTP_PASS required)")
 	}
 
 	// Build MIME message
@@ -36,10 +62,11 @@ func sendEmail(to, subject, html string) error {
 		"\r\n" + html
 
 	// Port 465 uses implicit TLS (SMTPS)
-	conn, err := tls.Dial("tcp", host+":"+port, &tls.Config{ServerName: host})
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", host+":"+port, &tls.Config{ServerName: host})
 	if err != nil {
 		return fmt.Errorf("SMTP TLS connection failed: %w", err)
 	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
 
 	client, err := smtp.NewClient(conn, host)
 	if err != nil {
@@ -70,37 +97,15 @@ func sendEmail(to, subject, html string) error {
 	return client.Quit()
 }
 
-var planLabels = map[string]map[string]string{
-	"fullPayment":  {"es": "Pago completo (-10%)", "en": "Full payment (-10%)"},
-	"splitPayment": {"es": "50% inicio / 50% entrega", "en": "50% upfront / 50% delivery"},
-	"msi3":         {"es": "3 meses sin intereses", "en": "3 interest-free installments"},
-	"msi6":         {"es": "6 meses sin intereses", "en": "6 interest-free installments"},
-	"saasMonthly":  {"es": "SaaS mensual", "en": "Monthly SaaS"},
-	"timeRetainer": {"es": "Retainer por horas", "en": "Hourly retainer"},
-}
-
-func getPlanLabel(key, lang string) string {
-	if labels, ok := planLabels[key]; ok {
-		if label, ok := labels[lang]; ok {
-			return label
-		}
+// PlanLabel returns the payment plan's name in lang, or the key itself for
+// plans the catalog does not know.
+func PlanLabel(lang, key string) string {
+	if label := i18n.T(lang, "plan."+key); label != "plan."+key {
+		return label
 	}
 	return key
 }
 
-func formatSourceCode(include bool, lang string) string {
-	if include {
-		if lang == "en" {
-			return "Yes"
-		}
-		return "Sí"
-	}
-	if lang == "en" {
-		return "No"
-	}
-	return "No"
-}
-
 func formatCurrency(amount int, currency string) string {
 	if currency == "USD" {
 		return fmt.Sprintf("$%d USD", amount)
@@ -108,12 +113,9 @@ func formatCurrency(amount int, currency string) string {
 	return fmt.Sprintf("$%d MXN", amount)
 }
 
-func SendQuoteNotification(q *models.QuoteRequest, quoteID string) error {
-	contactEmail := os.Getenv("CONTACT_EMAIL")
-	if contactEmail == "" {
-		contactEmail = "contacto@joledev.com"
-	}
-
+// QuoteNotificationEmail renders the new-quote notice sent to the business
+// inbox at contactEmail.
+func QuoteNotificationEmail(q *models.QuoteRequest, quoteID, contactEmail string) Email {
 	projectTypes := strings.Join(q.ProjectTypes, ", ")
 	features := strings.Join(q.Features, ", ")
 	estimate := fmt.Sprintf("%s — %s", formatCurrency(q.EstimatedMin, q.Currency), formatCurrency(q.EstimatedMax, q.Currency))
@@ -141,44 +143,31 @@ func SendQuoteNotification(q *models.QuoteRequest, quoteID string) error {
 		quoteID, q.Contact.Name, q.Contact.Email, q.Contact.Phone,
 		q.Contact.Company, projectTypes, features,
 		q.BusinessSize, q.CurrentState, q.Timeline, q.Currency,
-		estimate, getPlanLabel(q.PaymentPlan, "es"), formatSourceCode(q.IncludeSourceCode, "es"),
+		estimate, PlanLabel("es", q.PaymentPlan), i18n.T("es", fmt.Sprintf("source_code.%t", q.IncludeSourceCode)),
 		q.Contact.Notes)
 
-	return sendEmail(contactEmail, subject, html)
+	return Email{Template: "quote_notification", Ref: quoteID, To: contactEmail, Subject: subject, HTML: html}
 }
 
-func SendQuoteConfirmation(q *models.QuoteRequest, quoteID string) error {
+// QuoteConfirmationEmail renders the acknowledgement sent to the client in
+// the quote's language.
+func QuoteConfirmationEmail(q *models.QuoteRequest, quoteID string) Email {
+	lang := q.Lang
 	estimate := fmt.Sprintf("%s — %s", formatCurrency(q.EstimatedMin, q.Currency), formatCurrency(q.EstimatedMax, q.Currency))
-
-	var subject, html string
-
-	if q.Lang == "en" {
-		subject = fmt.Sprintf("Your JoleDev quote - %s", quoteID)
-		html = fmt.Sprintf(`<p>Hi %s,</p>
-<p>Thank you for your interest in my services. I've received your quote request and will review it in detail.</p>
-<p>I'll contact you within the next 24 hours to discuss your project and prepare a personalized proposal.</p>
-<p><strong>Summary:</strong><br>
-Projects: %s<br>
-Estimated budget: %s<br>
-Payment plan: %s</p>
-<p>If you have any questions, feel free to reach out at contacto@joledev.com.</p>
-<p>Best regards,<br>Joel López Verdugo<br>JoleDev — Technology tailored to your business</p>`,
-			q.Contact.Name, strings.Join(q.ProjectTypes, ", "), estimate,
-			getPlanLabel(q.PaymentPlan, "en"))
-	} else {
-		subject = fmt.Sprintf("Tu cotización JoleDev - %s", quoteID)
-		html = fmt.Sprintf(`<p>Hola %s,</p>
-<p>Gracias por tu interés en mis servicios. He recibido tu solicitud de cotización y la revisaré en detalle.</p>
-<p>Me pondré en contacto contigo en las próximas 24 horas para discutir tu proyecto y preparar una propuesta personalizada.</p>
-<p><strong>Resumen:</strong><br>
-Proyectos: %s<br>
-Presupuesto estimado: %s<br>
-Plan seleccionado: %s</p>
-<p>Si tienes alguna pregunta, escríbeme a contacto@joledev.com.</p>
-<p>Saludos,<br>Joel López Verdugo<br>JoleDev — Desarrollo a la medida de tu negocio</p>`,
-			q.Contact.Name, strings.Join(q.ProjectTypes, ", "), estimate,
-			getPlanLabel(q.PaymentPlan, "es"))
-	}
-
-	return sendEmail(q.Contact.Email, subject, html)
+	projects := i18n.N(lang, "email.quote_confirmation.projects", len(q.ProjectTypes), "list", strings.Join(q.ProjectTypes, ", "))
+
+	var sb strings.Builder
+	for _, p := range []string{
+		i18n.T(lang, "email.greeting", "name", q.Contact.Name),
+		i18n.T(lang, "email.quote_confirmation.thanks"),
+		i18n.T(lang, "email.quote_confirmation.followup"),
+		i18n.T(lang, "email.quote_confirmation.summary", "projects", projects, "estimate", estimate, "plan", PlanLabel(lang, q.PaymentPlan)),
+		i18n.T(lang, "email.quote_confirmation.questions"),
+		i18n.T(lang, "email.signoff"),
+	} {
+		sb.WriteString("<p>" + p + "</p>\n")
+	}
+
+	subject := i18n.T(lang, "email.quote_confirmation.subject", "id", quoteID)
+	return Email{Template: "quote_confirmation", Ref: quoteID, To: q.Contact.Email, Subject: subject, HTML: strings.TrimSuffix(sb.String(), "\n")}
 }
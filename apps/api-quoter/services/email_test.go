@@ -0,0 +1,52 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joledev/api-quoter/models"
+)
+
+func TestQuoteConfirmationEmailLanguages(t *testing.T) {
+	q := &models.QuoteRequest{
+		ProjectTypes: []string{"websites"},
+		Currency:     "MXN",
+		EstimatedMin: 25000,
+		EstimatedMax: 40000,
+		PaymentPlan:  "msi3",
+		Contact:      models.QuoteContact{Name: "Ana", Email: "ana@example.com"},
+	}
+	tests := []struct {
+		lang     string
+		projects []string
+		subject  string
+		want     []string
+	}{
+		{"es", []string{"websites"}, "Tu cotización JoleDev - QT-2037-001",
+			[]string{"Hola Ana,", "Proyecto: websites", "3 meses sin intereses"}},
+		{"es", []string{"websites", "pos"}, "Tu cotización JoleDev - QT-2037-001",
+			[]string{"Proyectos: websites, pos"}},
+		{"en", []string{"websites", "pos"}, "Your JoleDev quote - QT-2037-001",
+			[]string{"Hi Ana,", "Projects: websites, pos", "3 interest-free installments"}},
+		{"pt-BR", []string{"websites"}, "Seu orçamento JoleDev - QT-2037-001",
+			[]string{"Olá Ana,", "Projeto: websites", "3 parcelas sem juros"}},
+	}
+	for _, tt := range tests {
+		q.Lang, q.ProjectTypes = tt.lang, tt.projects
+		e := QuoteConfirmationEmail(q, "QT-2037-001")
+		if e.Subject != tt.subject {
+			t.Errorf("%s: subject = %q, want %q", tt.lang, e.Subject, tt.subject)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(e.HTML, s) {
+				t.Errorf("%s: body lacks %q:\n%s", tt.lang, s, e.HTML)
+			}
+		}
+	}
+}
+
+func TestPlanLabelUnknownKey(t *testing.T) {
+	if got := PlanLabel("en", "barter"); got != "barter" {
+		t.Errorf("PlanLabel = %q, want the key", got)
+	}
+}
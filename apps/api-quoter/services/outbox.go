@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+)
+
+// maxEmailAttempts bounds how many times Resume retries a persisted email.
+const maxEmailAttempts = 5
+
+// Email is a rendered message ready for delivery. Template names the message
+// kind for logs and metrics; Ref is the quote it belongs to.
+type Email struct {
+	Template string
+	Ref      string
+	To       string
+	Subject  string
+	HTML     string
+}
+
+// Outbox delivers emails in background goroutines. Every email is written to
+// the email_outbox table before its goroutine starts and deleted once sent,
+// so an email still undelivered when the process exits is retried by Resume
+// on the next start instead of being lost.
+type Outbox struct {
+	db   *sql.DB
+	wg   sync.WaitGroup
+	send func(ctx context.Context, e Email) error
+}
+
+func NewOutbox(db *sql.DB, mailer *Mailer) *Outbox {
+	return &Outbox{db: db, send: mailer.Send}
+}
+
+// Enqueue persists the emails and sends them, in order, in one background
+// goroutine. ctx should be detached from the request so it only carries
+// values (the request ID) and not its cancellation.
+func (o *Outbox) Enqueue(ctx context.Context, emails ...Email) {
+	ids := make([]int64, len(emails))
+	for i, e := range emails {
+		res, err := o.db.ExecContext(ctx,
+			`INSERT INTO email_outbox (template, ref, recipient, subject, html) VALUES (?, ?, ?, ?, ?)`,
+			e.Template, e.Ref, e.To, e.Subject, e.HTML)
+		if err != nil {
+			// Still try to send; the email just won't survive a restart.
+			slog.ErrorContext(ctx, "persisting email", "template", e.Template, "ref", e.Ref, "err", err)
+			continue
+		}
+		ids[i], _ = res.LastInsertId()
+	}
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		for i, e := range emails {
+			o.deliver(ctx, ids[i], e)
+		}
+	}()
+}
+
+func (o *Outbox) deliver(ctx context.Context, id int64, e Email) {
+	if err := o.send(ctx, e); err != nil {
+		slog.ErrorContext(ctx, "sending email", "template", e.Template, "ref", e.Ref, "err", err)
+		if id != 0 {
+			o.db.ExecContext(ctx,
+				`UPDATE email_outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?`, err.Error(), id)
+		}
+		return
+	}
+	if id != 0 {
+		if _, err := o.db.ExecContext(ctx, `DELETE FROM email_outbox WHERE id = ?`, id); err != nil {
+			slog.ErrorContext(ctx, "removing sent email from outbox", "template", e.Template, "ref", e.Ref, "err", err)
+		}
+	}
+}
+
+// Resume sends emails left in the outbox by a previous process, skipping
+// those that already failed maxEmailAttempts times.
+func (o *Outbox) Resume(ctx context.Context) error {
+	rows, err := o.db.QueryContext(ctx,
+		`SELECT id, template, COALESCE(ref, ''), recipient, subject, html FROM email_outbox
+		 WHERE attempts < ? ORDER BY id`, maxEmailAttempts)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type pending struct {
+		id int64
+		e  Email
+	}
+	var queued []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.e.Template, &p.e.Ref, &p.e.To, &p.e.Subject, &p.e.HTML); err != nil {
+			return err
+		}
+		queued = append(queued, p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "resuming unsent emails", "count", len(queued))
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		for _, p := range queued {
+			o.deliver(ctx, p.id, p.e)
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until every background email has been handled or ctx is done.
+// Emails cut off by ctx stay in the outbox for the next start.
+func (o *Outbox) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
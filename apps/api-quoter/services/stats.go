@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/joledev/api-quoter/metrics"
+	"github.com/joledev/api-quoter/models"
+)
+
+// Stats computes the admin quote statistics and keeps each result for a
+// short TTL, so a dashboard polling it does not rescan the table each time.
+type Stats struct {
+	db  *sql.DB
+	ttl time.Duration
+	now func() time.Time
+
+	mu     sync.Mutex
+	cached map[string]cachedStats
+}
+
+type cachedStats struct {
+	stats   *models.QuoteStats
+	expires time.Time
+}
+
+func NewStats(db *sql.DB, ttl time.Duration) *Stats {
+	return &Stats{db: db, ttl: ttl, now: time.Now, cached: map[string]cachedStats{}}
+}
+
+// Quotes returns the statistics of the quotes created between the dates
+// from and to (UTC), inclusive. The lock is held while computing, so
+// concurrent requests for the same range run the queries once.
+func (s *Stats) Quotes(ctx context.Context, from, to string) (*models.QuoteStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key := from + "/" + to
+	if c, ok := s.cached[key]; ok && now.Before(c.expires) {
+		return c.stats, nil
+	}
+	done := metrics.TimeQuery("quote_stats")
+	stats, err := quoteStats(ctx, s.db, from, to)
+	done()
+	if err != nil {
+		return nil, err
+	}
+	stats.GeneratedAt = now.UTC().Format(time.RFC3339)
+	for k, c := range s.cached {
+		if !now.Before(c.expires) {
+			delete(s.cached, k)
+		}
+	}
+	s.cached[key] = cachedStats{stats: stats, expires: now.Add(s.ttl)}
+	return stats, nil
+}
+
+func quoteStats(ctx context.Context, db *sql.DB, from, to string) (*models.QuoteStats, error) {
+	st := &models.QuoteStats{
+		From: from, To: to,
+		ProjectTypes: []models.KeyCount{}, Features: []models.KeyCount{}, Currencies: []models.CurrencyStats{},
+	}
+
+	err := eachRow(ctx, db,
+		`SELECT currency, COUNT(*), CAST(ROUND(AVG(estimated_min)) AS INTEGER), CAST(ROUND(AVG(estimated_max)) AS INTEGER)
+		 FROM quotes WHERE date(created_at) BETWEEN ? AND ?
+		 GROUP BY currency ORDER BY COUNT(*) DESC, currency`,
+		[]any{from, to}, func(rows *sql.Rows) error {
+			var c models.CurrencyStats
+			if err := rows.Scan(&c.Currency, &c.Count, &c.AvgEstimatedMin, &c.AvgEstimatedMax); err != nil {
+				return err
+			}
+			st.Currencies = append(st.Currencies, c)
+			st.Total += c.Count
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// project_types and features hold JSON arrays of keys.
+	for _, list := range []struct {
+		column string
+		dst    *[]models.KeyCount
+	}{
+		{"project_types", &st.ProjectTypes},
+		{"features", &st.Features},
+	} {
+		err := eachRow(ctx, db,
+			`SELECT j.value, COUNT(*) AS n FROM quotes, json_each(quotes.`+list.column+`) AS j
+			 WHERE date(quotes.created_at) BETWEEN ? AND ?
+			 GROUP BY j.value ORDER BY n DESC, j.value`,
+			[]any{from, to}, func(rows *sql.Rows) error {
+				var c models.KeyCount
+				if err := rows.Scan(&c.Key, &c.Count); err != nil {
+					return err
+				}
+				*list.dst = append(*list.dst, c)
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// eachRow runs query and calls scan for every row.
+func eachRow(ctx context.Context, db *sql.DB, query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
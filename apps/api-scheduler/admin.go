@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joledev/api-scheduler/services"
+)
+
+const adminUsage = `usage:
+	server admin list
+	server admin add USERNAME         (password read from stdin)
+	server admin passwd USERNAME      (password read from stdin)
+	server admin disable USERNAME
+	server admin enable USERNAME
+	server admin reset-totp USERNAME  (turn off two-factor for a lost device)
+`
+
+// runAdmin implements the admin subcommand, which manages the accounts
+// allowed into /scheduler/admin. Passwords are read from a line of stdin so
+// they stay out of shell history and process listings. It returns the
+// process exit code.
+func runAdmin(admins *services.Admins, args []string, in io.Reader, out io.Writer) int {
+	ctx := context.Background()
+	if len(args) == 1 && args[0] == "list" {
+		return adminList(ctx, admins, out)
+	}
+	if len(args) != 2 {
+		fmt.Fprint(out, adminUsage)
+		return 2
+	}
+
+	cmd, username := args[0], args[1]
+	var err error
+	switch cmd {
+	case "add", "passwd":
+		fmt.Fprintf(out, "password for %s: ", username)
+		var password string
+		if password, err = readLine(in); err != nil {
+			break
+		}
+		fmt.Fprintln(out)
+		if cmd == "add" {
+			_, err = admins.Create(ctx, username, password)
+		} else {
+			err = admins.SetPassword(ctx, username, password)
+		}
+	case "disable", "enable":
+		err = admins.SetDisabled(ctx, username, cmd == "disable")
+	case "reset-totp":
+		err = admins.ResetTOTP(ctx, username)
+	default:
+		fmt.Fprint(out, adminUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(out, "error:", err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s: %s done\n", username, cmd)
+	return 0
+}
+
+func readLine(in io.Reader) (string, error) {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", errors.New("no password on stdin")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func adminList(ctx context.Context, admins *services.Admins, out io.Writer) int {
+	users, err := admins.List(ctx)
+	if err != nil {
+		fmt.Fprintln(out, "error:", err)
+		return 1
+	}
+	if len(users) == 0 {
+		fmt.Fprintln(out, "no admin accounts; add one with `server admin add USERNAME`")
+		return 0
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tSTATUS\tTOTP\tCREATED\tLAST LOGIN")
+	for _, u := range users {
+		status := "enabled"
+		if u.Disabled {
+			status = "disabled"
+		}
+		last := u.LastLoginAt
+		if last == "" {
+			last = "never"
+		}
+		totp := "off"
+		if u.TOTPEnabled {
+			totp = "on"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.Username, status, totp, u.CreatedAt, last)
+	}
+	tw.Flush()
+	return 0
+}
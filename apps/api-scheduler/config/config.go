@@ -0,0 +1,474 @@
+// Package config loads the scheduler's settings once at startup.
+//
+// Values come from, in increasing precedence: built-in defaults, the YAML
+// file named by CONFIG_FILE, and environment variables. Any variable can
+// instead be read from a file by setting NAME_FILE to its path, which is how
+// Kubernetes secret volumes are consumed (e.g. SMTP_PASS_FILE).
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Port            string        `yaml:"port"`
+	DBPath          string        `yaml:"db_path"`
+	LogLevel        string        `yaml:"log_level"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// CORSOrigins are the allowed browser origins; see middleware.CORSOptions
+	// for the wildcard syntax. CORS_ORIGIN takes a comma-separated list.
+	CORSOrigins []string `yaml:"cors_origins"`
+	// ContactEmail receives the new-booking notifications.
+	ContactEmail string `yaml:"contact_email"`
+	// APIBaseURL is the public URL of this API, used for the action links
+	// in admin emails.
+	APIBaseURL string `yaml:"api_base_url"`
+	// AdminPassword creates the account "admin" when there are no admin
+	// accounts yet; after that accounts are managed with `server admin`.
+	AdminPassword string `yaml:"admin_password"`
+	// SessionSecret signs admin session cookies and the links in emails.
+	// It is required when email is sent; with SMTP disabled, empty uses a
+	// random key, which logs everyone out on restart.
+	SessionSecret string        `yaml:"session_secret"`
+	SessionTTL    time.Duration `yaml:"session_ttl"`
+	// ActionTokenTTL is how long confirm/reject links stay valid.
+	ActionTokenTTL time.Duration `yaml:"action_token_ttl"`
+	// WaitlistHoldTTL is how long a waitlisted client has to claim a freed
+	// slot held for them.
+	WaitlistHoldTTL time.Duration `yaml:"waitlist_hold_ttl"`
+	// StatsTTL is how long the admin statistics are cached.
+	StatsTTL time.Duration `yaml:"stats_ttl"`
+	// Timezone is the IANA zone of business hours and of the dates and
+	// times stored with bookings.
+	Timezone string `yaml:"timezone"`
+	// BookingLimits restrict which slots are offered and can be booked.
+	BookingLimits BookingLimits `yaml:"booking_limits"`
+	// TurnstileSecret enables CAPTCHA verification; empty skips it (dev).
+	TurnstileSecret string      `yaml:"turnstile_secret_key"`
+	ReadyzCheckSMTP bool        `yaml:"readyz_check_smtp"`
+	SMTP            SMTP        `yaml:"smtp"`
+	Meetings        Meetings    `yaml:"meetings"`
+	ServiceArea     ServiceArea `yaml:"service_area"`
+}
+
+type SMTP struct {
+	Host string `yaml:"host"`
+	Port string `yaml:"port"`
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+	From string `yaml:"from"`
+	// Disabled drops outgoing email instead of requiring SMTP settings,
+	// for local development.
+	Disabled bool `yaml:"disabled"`
+}
+
+// Meetings chooses how videollamada bookings get their video-call link.
+type Meetings struct {
+	// Provider is "jitsi" (a room per booking on JitsiURL, no API needed),
+	// "webhook" (WebhookURL answers with the link) or "none".
+	Provider string `yaml:"provider"`
+	JitsiURL string `yaml:"jitsi_url"`
+	// WebhookURL receives a POST with the booking and answers
+	// {"url": "..."}. WebhookSecret, if set, signs the request body.
+	WebhookURL    string `yaml:"webhook_url"`
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+// ServiceArea is where in-person meetings are offered. A presencial booking
+// needs an address in one of the zones; with no zones (service_area:
+// {zones: []}) any address is accepted.
+type ServiceArea struct {
+	Zones []Zone `yaml:"zones"`
+}
+
+// Zone is part of the service area. An address is in the zone when its
+// postal code starts with one of PostalPrefixes or, failing that, its city
+// is one of Cities (ignoring case and accents). TravelBuffer is kept free
+// between an in-person meeting in the zone and any other booking.
+type Zone struct {
+	Name           string        `yaml:"name"`
+	Cities         []string      `yaml:"cities"`
+	PostalPrefixes []string      `yaml:"postal_prefixes"`
+	TravelBuffer   time.Duration `yaml:"travel_buffer"`
+}
+
+// BookingLimits are the booking rules. MinNotice counts business hours only,
+// so 12h asked for on a Friday afternoon reaches into Tuesday. A slot must
+// be at most MaxHorizonDays after today, one request for slots may span at
+// most MaxRangeDays, and a day or a week (Monday to Sunday) with DailyCap or
+// WeeklyCap active bookings takes no more. Zero turns a limit off.
+type BookingLimits struct {
+	MinNotice      time.Duration `yaml:"min_notice"`
+	MaxHorizonDays int           `yaml:"max_horizon_days"`
+	MaxRangeDays   int           `yaml:"max_range_days"`
+	DailyCap       int           `yaml:"daily_cap"`
+	WeeklyCap      int           `yaml:"weekly_cap"`
+}
+
+// Defaults returns the configuration used when nothing is set. It is not
+// valid on its own: SMTP must be configured or disabled.
+func Defaults() *Config {
+	return &Config{
+		Port:            "8082",
+		DBPath:          "/data/scheduler.db",
+		LogLevel:        "info",
+		ShutdownTimeout: 25 * time.Second,
+		SessionTTL:      12 * time.Hour,
+		ActionTokenTTL:  7 * 24 * time.Hour,
+		WaitlistHoldTTL: 2 * time.Hour,
+		StatsTTL:        5 * time.Minute,
+		Timezone:        "America/Tijuana",
+		BookingLimits:   BookingLimits{MinNotice: 12 * time.Hour, MaxHorizonDays: 60, MaxRangeDays: 31},
+		CORSOrigins:     []string{"https://joledev.com", "https://www.joledev.com"},
+		ContactEmail:    "contacto@joledev.com",
+		APIBaseURL:      "http://localhost:8082",
+		SMTP:            SMTP{Port: "465"},
+		Meetings:        Meetings{Provider: "jitsi", JitsiURL: "https://meet.jit.si"},
+		ServiceArea: ServiceArea{Zones: []Zone{
+			{Name: "tijuana", Cities: []string{"Tijuana"},
+				PostalPrefixes: []string{"220", "221", "222", "223", "224", "225", "226"}, TravelBuffer: 2 * time.Hour},
+			{Name: "rosarito", Cities: []string{"Rosarito", "Playas de Rosarito"},
+				PostalPrefixes: []string{"227"}, TravelBuffer: 3 * time.Hour},
+			{Name: "ensenada", Cities: []string{"Ensenada"},
+				PostalPrefixes: []string{"228"}, TravelBuffer: 4 * time.Hour},
+		}},
+	}
+}
+
+// Load reads and validates the configuration. The error lists every
+// problem found, not just the first.
+func Load() (*Config, error) {
+	cfg := Defaults()
+
+	path, err := lookup("CONFIG_FILE")
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	cfg.APIBaseURL = strings.TrimRight(cfg.APIBaseURL, "/")
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	strs := map[string]*string{
+		"PORT":                     &c.Port,
+		"DB_PATH":                  &c.DBPath,
+		"LOG_LEVEL":                &c.LogLevel,
+		"CONTACT_EMAIL":            &c.ContactEmail,
+		"API_BASE_URL":             &c.APIBaseURL,
+		"SCHEDULER_ADMIN_PASSWORD": &c.AdminPassword,
+		"SCHEDULER_SESSION_SECRET": &c.SessionSecret,
+		"SCHEDULER_TIMEZONE":       &c.Timezone,
+		"TURNSTILE_SECRET_KEY":     &c.TurnstileSecret,
+		"SMTP_HOST":                &c.SMTP.Host,
+		"SMTP_PORT":                &c.SMTP.Port,
+		"SMTP_USER":                &c.SMTP.User,
+		"SMTP_PASS":                &c.SMTP.Pass,
+		"SMTP_FROM":                &c.SMTP.From,
+		"MEETING_PROVIDER":         &c.Meetings.Provider,
+		"MEETING_JITSI_URL":        &c.Meetings.JitsiURL,
+		"MEETING_WEBHOOK_URL":      &c.Meetings.WebhookURL,
+		"MEETING_WEBHOOK_SECRET":   &c.Meetings.WebhookSecret,
+	}
+	for name, dst := range strs {
+		v, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			*dst = v
+		}
+	}
+
+	bools := map[string]*bool{
+		"READYZ_CHECK_SMTP": &c.ReadyzCheckSMTP,
+		"SMTP_DISABLED":     &c.SMTP.Disabled,
+	}
+	for name, dst := range bools {
+		v, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", name, v)
+		}
+		*dst = b
+	}
+
+	v, err := lookup("CORS_ORIGIN")
+	if err != nil {
+		return err
+	}
+	if v != "" {
+		c.CORSOrigins = nil
+		for _, o := range strings.Split(v, ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				c.CORSOrigins = append(c.CORSOrigins, o)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		"SCHEDULER_MAX_HORIZON_DAYS": &c.BookingLimits.MaxHorizonDays,
+		"SCHEDULER_MAX_RANGE_DAYS":   &c.BookingLimits.MaxRangeDays,
+		"SCHEDULER_DAILY_CAP":        &c.BookingLimits.DailyCap,
+		"SCHEDULER_WEEKLY_CAP":       &c.BookingLimits.WeeklyCap,
+	}
+	for name, dst := range ints {
+		v, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a whole number", name, v)
+		}
+		*dst = n
+	}
+
+	durations := map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT":            &c.ShutdownTimeout,
+		"SCHEDULER_SESSION_TTL":       &c.SessionTTL,
+		"SCHEDULER_ACTION_TOKEN_TTL":  &c.ActionTokenTTL,
+		"SCHEDULER_WAITLIST_HOLD_TTL": &c.WaitlistHoldTTL,
+		"SCHEDULER_STATS_TTL":         &c.StatsTTL,
+		"SCHEDULER_MIN_NOTICE":        &c.BookingLimits.MinNotice,
+	}
+	for name, dst := range durations {
+		v, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration (e.g. 25s)", name, v)
+		}
+		*dst = d
+	}
+	return nil
+}
+
+// lookup returns the variable name, or the trimmed contents of the file
+// named by name_FILE when that is set.
+func lookup(name string) (string, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return os.Getenv(name), nil
+}
+
+// Validate checks every setting and reports all problems together.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if p, err := strconv.Atoi(c.Port); err != nil || p < 1 || p > 65535 {
+		add("PORT: %q is not a valid port", c.Port)
+	}
+	if c.DBPath == "" {
+		add("DB_PATH is required")
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		add("LOG_LEVEL: %q is not one of debug, info, warn, error", c.LogLevel)
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if len(c.CORSOrigins) == 0 {
+		add("CORS_ORIGIN needs at least one origin")
+	}
+	if _, err := mail.ParseAddress(c.ContactEmail); err != nil {
+		add("CONTACT_EMAIL: %q is not an email address", c.ContactEmail)
+	}
+	if !httpURL(c.APIBaseURL) {
+		add("API_BASE_URL: %q is not an absolute http(s) URL", c.APIBaseURL)
+	}
+	switch {
+	case c.SessionSecret == "" && !c.SMTP.Disabled:
+		// A random key would break every emailed link on restart.
+		add("SCHEDULER_SESSION_SECRET is required (or set SMTP_DISABLED=true)")
+	case c.SessionSecret != "" && len(c.SessionSecret) < 32:
+		add("SCHEDULER_SESSION_SECRET must be at least 32 characters")
+	}
+	if c.SessionTTL < time.Minute {
+		add("SCHEDULER_SESSION_TTL must be at least 1m")
+	}
+	if c.ActionTokenTTL < time.Hour {
+		add("SCHEDULER_ACTION_TOKEN_TTL must be at least 1h")
+	}
+	if c.WaitlistHoldTTL < 5*time.Minute {
+		add("SCHEDULER_WAITLIST_HOLD_TTL must be at least 5m")
+	}
+	if c.StatsTTL < 0 {
+		add("SCHEDULER_STATS_TTL must not be negative")
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "" || c.Timezone == "Local" {
+		add("SCHEDULER_TIMEZONE: %q is not an IANA time zone (e.g. America/Tijuana)", c.Timezone)
+	}
+	errs = append(errs, c.SMTP.validate()...)
+	errs = append(errs, c.Meetings.validate()...)
+	errs = append(errs, c.ServiceArea.validate()...)
+	errs = append(errs, c.BookingLimits.validate()...)
+
+	return errors.Join(errs...)
+}
+
+func (l BookingLimits) validate() []error {
+	var errs []error
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"SCHEDULER_MAX_HORIZON_DAYS", l.MaxHorizonDays}, {"SCHEDULER_MAX_RANGE_DAYS", l.MaxRangeDays},
+		{"SCHEDULER_DAILY_CAP", l.DailyCap}, {"SCHEDULER_WEEKLY_CAP", l.WeeklyCap},
+	} {
+		if n.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", n.name))
+		}
+	}
+	if l.MinNotice < 0 {
+		errs = append(errs, errors.New("SCHEDULER_MIN_NOTICE must not be negative"))
+	}
+	return errs
+}
+
+func (s SMTP) validate() []error {
+	if s.Disabled {
+		return nil
+	}
+	var errs []error
+	for _, req := range []struct{ name, value string }{
+		{"SMTP_HOST", s.Host}, {"SMTP_USER", s.User}, {"SMTP_PASS", s.Pass},
+	} {
+		if req.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required (or set SMTP_DISABLED=true)", req.name))
+		}
+	}
+	if p, err := strconv.Atoi(s.Port); err != nil || p < 1 || p > 65535 {
+		errs = append(errs, fmt.Errorf("SMTP_PORT: %q is not a valid port", s.Port))
+	}
+	if s.From != "" {
+		if _, err := mail.ParseAddress(s.From); err != nil {
+			errs = append(errs, fmt.Errorf("SMTP_FROM: %q is not an address like Name <user@host>", s.From))
+		}
+	}
+	return errs
+}
+
+func (m Meetings) validate() []error {
+	switch m.Provider {
+	case "jitsi":
+		if !httpURL(m.JitsiURL) {
+			return []error{fmt.Errorf("MEETING_JITSI_URL: %q is not an absolute http(s) URL", m.JitsiURL)}
+		}
+	case "webhook":
+		if !httpURL(m.WebhookURL) {
+			return []error{fmt.Errorf("MEETING_WEBHOOK_URL: %q is not an absolute http(s) URL", m.WebhookURL)}
+		}
+	case "none":
+	default:
+		return []error{fmt.Errorf("MEETING_PROVIDER: %q is not one of jitsi, webhook, none", m.Provider)}
+	}
+	return nil
+}
+
+func (a ServiceArea) validate() []error {
+	var errs []error
+	add := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+	seen := map[string]bool{}
+	for i, z := range a.Zones {
+		name := fmt.Sprintf("service_area.zones[%d]", i)
+		switch {
+		case z.Name == "":
+			add("%s: name is required", name)
+		case seen[z.Name]:
+			add("%s: zone %q is defined twice", name, z.Name)
+		}
+		seen[z.Name] = true
+		if len(z.Cities) == 0 && len(z.PostalPrefixes) == 0 {
+			add("%s: needs cities or postal_prefixes", name)
+		}
+		for _, p := range z.PostalPrefixes {
+			if p == "" || len(p) > 5 || strings.Trim(p, "0123456789") != "" {
+				add("%s: postal prefix %q is not 1 to 5 digits", name, p)
+			}
+		}
+		// Availability looks for bookings up to a day away from a slot.
+		if z.TravelBuffer < 30*time.Minute || z.TravelBuffer > 24*time.Hour || z.TravelBuffer%(30*time.Minute) != 0 {
+			add("%s: travel_buffer must be a multiple of 30m, at most 24h", name)
+		}
+	}
+	return errs
+}
+
+func httpURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Location returns the business time zone. Validate has checked it loads.
+func (c *Config) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Sender returns the From header, defaulting to the login user.
+func (s SMTP) Sender() string {
+	if s.From != "" {
+		return s.From
+	}
+	return s.User
+}
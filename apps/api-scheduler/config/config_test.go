@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setValidEnv sets the minimum environment for a valid configuration.
+func setValidEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_USER", "bot@example.com")
+	t.Setenv("SMTP_PASS", "secret")
+	t.Setenv("SCHEDULER_ADMIN_PASSWORD", "admin-secret")
+	t.Setenv("SCHEDULER_SESSION_SECRET", strings.Repeat("s", 32))
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("PORT", "9000")
+	t.Setenv("API_BASE_URL", "https://api.example.com/")
+	t.Setenv("SHUTDOWN_TIMEOUT", "10s")
+	t.Setenv("SCHEDULER_SESSION_TTL", "1h")
+	t.Setenv("READYZ_CHECK_SMTP", "true")
+	t.Setenv("SCHEDULER_MIN_NOTICE", "4h")
+	t.Setenv("SCHEDULER_WEEKLY_CAP", "10")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != "9000" || cfg.ShutdownTimeout != 10*time.Second || cfg.SessionTTL != time.Hour || !cfg.ReadyzCheckSMTP {
+		t.Errorf("Env not applied: %+v", cfg)
+	}
+	if want := (BookingLimits{MinNotice: 4 * time.Hour, MaxHorizonDays: 60, MaxRangeDays: 31, WeeklyCap: 10}); cfg.BookingLimits != want {
+		t.Errorf("BookingLimits = %+v, want %+v", cfg.BookingLimits, want)
+	}
+	if cfg.APIBaseURL != "https://api.example.com" {
+		t.Errorf("Expected trailing slash trimmed, got %q", cfg.APIBaseURL)
+	}
+	if cfg.SMTP.Port != "465" || cfg.SMTP.Sender() != "bot@example.com" {
+		t.Errorf("Expected SMTP defaults, got %+v", cfg.SMTP)
+	}
+}
+
+func TestLoadSecretFromFile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("SCHEDULER_ADMIN_PASSWORD", "")
+	t.Setenv("SCHEDULER_ADMIN_PASSWORD_FILE", writeFile(t, "password", "from-file\n"))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.AdminPassword != "from-file" {
+		t.Errorf("Expected password from file, got %q", cfg.AdminPassword)
+	}
+}
+
+func TestLoadMissingSecretFile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("SMTP_PASS_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "SMTP_PASS_FILE") {
+		t.Errorf("Expected SMTP_PASS_FILE error, got %v", err)
+	}
+}
+
+func TestLoadYAMLWithEnvOverride(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", `
+port: "9100"
+contact_email: admin@example.com
+shutdown_timeout: 5s
+smtp:
+  port: "587"
+`))
+	t.Setenv("PORT", "9200")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != "9200" {
+		t.Errorf("Expected env to override file, got port %q", cfg.Port)
+	}
+	if cfg.ContactEmail != "admin@example.com" || cfg.ShutdownTimeout != 5*time.Second || cfg.SMTP.Port != "587" {
+		t.Errorf("File values not applied: %+v", cfg)
+	}
+}
+
+func TestLoadYAMLRejectsUnknownKeys(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", "smtp:\n  hots: typo\n"))
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "hots") {
+		t.Errorf("Expected unknown key error, got %v", err)
+	}
+}
+
+func TestLoadServiceAreaFromYAML(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", `
+service_area:
+  zones:
+    - name: tecate
+      cities: [Tecate]
+      postal_prefixes: ["214"]
+      travel_buffer: 3h
+`))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if z := cfg.ServiceArea.Zones; len(z) != 1 || z[0].Name != "tecate" || z[0].TravelBuffer != 3*time.Hour {
+		t.Errorf("Zones = %+v", z)
+	}
+
+	cfg.ServiceArea.Zones = []Zone{
+		{Name: "a", Cities: []string{"A"}, TravelBuffer: 45 * time.Minute},
+		{Name: "a", PostalPrefixes: []string{"22-"}, TravelBuffer: time.Hour},
+		{Name: "b", TravelBuffer: time.Hour},
+	}
+	err = cfg.Validate()
+	for _, want := range []string{"zones[0]: travel_buffer", `zones[1]: zone "a"`, `zones[1]: postal prefix "22-"`, "zones[2]: needs cities"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := Defaults()
+	cfg.Port = "http"
+	cfg.APIBaseURL = "api.example.com"
+	cfg.SessionSecret = "too-short"
+	cfg.SessionTTL = time.Second
+	cfg.ActionTokenTTL = time.Minute
+	cfg.WaitlistHoldTTL = time.Minute
+	cfg.StatsTTL = -time.Second
+	cfg.Meetings.Provider = "webhook"
+	cfg.Timezone = "Mars/Olympus"
+	cfg.BookingLimits.DailyCap = -1
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{"PORT", "API_BASE_URL", "SCHEDULER_SESSION_SECRET", "SCHEDULER_SESSION_TTL", "SCHEDULER_ACTION_TOKEN_TTL", "SCHEDULER_WAITLIST_HOLD_TTL", "SCHEDULER_STATS_TTL", "MEETING_WEBHOOK_URL", "SCHEDULER_TIMEZONE", "SCHEDULER_DAILY_CAP", "SMTP_HOST", "SMTP_PASS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateRequiresSessionSecretWithEmail(t *testing.T) {
+	cfg := Defaults()
+	cfg.SMTP = SMTP{Host: "smtp.example.com", Port: "465", User: "bot@example.com", Pass: "secret"}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "SCHEDULER_SESSION_SECRET is required") {
+		t.Errorf("Expected a missing secret to be reported, got %v", err)
+	}
+	cfg.SessionSecret = strings.Repeat("s", 32)
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a valid configuration, got %v", err)
+	}
+}
+
+func TestValidateSMTPDisabled(t *testing.T) {
+	cfg := Defaults()
+	cfg.SMTP.Disabled = true
+
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected disabled SMTP to need no settings, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+// Package export streams tables as CSV or XLSX spreadsheets, one row at a
+// time, so an export never holds more than a row in memory.
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Formats lists the supported formats, the default first.
+var Formats = []string{"csv", "xlsx"}
+
+// Writer writes a table row by row. Cells are strings or integers. Close
+// must be called after the last row; the output is incomplete until then.
+type Writer interface {
+	Write(row ...any) error
+	Close() error
+}
+
+// New starts a download of format ("csv" or "xlsx") named name plus the
+// extension on w, setting the response headers. sheet names the XLSX sheet.
+func New(w http.ResponseWriter, format, name, sheet string) (Writer, error) {
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+	switch format {
+	case "csv":
+		h.Set("Content-Type", "text/csv; charset=utf-8")
+		h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+		return NewCSV(w)
+	case "xlsx":
+		h.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, name))
+		return NewXLSX(w, sheet)
+	}
+	return nil, fmt.Errorf("export: unknown format %q", format)
+}
+
+// flushEvery is how many rows are buffered before they are sent on.
+const flushEvery = 100
+
+type csvWriter struct {
+	w      *csv.Writer
+	flush  func()
+	rows   int
+	record []string
+}
+
+// NewCSV returns a Writer producing CSV. The file starts with a UTF-8 byte
+// order mark, without which Excel misreads accented text, and text cells a
+// spreadsheet would run as a formula are prefixed with an apostrophe.
+func NewCSV(w io.Writer) (Writer, error) {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	c := &csvWriter{w: csv.NewWriter(w), flush: func() {}}
+	if f, ok := w.(http.Flusher); ok {
+		c.flush = f.Flush
+	}
+	return c, nil
+}
+
+func (c *csvWriter) Write(row ...any) error {
+	c.record = c.record[:0]
+	for _, cell := range row {
+		if s, ok := cell.(string); ok {
+			c.record = append(c.record, defuse(s))
+		} else {
+			c.record = append(c.record, fmt.Sprint(cell))
+		}
+	}
+	if err := c.w.Write(c.record); err != nil {
+		return err
+	}
+	if c.rows++; c.rows%flushEvery == 0 {
+		c.w.Flush()
+		c.flush()
+	}
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// defuse keeps s from being read as a formula when the file is opened in a
+// spreadsheet (CSV injection).
+func defuse(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
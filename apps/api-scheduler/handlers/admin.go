@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/metrics"
+	"github.com/joledev/api-scheduler/middleware"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+)
+
+// adminCookiePath scopes the session cookie to the admin API.
+const adminCookiePath = "/scheduler/admin"
+
+type AdminHandler struct {
+	db     *sql.DB
+	admins *services.Admins
+	// secure marks the session cookie HTTPS-only; off for a plain-HTTP
+	// local API_BASE_URL.
+	secure bool
+}
+
+func NewAdminHandler(db *sql.DB, admins *services.Admins, cfg *config.Config) *AdminHandler {
+	return &AdminHandler{db: db, admins: admins, secure: strings.HasPrefix(cfg.APIBaseURL, "https://")}
+}
+
+// auditEntry describes an action taken by the request's admin.
+func auditEntry(r *http.Request, action, target, detail string) services.AuditEntry {
+	return services.AuditEntry{
+		User:      middleware.Admin(r.Context()),
+		APIKey:    middleware.APIKey(r.Context()),
+		Action:    action,
+		Target:    target,
+		Detail:    detail,
+		IP:        getClientIP(r),
+		RequestID: chimw.GetReqID(r.Context()),
+	}
+}
+
+// Login exchanges a username and password for a session cookie and returns
+// the CSRF token to send with later requests.
+func (h *AdminHandler) Login(w http.ResponseWriter, r *http.Request) {
+	// Lockout is per account; this bounds how many accounts one client
+	// can probe.
+	if !limiter.allow("admin-login:"+getClientIP(r), 20) {
+		metrics.RateLimited.WithLabelValues("admin_login").Inc()
+		apierror.Write(w, r, "", apierror.New(apierror.RateLimited))
+		return
+	}
+
+	var req models.AdminLoginRequest
+	if e := apierror.Decode(w, r, 4*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+	v := apierror.Validation()
+	if req.Username == "" {
+		v.Required("username")
+	}
+	if req.Password == "" {
+		v.Required("password")
+	}
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
+		return
+	}
+
+	u, err := h.admins.Authenticate(r.Context(), req.Username, req.Password, req.TOTPCode)
+	if err != nil {
+		middleware.WriteAuthError(w, r, "", req.Username, err)
+		return
+	}
+	s, err := h.admins.CreateSession(r.Context(), u)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "creating admin session", "admin", u.Username, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    s.Token,
+		Path:     adminCookiePath,
+		Expires:  s.ExpiresAt,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	slog.InfoContext(r.Context(), "admin logged in", "admin", u.Username)
+	r = r.WithContext(middleware.WithAdmin(r.Context(), u))
+	services.Audit(r.Context(), h.db, auditEntry(r, "login", "", ""))
+
+	writeSession(w, s)
+}
+
+// Logout ends the request's session. With Basic credentials there is no
+// session and it only succeeds.
+func (h *AdminHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(middleware.SessionCookie); err == nil {
+		if err := h.admins.DeleteSession(r.Context(), c.Value); err != nil {
+			slog.ErrorContext(r.Context(), "deleting admin session", "err", err)
+			apierror.Write(w, r, "", apierror.New(apierror.Internal))
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Path:     adminCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	services.Audit(r.Context(), h.db, auditEntry(r, "logout", "", ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AdminSessionResponse{
+		Success:  true,
+		Username: middleware.Admin(r.Context()).Username,
+	})
+}
+
+// Me returns the signed-in admin, and the CSRF token when the request came
+// with a session cookie, so a reloaded page can resume its session. For an
+// API key it returns the key's scopes, which is how the quoter checks keys.
+func (h *AdminHandler) Me(w http.ResponseWriter, r *http.Request) {
+	if s := middleware.Session(r.Context()); s != nil {
+		writeSession(w, s)
+		return
+	}
+	resp := models.AdminSessionResponse{
+		Success:     true,
+		Username:    middleware.Admin(r.Context()).Username,
+		TOTPEnabled: middleware.Admin(r.Context()).TOTPEnabled,
+	}
+	if k := middleware.APIKey(r.Context()); k != nil {
+		resp.Scopes = k.Scopes
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// EnrollTOTP starts two-factor enrollment, returning the secret and the
+// provisioning URI for the authenticator app. Nothing changes at login until
+// ConfirmTOTP.
+func (h *AdminHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	admin := middleware.Admin(r.Context())
+	secret, uri, err := h.admins.EnrollTOTP(r.Context(), admin)
+	if err != nil {
+		writeTOTPError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.TOTPEnrollResponse{Success: true, Secret: secret, URI: uri})
+}
+
+// ConfirmTOTP enables two-factor authentication with a code from the newly
+// enrolled app and returns the recovery codes, which are not shown again.
+func (h *AdminHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req models.TOTPCodeRequest
+	if e := apierror.Decode(w, r, 4*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+	codes, err := h.admins.ConfirmTOTP(r.Context(), middleware.Admin(r.Context()), req.Code)
+	if err != nil {
+		writeTOTPError(w, r, err)
+		return
+	}
+	services.Audit(r.Context(), h.db, auditEntry(r, "totp.enable", "", ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.TOTPRecoveryCodesResponse{Success: true, RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off given a current code or a
+// recovery code.
+func (h *AdminHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req models.TOTPCodeRequest
+	if e := apierror.Decode(w, r, 4*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+	if err := h.admins.DisableTOTP(r.Context(), middleware.Admin(r.Context()), req.Code); err != nil {
+		writeTOTPError(w, r, err)
+		return
+	}
+	services.Audit(r.Context(), h.db, auditEntry(r, "totp.disable", "", ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+func writeTOTPError(w http.ResponseWriter, r *http.Request, err error) {
+	var locked *services.LockedError
+	switch {
+	case errors.As(err, &locked):
+		middleware.WriteAuthError(w, r, "", middleware.Admin(r.Context()).Username, err)
+	case errors.Is(err, services.ErrTOTPEnabled):
+		apierror.Write(w, r, "", apierror.New(apierror.TOTPAlreadyEnabled))
+	case errors.Is(err, services.ErrTOTPNotEnrolled):
+		apierror.Write(w, r, "", apierror.New(apierror.TOTPNotEnrolled))
+	case errors.Is(err, services.ErrInvalidCode):
+		apierror.Write(w, r, "", apierror.Validation().Invalid("code"))
+	default:
+		slog.ErrorContext(r.Context(), "updating two-factor authentication", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+	}
+}
+
+func writeSession(w http.ResponseWriter, s *services.AdminSession) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.AdminSessionResponse{
+		Success:     true,
+		Username:    s.User.Username,
+		TOTPEnabled: s.User.TOTPEnabled,
+		CSRFToken:   s.CSRFToken,
+		ExpiresAt:   s.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
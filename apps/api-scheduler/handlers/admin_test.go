@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/middleware"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+)
+
+// newAdminRouter wires the admin routes as main does.
+func newAdminRouter(db *sql.DB, admins *services.Admins) http.Handler {
+	cfg := config.Defaults()
+	ah := NewAdminHandler(db, admins, cfg)
+	bh := newTestBookingHandler(db)
+	r := chi.NewRouter()
+	r.Route("/scheduler/admin", func(r chi.Router) {
+		r.Post("/login", ah.Login)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AdminAuth(admins))
+			r.Get("/me", ah.Me)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead)).Get("/bookings", bh.GetAdminBookings)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead)).Get("/bookings/export", bh.ExportBookings)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead)).Get("/clients/bookings", bh.GetClientHistory)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead)).Get("/stats", bh.GetBookingStats)
+			r.With(middleware.RequireScope(services.ScopeBookingsWrite)).Post("/bookings", bh.AdminCreateBooking)
+			r.With(middleware.RequireScope(services.ScopeBookingsWrite)).Patch("/bookings/{id}", bh.UpdateBooking)
+			r.With(middleware.RequireScope(services.ScopeBookingsWrite)).Post("/bookings/{id}/reschedule", bh.RescheduleBooking)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead)).Get("/bookings/{id}/events", bh.GetBookingEvents)
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireAccount)
+				r.Post("/logout", ah.Logout)
+				r.Post("/totp/enroll", ah.EnrollTOTP)
+				r.Post("/totp/confirm", ah.ConfirmTOTP)
+				r.Post("/api-keys", ah.CreateAPIKey)
+				r.Delete("/api-keys/{id}", ah.RevokeAPIKey)
+			})
+		})
+	})
+	return r
+}
+
+func TestAdminSessionFlow(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	admins := services.NewAdmins(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	if _, err := admins.Create(context.Background(), "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	insertBooking(t, db, "2037-06-15", "09:00", "10:00", "client@example.com", "confirmed")
+	router := newAdminRouter(db, admins)
+
+	do := func(method, path, body string, cookie *http.Cookie, csrf string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-For", "198.51.100.36")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		if csrf != "" {
+			req.Header.Set(middleware.CSRFHeader, csrf)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/scheduler/admin/login", `{"username":"ana","password":"nope"}`, nil, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d", w.Code)
+	}
+
+	w = do("POST", "/scheduler/admin/login", `{"username":"ana","password":"correct horse battery"}`, nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	var login models.AdminSessionResponse
+	json.NewDecoder(w.Body).Decode(&login)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode ||
+		cookies[0].Path != "/scheduler/admin" {
+		t.Fatalf("session cookie = %+v", cookies)
+	}
+	session := cookies[0]
+	if login.Username != "ana" || login.CSRFToken == "" || login.ExpiresAt == "" {
+		t.Errorf("login response = %+v", login)
+	}
+
+	w = do("GET", "/scheduler/admin/me", "", session, "")
+	var me models.AdminSessionResponse
+	json.NewDecoder(w.Body).Decode(&me)
+	if w.Code != http.StatusOK || me.CSRFToken != login.CSRFToken {
+		t.Errorf("me: status %d, %+v", w.Code, me)
+	}
+
+	if w = do("PATCH", "/scheduler/admin/bookings/1", `{"status":"cancelled"}`, session, ""); w.Code != http.StatusForbidden {
+		t.Errorf("cancel without CSRF token: status %d", w.Code)
+	}
+	if w = do("PATCH", "/scheduler/admin/bookings/1", `{"status":"cancelled"}`, session, login.CSRFToken); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", w.Code, w.Body.String())
+	}
+
+	var actor, target string
+	db.QueryRow(`SELECT username, target FROM admin_audit_log WHERE action = 'booking.cancel'`).Scan(&actor, &target)
+	if actor != "ana" || target != "BK-2026-TEST" {
+		t.Errorf("audit log has %q on %q, want ana on BK-2026-TEST", actor, target)
+	}
+
+	if w = do("POST", "/scheduler/admin/logout", "", session, login.CSRFToken); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d", w.Code)
+	}
+	if w = do("GET", "/scheduler/admin/me", "", session, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("me after logout: status %d", w.Code)
+	}
+}
+
+// authenticatorCode computes the current code for a base32 secret the way an
+// authenticator app does (RFC 6238 defaults).
+func authenticatorCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	m := hmac.New(sha1.New, key)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[off:off+4])&0x7fffffff)%1000000)
+}
+
+func TestAdminTOTPEnrollment(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	admins := services.NewAdmins(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	u, err := admins.Create(context.Background(), "ana", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := admins.CreateSession(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &http.Cookie{Name: middleware.SessionCookie, Value: s.Token}
+	router := newAdminRouter(db, admins)
+
+	do := func(path, body string, withSession bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-For", "198.51.100.37")
+		if withSession {
+			req.AddCookie(session)
+			req.Header.Set(middleware.CSRFHeader, s.CSRFToken)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/scheduler/admin/totp/enroll", "", true)
+	var enroll models.TOTPEnrollResponse
+	json.NewDecoder(w.Body).Decode(&enroll)
+	if w.Code != http.StatusOK || !strings.HasPrefix(enroll.URI, "otpauth://totp/") {
+		t.Fatalf("enroll: status %d, %+v", w.Code, enroll)
+	}
+
+	if w = do("/scheduler/admin/totp/confirm", `{"code":"12345"}`, true); w.Code != http.StatusBadRequest {
+		t.Errorf("confirm with bad code: status %d", w.Code)
+	}
+	w = do("/scheduler/admin/totp/confirm", `{"code":"`+authenticatorCode(t, enroll.Secret)+`"}`, true)
+	var confirm models.TOTPRecoveryCodesResponse
+	json.NewDecoder(w.Body).Decode(&confirm)
+	if w.Code != http.StatusOK || len(confirm.RecoveryCodes) == 0 {
+		t.Fatalf("confirm: status %d, %+v", w.Code, confirm)
+	}
+
+	w = do("/scheduler/admin/login", `{"username":"ana","password":"correct horse battery"}`, false)
+	if resp := decodeError(t, w); w.Code != http.StatusUnauthorized || resp.Code != "TOTP_REQUIRED" {
+		t.Errorf("login without code: status %d, code %s", w.Code, resp.Code)
+	}
+	body := `{"username":"ana","password":"correct horse battery","totpCode":"` + confirm.RecoveryCodes[0] + `"}`
+	if w = do("/scheduler/admin/login", body, false); w.Code != http.StatusOK {
+		t.Errorf("login with recovery code: status %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/scheduler/admin/me", nil)
+	req.SetBasicAuth("ana", "correct horse battery")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Basic auth with TOTP enabled: status %d", w.Code)
+	}
+}
+
+func TestAPIKeyEndpoints(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	admins := services.NewAdmins(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	u, err := admins.Create(context.Background(), "ana", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := admins.CreateSession(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertBooking(t, db, "2037-06-15", "09:00", "10:00", "client@example.com", "confirmed")
+	router := newAdminRouter(db, admins)
+
+	do := func(method, path, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-For", "198.51.100.38")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		} else {
+			req.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: s.Token})
+			req.Header.Set(middleware.CSRFHeader, s.CSRFToken)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/scheduler/admin/api-keys", `{"name":"crm","scopes":["bookings:read","admin"]}`, "")
+	if resp := decodeError(t, w); w.Code != http.StatusBadRequest || resp.Details[0].Field != "scopes" {
+		t.Errorf("unknown scope: status %d, %+v", w.Code, resp)
+	}
+
+	w = do("POST", "/scheduler/admin/api-keys", `{"name":"crm","scopes":["bookings:read"]}`, "")
+	var created models.APIKeyCreatedResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if w.Code != http.StatusCreated || created.Key == "" || created.APIKey.CreatedBy != "ana" {
+		t.Fatalf("create: status %d, %+v", w.Code, created)
+	}
+
+	if w = do("GET", "/scheduler/admin/bookings?from=2037-06-01&to=2037-06-30", "", created.Key); w.Code != http.StatusOK {
+		t.Errorf("read with key: status %d: %s", w.Code, w.Body.String())
+	}
+	w = do("PATCH", "/scheduler/admin/bookings/1", `{"status":"cancelled"}`, created.Key)
+	if resp := decodeError(t, w); w.Code != http.StatusForbidden || resp.Code != "INSUFFICIENT_SCOPE" {
+		t.Errorf("write with read-only key: status %d, code %s", w.Code, resp.Code)
+	}
+	if w = do("POST", "/scheduler/admin/api-keys", `{"name":"more","scopes":["bookings:write"]}`, created.Key); w.Code != http.StatusForbidden {
+		t.Errorf("key minting keys: status %d", w.Code)
+	}
+
+	var me models.AdminSessionResponse
+	w = do("GET", "/scheduler/admin/me", "", created.Key)
+	json.NewDecoder(w.Body).Decode(&me)
+	if me.Username != "ana" || len(me.Scopes) != 1 {
+		t.Errorf("me with key = %+v", me)
+	}
+
+	path := fmt.Sprintf("/scheduler/admin/api-keys/%d", created.APIKey.ID)
+	if w = do("DELETE", path, "", ""); w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d", w.Code)
+	}
+	if w = do("GET", "/scheduler/admin/me", "", created.Key); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d", w.Code)
+	}
+	if w = do("DELETE", path, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("revoking twice: status %d", w.Code)
+	}
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/i18n"
+	"github.com/joledev/api-scheduler/metrics"
+	"github.com/joledev/api-scheduler/middleware"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+)
+
+// validateSlot flags a date or start time that has the right format but
+// cannot be booked at all: "2037-02-30", "25:00", or a start so late that
+// the 30-minute meeting would end at midnight or later, such as "23:30".
+// Bad formats are reported elsewhere.
+func validateSlot(v *apierror.Error, date, startTime string) {
+	if dateRegex.MatchString(date) {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			v.Invalid("date")
+		}
+	}
+	if timeRegex.MatchString(startTime) {
+		if t, err := time.Parse("15:04", startTime); err != nil || t.Hour()*60+t.Minute() >= 23*60+30 {
+			v.Invalid("startTime")
+		}
+	}
+}
+
+// slotFree re-checks inside tx that date/startTime is clear of the other
+// active bookings for a booking needing buffer, ignoring booking exceptID,
+// and within business hours unless override. The limits on client bookings
+// never apply to the admin.
+func (h *BookingHandler) slotFree(tx *sql.Tx, date, startTime string, buffer time.Duration, exceptID int64, override bool) (bool, error) {
+	return h.availability.IsSlotFreeForAdmin(tx, date, startTime, buffer, exceptID, override)
+}
+
+// AdminCreateBooking books on a client's behalf (admin). The booking is
+// created confirmed and the client gets the confirmation email.
+func (h *BookingHandler) AdminCreateBooking(w http.ResponseWriter, r *http.Request) {
+	var req models.AdminBookingRequest
+	if e := apierror.Decode(w, r, 64*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+	v := validateBookingRequest(&models.BookingRequest{
+		Date:           req.Date,
+		StartTime:      req.StartTime,
+		MeetingType:    req.MeetingType,
+		ClientName:     req.ClientName,
+		ClientEmail:    req.ClientEmail,
+		ClientPhone:    req.ClientPhone,
+		ClientCompany:  req.ClientCompany,
+		ClientAddress:  req.ClientAddress,
+		Address:        req.Address,
+		ClientTimezone: req.ClientTimezone,
+		Notes:          req.Notes,
+	})
+	validateSlot(v, req.Date, req.StartTime)
+	h.requireAddress(v, req.MeetingType, req.Address, req.Override)
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
+		return
+	}
+	zone, buffer, inArea := h.locate(req.MeetingType, req.Address)
+	if !inArea && !req.Override {
+		apierror.Write(w, r, "", apierror.New(apierror.OutsideServiceArea))
+		return
+	}
+	if req.Address != nil && req.ClientAddress == "" {
+		req.ClientAddress = req.Address.String()
+	}
+	// The client's language, not the admin's browser's.
+	lang := i18n.Negotiate(req.Lang, "")
+	endTime := h.availability.EndTime(req.Date, req.StartTime)
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "starting transaction", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	defer tx.Rollback()
+
+	free, err := h.slotFree(tx, req.Date, req.StartTime, buffer, 0, req.Override)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "checking slot availability", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	if !free {
+		apierror.Write(w, r, "", apierror.New(apierror.SlotTaken))
+		return
+	}
+
+	b := &models.Booking{
+		BookingID:      h.generateBookingID(tx),
+		Date:           req.Date,
+		StartTime:      req.StartTime,
+		EndTime:        endTime,
+		MeetingType:    req.MeetingType,
+		ClientName:     strings.TrimSpace(req.ClientName),
+		ClientEmail:    strings.TrimSpace(req.ClientEmail),
+		ClientPhone:    req.ClientPhone,
+		ClientCompany:  req.ClientCompany,
+		ClientAddress:  req.ClientAddress,
+		ClientTimezone: req.ClientTimezone,
+		Notes:          req.Notes,
+		Lang:           lang,
+		Status:         services.StatusConfirmed,
+		BufferMinutes:  int(buffer / time.Minute),
+	}
+	addr := addressOf(req.Address)
+	done := metrics.TimeQuery("insert_booking")
+	res, err := tx.ExecContext(r.Context(),
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+		 client_name, client_email, client_phone, client_company, client_address,
+		 address_street, address_city, address_state, address_postal_code,
+		 service_zone, buffer_minutes, client_timezone, notes, lang, status)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+		 NULLIF(?, ''), ?, ?, ?, ?, ?)`,
+		b.BookingID, b.Date, b.StartTime, b.EndTime, b.MeetingType,
+		b.ClientName, b.ClientEmail, b.ClientPhone, b.ClientCompany, b.ClientAddress,
+		addr.Street, addr.City, addr.State, addr.PostalCode,
+		zoneName(zone), b.BufferMinutes, b.ClientTimezone, b.Notes, b.Lang, b.Status)
+	done()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "saving booking", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	rowID, _ := res.LastInsertId()
+	b.ID = int(rowID)
+
+	admin := middleware.Admin(r.Context())
+	if err := services.RecordBookingEvent(r.Context(), tx, services.BookingEvent{
+		BookingID: rowID,
+		To:        b.Status,
+		User:      admin,
+		APIKey:    middleware.APIKey(r.Context()),
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "recording booking event", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "committing booking", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	detail := ""
+	if req.Override {
+		detail = "override"
+	}
+	slog.InfoContext(r.Context(), "booking created by admin", "booking_id", b.BookingID,
+		"date", b.Date, "start_time", b.StartTime, "admin", admin.Username, "override", req.Override)
+	services.Audit(r.Context(), h.db, auditEntry(r, "booking.create", b.BookingID, detail))
+	metrics.BookingTransitions.WithLabelValues("new", b.Status).Inc()
+
+	h.addMeetingLink(r.Context(), b)
+	h.outbox.Enqueue(context.WithoutCancel(r.Context()), services.BookingConfirmationEmail(b))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.BookingResponse{
+		Success:   true,
+		BookingID: b.BookingID,
+		Message:   "Booking created",
+	})
+}
+
+// RescheduleBooking moves a pending or confirmed booking to another date
+// and time (admin) and emails the client the new time.
+func (h *BookingHandler) RescheduleBooking(w http.ResponseWriter, r *http.Request) {
+	var req models.RescheduleRequest
+	if e := apierror.Decode(w, r, 8*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	v := apierror.Validation()
+	if !dateRegex.MatchString(req.Date) {
+		v.Format("date", "YYYY-MM-DD")
+	}
+	if !timeRegex.MatchString(req.StartTime) {
+		v.Format("startTime", "HH:MM")
+	}
+	validateSlot(v, req.Date, req.StartTime)
+	if len(req.Reason) > 500 {
+		v.TooLong("reason", 500)
+	}
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
+		return
+	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "starting transaction", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	defer tx.Rollback()
+
+	b, err := bookingByID(r.Context(), tx, id)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "loading booking", "id", id, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	if b.Status != services.StatusPending && b.Status != services.StatusConfirmed {
+		apierror.Write(w, r, "", apierror.New(apierror.InvalidTransition))
+		return
+	}
+
+	free, err := h.slotFree(tx, req.Date, req.StartTime, time.Duration(b.BufferMinutes)*time.Minute, id, req.Override)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "checking slot availability", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	if !free {
+		apierror.Write(w, r, "", apierror.New(apierror.SlotTaken))
+		return
+	}
+
+	old := *b
+	b.Date, b.StartTime, b.EndTime = req.Date, req.StartTime, h.availability.EndTime(req.Date, req.StartTime)
+	done := metrics.TimeQuery("update_booking_time")
+	_, err = tx.ExecContext(r.Context(),
+		`UPDATE bookings SET date = ?, start_time = ?, end_time = ? WHERE id = ?`,
+		b.Date, b.StartTime, b.EndTime, id)
+	done()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rescheduling booking", "booking_id", b.BookingID, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	moved := fmt.Sprintf("%s %s -> %s %s", old.Date, old.StartTime, b.Date, b.StartTime)
+	admin := middleware.Admin(r.Context())
+	if err := services.RecordBookingEvent(r.Context(), tx, services.BookingEvent{
+		BookingID: id,
+		Reason:    req.Reason,
+		Note:      "Rescheduled " + moved,
+		User:      admin,
+		APIKey:    middleware.APIKey(r.Context()),
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "recording booking event", "booking_id", b.BookingID, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "committing reschedule", "booking_id", b.BookingID, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	if req.Override {
+		moved += " (override)"
+	}
+	slog.InfoContext(r.Context(), "booking rescheduled", "booking_id", b.BookingID,
+		"from", old.Date+" "+old.StartTime, "to", b.Date+" "+b.StartTime, "admin", admin.Username, "override", req.Override)
+	services.Audit(r.Context(), h.db, auditEntry(r, "booking.reschedule", b.BookingID, moved))
+
+	h.outbox.Enqueue(context.WithoutCancel(r.Context()), services.BookingRescheduledEmail(b, &old, req.Reason))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.BookingResponse{
+		Success:   true,
+		BookingID: b.BookingID,
+		Message:   "Booking rescheduled",
+	})
+}
+
+// GetClientHistory lists every booking made with an email address, newest
+// first (admin).
+func (h *BookingHandler) GetClientHistory(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		apierror.Write(w, r, "", apierror.Validation().Required("email"))
+		return
+	}
+
+	bookings, total, _, err := services.SearchBookings(r.Context(), h.db, services.BookingQuery{Email: email, Sort: "-date"})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing client bookings", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	statuses := map[string]int{}
+	for _, b := range bookings {
+		statuses[b.Status]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ClientHistoryResponse{
+		Email:    email,
+		Total:    total,
+		Statuses: statuses,
+		Bookings: bookings,
+	})
+}
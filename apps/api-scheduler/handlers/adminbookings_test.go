@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+)
+
+// newBookingAdminRouter returns the admin router and a request helper signed
+// in as "ana", with its own rate-limit bucket.
+func newBookingAdminRouter(t *testing.T, db *sql.DB) func(method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	admins := services.NewAdmins(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	if _, err := admins.Create(context.Background(), "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	router := newAdminRouter(db, admins)
+	return func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-For", "198.51.100.41")
+		req.SetBasicAuth("ana", "correct horse battery")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+}
+
+func TestAdminCreateBooking(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	do := newBookingAdminRouter(t, db)
+	// The client already has an active booking, which only stops public requests.
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "client@example.com", "pending")
+
+	body := func(date, start, extra string) string {
+		return `{"date":"` + date + `","startTime":"` + start + `","meetingType":"videollamada",` +
+			`"clientName":"Phone Client","clientEmail":"client@example.com","lang":"en"` + extra + `}`
+	}
+	for _, tt := range []struct {
+		name string
+		body string
+		code int
+		err  string
+	}{
+		{"within buffer", body("2037-06-15", "10:00", ""), http.StatusConflict, "SLOT_TAKEN"},
+		{"saturday", body("2037-06-20", "10:00", ""), http.StatusConflict, "SLOT_TAKEN"},
+		{"impossible date", body("2037-02-30", "10:00", `,"override":true`), http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"impossible time", body("2037-06-15", "24:00", `,"override":true`), http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"ends at midnight", body("2037-06-15", "23:30", `,"override":true`), http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"override on a taken slot", body("2037-06-15", "09:00", `,"override":true`), http.StatusConflict, "SLOT_TAKEN"},
+		{"override within buffer", body("2037-06-15", "10:00", `,"override":true`), http.StatusConflict, "SLOT_TAKEN"},
+	} {
+		w := do("POST", "/scheduler/admin/bookings", tt.body)
+		if resp := decodeError(t, w); w.Code != tt.code || string(resp.Code) != tt.err {
+			t.Errorf("%s: status %d, code %s; want %d %s", tt.name, w.Code, resp.Code, tt.code, tt.err)
+		}
+	}
+
+	w := do("POST", "/scheduler/admin/bookings", body("2037-06-15", "11:00", ""))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.BookingResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	var status, lang string
+	db.QueryRow(`SELECT status, lang FROM bookings WHERE booking_id = ?`, resp.BookingID).Scan(&status, &lang)
+	if status != "confirmed" || lang != "en" {
+		t.Errorf("created booking: status %q, lang %q", status, lang)
+	}
+	var to, actor string
+	db.QueryRow(`SELECT to_status, actor FROM booking_events e JOIN bookings b ON b.id = e.booking_id
+	             WHERE b.booking_id = ?`, resp.BookingID).Scan(&to, &actor)
+	if to != "confirmed" || actor != "ana" {
+		t.Errorf("creation event: to %q, actor %q", to, actor)
+	}
+	var emails int
+	db.QueryRow(`SELECT COUNT(*) FROM email_outbox WHERE template = 'booking_confirmation'`).Scan(&emails)
+	if emails != 1 {
+		t.Errorf("%d confirmation emails queued, want 1", emails)
+	}
+
+	if w := do("POST", "/scheduler/admin/bookings", body("2037-06-20", "18:00", `,"override":true`)); w.Code != http.StatusCreated {
+		t.Errorf("override: status %d: %s", w.Code, w.Body.String())
+	}
+
+	inPerson := strings.Replace(body("2037-06-22", "10:00",
+		`,"address":{"street":"Calle 2 #30","city":"Tecate","postalCode":"21400"}`), "videollamada", "presencial", 1)
+	if w := do("POST", "/scheduler/admin/bookings", inPerson); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("outside the service area: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/scheduler/admin/bookings", strings.Replace(inPerson, `"lang"`, `"override":true,"lang"`, 1)); w.Code != http.StatusCreated {
+		t.Errorf("outside the service area with override: status %d: %s", w.Code, w.Body.String())
+	}
+	var list models.AdminBookingsResponse
+	json.NewDecoder(do("GET", "/scheduler/admin/bookings?from=2037-06-22&to=2037-06-22", "").Body).Decode(&list)
+	if len(list.Bookings) != 1 || list.Bookings[0].Address == nil || list.Bookings[0].Address.City != "Tecate" ||
+		list.Bookings[0].ClientAddress != "Calle 2 #30, Tecate, 21400" || list.Bookings[0].ServiceZone != "" {
+		t.Errorf("listed %+v", list.Bookings)
+	}
+}
+
+func TestRescheduleBooking(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	do := newBookingAdminRouter(t, db)
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "client@example.com", "confirmed")
+	if _, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, status)
+		 VALUES ('BK-2026-TEST2', '2037-06-16', '13:00', '13:30', 'videollamada', 'Test', 'other@example.com', 'cancelled')`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path string
+		body string
+		code int
+		err  string
+	}{
+		{"/scheduler/admin/bookings/1/reschedule", `{"date":"2037-06-20","startTime":"10:00"}`, http.StatusConflict, "SLOT_TAKEN"},
+		{"/scheduler/admin/bookings/1/reschedule", `{"date":"2037-06-15"}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"/scheduler/admin/bookings/2/reschedule", `{"date":"2037-06-17","startTime":"10:00"}`, http.StatusConflict, "INVALID_TRANSITION"},
+		{"/scheduler/admin/bookings/99/reschedule", `{"date":"2037-06-17","startTime":"10:00"}`, http.StatusNotFound, "NOT_FOUND"},
+	} {
+		w := do("POST", tt.path, tt.body)
+		if resp := decodeError(t, w); w.Code != tt.code || string(resp.Code) != tt.err {
+			t.Errorf("POST %s %s: status %d, code %s; want %d %s", tt.path, tt.body, w.Code, resp.Code, tt.code, tt.err)
+		}
+	}
+
+	// An hour later on the same day is inside the buffer of the booking
+	// itself, which must not count.
+	w := do("POST", "/scheduler/admin/bookings/1/reschedule", `{"date":"2037-06-15","startTime":"10:00","reason":"Client asked <by phone>"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reschedule: status %d: %s", w.Code, w.Body.String())
+	}
+	var date, start, end, status string
+	db.QueryRow(`SELECT date, start_time, end_time, status FROM bookings WHERE id = 1`).Scan(&date, &start, &end, &status)
+	if date != "2037-06-15" || start != "10:00" || end != "10:30" || status != "confirmed" {
+		t.Errorf("after reschedule: %s %s-%s %s", date, start, end, status)
+	}
+	var html string
+	db.QueryRow(`SELECT html FROM email_outbox WHERE template = 'booking_rescheduled'`).Scan(&html)
+	if !strings.Contains(html, "10:00") || !strings.Contains(html, "Client asked &lt;by phone&gt;") {
+		t.Errorf("reschedule email lacks the new time or escaped reason:\n%s", html)
+	}
+	var note, reason string
+	db.QueryRow(`SELECT COALESCE(note, ''), COALESCE(reason, '') FROM booking_events WHERE booking_id = 1`).Scan(&note, &reason)
+	if note != "Rescheduled 2037-06-15 09:00 -> 2037-06-15 10:00" || reason != "Client asked <by phone>" {
+		t.Errorf("reschedule event: note %q, reason %q", note, reason)
+	}
+
+	if w := do("POST", "/scheduler/admin/bookings/1/reschedule", `{"date":"2037-06-20","startTime":"19:00","override":true}`); w.Code != http.StatusOK {
+		t.Errorf("override: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetAdminBookingsPagesAndFilters(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	do := newBookingAdminRouter(t, db)
+	for i, status := range []string{"pending", "confirmed", "cancelled", "confirmed", "rejected"} {
+		if _, err := db.Exec(
+			`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, status)
+			 VALUES (?, ?, '09:00', '09:30', 'videollamada', 'Test', ?, ?)`,
+			fmt.Sprintf("BK-2037-%03d", i+1), fmt.Sprintf("2037-06-%d", 15+i), []string{"ana@example.com", "bo@example.com"}[i%2], status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, query := range []string{"status=confirmed,done", "limit=0", "limit=201", "sort=price", "cursor=bogus", "from=June"} {
+		w := do("GET", "/scheduler/admin/bookings?"+query, "")
+		if resp := decodeError(t, w); w.Code != http.StatusBadRequest || resp.Code != "VALIDATION_FAILED" {
+			t.Errorf("%s: status %d, code %s; want 400 VALIDATION_FAILED", query, w.Code, resp.Code)
+		}
+	}
+
+	var seen []string
+	path := "/scheduler/admin/bookings?status=pending,confirmed,cancelled&sort=-date&limit=2"
+	for page := 0; page < 3; page++ {
+		w := do("GET", path, "")
+		var resp models.AdminBookingsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("page %d: status %d, %v", page, w.Code, err)
+		}
+		if resp.Total != 4 {
+			t.Errorf("page %d: total %d, want 4", page, resp.Total)
+		}
+		for _, b := range resp.Bookings {
+			seen = append(seen, b.BookingID)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		path = "/scheduler/admin/bookings?status=pending,confirmed,cancelled&sort=-date&limit=2&cursor=" + resp.NextCursor
+	}
+	if got := strings.Join(seen, " "); got != "BK-2037-004 BK-2037-003 BK-2037-002 BK-2037-001" {
+		t.Errorf("pages = %s", got)
+	}
+
+	w := do("GET", "/scheduler/admin/clients/bookings?email=ANA@example.com", "")
+	var history models.ClientHistoryResponse
+	json.NewDecoder(w.Body).Decode(&history)
+	if w.Code != http.StatusOK || history.Total != 3 || len(history.Bookings) != 3 {
+		t.Fatalf("history: status %d, %+v", w.Code, history)
+	}
+	if history.Bookings[0].BookingID != "BK-2037-005" || history.Statuses["rejected"] != 1 || history.Statuses["pending"] != 1 {
+		t.Errorf("history = %+v", history)
+	}
+	if w := do("GET", "/scheduler/admin/clients/bookings", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("history without email: status %d", w.Code)
+	}
+}
+
+func TestGetBookingStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	do := newBookingAdminRouter(t, db)
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "client@example.com", "confirmed")
+
+	for _, query := range []string{"from=2037-06-01", "from=2037-06-30&to=2037-06-01", "from=June&to=July"} {
+		w := do("GET", "/scheduler/admin/stats?"+query, "")
+		if resp := decodeError(t, w); w.Code != http.StatusBadRequest || resp.Code != "VALIDATION_FAILED" {
+			t.Errorf("%s: status %d, code %s; want 400 VALIDATION_FAILED", query, w.Code, resp.Code)
+		}
+	}
+
+	w := do("GET", "/scheduler/admin/stats?from=2037-06-01&to=2037-06-30", "")
+	var stats models.BookingStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, %v", w.Code, err)
+	}
+	if stats.Total != 1 || stats.ConfirmRate != 1 || len(stats.TopSlots) != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestConfirmGivesMeetingLink(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	do := newBookingAdminRouter(t, db)
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "client@example.com", "pending")
+
+	if w := do("PATCH", "/scheduler/admin/bookings/1", `{"status":"confirmed"}`); w.Code != http.StatusOK {
+		t.Fatalf("confirm: status %d: %s", w.Code, w.Body.String())
+	}
+	var link string
+	db.QueryRow(`SELECT COALESCE(meeting_url, '') FROM bookings WHERE id = 1`).Scan(&link)
+	if !strings.HasPrefix(link, "https://meet.jit.si/JoleDev-BK-2026-TEST-") {
+		t.Fatalf("meeting_url = %q", link)
+	}
+	var html, ics string
+	db.QueryRow(`SELECT html, COALESCE(ics, '') FROM email_outbox WHERE template = 'booking_confirmation'`).Scan(&html, &ics)
+	if !strings.Contains(html, link) || !strings.Contains(ics, "URL:"+link) {
+		t.Errorf("confirmation lacks the link:\n%s\n%s", html, ics)
+	}
+
+	w := do("GET", "/scheduler/admin/bookings", "")
+	var resp models.AdminBookingsResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Bookings) != 1 || resp.Bookings[0].MeetingURL != link {
+		t.Errorf("listing = %+v", resp.Bookings)
+	}
+}
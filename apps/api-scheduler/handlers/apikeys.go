@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/middleware"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+)
+
+// ListAPIKeys lists every admin's keys, so any admin can revoke a leaked one.
+func (h *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.admins.APIKeys(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing API keys", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.APIKeysResponse{Success: true, APIKeys: keys})
+}
+
+// CreateAPIKey mints a key acting as the signed-in admin. The key is in this
+// response only.
+func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateAPIKeyRequest
+	if e := apierror.Decode(w, r, 4*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	v := apierror.Validation()
+	if req.Name == "" {
+		v.Required("name")
+	} else if len(req.Name) > 100 {
+		v.TooLong("name", 100)
+	}
+	if len(req.Scopes) == 0 {
+		v.Required("scopes")
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := map[string]bool{}
+	for _, s := range req.Scopes {
+		if !services.ValidScope(s) {
+			v.OneOf("scopes", services.Scopes...)
+			break
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	var expiresAt time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		switch {
+		case err != nil:
+			v.Format("expiresAt", "RFC 3339")
+		case !t.After(time.Now()):
+			v.Invalid("expiresAt")
+		default:
+			expiresAt = t
+		}
+	}
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
+		return
+	}
+
+	key, k, err := h.admins.CreateAPIKey(r.Context(), middleware.Admin(r.Context()), req.Name, scopes, expiresAt)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "creating API key", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	slog.InfoContext(r.Context(), "API key created", "key", k.Prefix, "scopes", scopes)
+	services.Audit(r.Context(), h.db, auditEntry(r, "apikey.create", k.Prefix, strings.Join(scopes, " ")))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.APIKeyCreatedResponse{Success: true, Key: key, APIKey: *k})
+}
+
+// RevokeAPIKey stops a key from working. It stays listed with revokedAt.
+func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
+		return
+	}
+	if err := h.admins.RevokeAPIKey(r.Context(), id); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			apierror.Write(w, r, "", apierror.New(apierror.NotFound))
+			return
+		}
+		slog.ErrorContext(r.Context(), "revoking API key", "id", id, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	slog.InfoContext(r.Context(), "API key revoked", "id", id)
+	services.Audit(r.Context(), h.db, auditEntry(r, "apikey.revoke", strconv.FormatInt(id, 10), ""))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
@@ -1,17 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/i18n"
+	"github.com/joledev/api-scheduler/metrics"
+	"github.com/joledev/api-scheduler/middleware"
 	"github.com/joledev/api-scheduler/models"
 	"github.com/joledev/api-scheduler/services"
 )
@@ -19,6 +28,7 @@ import (
 var emailRegex = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
 var dateRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
 var timeRegex = regexp.MustCompile(`^\d{2}:\d{2}$`)
+var postalCodeRegex = regexp.MustCompile(`^\d{5}$`)
 
 // Rate limiter: max 10 requests per IP per hour
 type rateLimiter struct {
@@ -60,125 +70,123 @@ func getClientIP(r *http.Request) string {
 }
 
 type BookingHandler struct {
-	db *sql.DB
+	db           *sql.DB
+	outbox       *services.Outbox
+	turnstile    *services.Turnstile
+	actions      *services.ActionTokens
+	waitlist     *services.Waitlist
+	meetings     services.MeetingLinks
+	stats        *services.Stats
+	availability *services.Availability
+	serviceArea  config.ServiceArea
+	contactEmail string
+	baseURL      string
 }
 
-func NewBookingHandler(db *sql.DB) *BookingHandler {
-	return &BookingHandler{db: db}
+// NewBookingHandler returns the booking handlers. meetings may be nil, in
+// which case videollamada bookings get no link.
+func NewBookingHandler(db *sql.DB, outbox *services.Outbox, actions *services.ActionTokens, waitlist *services.Waitlist, meetings services.MeetingLinks, cfg *config.Config) *BookingHandler {
+	return &BookingHandler{
+		db:           db,
+		outbox:       outbox,
+		turnstile:    services.NewTurnstile(cfg.TurnstileSecret),
+		actions:      actions,
+		waitlist:     waitlist,
+		meetings:     meetings,
+		stats:        services.NewStats(db, cfg.StatsTTL),
+		availability: services.NewAvailability(cfg.Location(), cfg.BookingLimits),
+		serviceArea:  cfg.ServiceArea,
+		contactEmail: cfg.ContactEmail,
+		baseURL:      cfg.APIBaseURL,
+	}
 }
 
 // CreateBooking creates a new booking request (public). Status starts as "pending".
 func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 	ip := getClientIP(r)
 	if !limiter.allow(ip, 10) {
-		http.Error(w, `{"success":false,"message":"Too many requests. Please try again later."}`, http.StatusTooManyRequests)
+		slog.WarnContext(r.Context(), "rate limit exceeded", "ip", ip)
+		metrics.RateLimited.WithLabelValues("create_booking").Inc()
+		apierror.Write(w, r, "", apierror.New(apierror.RateLimited))
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 64*1024) // 64KB max
-
 	var req models.BookingRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"success":false,"message":"Invalid request body"}`, http.StatusBadRequest)
+	if e := apierror.Decode(w, r, 64*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
 		return
 	}
 
 	// Verify Turnstile CAPTCHA
-	if err := services.VerifyTurnstile(req.TurnstileToken, ip); err != nil {
-		http.Error(w, `{"success":false,"message":"`+err.Error()+`"}`, http.StatusForbidden)
+	if err := h.turnstile.Verify(req.TurnstileToken, ip); err != nil {
+		slog.WarnContext(r.Context(), "captcha verification failed", "ip", ip, "err", err)
+		metrics.TurnstileFailures.Inc()
+		code := apierror.CaptchaFailed
+		if errors.Is(err, services.ErrCaptchaRequired) {
+			code = apierror.CaptchaRequired
+		}
+		apierror.Write(w, r, req.Lang, apierror.New(code))
 		return
 	}
 
-	// Validate required fields
-	clientName := strings.TrimSpace(req.ClientName)
-	if clientName == "" || len(clientName) > 200 {
-		http.Error(w, `{"success":false,"message":"Name is required (max 200 chars)"}`, http.StatusBadRequest)
-		return
-	}
-	if !emailRegex.MatchString(strings.TrimSpace(req.ClientEmail)) || len(req.ClientEmail) > 254 {
-		http.Error(w, `{"success":false,"message":"Valid email is required"}`, http.StatusBadRequest)
-		return
-	}
-	if req.MeetingType != "presencial" && req.MeetingType != "videollamada" {
-		http.Error(w, `{"success":false,"message":"meetingType must be 'presencial' or 'videollamada'"}`, http.StatusBadRequest)
-		return
-	}
-	if !dateRegex.MatchString(req.Date) {
-		http.Error(w, `{"success":false,"message":"date must be YYYY-MM-DD format"}`, http.StatusBadRequest)
+	// Validate fields, reporting every problem at once
+	v := validateBookingRequest(&req)
+	h.requireAddress(v, req.MeetingType, req.Address, false)
+	if !v.Empty() {
+		apierror.Write(w, r, req.Lang, v)
 		return
 	}
-	if !timeRegex.MatchString(req.StartTime) {
-		http.Error(w, `{"success":false,"message":"startTime must be HH:MM format"}`, http.StatusBadRequest)
-		return
-	}
-	if len(req.ClientPhone) > 30 || len(req.ClientCompany) > 200 || len(req.ClientAddress) > 500 || len(req.Notes) > 2000 {
-		http.Error(w, `{"success":false,"message":"Field too long"}`, http.StatusBadRequest)
+	// Stored with the booking so later emails use the same language.
+	req.Lang = i18n.FromRequest(r, req.Lang)
+
+	zone, buffer, inArea := h.locate(req.MeetingType, req.Address)
+	if !inArea {
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.OutsideServiceArea))
 		return
 	}
-	if req.Lang != "es" && req.Lang != "en" {
-		req.Lang = "es"
+	if req.Address != nil && req.ClientAddress == "" {
+		req.ClientAddress = req.Address.String()
 	}
 
 	clientEmail := strings.TrimSpace(req.ClientEmail)
 
-	// Compute endTime = startTime + 30min
-	endTime := addMinutes(req.StartTime, 30)
+	endTime := h.availability.EndTime(req.Date, req.StartTime)
 
 	// Check one active booking per email
-	todayStr := time.Now().Format("2006-01-02")
+	todayStr := h.availability.Today()
 	var activeCount int
+	done := metrics.TimeQuery("count_active_bookings_by_email")
 	err := h.db.QueryRow(
 		`SELECT COUNT(*) FROM bookings WHERE client_email = ? AND status IN ('pending', 'confirmed') AND date >= ?`,
 		clientEmail, todayStr).Scan(&activeCount)
+	done()
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "counting active bookings", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
 		return
 	}
 	if activeCount > 0 {
-		msg := "Ya tienes una solicitud de reunión activa. Espera a que sea procesada o cancelada antes de agendar otra."
-		if req.Lang == "en" {
-			msg = "You already have an active meeting request. Wait for it to be processed or cancelled before scheduling another."
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(models.BookingResponse{Success: false, Message: msg})
-		return
-	}
-
-	// Generate tokens
-	confirmToken, err := services.GenerateToken()
-	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
-		return
-	}
-	rejectToken, err := services.GenerateToken()
-	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.ActiveBookingExists))
 		return
 	}
 
 	// BEGIN IMMEDIATE transaction for atomicity
 	tx, err := h.db.Begin()
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
 		return
 	}
 	defer tx.Rollback()
 
 	// Re-verify availability inside transaction
-	available, err := services.IsSlotAvailable(tx, req.Date, req.StartTime)
+	available, err := h.availability.IsSlotAvailable(tx, req.Date, req.StartTime, buffer)
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "checking slot availability", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
 		return
 	}
 	if !available {
-		msg := "Este horario ya no está disponible. Por favor selecciona otro."
-		if req.Lang == "en" {
-			msg = "This time slot is no longer available. Please select another."
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(models.BookingResponse{Success: false, Message: msg})
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.SlotTaken))
 		return
 	}
 
@@ -186,23 +194,52 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 	bookingID := h.generateBookingID(tx)
 
 	// Insert booking
-	_, err = tx.Exec(
+	addr := addressOf(req.Address)
+	done = metrics.TimeQuery("insert_booking")
+	res, err := tx.Exec(
 		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
 		 client_name, client_email, client_phone, client_company, client_address,
-		 client_timezone, notes, lang, status, confirm_token, reject_token)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?, ?)`,
+		 address_street, address_city, address_state, address_postal_code,
+		 service_zone, buffer_minutes, client_timezone, notes, lang, status)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+		 NULLIF(?, ''), ?, ?, ?, ?, 'pending')`,
 		bookingID, req.Date, req.StartTime, endTime, req.MeetingType,
 		strings.TrimSpace(req.ClientName), clientEmail,
 		req.ClientPhone, req.ClientCompany, req.ClientAddress,
-		req.ClientTimezone, req.Notes, req.Lang,
-		confirmToken, rejectToken)
+		addr.Street, addr.City, addr.State, addr.PostalCode,
+		zoneName(zone), int(buffer/time.Minute), req.ClientTimezone, req.Notes, req.Lang)
+	done()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "saving booking", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
+		return
+	}
+
+	// Links for the admin email; only their hashes are stored.
+	rowID, _ := res.LastInsertId()
+	confirmToken, err := h.actions.Issue(r.Context(), tx, rowID, services.ActionConfirm)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "issuing confirm token", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
+		return
+	}
+	rejectToken, err := h.actions.Issue(r.Context(), tx, rowID, services.ActionReject)
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "issuing reject token", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
+		return
+	}
+	if err := services.RecordBookingEvent(r.Context(), tx, services.BookingEvent{
+		BookingID: rowID, To: services.StatusPending, Actor: "client",
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "recording booking event", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
 		return
 	}
 
 	if err := tx.Commit(); err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "committing booking", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
 		return
 	}
 
@@ -226,44 +263,162 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		RejectToken:    rejectToken,
 	}
 
-	// Send emails asynchronously
-	go func() {
-		if err := services.SendAdminPendingNotification(booking); err != nil {
-			log.Printf("Error sending admin pending notification: %v", err)
-		}
-		if err := services.SendClientPendingNotification(booking); err != nil {
-			log.Printf("Error sending client pending notification: %v", err)
-		}
-	}()
+	slog.InfoContext(r.Context(), "booking created", "booking_id", bookingID,
+		"date", req.Date, "start_time", req.StartTime, "meeting_type", req.MeetingType)
+	metrics.BookingTransitions.WithLabelValues("new", "pending").Inc()
 
-	msg := "Tu solicitud de reunión ha sido recibida. Te notificaremos cuando sea confirmada."
-	if req.Lang == "en" {
-		msg = "Your meeting request has been received. We'll notify you when it's confirmed."
-	}
+	// Send emails asynchronously; the detached context keeps the request ID.
+	h.outbox.Enqueue(context.WithoutCancel(r.Context()),
+		services.AdminPendingEmail(booking, h.contactEmail, h.baseURL),
+		services.ClientPendingEmail(booking))
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", req.Lang)
 	json.NewEncoder(w).Encode(models.BookingResponse{
 		Success:   true,
 		BookingID: bookingID,
-		Message:   msg,
+		Message:   i18n.T(req.Lang, "booking.created"),
 	})
 }
 
+// validateBookingRequest checks a booking's fields, reporting every problem
+// at once.
+func validateBookingRequest(req *models.BookingRequest) *apierror.Error {
+	v := apierror.Validation()
+	validateClient(v, req, func() {
+		if !dateRegex.MatchString(req.Date) {
+			v.Format("date", "YYYY-MM-DD")
+		}
+		if !timeRegex.MatchString(req.StartTime) {
+			v.Format("startTime", "HH:MM")
+		}
+	})
+	return v
+}
+
+// validateClient checks the client and meeting fields of req, adding
+// problems to v. when checks the date and time; it runs after the meeting
+// type so problems are reported in the order of the form.
+func validateClient(v *apierror.Error, req *models.BookingRequest, when func()) {
+	clientName := strings.TrimSpace(req.ClientName)
+	if clientName == "" {
+		v.Required("clientName")
+	} else if len(clientName) > 200 {
+		v.TooLong("clientName", 200)
+	}
+	if email := strings.TrimSpace(req.ClientEmail); email == "" {
+		v.Required("clientEmail")
+	} else if !emailRegex.MatchString(email) || len(email) > 254 {
+		v.Invalid("clientEmail")
+	}
+	if req.MeetingType != "presencial" && req.MeetingType != "videollamada" {
+		v.OneOf("meetingType", "presencial", "videollamada")
+	}
+	when()
+	if req.ClientTimezone != "" {
+		if _, err := services.ClientLocation(req.ClientTimezone); err != nil {
+			v.Invalid("clientTimezone")
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"clientPhone", req.ClientPhone, 30},
+		{"clientCompany", req.ClientCompany, 200},
+		{"clientAddress", req.ClientAddress, 500},
+		{"notes", req.Notes, 2000},
+	} {
+		if len(f.value) > f.max {
+			v.TooLong(f.name, f.max)
+		}
+	}
+	if req.Address != nil {
+		a := addressOf(req.Address)
+		if a.Street == "" {
+			v.Required("address.street")
+		} else if len(a.Street) > 200 {
+			v.TooLong("address.street", 200)
+		}
+		if a.City == "" {
+			v.Required("address.city")
+		} else if len(a.City) > 100 {
+			v.TooLong("address.city", 100)
+		}
+		if len(a.State) > 100 {
+			v.TooLong("address.state", 100)
+		}
+		if a.PostalCode != "" && !postalCodeRegex.MatchString(a.PostalCode) {
+			v.Format("address.postalCode", "NNNNN")
+		}
+	}
+}
+
+// requireAddress flags a presencial booking without an address when there
+// is a service area to check it against, unless override.
+func (h *BookingHandler) requireAddress(v *apierror.Error, meetingType string, addr *models.Address, override bool) {
+	if meetingType == "presencial" && addr == nil && len(h.serviceArea.Zones) > 0 && !override {
+		v.Required("address")
+	}
+}
+
+// locate returns the service area zone of a presencial booking and the
+// buffer to keep around the booking: the zone's travel buffer, or
+// services.DefaultBuffer for videollamadas and when no zone applies.
+// inArea is false for an address outside a configured service area.
+func (h *BookingHandler) locate(meetingType string, addr *models.Address) (zone *config.Zone, buffer time.Duration, inArea bool) {
+	if meetingType != "presencial" || len(h.serviceArea.Zones) == 0 {
+		return nil, services.DefaultBuffer, true
+	}
+	if addr != nil {
+		zone = services.FindZone(h.serviceArea, *addr)
+	}
+	if zone == nil {
+		return nil, services.DefaultBuffer, false
+	}
+	return zone, zone.TravelBuffer, true
+}
+
+// addressOf returns *a with its fields trimmed, or the empty address when a
+// is nil.
+func addressOf(a *models.Address) models.Address {
+	if a == nil {
+		return models.Address{}
+	}
+	return models.Address{
+		Street:     strings.TrimSpace(a.Street),
+		City:       strings.TrimSpace(a.City),
+		State:      strings.TrimSpace(a.State),
+		PostalCode: strings.TrimSpace(a.PostalCode),
+	}
+}
+
+func zoneName(z *config.Zone) string {
+	if z == nil {
+		return ""
+	}
+	return z.Name
+}
+
 // GetBooking returns booking details by public ID
 func (h *BookingHandler) GetBooking(w http.ResponseWriter, r *http.Request) {
 	ip := getClientIP(r)
 	if !limiter.allow(ip, 10) {
-		http.Error(w, `{"success":false,"message":"Too many requests"}`, http.StatusTooManyRequests)
+		slog.WarnContext(r.Context(), "rate limit exceeded", "ip", ip)
+		metrics.RateLimited.WithLabelValues("get_booking").Inc()
+		apierror.Write(w, r, "", apierror.New(apierror.RateLimited))
 		return
 	}
 
 	bookingID := chi.URLParam(r, "bookingId")
 	if bookingID == "" {
-		http.Error(w, `{"success":false,"message":"Booking ID required"}`, http.StatusBadRequest)
+		apierror.Write(w, r, "", apierror.Validation().Required("bookingId"))
 		return
 	}
 
 	var b models.Booking
+	done := metrics.TimeQuery("get_booking_by_id")
 	err := h.db.QueryRow(
 		`SELECT id, booking_id, date, start_time, end_time, meeting_type,
 		        client_name, client_email, client_phone, client_company, client_address,
@@ -272,12 +427,14 @@ func (h *BookingHandler) GetBooking(w http.ResponseWriter, r *http.Request) {
 		&b.ID, &b.BookingID, &b.Date, &b.StartTime, &b.EndTime, &b.MeetingType,
 		&b.ClientName, &b.ClientEmail, &b.ClientPhone, &b.ClientCompany, &b.ClientAddress,
 		&b.ClientTimezone, &b.Notes, &b.Lang, &b.Status, &b.CreatedAt)
+	done()
 	if err == sql.ErrNoRows {
-		http.Error(w, `{"success":false,"message":"Booking not found"}`, http.StatusNotFound)
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
 		return
 	}
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "loading booking", "booking_id", bookingID, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
 		return
 	}
 
@@ -285,220 +442,500 @@ func (h *BookingHandler) GetBooking(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(b)
 }
 
-// ConfirmBooking confirms a booking via token (admin clicks link in email)
+// ConfirmBooking serves the Confirm link in the admin email: GET shows the
+// booking with a button, which POSTs the token back to confirm it.
 func (h *BookingHandler) ConfirmBooking(w http.ResponseWriter, r *http.Request) {
+	h.bookingAction(w, r, services.ActionConfirm)
+}
+
+// RejectBooking serves the Reject link in the admin email, like ConfirmBooking.
+func (h *BookingHandler) RejectBooking(w http.ResponseWriter, r *http.Request) {
+	h.bookingAction(w, r, services.ActionReject)
+}
+
+// bookingAction handles both email links. Mail scanners fetch links to check
+// them, so GET only describes what the button will do; the POST spends the
+// token and changes the booking.
+func (h *BookingHandler) bookingAction(w http.ResponseWriter, r *http.Request, action string) {
+	// The token is in the URL: keep it out of caches and Referer headers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	// The admin inbox is in Spanish, but the page follows their browser.
+	lang := i18n.FromRequest(r, "")
 	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+		token = r.PostFormValue("token")
+	}
 	if token == "" {
-		h.renderTokenPage(w, "error", "Token is required", "")
+		h.renderTokenPage(w, lang, "error", i18n.T(lang, "action.missing"), "")
 		return
 	}
 
-	var b models.Booking
-	err := h.db.QueryRow(
-		`SELECT id, booking_id, date, start_time, end_time, meeting_type,
-		        client_name, client_email, COALESCE(client_phone, ''), COALESCE(client_company, ''),
-		        COALESCE(client_address, ''), COALESCE(client_timezone, ''), COALESCE(notes, ''),
-		        COALESCE(lang, 'es'), status
-		 FROM bookings WHERE confirm_token = ?`, token).Scan(
-		&b.ID, &b.BookingID, &b.Date, &b.StartTime, &b.EndTime, &b.MeetingType,
-		&b.ClientName, &b.ClientEmail, &b.ClientPhone, &b.ClientCompany, &b.ClientAddress,
-		&b.ClientTimezone, &b.Notes, &b.Lang, &b.Status)
-	if err == sql.ErrNoRows {
-		h.renderTokenPage(w, "error", "Invalid or expired token", "")
+	if r.Method != http.MethodPost {
+		id, err := h.actions.Check(r.Context(), token, action)
+		if err != nil {
+			h.renderTokenError(w, r, lang, err)
+			return
+		}
+		b, err := bookingByID(r.Context(), h.db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "loading booking by token", "err", err)
+			h.renderTokenPage(w, lang, "error", i18n.T(lang, "action.error"), "")
+			return
+		}
+		if b.Status != "pending" {
+			h.renderAlready(w, lang, b)
+			return
+		}
+		h.renderActionPage(w, lang, action, token, b)
 		return
 	}
+
+	to := map[string]string{services.ActionConfirm: services.StatusConfirmed, services.ActionReject: services.StatusRejected}[action]
+	tx, err := h.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		h.renderTokenPage(w, "error", "Internal error", "")
+		slog.ErrorContext(r.Context(), "starting transaction", "err", err)
+		h.renderTokenPage(w, lang, "error", i18n.T(lang, "action.error"), "")
 		return
 	}
+	defer tx.Rollback()
 
-	if b.Status != "pending" {
-		h.renderTokenPage(w, "info", fmt.Sprintf("This booking is already %s", b.Status), b.BookingID)
+	id, err := h.actions.Use(r.Context(), tx, token, action)
+	if err != nil {
+		h.renderTokenError(w, r, lang, err)
 		return
 	}
-
-	_, err = h.db.Exec(`UPDATE bookings SET status = 'confirmed' WHERE id = ?`, b.ID)
+	b, err := bookingByID(r.Context(), tx, id)
 	if err != nil {
-		h.renderTokenPage(w, "error", "Failed to confirm booking", "")
+		slog.ErrorContext(r.Context(), "loading booking by token", "err", err)
+		h.renderTokenPage(w, lang, "error", i18n.T(lang, "action.error"), "")
 		return
 	}
-
-	// Send confirmation email to client
-	go func() {
-		if err := services.SendBookingConfirmation(&b); err != nil {
-			log.Printf("Error sending confirmation email: %v", err)
-		}
-	}()
-
-	h.renderTokenPage(w, "confirmed", fmt.Sprintf("Booking %s confirmed!", b.BookingID),
-		fmt.Sprintf("%s — %s %s", b.ClientName, b.Date, b.StartTime))
-}
-
-// RejectBooking rejects a booking via token (admin clicks link in email)
-func (h *BookingHandler) RejectBooking(w http.ResponseWriter, r *http.Request) {
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		h.renderTokenPage(w, "error", "Token is required", "")
+	if b.Status != "pending" {
+		h.renderAlready(w, lang, b)
 		return
 	}
 
-	var b models.Booking
-	err := h.db.QueryRow(
-		`SELECT id, booking_id, date, start_time, end_time, meeting_type,
-		        client_name, client_email, COALESCE(client_phone, ''), COALESCE(client_company, ''),
-		        COALESCE(client_address, ''), COALESCE(client_timezone, ''), COALESCE(notes, ''),
-		        COALESCE(lang, 'es'), status
-		 FROM bookings WHERE reject_token = ?`, token).Scan(
-		&b.ID, &b.BookingID, &b.Date, &b.StartTime, &b.EndTime, &b.MeetingType,
-		&b.ClientName, &b.ClientEmail, &b.ClientPhone, &b.ClientCompany, &b.ClientAddress,
-		&b.ClientTimezone, &b.Notes, &b.Lang, &b.Status)
-	if err == sql.ErrNoRows {
-		h.renderTokenPage(w, "error", "Invalid or expired token", "")
-		return
+	done := metrics.TimeQuery("update_booking_status")
+	_, err = tx.ExecContext(r.Context(), `UPDATE bookings SET status = ?, status_reason = NULL WHERE id = ?`, to, b.ID)
+	done()
+	if err == nil {
+		err = services.RecordBookingEvent(r.Context(), tx, services.BookingEvent{
+			BookingID: int64(b.ID), From: b.Status, To: to, Actor: "email-link",
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
 	}
 	if err != nil {
-		h.renderTokenPage(w, "error", "Internal error", "")
+		slog.ErrorContext(r.Context(), "updating booking status", "booking_id", b.BookingID, "status", to, "err", err)
+		h.renderTokenPage(w, lang, "error", i18n.T(lang, "action."+action+".failed"), "")
 		return
 	}
 
-	if b.Status != "pending" {
-		h.renderTokenPage(w, "info", fmt.Sprintf("This booking is already %s", b.Status), b.BookingID)
-		return
+	slog.InfoContext(r.Context(), "booking "+to, "booking_id", b.BookingID)
+	h.auditEmailLink(r, "booking."+action, b.BookingID)
+	metrics.BookingTransitions.WithLabelValues(b.Status, to).Inc()
+
+	var email services.Email
+	if action == services.ActionConfirm {
+		h.addMeetingLink(r.Context(), b)
+		email = services.BookingConfirmationEmail(b)
+	} else {
+		email = services.BookingRejectionEmail(b)
+	}
+	h.outbox.Enqueue(context.WithoutCancel(r.Context()), email)
+	if to == services.StatusRejected {
+		h.offerSlot(context.WithoutCancel(r.Context()), b.Date, b.StartTime)
 	}
 
-	_, err = h.db.Exec(`UPDATE bookings SET status = 'rejected' WHERE id = ?`, b.ID)
-	if err != nil {
-		h.renderTokenPage(w, "error", "Failed to reject booking", "")
-		return
+	h.renderTokenPage(w, lang, to, i18n.T(lang, "action."+action+".done", "id", b.BookingID), bookingSummary(lang, b))
+}
+
+// renderTokenError explains, in lang, why an email link cannot be used.
+func (h *BookingHandler) renderTokenError(w http.ResponseWriter, r *http.Request, lang string, err error) {
+	switch {
+	case errors.Is(err, services.ErrActionTokenInvalid):
+		h.renderTokenPage(w, lang, "error", i18n.T(lang, "action.invalid"), "")
+	case errors.Is(err, services.ErrActionTokenUsed):
+		h.renderTokenPage(w, lang, "info", i18n.T(lang, "action.used"), "")
+	case errors.Is(err, services.ErrActionTokenExpired):
+		h.renderTokenPage(w, lang, "error", i18n.T(lang, "action.expired"), i18n.T(lang, "action.expired_detail"))
+	default:
+		slog.ErrorContext(r.Context(), "checking action token", "err", err)
+		h.renderTokenPage(w, lang, "error", i18n.T(lang, "action.error"), "")
 	}
+}
 
-	// Send rejection email to client
-	go func() {
-		if err := services.SendBookingRejection(&b); err != nil {
-			log.Printf("Error sending rejection email: %v", err)
-		}
-	}()
+// renderAlready says booking b was already confirmed, rejected or the like.
+func (h *BookingHandler) renderAlready(w http.ResponseWriter, lang string, b *models.Booking) {
+	status := strings.ToLower(i18n.T(lang, "status."+b.Status))
+	h.renderTokenPage(w, lang, "info", i18n.T(lang, "action.already", "status", status), b.BookingID)
+}
+
+// Admin listing page sizes.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
 
-	h.renderTokenPage(w, "rejected", fmt.Sprintf("Booking %s rejected.", b.BookingID),
-		fmt.Sprintf("%s — %s %s", b.ClientName, b.Date, b.StartTime))
+// bookingQuery reads the admin listing's filters and sort from r's query.
+func bookingQuery(r *http.Request) (services.BookingQuery, *apierror.Error) {
+	query := r.URL.Query()
+	q := services.BookingQuery{
+		From:        query.Get("from"),
+		To:          query.Get("to"),
+		MeetingType: query.Get("meetingType"),
+		Email:       strings.TrimSpace(query.Get("email")),
+		Text:        strings.TrimSpace(query.Get("q")),
+		Sort:        query.Get("sort"),
+	}
+
+	v := apierror.Validation()
+	if q.From != "" && !dateRegex.MatchString(q.From) {
+		v.Format("from", "YYYY-MM-DD")
+	}
+	if q.To != "" && !dateRegex.MatchString(q.To) {
+		v.Format("to", "YYYY-MM-DD")
+	}
+	if status := query.Get("status"); status != "" {
+		q.Statuses = strings.Split(status, ",")
+		for _, s := range q.Statuses {
+			if !services.ValidStatus(s) {
+				v.OneOf("status", services.Statuses...)
+				break
+			}
+		}
+	}
+	if q.MeetingType != "" && q.MeetingType != "presencial" && q.MeetingType != "videollamada" {
+		v.OneOf("meetingType", "presencial", "videollamada")
+	}
+	if q.Sort != "" && !services.ValidBookingSort(q.Sort) {
+		v.OneOf("sort", services.BookingSorts...)
+	}
+	return q, v
 }
 
-// GetAdminBookings returns all bookings in a date range (admin)
+// GetAdminBookings lists bookings for the admin panel, filtered, sorted and
+// a page at a time (admin). Without from and to it covers every date.
 func (h *BookingHandler) GetAdminBookings(w http.ResponseWriter, r *http.Request) {
-	from := r.URL.Query().Get("from")
-	to := r.URL.Query().Get("to")
-
-	if !dateRegex.MatchString(from) || !dateRegex.MatchString(to) {
-		http.Error(w, `{"success":false,"message":"from and to must be YYYY-MM-DD format"}`, http.StatusBadRequest)
+	q, v := bookingQuery(r)
+	q.Limit, q.Cursor = defaultPageSize, r.URL.Query().Get("cursor")
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageSize {
+			v.Invalid("limit")
+		}
+		q.Limit = n
+	}
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
 		return
 	}
 
-	rows, err := h.db.Query(
-		`SELECT id, booking_id, date, start_time, end_time, meeting_type,
-		        client_name, client_email, client_phone, client_company, client_address,
-		        COALESCE(client_timezone, ''), notes, lang, status, created_at
-		 FROM bookings WHERE date >= ? AND date <= ?
-		 ORDER BY date, start_time`, from, to)
-	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+	bookings, total, next, err := services.SearchBookings(r.Context(), h.db, q)
+	if errors.Is(err, services.ErrInvalidCursor) {
+		apierror.Write(w, r, "", apierror.Validation().Invalid("cursor"))
 		return
 	}
-	defer rows.Close()
-
-	bookings := []models.AdminBooking{}
-	for rows.Next() {
-		var b models.AdminBooking
-		if err := rows.Scan(
-			&b.ID, &b.BookingID, &b.Date, &b.StartTime, &b.EndTime, &b.MeetingType,
-			&b.ClientName, &b.ClientEmail, &b.ClientPhone, &b.ClientCompany, &b.ClientAddress,
-			&b.ClientTimezone, &b.Notes, &b.Lang, &b.Status, &b.CreatedAt,
-		); err != nil {
-			continue
-		}
-		bookings = append(bookings, b)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing bookings", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.AdminBookingsResponse{Bookings: bookings})
+	json.NewEncoder(w).Encode(models.AdminBookingsResponse{Bookings: bookings, Total: total, NextCursor: next})
 }
 
-// CancelBooking cancels a booking (admin)
-func (h *BookingHandler) CancelBooking(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
+// statusActions names each status change in admin_audit_log and the reply.
+var statusActions = map[string]struct{ action, message string }{
+	services.StatusConfirmed: {"booking.confirm", "Booking confirmed"},
+	services.StatusRejected:  {"booking.reject", "Booking rejected"},
+	services.StatusCancelled: {"booking.cancel", "Booking cancelled"},
+	services.StatusCompleted: {"booking.complete", "Booking marked as completed"},
+	services.StatusNoShow:    {"booking.no_show", "Booking marked as no-show"},
+}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 4*1024) // 4KB max
+// UpdateBooking moves a booking to another status, following the allowed
+// transitions, and/or adds an internal note to its history (admin). The
+// client is emailed when the booking is confirmed, rejected or cancelled,
+// with the reason if one is given. The slot of a rejected or cancelled
+// booking is offered to the waitlist.
+func (h *BookingHandler) UpdateBooking(w http.ResponseWriter, r *http.Request) {
+	var req models.BookingStatusUpdate
+	if e := apierror.Decode(w, r, 8*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Note = strings.TrimSpace(req.Note)
 
-	var status struct {
-		Status string `json:"status"`
+	v := apierror.Validation()
+	switch {
+	case req.Status == "" && req.Note == "":
+		v.Required("status")
+	case req.Status != "" && statusActions[req.Status].action == "":
+		v.OneOf("status", services.StatusConfirmed, services.StatusRejected, services.StatusCancelled,
+			services.StatusCompleted, services.StatusNoShow)
+	}
+	if req.Reason != "" && req.Status == "" {
+		v.Invalid("reason")
+	} else if len(req.Reason) > 500 {
+		v.TooLong("reason", 500)
+	}
+	if len(req.Note) > 2000 {
+		v.TooLong("note", 2000)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&status); err != nil || status.Status != "cancelled" {
-		http.Error(w, `{"success":false,"message":"Status must be 'cancelled'"}`, http.StatusBadRequest)
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
 		return
 	}
 
-	var b models.Booking
-	err := h.db.QueryRow(
-		`SELECT id, booking_id, date, start_time, end_time, meeting_type,
-		        client_name, client_email, COALESCE(client_phone, ''), COALESCE(client_company, ''),
-		        COALESCE(client_address, ''), COALESCE(client_timezone, ''), COALESCE(notes, ''),
-		        COALESCE(lang, 'es'), status
-		 FROM bookings WHERE id = ?`, idStr).Scan(
-		&b.ID, &b.BookingID, &b.Date, &b.StartTime, &b.EndTime, &b.MeetingType,
-		&b.ClientName, &b.ClientEmail, &b.ClientPhone, &b.ClientCompany, &b.ClientAddress,
-		&b.ClientTimezone, &b.Notes, &b.Lang, &b.Status)
-	if err == sql.ErrNoRows {
-		http.Error(w, `{"success":false,"message":"Booking not found"}`, http.StatusNotFound)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
 		return
 	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "starting transaction", "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
 		return
 	}
+	defer tx.Rollback()
 
-	if b.Status == "cancelled" {
-		http.Error(w, `{"success":false,"message":"Booking already cancelled"}`, http.StatusConflict)
+	b, err := bookingByID(r.Context(), tx, id)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
 		return
 	}
-
-	_, err = h.db.Exec(`UPDATE bookings SET status = 'cancelled' WHERE id = ?`, idStr)
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "loading booking", "id", id, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
 		return
 	}
 
-	// Send cancellation email
-	go func() {
-		if err := services.SendBookingCancellation(&b); err != nil {
-			log.Printf("Error sending cancellation email: %v", err)
+	from := b.Status
+	if req.Status != "" && !services.CanTransition(from, req.Status) {
+		code := apierror.InvalidTransition
+		if from == services.StatusCancelled && req.Status == services.StatusCancelled {
+			code = apierror.AlreadyCancelled
 		}
-	}()
+		apierror.Write(w, r, "", apierror.New(code))
+		return
+	}
+
+	admin := middleware.Admin(r.Context())
+	if req.Status != "" {
+		done := metrics.TimeQuery("update_booking_status")
+		_, err = tx.ExecContext(r.Context(),
+			`UPDATE bookings SET status = ?, status_reason = ? WHERE id = ?`, req.Status, req.Reason, id)
+		done()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "updating booking status", "booking_id", b.BookingID, "err", err)
+			apierror.Write(w, r, "", apierror.New(apierror.Internal))
+			return
+		}
+		b.Status, b.StatusReason = req.Status, req.Reason
+	}
+	if from == services.StatusHeld && req.Status != "" {
+		if err := h.waitlist.Lapse(r.Context(), tx, id); err != nil {
+			slog.ErrorContext(r.Context(), "lapsing waitlist hold", "booking_id", b.BookingID, "err", err)
+			apierror.Write(w, r, "", apierror.New(apierror.Internal))
+			return
+		}
+	}
+	event := services.BookingEvent{
+		BookingID: id,
+		To:        req.Status,
+		Reason:    req.Reason,
+		Note:      req.Note,
+		User:      admin,
+		APIKey:    middleware.APIKey(r.Context()),
+	}
+	if req.Status != "" {
+		event.From = from
+	}
+	if err := services.RecordBookingEvent(r.Context(), tx, event); err != nil {
+		slog.ErrorContext(r.Context(), "recording booking event", "booking_id", b.BookingID, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "committing booking update", "booking_id", b.BookingID, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	message := "Note added"
+	if req.Status == "" {
+		slog.InfoContext(r.Context(), "booking note added", "booking_id", b.BookingID, "admin", admin.Username)
+		services.Audit(r.Context(), h.db, auditEntry(r, "booking.note", b.BookingID, ""))
+	} else {
+		sa := statusActions[req.Status]
+		message = sa.message
+		slog.InfoContext(r.Context(), "booking status changed", "booking_id", b.BookingID,
+			"from", from, "to", req.Status, "admin", admin.Username)
+		services.Audit(r.Context(), h.db, auditEntry(r, sa.action, b.BookingID, req.Reason))
+		metrics.BookingTransitions.WithLabelValues(from, req.Status).Inc()
+
+		var emails []services.Email
+		switch req.Status {
+		case services.StatusConfirmed:
+			h.addMeetingLink(r.Context(), b)
+			emails = append(emails, services.BookingConfirmationEmail(b))
+		case services.StatusRejected:
+			emails = append(emails, services.BookingRejectionEmail(b))
+		case services.StatusCancelled:
+			// A held slot was only ever offered, so there is nothing to
+			// tell the client.
+			if from != services.StatusHeld {
+				emails = append(emails, services.BookingCancellationEmail(b))
+			}
+		}
+		if len(emails) > 0 {
+			h.outbox.Enqueue(context.WithoutCancel(r.Context()), emails...)
+		}
+		if req.Status == services.StatusRejected || req.Status == services.StatusCancelled {
+			h.offerSlot(context.WithoutCancel(r.Context()), b.Date, b.StartTime)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Booking cancelled",
+	json.NewEncoder(w).Encode(models.BookingResponse{
+		Success:   true,
+		BookingID: b.BookingID,
+		Message:   message,
 	})
 }
 
+// GetBookingEvents returns a booking's status changes and internal notes,
+// oldest first (admin).
+func (h *BookingHandler) GetBookingEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
+		return
+	}
+	if _, err := bookingByID(r.Context(), h.db, id); err == sql.ErrNoRows {
+		apierror.Write(w, r, "", apierror.New(apierror.NotFound))
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "loading booking", "id", id, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	defer metrics.TimeQuery("list_booking_events")()
+	events, err := services.BookingEvents(r.Context(), h.db, id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing booking events", "id", id, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.BookingEventsResponse{Success: true, Events: events})
+}
+
+// auditEmailLink records an action taken through a link in the admin email.
+// Whoever holds the link can use it, so no account is attributed.
+func (h *BookingHandler) auditEmailLink(r *http.Request, action, bookingID string) {
+	e := auditEntry(r, action, bookingID, "")
+	e.Actor = "email-link"
+	services.Audit(r.Context(), h.db, e)
+}
+
 func (h *BookingHandler) generateBookingID(tx *sql.Tx) string {
 	year := time.Now().Year()
 	var count int
+	defer metrics.TimeQuery("count_bookings_by_year")()
 	tx.QueryRow("SELECT COUNT(*) FROM bookings WHERE booking_id LIKE ?", fmt.Sprintf("BK-%d-%%", year)).Scan(&count)
 	return fmt.Sprintf("BK-%d-%03d", year, count+1)
 }
 
-func addMinutes(timeStr string, mins int) string {
-	if len(timeStr) < 5 {
-		return timeStr
+// bookingByID loads booking id (the row ID) from q, a *sql.DB or *sql.Tx.
+func bookingByID(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, id int64) (*models.Booking, error) {
+	var b models.Booking
+	defer metrics.TimeQuery("get_booking_by_pk")()
+	err := q.QueryRowContext(ctx,
+		`SELECT id, booking_id, date, start_time, end_time, meeting_type,
+		        client_name, client_email, COALESCE(client_phone, ''), COALESCE(client_company, ''),
+		        COALESCE(client_address, ''), COALESCE(client_timezone, ''), COALESCE(notes, ''),
+		        COALESCE(lang, 'es'), status, COALESCE(meeting_url, ''), COALESCE(buffer_minutes, ?)
+		 FROM bookings WHERE id = ?`, int(services.DefaultBuffer/time.Minute), id).Scan(
+		&b.ID, &b.BookingID, &b.Date, &b.StartTime, &b.EndTime, &b.MeetingType,
+		&b.ClientName, &b.ClientEmail, &b.ClientPhone, &b.ClientCompany, &b.ClientAddress,
+		&b.ClientTimezone, &b.Notes, &b.Lang, &b.Status, &b.MeetingURL, &b.BufferMinutes)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// addMeetingLink gives a confirmed videollamada booking its video-call
+// link, unless it already has one. A provider failure is logged and the
+// booking stays without a link: the confirmation email then says it will be
+// sent separately, as it did before links were generated.
+func (h *BookingHandler) addMeetingLink(ctx context.Context, b *models.Booking) {
+	if h.meetings == nil || b.MeetingType != "videollamada" || b.MeetingURL != "" {
+		return
+	}
+	link, err := h.meetings.Link(ctx, b)
+	if err != nil {
+		slog.ErrorContext(ctx, "creating meeting link", "booking_id", b.BookingID, "err", err)
+		return
+	}
+	if _, err := h.db.ExecContext(ctx, `UPDATE bookings SET meeting_url = ? WHERE id = ?`, link, b.ID); err != nil {
+		slog.ErrorContext(ctx, "saving meeting link", "booking_id", b.BookingID, "err", err)
+		return
 	}
-	h := int(timeStr[0]-'0')*10 + int(timeStr[1]-'0')
-	m := int(timeStr[3]-'0')*10 + int(timeStr[4]-'0')
-	total := h*60 + m + mins
-	return fmt.Sprintf("%02d:%02d", total/60, total%60)
+	b.MeetingURL = link
 }
 
-// renderTokenPage renders a simple HTML page for confirm/reject token responses
-func (h *BookingHandler) renderTokenPage(w http.ResponseWriter, status, message, detail string) {
+// renderTokenPage renders a simple HTML page in lang for confirm/reject
+// token responses; message and detail are already translated.
+func (h *BookingHandler) renderTokenPage(w http.ResponseWriter, lang, status, message, detail string) {
+	detailHTML := ""
+	if detail != "" {
+		detailHTML = fmt.Sprintf(`<p style="color:#6b7280;margin-top:0.5rem;font-size:0.875rem">%s</p>`, html.EscapeString(detail))
+	}
+	writeTokenPage(w, lang, status, html.EscapeString(message), detailHTML)
+}
+
+// bookingSummary is booking b's client, date, times and meeting type in lang.
+func bookingSummary(lang string, b *models.Booking) string {
+	times := i18n.T(lang, "time.range", "start", i18n.Time(lang, b.StartTime), "end", i18n.Time(lang, b.EndTime))
+	return fmt.Sprintf("%s — %s, %s (%s)", b.ClientName, i18n.Date(lang, b.Date), times,
+		i18n.T(lang, "meeting_type."+b.MeetingType))
+}
+
+// renderActionPage shows booking b and a button that POSTs token back to
+// perform action.
+func (h *BookingHandler) renderActionPage(w http.ResponseWriter, lang, action, token string, b *models.Booking) {
+	color := "#22c55e"
+	if action == services.ActionReject {
+		color = "#ef4444"
+	}
+	body := fmt.Sprintf(`<p style="color:#6b7280;margin-top:0.5rem;font-size:0.875rem">%s</p>
+<form method="post" action="%s" style="margin-top:1.5rem">
+<input type="hidden" name="token" value="%s">
+<button type="submit" style="padding:0.75rem 1.5rem;border:0;border-radius:0.5rem;background:%s;color:#fff;font-size:1rem;cursor:pointer">%s</button>
+</form>`,
+		html.EscapeString(bookingSummary(lang, b)), action, html.EscapeString(token), color,
+		html.EscapeString(i18n.T(lang, "action."+action+".button")))
+	writeTokenPage(w, lang, "info", html.EscapeString(i18n.T(lang, "action."+action+".prompt", "id", b.BookingID)), body)
+}
+
+// writeTokenPage writes the page, in lang, around message and body, which
+// must already be HTML.
+func writeTokenPage(w http.ResponseWriter, lang, status, message, body string) {
 	var bgColor, icon string
 	switch status {
 	case "confirmed":
@@ -515,13 +952,8 @@ func (h *BookingHandler) renderTokenPage(w http.ResponseWriter, status, message,
 		icon = "&#9888;"
 	}
 
-	detailHTML := ""
-	if detail != "" {
-		detailHTML = fmt.Sprintf(`<p style="color:#6b7280;margin-top:0.5rem;font-size:0.875rem">%s</p>`, detail)
-	}
-
-	html := fmt.Sprintf(`<!DOCTYPE html>
-<html lang="en">
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html lang="%s">
 <head><meta charset="UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1">
 <title>JoleDev Scheduler</title></head>
 <body style="margin:0;min-height:100vh;display:flex;align-items:center;justify-content:center;font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,sans-serif;background:#f9fafb">
@@ -531,8 +963,8 @@ func (h *BookingHandler) renderTokenPage(w http.ResponseWriter, status, message,
 %s
 </div>
 </body>
-</html>`, bgColor, icon, message, detailHTML)
+</html>`, lang, bgColor, icon, message, body)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(html))
+	w.Write([]byte(page))
 }
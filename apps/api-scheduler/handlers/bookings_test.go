@@ -2,56 +2,106 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/metrics"
+	"github.com/joledev/api-scheduler/migrations"
 	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
+	t.Helper()
 	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		t.Fatalf("Failed to open test db: %v", err)
 	}
+	// Every connection to :memory: is a separate database, so keep one.
+	db.SetMaxOpenConns(1)
 
-	_, err = db.Exec(`CREATE TABLE bookings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		booking_id TEXT UNIQUE NOT NULL,
-		date TEXT NOT NULL,
-		start_time TEXT NOT NULL,
-		end_time TEXT NOT NULL,
-		meeting_type TEXT NOT NULL,
-		client_name TEXT NOT NULL,
-		client_email TEXT NOT NULL,
-		client_phone TEXT,
-		client_company TEXT,
-		client_address TEXT,
-		client_timezone TEXT,
-		notes TEXT,
-		lang TEXT DEFAULT 'es',
-		status TEXT DEFAULT 'pending',
-		confirm_token TEXT UNIQUE,
-		reject_token TEXT UNIQUE,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`)
+	if _, err := migrations.Up(context.Background(), db, migrations.Options{}); err != nil {
+		t.Fatalf("Failed to migrate test db: %v", err)
+	}
+	return db
+}
+
+// testConfig is the default configuration without the booking horizon, as
+// the tests book in 2037 to stay in the future.
+func testConfig() *config.Config {
+	cfg := config.Defaults()
+	cfg.BookingLimits.MaxHorizonDays = 0
+	return cfg
+}
+
+func newTestBookingHandler(db *sql.DB) *BookingHandler {
+	cfg := testConfig()
+	return NewBookingHandler(db, services.NewOutbox(db, services.NewMailer(cfg.SMTP)),
+		services.NewActionTokens(db, []byte("test-secret"), cfg.ActionTokenTTL),
+		services.NewWaitlist(db, []byte("test-secret"), cfg.WaitlistHoldTTL),
+		services.NewMeetingLinks(cfg.Meetings, []byte("test-secret")), cfg)
+}
+
+// issueActionToken creates the email link token for action on bookingID.
+func issueActionToken(t *testing.T, db *sql.DB, h *BookingHandler, bookingID, action string) string {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var id int64
+	if err := tx.QueryRow("SELECT id FROM bookings WHERE booking_id = ?", bookingID).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	token, err := h.actions.Issue(context.Background(), tx, id, action)
 	if err != nil {
-		t.Fatalf("Failed to create bookings table: %v", err)
+		t.Fatal(err)
 	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
 
-	return db
+// postActionToken submits the button on an email link's page.
+func postActionToken(handler http.HandlerFunc, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) models.ErrorResponse {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var resp models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	return resp
 }
 
 func insertBooking(t *testing.T, db *sql.DB, date, start, end, email, status string) {
 	_, err := db.Exec(
 		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
-		 client_name, client_email, status, confirm_token, reject_token)
-		 VALUES (?, ?, ?, ?, 'videollamada', 'Test', ?, ?, 'ct-test', 'rt-test')`,
+		 client_name, client_email, status)
+		 VALUES (?, ?, ?, ?, 'videollamada', 'Test', ?, ?)`,
 		"BK-2026-TEST", date, start, end, email, status)
 	if err != nil {
 		t.Fatalf("Failed to insert booking: %v", err)
@@ -62,10 +112,10 @@ func TestCreateBookingSuccess(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	// Use a far-future date to ensure it's a weekday and available
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-15", // Monday
+		Date:        "2037-06-15", // Monday
 		StartTime:   "09:00",
 		MeetingType: "videollamada",
 		ClientName:  "Test User",
@@ -99,11 +149,19 @@ func TestCreateBookingSuccess(t *testing.T) {
 		t.Errorf("Expected status 'pending', got '%s'", status)
 	}
 
-	// Verify tokens were generated
-	var confirmToken, rejectToken string
-	db.QueryRow("SELECT confirm_token, reject_token FROM bookings WHERE booking_id = ?", resp.BookingID).Scan(&confirmToken, &rejectToken)
-	if confirmToken == "" || rejectToken == "" {
-		t.Error("Expected confirm and reject tokens to be generated")
+	// Verify tokens were generated, stored only as hashes
+	var tokens int
+	db.QueryRow(`SELECT COUNT(*) FROM booking_action_tokens t JOIN bookings b ON b.id = t.booking_id
+		WHERE b.booking_id = ? AND b.confirm_token IS NULL AND b.reject_token IS NULL`, resp.BookingID).Scan(&tokens)
+	if tokens != 2 {
+		t.Errorf("Expected confirm and reject tokens to be generated, got %d", tokens)
+	}
+
+	var actor string
+	db.QueryRow(`SELECT e.actor FROM booking_events e JOIN bookings b ON b.id = e.booking_id
+		WHERE b.booking_id = ? AND e.from_status IS NULL AND e.to_status = 'pending'`, resp.BookingID).Scan(&actor)
+	if actor != "client" {
+		t.Errorf("Expected creation recorded in booking history, got actor %q", actor)
 	}
 }
 
@@ -112,11 +170,11 @@ func TestCreateBookingDuplicateEmail(t *testing.T) {
 	defer db.Close()
 
 	// Insert an existing active booking for this email
-	insertBooking(t, db, "2026-06-15", "09:00", "09:30", "test@example.com", "pending")
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "test@example.com", "pending")
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-16", // Tuesday
+		Date:        "2037-06-16", // Tuesday
 		StartTime:   "11:00",
 		MeetingType: "videollamada",
 		ClientName:  "Test User",
@@ -133,15 +191,18 @@ func TestCreateBookingDuplicateEmail(t *testing.T) {
 	if w.Code != http.StatusConflict {
 		t.Errorf("Expected 409 for duplicate email, got %d: %s", w.Code, w.Body.String())
 	}
+	if resp := decodeError(t, w); resp.Code != "ACTIVE_BOOKING_EXISTS" {
+		t.Errorf("code = %q, want ACTIVE_BOOKING_EXISTS", resp.Code)
+	}
 }
 
 func TestCreateBookingMissingEmail(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-15",
+		Date:        "2037-06-15",
 		StartTime:   "09:00",
 		MeetingType: "videollamada",
 		ClientName:  "Test User",
@@ -158,6 +219,50 @@ func TestCreateBookingMissingEmail(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected 400, got %d: %s", w.Code, w.Body.String())
 	}
+	resp := decodeError(t, w)
+	if resp.Code != "VALIDATION_FAILED" || len(resp.Details) != 1 || resp.Details[0].Field != "clientEmail" || resp.Details[0].Code != "required" {
+		t.Errorf("unexpected error response: %+v", resp)
+	}
+}
+
+func TestCreateBookingReportsAllInvalidFields(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := newTestBookingHandler(db)
+	body, _ := json.Marshal(models.BookingRequest{
+		Date:           "15/06/2037",
+		StartTime:      "9am",
+		MeetingType:    "phone",
+		ClientEmail:    "not-an-email",
+		ClientTimezone: "Mars/Olympus",
+	})
+
+	req := httptest.NewRequest("POST", "/scheduler/bookings", bytes.NewBuffer(body))
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9,es;q=0.5")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7") // own rate-limit bucket
+	w := httptest.NewRecorder()
+
+	handler.CreateBooking(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Language"); got != "en" {
+		t.Errorf("Content-Language = %q, want en", got)
+	}
+	resp := decodeError(t, w)
+	var fields []string
+	for _, d := range resp.Details {
+		fields = append(fields, d.Field+":"+d.Code)
+	}
+	want := "clientName:required clientEmail:invalid meetingType:one_of date:format startTime:format clientTimezone:invalid"
+	if got := strings.Join(fields, " "); got != want {
+		t.Errorf("details = %s, want %s", got, want)
+	}
+	if resp.Message != "Some fields are invalid." {
+		t.Errorf("message = %q, want the English summary", resp.Message)
+	}
 }
 
 func TestCreateBookingBufferBlocks(t *testing.T) {
@@ -165,12 +270,12 @@ func TestCreateBookingBufferBlocks(t *testing.T) {
 	defer db.Close()
 
 	// Insert a booking at 09:00
-	insertBooking(t, db, "2026-06-15", "09:00", "09:30", "other@example.com", "confirmed")
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "other@example.com", "confirmed")
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	// Try to book at 10:30 — should be blocked (90 min < 120 min buffer)
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-15",
+		Date:        "2037-06-15",
 		StartTime:   "10:30",
 		MeetingType: "videollamada",
 		ClientName:  "Test User",
@@ -187,6 +292,9 @@ func TestCreateBookingBufferBlocks(t *testing.T) {
 	if w.Code != http.StatusConflict {
 		t.Errorf("Expected 409 for buffer conflict, got %d: %s", w.Code, w.Body.String())
 	}
+	if resp := decodeError(t, w); resp.Code != "SLOT_TAKEN" {
+		t.Errorf("code = %q, want SLOT_TAKEN", resp.Code)
+	}
 }
 
 func TestCreateBookingBufferAllows(t *testing.T) {
@@ -194,12 +302,12 @@ func TestCreateBookingBufferAllows(t *testing.T) {
 	defer db.Close()
 
 	// Insert a booking at 09:00
-	insertBooking(t, db, "2026-06-15", "09:00", "09:30", "other@example.com", "confirmed")
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "other@example.com", "confirmed")
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	// Try to book at 11:00 — should be allowed (120 min = exactly 2h, which is NOT < 120)
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-15",
+		Date:        "2037-06-15",
 		StartTime:   "11:00",
 		MeetingType: "videollamada",
 		ClientName:  "Test User",
@@ -218,14 +326,75 @@ func TestCreateBookingBufferAllows(t *testing.T) {
 	}
 }
 
+func TestCreateBookingServiceArea(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	handler := newTestBookingHandler(db)
+	// Its own rate-limit bucket, as it makes several requests.
+	const ip = "192.0.2.46:1234"
+
+	post := func(email string, addr *models.Address) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.BookingRequest{
+			Date:        "2037-06-15",
+			StartTime:   "09:00",
+			MeetingType: "presencial",
+			ClientName:  "Test User",
+			ClientEmail: email,
+			Address:     addr,
+			Lang:        "es",
+		})
+		req := httptest.NewRequest("POST", "/scheduler/bookings", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip
+		w := httptest.NewRecorder()
+		handler.CreateBooking(w, req)
+		return w
+	}
+
+	w := post("a@example.com", nil)
+	if resp := decodeError(t, w); w.Code != http.StatusBadRequest || len(resp.Details) != 1 || resp.Details[0].Field != "address" {
+		t.Errorf("Expected address to be required, got %d: %+v", w.Code, resp)
+	}
+
+	w = post("a@example.com", &models.Address{Street: "Calle 1", City: "Mexicali", PostalCode: "21000"})
+	if w.Code != http.StatusUnprocessableEntity || decodeError(t, w).Code != "OUTSIDE_SERVICE_AREA" {
+		t.Errorf("Expected OUTSIDE_SERVICE_AREA, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = post("a@example.com", &models.Address{Street: " Av. Reforma 100 ", City: "Ensenada", State: "B.C.", PostalCode: "22800"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var address, zone string
+	var buffer int
+	db.QueryRow(`SELECT client_address, service_zone, buffer_minutes FROM bookings WHERE client_email = 'a@example.com'`).
+		Scan(&address, &zone, &buffer)
+	if address != "Av. Reforma 100, Ensenada, B.C. 22800" || zone != "ensenada" || buffer != 240 {
+		t.Errorf("Stored address %q, zone %q, buffer %d", address, zone, buffer)
+	}
+
+	// Ensenada's 4h travel buffer blocks 12:30, which the default 2h would not.
+	body, _ := json.Marshal(models.BookingRequest{
+		Date: "2037-06-15", StartTime: "12:30", MeetingType: "videollamada",
+		ClientName: "Test User", ClientEmail: "b@example.com", Lang: "es",
+	})
+	req := httptest.NewRequest("POST", "/scheduler/bookings", bytes.NewBuffer(body))
+	req.RemoteAddr = ip
+	w = httptest.NewRecorder()
+	handler.CreateBooking(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 within the travel buffer, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 func TestGetAvailableSlotsWeekdaysOnly(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewSlotHandler(db)
+	handler := NewSlotHandler(db, testConfig())
 
-	// 2026-06-13 = Saturday, 2026-06-14 = Sunday, 2026-06-15 = Monday
-	req := httptest.NewRequest("GET", "/scheduler/slots?from=2026-06-13&to=2026-06-15", nil)
+	// 2037-06-13 = Saturday, 2037-06-14 = Sunday, 2037-06-15 = Monday
+	req := httptest.NewRequest("GET", "/scheduler/slots?from=2037-06-13&to=2037-06-15", nil)
 	w := httptest.NewRecorder()
 
 	r := chi.NewRouter()
@@ -241,7 +410,7 @@ func TestGetAvailableSlotsWeekdaysOnly(t *testing.T) {
 
 	// Should only have slots for Monday (no Sat/Sun)
 	for _, slot := range resp.Slots {
-		if slot.Date == "2026-06-13" || slot.Date == "2026-06-14" {
+		if slot.Date == "2037-06-13" || slot.Date == "2037-06-14" {
 			t.Errorf("Expected no slots on weekend, got slot on %s", slot.Date)
 		}
 	}
@@ -249,7 +418,7 @@ func TestGetAvailableSlotsWeekdaysOnly(t *testing.T) {
 	// Monday should have 14 slots (09:00 to 15:30)
 	mondaySlots := 0
 	for _, slot := range resp.Slots {
-		if slot.Date == "2026-06-15" {
+		if slot.Date == "2037-06-15" {
 			mondaySlots++
 		}
 	}
@@ -263,10 +432,10 @@ func TestGetAvailableSlotsWithBuffer(t *testing.T) {
 	defer db.Close()
 
 	// Insert booking at 09:00 on Monday
-	insertBooking(t, db, "2026-06-15", "09:00", "09:30", "someone@example.com", "confirmed")
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "someone@example.com", "confirmed")
 
-	handler := NewSlotHandler(db)
-	req := httptest.NewRequest("GET", "/scheduler/slots?from=2026-06-15&to=2026-06-15", nil)
+	handler := NewSlotHandler(db, testConfig())
+	req := httptest.NewRequest("GET", "/scheduler/slots?from=2037-06-15&to=2037-06-15", nil)
 	w := httptest.NewRecorder()
 
 	r := chi.NewRouter()
@@ -308,32 +477,65 @@ func TestConfirmBooking(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	// Insert a pending booking with known tokens
 	_, err := db.Exec(
 		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
-		 client_name, client_email, status, confirm_token, reject_token, lang)
-		 VALUES ('BK-2026-001', '2026-06-15', '09:00', '09:30', 'videollamada',
-		 'Test User', 'test@example.com', 'pending', 'confirm-token-123', 'reject-token-456', 'es')`)
+		 client_name, client_email, status, lang)
+		 VALUES ('BK-2026-001', '2037-06-15', '09:00', '09:30', 'videollamada',
+		 'Test <User>', 'test@example.com', 'pending', 'es')`)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	handler := NewBookingHandler(db)
-	req := httptest.NewRequest("GET", "/scheduler/bookings/confirm?token=confirm-token-123", nil)
-	w := httptest.NewRecorder()
+	handler := newTestBookingHandler(db)
+	token := issueActionToken(t, db, handler, "BK-2026-001", services.ActionConfirm)
 
+	// Opening the link (or a mail scanner prefetching it) changes nothing.
+	req := httptest.NewRequest("GET", "/scheduler/bookings/confirm?token="+url.QueryEscape(token), nil)
+	w := httptest.NewRecorder()
 	handler.ConfirmBooking(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected 200, got %d", w.Code)
 	}
-
-	// Verify status changed to confirmed
+	if !strings.Contains(w.Body.String(), `<form method="post"`) || !strings.Contains(w.Body.String(), token) {
+		t.Errorf("Expected a form posting the token, got:\n%s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "<User>") {
+		t.Error("Expected client name to be HTML-escaped")
+	}
+	// The page follows the browser's language, Spanish by default.
+	if !strings.Contains(w.Body.String(), "¿Confirmar la reserva BK-2026-001?") {
+		t.Errorf("Expected a Spanish prompt, got:\n%s", w.Body.String())
+	}
+	if got := w.Header().Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("Referrer-Policy = %q, want no-referrer", got)
+	}
 	var status string
 	db.QueryRow("SELECT status FROM bookings WHERE booking_id = 'BK-2026-001'").Scan(&status)
+	if status != "pending" {
+		t.Errorf("Expected GET to leave status 'pending', got '%s'", status)
+	}
+
+	w = postActionToken(handler.ConfirmBooking, "/scheduler/bookings/confirm", token)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	db.QueryRow("SELECT status FROM bookings WHERE booking_id = 'BK-2026-001'").Scan(&status)
 	if status != "confirmed" {
 		t.Errorf("Expected status 'confirmed', got '%s'", status)
 	}
+
+	var actor string
+	db.QueryRow("SELECT username FROM admin_audit_log WHERE action = 'booking.confirm' AND target = 'BK-2026-001'").Scan(&actor)
+	if actor != "email-link" {
+		t.Errorf("Expected confirmation audited as email-link, got %q", actor)
+	}
+
+	// The link works once.
+	w = postActionToken(handler.ConfirmBooking, "/scheduler/bookings/confirm", token)
+	if !strings.Contains(w.Body.String(), "already been used") {
+		t.Errorf("Expected reused link to be refused, got:\n%s", w.Body.String())
+	}
 }
 
 func TestRejectBooking(t *testing.T) {
@@ -342,28 +544,39 @@ func TestRejectBooking(t *testing.T) {
 
 	_, err := db.Exec(
 		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
-		 client_name, client_email, status, confirm_token, reject_token, lang)
-		 VALUES ('BK-2026-002', '2026-06-15', '11:00', '11:30', 'presencial',
-		 'Test User', 'test@example.com', 'pending', 'confirm-token-789', 'reject-token-012', 'es')`)
+		 client_name, client_email, status, lang)
+		 VALUES ('BK-2026-002', '2037-06-15', '11:00', '11:30', 'presencial',
+		 'Test User', 'test@example.com', 'pending', 'es')`)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	handler := NewBookingHandler(db)
-	req := httptest.NewRequest("GET", "/scheduler/bookings/reject?token=reject-token-012", nil)
-	w := httptest.NewRecorder()
+	handler := newTestBookingHandler(db)
+	confirm := issueActionToken(t, db, handler, "BK-2026-002", services.ActionConfirm)
+	reject := issueActionToken(t, db, handler, "BK-2026-002", services.ActionReject)
 
-	handler.RejectBooking(w, req)
+	// A confirm token is no good for rejecting.
+	postActionToken(handler.RejectBooking, "/scheduler/bookings/reject", confirm)
+	var status string
+	db.QueryRow("SELECT status FROM bookings WHERE booking_id = 'BK-2026-002'").Scan(&status)
+	if status != "pending" {
+		t.Fatalf("Expected confirm token to be refused by reject, got status '%s'", status)
+	}
 
+	w := postActionToken(handler.RejectBooking, "/scheduler/bookings/reject", reject)
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected 200, got %d", w.Code)
 	}
-
-	var status string
 	db.QueryRow("SELECT status FROM bookings WHERE booking_id = 'BK-2026-002'").Scan(&status)
 	if status != "rejected" {
 		t.Errorf("Expected status 'rejected', got '%s'", status)
 	}
+
+	// Rejecting spent the confirm link too.
+	w = postActionToken(handler.ConfirmBooking, "/scheduler/bookings/confirm", confirm)
+	if !strings.Contains(w.Body.String(), "already been used") {
+		t.Errorf("Expected confirm link to be spent, got:\n%s", w.Body.String())
+	}
 }
 
 func TestConfirmAlreadyConfirmed(t *testing.T) {
@@ -372,23 +585,24 @@ func TestConfirmAlreadyConfirmed(t *testing.T) {
 
 	_, err := db.Exec(
 		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
-		 client_name, client_email, status, confirm_token, reject_token, lang)
-		 VALUES ('BK-2026-003', '2026-06-15', '13:00', '13:30', 'videollamada',
-		 'Test User', 'test@example.com', 'confirmed', 'confirm-token-aaa', 'reject-token-bbb', 'es')`)
+		 client_name, client_email, status, lang)
+		 VALUES ('BK-2026-003', '2037-06-15', '13:00', '13:30', 'videollamada',
+		 'Test User', 'test@example.com', 'confirmed', 'es')`)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	handler := NewBookingHandler(db)
-	req := httptest.NewRequest("GET", "/scheduler/bookings/confirm?token=confirm-token-aaa", nil)
-	w := httptest.NewRecorder()
-
-	handler.ConfirmBooking(w, req)
+	handler := newTestBookingHandler(db)
+	token := issueActionToken(t, db, handler, "BK-2026-003", services.ActionConfirm)
+	w := postActionToken(handler.ConfirmBooking, "/scheduler/bookings/confirm", token)
 
 	// Should return 200 with info page, not error
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected 200 (info page), got %d", w.Code)
 	}
+	if !strings.Contains(w.Body.String(), "already confirmed") {
+		t.Errorf("Expected info page, got:\n%s", w.Body.String())
+	}
 
 	// Status should still be confirmed
 	var status string
@@ -398,11 +612,33 @@ func TestConfirmAlreadyConfirmed(t *testing.T) {
 	}
 }
 
+func TestConfirmBookingInvalidToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "test@example.com", "pending")
+
+	handler := newTestBookingHandler(db)
+	token := issueActionToken(t, db, handler, "BK-2026-TEST", services.ActionConfirm)
+	id, _, _ := strings.Cut(token, ".")
+
+	for _, tok := range []string{"", "nonsense", id, id + ".forged"} {
+		w := postActionToken(handler.ConfirmBooking, "/scheduler/bookings/confirm", tok)
+		if strings.Contains(w.Body.String(), "confirmed!") {
+			t.Errorf("token %q confirmed the booking", tok)
+		}
+	}
+	var status string
+	db.QueryRow("SELECT status FROM bookings WHERE booking_id = 'BK-2026-TEST'").Scan(&status)
+	if status != "pending" {
+		t.Errorf("Expected status to remain 'pending', got '%s'", status)
+	}
+}
+
 func TestCreateBooking_InvalidDateFormat(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	body, _ := json.Marshal(models.BookingRequest{
 		Date:        "15-06-2026", // wrong format
 		StartTime:   "09:00",
@@ -427,9 +663,9 @@ func TestCreateBooking_InvalidTimeFormat(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-15",
+		Date:        "2037-06-15",
 		StartTime:   "9:00", // missing leading zero
 		MeetingType: "videollamada",
 		ClientName:  "Test User",
@@ -452,9 +688,9 @@ func TestCreateBooking_InvalidMeetingType(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-15",
+		Date:        "2037-06-15",
 		StartTime:   "09:00",
 		MeetingType: "phone", // invalid
 		ClientName:  "Test User",
@@ -477,9 +713,9 @@ func TestCreateBooking_NameTooLong(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewBookingHandler(db)
+	handler := newTestBookingHandler(db)
 	body, _ := json.Marshal(models.BookingRequest{
-		Date:        "2026-06-15",
+		Date:        "2037-06-15",
 		StartTime:   "09:00",
 		MeetingType: "videollamada",
 		ClientName:  strings.Repeat("x", 201),
@@ -499,12 +735,56 @@ func TestCreateBooking_NameTooLong(t *testing.T) {
 	}
 }
 
+func TestGetAvailableSlotsInClientTimezone(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	r := chi.NewRouter()
+	r.Get("/scheduler/slots", NewSlotHandler(db, testConfig()).GetAvailableSlots)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/scheduler/slots?from=2037-06-15&to=2037-06-15"+query, nil))
+		return w
+	}
+
+	w := get("&tz=Europe/Madrid")
+	var resp models.AvailableSlotsResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Slots) == 0 {
+		t.Fatalf("Expected slots, got %d: %s", w.Code, w.Body.String())
+	}
+	if resp.Timezone != "America/Tijuana" || resp.ClientTimezone != "Europe/Madrid" {
+		t.Errorf("timezones %q, %q", resp.Timezone, resp.ClientTimezone)
+	}
+	// 15:30 PDT (UTC-7) is 22:30 UTC and 00:30 the next day in Madrid (UTC+2).
+	last := resp.Slots[len(resp.Slots)-1]
+	if last.StartTime != "15:30" || last.Start != "2037-06-15T22:30:00Z" || last.End != "2037-06-15T23:00:00Z" {
+		t.Errorf("last slot %+v", last)
+	}
+	if c := last.Client; c == nil || c.Date != "2037-06-16" || c.StartTime != "00:30" || c.EndTime != "01:00" {
+		t.Errorf("last slot in Madrid %+v", c)
+	}
+
+	resp = models.AvailableSlotsResponse{}
+	json.NewDecoder(get("").Body).Decode(&resp)
+	if len(resp.Slots) == 0 || resp.Slots[0].Client != nil || resp.Slots[0].Start == "" || resp.ClientTimezone != "" {
+		t.Errorf("Expected UTC instants and no client times without tz, got %+v", resp)
+	}
+
+	for _, tz := range []string{"Mars/Olympus", "Local", "../../etc/passwd"} {
+		w := get("&tz=" + tz)
+		if resp := decodeError(t, w); w.Code != http.StatusBadRequest || len(resp.Details) != 1 || resp.Details[0].Field != "tz" {
+			t.Errorf("tz=%s: %d %s", tz, w.Code, w.Body.String())
+		}
+	}
+}
+
 func TestGetAvailableSlots_InvalidDateFormat(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	handler := NewSlotHandler(db)
-	req := httptest.NewRequest("GET", "/scheduler/slots?from=invalid&to=2026-06-15", nil)
+	handler := NewSlotHandler(db, testConfig())
+	req := httptest.NewRequest("GET", "/scheduler/slots?from=invalid&to=2037-06-15", nil)
 	w := httptest.NewRecorder()
 
 	r := chi.NewRouter()
@@ -515,3 +795,141 @@ func TestGetAvailableSlots_InvalidDateFormat(t *testing.T) {
 		t.Errorf("Expected 400 for invalid date format, got %d: %s", w.Code, w.Body.String())
 	}
 }
+
+func TestGetAvailableSlots_RangeTooLong(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := NewSlotHandler(db, testConfig())
+	req := httptest.NewRequest("GET", "/scheduler/slots?from=2037-06-01&to=2037-07-31", nil)
+	req.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+
+	r := chi.NewRouter()
+	r.Get("/scheduler/slots", handler.GetAvailableSlots)
+	r.ServeHTTP(w, req)
+
+	resp := decodeError(t, w)
+	if w.Code != http.StatusBadRequest || len(resp.Details) != 1 || resp.Details[0].Field != "to" || resp.Details[0].Code != "max_days" {
+		t.Fatalf("Expected 400 max_days on to, got %d: %+v", w.Code, resp)
+	}
+	if want := "to: the range can span at most 31 days"; resp.Details[0].Message != want {
+		t.Errorf("message = %q, want %q", resp.Details[0].Message, want)
+	}
+}
+
+func TestBookingTransitionsRecordedInMetrics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+		 client_name, client_email, status, lang)
+		 VALUES ('BK-2037-010', '2037-06-16', '09:00', '09:30', 'videollamada',
+		 'Test User', 'metrics@example.com', 'pending', 'es')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := newTestBookingHandler(db)
+	token := issueActionToken(t, db, handler, "BK-2037-010", services.ActionConfirm)
+	postActionToken(handler.ConfirmBooking, "/scheduler/bookings/confirm", token)
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `scheduler_booking_transitions_total{from="pending",to="confirmed"}`) {
+		t.Errorf("Expected pending->confirmed transition in /metrics, got:\n%s", w.Body.String())
+	}
+}
+
+func TestUpdateBookingStatus(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	admins := services.NewAdmins(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	if _, err := admins.Create(context.Background(), "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "client@example.com", "pending")
+	if _, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, status)
+		 VALUES ('BK-2026-TEST2', '2037-06-16', '09:00', '09:30', 'videollamada', 'Test', 'other@example.com', 'confirmed')`); err != nil {
+		t.Fatal(err)
+	}
+	router := newAdminRouter(db, admins)
+
+	patch := func(id int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", fmt.Sprintf("/scheduler/admin/bookings/%d", id), strings.NewReader(body))
+		req.Header.Set("X-Forwarded-For", "198.51.100.40")
+		req.SetBasicAuth("ana", "correct horse battery")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	statusOf := func(id int) (status, reason string) {
+		db.QueryRow(`SELECT status, COALESCE(status_reason, '') FROM bookings WHERE id = ?`, id).Scan(&status, &reason)
+		return status, reason
+	}
+
+	for _, tt := range []struct {
+		id   int
+		body string
+		code int
+		err  string
+	}{
+		{1, `{"status":"completed"}`, http.StatusConflict, "INVALID_TRANSITION"},
+		{1, `{"status":"pending"}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{1, `{"reason":"no status"}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{1, `{}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{99, `{"status":"cancelled"}`, http.StatusNotFound, "NOT_FOUND"},
+	} {
+		w := patch(tt.id, tt.body)
+		if resp := decodeError(t, w); w.Code != tt.code || string(resp.Code) != tt.err {
+			t.Errorf("PATCH %d %s: status %d, code %s; want %d %s", tt.id, tt.body, w.Code, resp.Code, tt.code, tt.err)
+		}
+	}
+	if status, _ := statusOf(1); status != "pending" {
+		t.Fatalf("refused changes left status %q", status)
+	}
+
+	if w := patch(1, `{"status":"rejected","reason":"Out of town <that week>"}`); w.Code != http.StatusOK {
+		t.Fatalf("reject: status %d: %s", w.Code, w.Body.String())
+	}
+	if status, reason := statusOf(1); status != "rejected" || reason != "Out of town <that week>" {
+		t.Errorf("after reject: %q, %q", status, reason)
+	}
+	var html string
+	db.QueryRow(`SELECT html FROM email_outbox WHERE template = 'booking_rejection'`).Scan(&html)
+	if !strings.Contains(html, "Out of town &lt;that week&gt;") {
+		t.Errorf("rejection email lacks the escaped reason:\n%s", html)
+	}
+	if w := patch(1, `{"status":"confirmed"}`); w.Code != http.StatusConflict {
+		t.Errorf("confirm after reject: status %d", w.Code)
+	}
+	if w := patch(1, `{"note":"Called to offer another week"}`); w.Code != http.StatusOK {
+		t.Errorf("note: status %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := patch(2, `{"status":"no_show"}`); w.Code != http.StatusOK {
+		t.Errorf("no-show: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := patch(2, `{"status":"cancelled"}`); w.Code != http.StatusConflict {
+		t.Errorf("cancel after no-show: status %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/scheduler/admin/bookings/1/events", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.40")
+	req.SetBasicAuth("ana", "correct horse battery")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp models.BookingEventsResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || len(resp.Events) != 2 {
+		t.Fatalf("events: status %d, %+v", w.Code, resp)
+	}
+	if e := resp.Events[0]; e.From != "pending" || e.To != "rejected" || e.Reason == "" || e.Actor != "ana" {
+		t.Errorf("first event = %+v", e)
+	}
+	if e := resp.Events[1]; e.To != "" || e.Note != "Called to offer another week" {
+		t.Errorf("second event = %+v", e)
+	}
+}
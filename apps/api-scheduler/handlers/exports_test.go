@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportBookings(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	do := newBookingAdminRouter(t, db)
+	insertBooking(t, db, "2037-06-15", "09:00", "09:30", "ana@example.com", "confirmed")
+	if _, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, client_phone, status)
+		 VALUES ('BK-2037-002', '2037-06-16', '10:00', '10:30', 'presencial', '=cmd()', 'bo@example.com', '+52 664', 'pending'),
+		        ('BK-2037-003', '2037-07-01', '10:00', '10:30', 'presencial', 'Later', 'cy@example.com', NULL, 'confirmed')`); err != nil {
+		t.Fatal(err)
+	}
+
+	w := do("GET", "/scheduler/admin/bookings/export?from=2037-06-01&to=2037-06-30&lang=en", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("csv: status %d, Content-Type %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="bookings-`) || !strings.HasSuffix(cd, `.csv"`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(w.Body.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want header and 2 bookings: %q", len(records), records)
+	}
+	if records[0][0] != "Booking ID" || records[0][5] != "Status" {
+		t.Errorf("header = %q", records[0])
+	}
+	if r := records[2]; r[0] != "BK-2037-002" || r[4] != "In-person" || r[5] != "Pending" || r[7] != "'=cmd()" || r[9] != "'+52 664" {
+		t.Errorf("row = %q", r)
+	}
+
+	w = do("GET", "/scheduler/admin/bookings/export?format=xlsx&status=confirmed", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("xlsx: status %d: %s", w.Code, w.Body.String())
+	}
+	z, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("xlsx is not a zip: %v", err)
+	}
+	var sheet []byte
+	for _, f := range z.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			sheet, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	// Spanish by default; only the two confirmed bookings.
+	if !bytes.Contains(sheet, []byte(">Folio<")) || !bytes.Contains(sheet, []byte(">Confirmada<")) ||
+		bytes.Contains(sheet, []byte("BK-2037-002")) || !bytes.Contains(sheet, []byte("BK-2037-003")) {
+		t.Errorf("unexpected sheet:\n%s", sheet)
+	}
+
+	if w := do("GET", "/scheduler/admin/bookings/export?format=pdf", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("format=pdf: status %d", w.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+)
+
+func TestReadyzOK(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := NewHealthHandler(db, nil)
+	w := httptest.NewRecorder()
+	handler.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Status != "ok" {
+		t.Errorf("Expected status ok, got %s", resp.Status)
+	}
+	for _, name := range []string{"database", "database_writable", "schema"} {
+		if resp.Checks[name].Status != "ok" {
+			t.Errorf("Expected check %s to be ok, got %+v", name, resp.Checks[name])
+		}
+	}
+	if _, ok := resp.Checks["smtp"]; ok {
+		t.Error("Expected no smtp check when disabled")
+	}
+}
+
+func TestReadyzReadOnlyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.db")
+	rw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rw.Exec(`CREATE TABLE bookings (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	rw.Close()
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	handler := NewHealthHandler(db, nil)
+	w := httptest.NewRecorder()
+	handler.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.HealthResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Checks["database"].Status != "ok" {
+		t.Errorf("Expected database ping to succeed, got %+v", resp.Checks["database"])
+	}
+	if resp.Checks["database_writable"].Status != "fail" {
+		t.Errorf("Expected database_writable to fail, got %+v", resp.Checks["database_writable"])
+	}
+	if resp.Checks["schema"].Status != "fail" {
+		t.Errorf("Expected schema check to fail on an unmigrated database, got %+v", resp.Checks["schema"])
+	}
+}
+
+func TestReadyzOptionalSMTPDegrades(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	handler := NewHealthHandler(db, services.NewMailer(config.SMTP{}).Check)
+	w := httptest.NewRecorder()
+	handler.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 when only SMTP fails, got %d", w.Code)
+	}
+	var resp models.HealthResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Status != "degraded" || resp.Checks["smtp"].Status != "fail" {
+		t.Errorf("Expected degraded with failing smtp, got %+v", resp)
+	}
+}
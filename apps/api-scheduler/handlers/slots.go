@@ -3,53 +3,97 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
-	"regexp"
 	"strings"
+	"time"
 
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/metrics"
 	"github.com/joledev/api-scheduler/models"
 	"github.com/joledev/api-scheduler/services"
 )
 
-var slotDateRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
-
 type SlotHandler struct {
-	db *sql.DB
+	db           *sql.DB
+	availability *services.Availability
 }
 
-func NewSlotHandler(db *sql.DB) *SlotHandler {
-	return &SlotHandler{db: db}
+func NewSlotHandler(db *sql.DB, cfg *config.Config) *SlotHandler {
+	return &SlotHandler{db: db, availability: services.NewAvailability(cfg.Location(), cfg.BookingLimits)}
 }
 
-// GetAvailableSlots returns computed available slots for a date range (public)
+// GetAvailableSlots returns computed available slots for a date range
+// (public). With tz, an IANA time zone, each slot also has its times there.
 func (h *SlotHandler) GetAvailableSlots(w http.ResponseWriter, r *http.Request) {
 	ip := r.RemoteAddr
 	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
 		ip = strings.Split(fwd, ",")[0]
 	}
 	if !limiter.allow(strings.TrimSpace(ip), 60) {
-		http.Error(w, `{"success":false,"message":"Too many requests"}`, http.StatusTooManyRequests)
+		slog.WarnContext(r.Context(), "rate limit exceeded", "ip", strings.TrimSpace(ip))
+		metrics.RateLimited.WithLabelValues("get_slots").Inc()
+		apierror.Write(w, r, "", apierror.New(apierror.RateLimited))
 		return
 	}
 
 	from := r.URL.Query().Get("from")
 	to := r.URL.Query().Get("to")
+	tz := r.URL.Query().Get("tz")
 
-	if !slotDateRegex.MatchString(from) || !slotDateRegex.MatchString(to) {
-		http.Error(w, `{"success":false,"message":"from and to must be YYYY-MM-DD format"}`, http.StatusBadRequest)
+	v := validateRange(from, to)
+	var loc *time.Location
+	if tz != "" {
+		var err error
+		if loc, err = services.ClientLocation(tz); err != nil {
+			v.Invalid("tz")
+		}
+	}
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
 		return
 	}
 
-	slots, err := services.GetAvailableSlots(h.db, from, to)
+	slots, err := h.availability.Slots(h.db, from, to)
+	var tooLong *services.RangeError
+	if errors.As(err, &tooLong) {
+		apierror.Write(w, r, "", apierror.Validation().MaxDays("to", tooLong.MaxDays))
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"success":false,"message":"Internal error"}`, http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "computing available slots", "from", from, "to", to, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
 		return
 	}
 
 	if slots == nil {
 		slots = []models.AvailableSlot{}
 	}
+	resp := models.AvailableSlotsResponse{Slots: slots, Timezone: h.availability.Location().String()}
+	if loc != nil {
+		if err := services.LocalizeSlots(slots, loc); err != nil {
+			slog.ErrorContext(r.Context(), "converting slots", "tz", tz, "err", err)
+			apierror.Write(w, r, "", apierror.New(apierror.Internal))
+			return
+		}
+		resp.ClientTimezone = tz
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.AvailableSlotsResponse{Slots: slots})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// validateRange checks the from/to query parameters shared by the slot and
+// admin listing endpoints.
+func validateRange(from, to string) *apierror.Error {
+	v := apierror.Validation()
+	if !dateRegex.MatchString(from) {
+		v.Format("from", "YYYY-MM-DD")
+	}
+	if !dateRegex.MatchString(to) {
+		v.Format("to", "YYYY-MM-DD")
+	}
+	return v
 }
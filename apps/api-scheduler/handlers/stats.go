@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/joledev/api-scheduler/apierror"
+)
+
+// GetBookingStats returns the booking statistics for the meetings between
+// from and to (admin). Results are cached for the configured TTL;
+// generatedAt says when they were computed.
+func (h *BookingHandler) GetBookingStats(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	v := validateRange(from, to)
+	if v.Empty() && to < from {
+		v.Invalid("to")
+	}
+	if !v.Empty() {
+		apierror.Write(w, r, "", v)
+		return
+	}
+
+	stats, err := h.stats.Bookings(r.Context(), from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "computing booking stats", "from", from, "to", to, "err", err)
+		apierror.Write(w, r, "", apierror.New(apierror.Internal))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
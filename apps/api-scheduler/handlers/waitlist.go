@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/i18n"
+	"github.com/joledev/api-scheduler/metrics"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+)
+
+// JoinWaitlist puts a client on the waitlist for a date range (public).
+// When a booking in the range is cancelled, rejected or its hold expires,
+// the slot is held for the first waiting client it suits (see offerSlot).
+func (h *BookingHandler) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	ip := getClientIP(r)
+	if !limiter.allow(ip, 10) {
+		slog.WarnContext(r.Context(), "rate limit exceeded", "ip", ip)
+		metrics.RateLimited.WithLabelValues("join_waitlist").Inc()
+		apierror.Write(w, r, "", apierror.New(apierror.RateLimited))
+		return
+	}
+
+	var req models.WaitlistRequest
+	if e := apierror.Decode(w, r, 64*1024, &req); e != nil {
+		apierror.Write(w, r, "", e)
+		return
+	}
+
+	if err := h.turnstile.Verify(req.TurnstileToken, ip); err != nil {
+		slog.WarnContext(r.Context(), "captcha verification failed", "ip", ip, "err", err)
+		metrics.TurnstileFailures.Inc()
+		code := apierror.CaptchaFailed
+		if errors.Is(err, services.ErrCaptchaRequired) {
+			code = apierror.CaptchaRequired
+		}
+		apierror.Write(w, r, req.Lang, apierror.New(code))
+		return
+	}
+
+	v := apierror.Validation()
+	validateClient(v, &models.BookingRequest{
+		MeetingType:    req.MeetingType,
+		ClientName:     req.ClientName,
+		ClientEmail:    req.ClientEmail,
+		ClientPhone:    req.ClientPhone,
+		ClientCompany:  req.ClientCompany,
+		ClientAddress:  req.ClientAddress,
+		Address:        req.Address,
+		ClientTimezone: req.ClientTimezone,
+		Notes:          req.Notes,
+	}, func() { h.validateWaitlistRange(v, req.From, req.To) })
+	h.requireAddress(v, req.MeetingType, req.Address, false)
+	if !v.Empty() {
+		apierror.Write(w, r, req.Lang, v)
+		return
+	}
+	req.Lang = i18n.FromRequest(r, req.Lang)
+
+	zone, buffer, inArea := h.locate(req.MeetingType, req.Address)
+	if !inArea {
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.OutsideServiceArea))
+		return
+	}
+	if req.Address != nil && req.ClientAddress == "" {
+		req.ClientAddress = req.Address.String()
+	}
+
+	entry := services.WaitlistEntry{
+		ClientName:    strings.TrimSpace(req.ClientName),
+		ClientEmail:   strings.TrimSpace(req.ClientEmail),
+		ClientPhone:   req.ClientPhone,
+		ClientCompany: req.ClientCompany,
+		ClientAddress: req.ClientAddress,
+		Address:       addressOf(req.Address),
+		Zone:          zoneName(zone),
+		Buffer:        buffer,
+		MeetingType:   req.MeetingType,
+		From:          req.From,
+		To:            req.To,
+		Timezone:      req.ClientTimezone,
+		Notes:         req.Notes,
+		Lang:          req.Lang,
+	}
+	id, err := h.waitlist.Join(r.Context(), entry)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "joining waitlist", "err", err)
+		apierror.Write(w, r, req.Lang, apierror.New(apierror.Internal))
+		return
+	}
+	slog.InfoContext(r.Context(), "waitlist joined", "entry", id, "from", req.From, "to", req.To,
+		"meeting_type", req.MeetingType)
+	h.outbox.Enqueue(context.WithoutCancel(r.Context()),
+		services.WaitlistJoinedEmail(entry, h.waitlist.LeaveToken(id), h.baseURL))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", req.Lang)
+	json.NewEncoder(w).Encode(models.WaitlistResponse{
+		Success: true,
+		Message: i18n.T(req.Lang, "waitlist.joined"),
+	})
+}
+
+// validateWaitlistRange checks the dates a client waits between: from to
+// to, ending no earlier than today and spanning at most MaxRangeDays.
+func (h *BookingHandler) validateWaitlistRange(v *apierror.Error, from, to string) {
+	fromOK, toOK := dateRegex.MatchString(from), dateRegex.MatchString(to)
+	if !fromOK {
+		v.Format("from", "YYYY-MM-DD")
+	}
+	if !toOK {
+		v.Format("to", "YYYY-MM-DD")
+	}
+	if !fromOK || !toOK {
+		return
+	}
+	var tooLong *services.RangeError
+	switch err := h.availability.CheckRange(from, to); {
+	case errors.As(err, &tooLong):
+		v.MaxDays("to", tooLong.MaxDays)
+	case err != nil:
+		v.Invalid("from")
+	case to < from || to < h.availability.Today():
+		v.Invalid("to")
+	}
+}
+
+// offerSlot holds the slot at date and start, just freed, for the first
+// waiting client whose meeting fits it and who has no active booking, and
+// emails them the link to claim it. Failures are only logged: the slot then
+// stays free for anyone to book.
+func (h *BookingHandler) offerSlot(ctx context.Context, date, start string) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "starting transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	done := metrics.TimeQuery("list_waitlist_candidates")
+	entries, err := h.waitlist.Candidates(ctx, tx, date)
+	done()
+	if err != nil {
+		slog.ErrorContext(ctx, "listing waitlist", "date", date, "err", err)
+		return
+	}
+	today := h.availability.Today()
+	for _, e := range entries {
+		var active int
+		done := metrics.TimeQuery("count_active_bookings_by_email")
+		err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM bookings WHERE client_email = ? AND status IN ('pending', 'confirmed', 'held') AND date >= ?`,
+			e.ClientEmail, today).Scan(&active)
+		done()
+		if err != nil {
+			slog.ErrorContext(ctx, "counting active bookings", "err", err)
+			return
+		}
+		if active > 0 {
+			continue
+		}
+		ok, err := h.availability.IsSlotAvailable(tx, date, start, e.Buffer)
+		if err != nil {
+			slog.ErrorContext(ctx, "checking slot availability", "err", err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		h.hold(ctx, tx, e, date, start)
+		return
+	}
+}
+
+// hold books the slot at date and start as held for waitlist entry e,
+// inside tx, commits tx and emails the client the link to claim it.
+func (h *BookingHandler) hold(ctx context.Context, tx *sql.Tx, e services.WaitlistEntry, date, start string) {
+	b := &models.Booking{
+		BookingID:      h.generateBookingID(tx),
+		Date:           date,
+		StartTime:      start,
+		EndTime:        h.availability.EndTime(date, start),
+		MeetingType:    e.MeetingType,
+		ClientName:     e.ClientName,
+		ClientEmail:    e.ClientEmail,
+		ClientPhone:    e.ClientPhone,
+		ClientCompany:  e.ClientCompany,
+		ClientAddress:  e.ClientAddress,
+		ClientTimezone: e.Timezone,
+		Notes:          e.Notes,
+		Lang:           e.Lang,
+		Status:         services.StatusHeld,
+	}
+	done := metrics.TimeQuery("insert_booking")
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+		 client_name, client_email, client_phone, client_company, client_address,
+		 address_street, address_city, address_state, address_postal_code,
+		 service_zone, buffer_minutes, client_timezone, notes, lang, status)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''),
+		 NULLIF(?, ''), ?, ?, ?, ?, ?)`,
+		b.BookingID, b.Date, b.StartTime, b.EndTime, b.MeetingType,
+		b.ClientName, b.ClientEmail, b.ClientPhone, b.ClientCompany, b.ClientAddress,
+		e.Address.Street, e.Address.City, e.Address.State, e.Address.PostalCode,
+		e.Zone, int(e.Buffer/time.Minute), b.ClientTimezone, b.Notes, b.Lang, b.Status)
+	done()
+	if err != nil {
+		slog.ErrorContext(ctx, "saving held booking", "err", err)
+		return
+	}
+	rowID, _ := res.LastInsertId()
+	b.ID = int(rowID)
+
+	token, expires, err := h.waitlist.Hold(ctx, tx, e.ID, rowID)
+	if err == nil {
+		err = services.RecordBookingEvent(ctx, tx, services.BookingEvent{
+			BookingID: rowID, To: services.StatusHeld, Actor: "waitlist",
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "holding slot for waitlist", "booking_id", b.BookingID, "err", err)
+		return
+	}
+
+	slog.InfoContext(ctx, "slot held for waitlist", "booking_id", b.BookingID, "entry", e.ID,
+		"date", date, "start_time", start, "expires", expires)
+	metrics.BookingTransitions.WithLabelValues("new", services.StatusHeld).Inc()
+	h.outbox.Enqueue(context.WithoutCancel(ctx), services.WaitlistOfferEmail(b, token, h.baseURL, expires))
+}
+
+// ClaimHold serves the link in the waitlist offer email like the admin
+// email links: GET shows the held slot with a button, which POSTs the token
+// back to claim it. A claimed hold becomes a pending booking, which the
+// admin confirms or rejects as if the client had booked it.
+func (h *BookingHandler) ClaimHold(w http.ResponseWriter, r *http.Request) {
+	// The token is in the URL: keep it out of caches and Referer headers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	lang := i18n.FromRequest(r, "")
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+		token = r.PostFormValue("token")
+	}
+	if token == "" {
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.invalid", "")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		id, err := h.waitlist.Check(r.Context(), token)
+		if err != nil {
+			h.renderHoldError(w, r, bookingLang(r.Context(), h.db, id, lang), err)
+			return
+		}
+		b, err := bookingByID(r.Context(), h.db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "loading booking by hold", "err", err)
+			h.renderHoldPage(w, lang, "error", "waitlist.claim.error", "")
+			return
+		}
+		h.renderClaimPage(w, token, b)
+		return
+	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "starting transaction", "err", err)
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.error", "")
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := h.waitlist.Claim(r.Context(), tx, token)
+	if err != nil {
+		h.renderHoldError(w, r, bookingLang(r.Context(), tx, id, lang), err)
+		return
+	}
+	b, err := bookingByID(r.Context(), tx, id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "loading booking by hold", "err", err)
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.error", "")
+		return
+	}
+	lang = b.Lang
+
+	// One active booking per email, as for CreateBooking.
+	var active int
+	done := metrics.TimeQuery("count_active_bookings_by_email")
+	err = tx.QueryRowContext(r.Context(),
+		`SELECT COUNT(*) FROM bookings WHERE client_email = ? AND status IN ('pending', 'confirmed') AND date >= ?`,
+		b.ClientEmail, h.availability.Today()).Scan(&active)
+	done()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "counting active bookings", "err", err)
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.error", "")
+		return
+	}
+	if active > 0 {
+		h.renderHoldPage(w, lang, "info", "waitlist.claim.active", "")
+		return
+	}
+
+	done = metrics.TimeQuery("update_booking_status")
+	_, err = tx.ExecContext(r.Context(),
+		`UPDATE bookings SET status = 'pending', hold_expires_at = NULL WHERE id = ?`, b.ID)
+	done()
+	if err == nil {
+		b.ConfirmToken, err = h.actions.Issue(r.Context(), tx, id, services.ActionConfirm)
+	}
+	if err == nil {
+		b.RejectToken, err = h.actions.Issue(r.Context(), tx, id, services.ActionReject)
+	}
+	if err == nil {
+		err = services.RecordBookingEvent(r.Context(), tx, services.BookingEvent{
+			BookingID: id, From: services.StatusHeld, To: services.StatusPending, Actor: "client",
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "claiming held booking", "booking_id", b.BookingID, "err", err)
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.error", "")
+		return
+	}
+	b.Status = services.StatusPending
+
+	slog.InfoContext(r.Context(), "held booking claimed", "booking_id", b.BookingID)
+	metrics.BookingTransitions.WithLabelValues(services.StatusHeld, services.StatusPending).Inc()
+	h.outbox.Enqueue(context.WithoutCancel(r.Context()),
+		services.AdminPendingEmail(b, h.contactEmail, h.baseURL),
+		services.ClientPendingEmail(b))
+
+	writeTokenPage(w, lang, "confirmed", html.EscapeString(i18n.T(lang, "waitlist.claim.done", "id", b.BookingID)),
+		holdDetails(lang, b))
+}
+
+// LeaveWaitlist serves the link in the email sent on joining the waitlist
+// like the other email links: GET asks, and the button POSTs the token back
+// to take the client off the waitlist. Only a waiting entry can leave; a
+// slot already held for the client simply lapses if not claimed.
+func (h *BookingHandler) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	// The token is in the URL: keep it out of caches and Referer headers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	lang := i18n.FromRequest(r, "")
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+		token = r.PostFormValue("token")
+	}
+
+	if r.Method != http.MethodPost {
+		entryLang, waiting, err := h.waitlist.CheckLeave(r.Context(), token)
+		switch {
+		case errors.Is(err, services.ErrLeaveInvalid):
+			h.renderHoldPage(w, lang, "error", "waitlist.leave.invalid", "")
+		case err != nil:
+			slog.ErrorContext(r.Context(), "checking waitlist leave link", "err", err)
+			h.renderHoldPage(w, lang, "error", "waitlist.leave.error", "")
+		case !waiting:
+			h.renderHoldPage(w, entryLang, "info", "waitlist.leave.gone", "")
+		default:
+			body := fmt.Sprintf(`<form method="post" action="leave" style="margin-top:1.5rem">
+<input type="hidden" name="token" value="%s">
+<button type="submit" style="padding:0.75rem 1.5rem;border:0;border-radius:0.5rem;background:#ef4444;color:#fff;font-size:1rem;cursor:pointer">%s</button>
+</form>`, html.EscapeString(token), html.EscapeString(i18n.T(entryLang, "waitlist.leave.button")))
+			writeTokenPage(w, entryLang, "info", html.EscapeString(i18n.T(entryLang, "waitlist.leave.prompt")), body)
+		}
+		return
+	}
+
+	entryLang, left, err := h.waitlist.Leave(r.Context(), token)
+	switch {
+	case errors.Is(err, services.ErrLeaveInvalid):
+		h.renderHoldPage(w, lang, "error", "waitlist.leave.invalid", "")
+	case err != nil:
+		slog.ErrorContext(r.Context(), "leaving waitlist", "err", err)
+		h.renderHoldPage(w, lang, "error", "waitlist.leave.error", "")
+	case !left:
+		h.renderHoldPage(w, entryLang, "info", "waitlist.leave.gone", "")
+	default:
+		slog.InfoContext(r.Context(), "waitlist left")
+		h.renderHoldPage(w, entryLang, "confirmed", "waitlist.leave.done", "")
+	}
+}
+
+// bookingLang returns the language of booking id (the row ID) from q, or
+// fallback when it is unknown.
+func bookingLang(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, id int64, fallback string) string {
+	if id == 0 {
+		return fallback
+	}
+	b, err := bookingByID(ctx, q, id)
+	if err != nil {
+		return fallback
+	}
+	return b.Lang
+}
+
+// renderHoldError explains why a hold link cannot be used.
+func (h *BookingHandler) renderHoldError(w http.ResponseWriter, r *http.Request, lang string, err error) {
+	switch {
+	case errors.Is(err, services.ErrHoldInvalid):
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.invalid", "")
+	case errors.Is(err, services.ErrHoldClaimed):
+		h.renderHoldPage(w, lang, "info", "waitlist.claim.claimed", "")
+	case errors.Is(err, services.ErrHoldExpired):
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.expired", "waitlist.claim.expired_detail")
+	default:
+		slog.ErrorContext(r.Context(), "checking hold token", "err", err)
+		h.renderHoldPage(w, lang, "error", "waitlist.claim.error", "")
+	}
+}
+
+// renderHoldPage renders the page for a waitlist link with the messages
+// message and, if given, detail in lang.
+func (h *BookingHandler) renderHoldPage(w http.ResponseWriter, lang, status, message, detail string) {
+	detailHTML := ""
+	if detail != "" {
+		detailHTML = fmt.Sprintf(`<p style="color:#6b7280;margin-top:0.5rem;font-size:0.875rem">%s</p>`,
+			html.EscapeString(i18n.T(lang, detail)))
+	}
+	writeTokenPage(w, lang, status, html.EscapeString(i18n.T(lang, message)), detailHTML)
+}
+
+// renderClaimPage shows held booking b and a button that POSTs token back
+// to claim it.
+func (h *BookingHandler) renderClaimPage(w http.ResponseWriter, token string, b *models.Booking) {
+	lang := b.Lang
+	body := holdDetails(lang, b) + fmt.Sprintf(`
+<form method="post" action="claim" style="margin-top:1.5rem">
+<input type="hidden" name="token" value="%s">
+<button type="submit" style="padding:0.75rem 1.5rem;border:0;border-radius:0.5rem;background:#22c55e;color:#fff;font-size:1rem;cursor:pointer">%s</button>
+</form>`, html.EscapeString(token), html.EscapeString(i18n.T(lang, "waitlist.claim.button")))
+	writeTokenPage(w, lang, "info", html.EscapeString(i18n.T(lang, "waitlist.claim.prompt")), body)
+}
+
+// holdDetails is the date, times and meeting type of b for the hold pages.
+func holdDetails(lang string, b *models.Booking) string {
+	times := i18n.T(lang, "time.range", "start", i18n.Time(lang, b.StartTime), "end", i18n.Time(lang, b.EndTime))
+	return fmt.Sprintf(`<p style="color:#6b7280;margin-top:0.5rem;font-size:0.875rem">%s — %s (%s)</p>`,
+		html.EscapeString(i18n.Date(lang, b.Date)), html.EscapeString(times),
+		html.EscapeString(i18n.T(lang, "meeting_type."+b.MeetingType)))
+}
+
+// SweepHolds expires the holds that ran out every interval until ctx is
+// done, offering each freed slot to the next waiting client.
+func (h *BookingHandler) SweepHolds(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.expireHolds(ctx)
+		}
+	}
+}
+
+// expireHolds moves held bookings past their hold to expired and offers
+// their slots again.
+func (h *BookingHandler) expireHolds(ctx context.Context) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "starting transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	done := metrics.TimeQuery("expire_held_bookings")
+	ids, err := h.waitlist.Expire(ctx, tx)
+	done()
+	if err != nil {
+		slog.ErrorContext(ctx, "expiring holds", "err", err)
+		return
+	}
+	var freed []*models.Booking
+	for _, id := range ids {
+		b, err := bookingByID(ctx, tx, id)
+		if err == nil {
+			err = services.RecordBookingEvent(ctx, tx, services.BookingEvent{
+				BookingID: id, From: services.StatusHeld, To: services.StatusExpired, Actor: "waitlist",
+			})
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "expiring hold", "id", id, "err", err)
+			return
+		}
+		freed = append(freed, b)
+	}
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(ctx, "committing expired holds", "err", err)
+		return
+	}
+
+	for _, b := range freed {
+		slog.InfoContext(ctx, "hold expired", "booking_id", b.BookingID)
+		metrics.BookingTransitions.WithLabelValues(services.StatusHeld, services.StatusExpired).Inc()
+		h.offerSlot(ctx, b.Date, b.StartTime)
+	}
+}
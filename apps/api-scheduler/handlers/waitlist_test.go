@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+// joinWaitlist posts req to JoinWaitlist from ip, so each test has its own
+// rate-limit bucket.
+func joinWaitlist(h *BookingHandler, ip string, req models.WaitlistRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest("POST", "/scheduler/waitlist", bytes.NewBuffer(body))
+	r.RemoteAddr = ip
+	w := httptest.NewRecorder()
+	h.JoinWaitlist(w, r)
+	return w
+}
+
+var holdTokenRegex = regexp.MustCompile(`claim\?token=([^"&]+)`)
+
+// offeredHold returns the booking held for email and the token in the offer
+// email sent to them.
+func offeredHold(t *testing.T, db *sql.DB, email string) (bookingID, status, token string) {
+	t.Helper()
+	db.QueryRow(`SELECT booking_id, status FROM bookings WHERE client_email = ? ORDER BY id DESC LIMIT 1`, email).
+		Scan(&bookingID, &status)
+	var html string
+	db.QueryRow(`SELECT html FROM email_outbox WHERE template = 'waitlist_offer' AND recipient = ? ORDER BY id DESC LIMIT 1`, email).
+		Scan(&html)
+	if m := holdTokenRegex.FindStringSubmatch(html); m != nil {
+		token = m[1]
+	}
+	return bookingID, status, token
+}
+
+func TestJoinWaitlistValidation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	handler := newTestBookingHandler(db)
+
+	valid := models.WaitlistRequest{
+		From: "2037-06-15", To: "2037-06-19", MeetingType: "videollamada",
+		ClientName: "Ana", ClientEmail: "ana@example.com", Lang: "en",
+	}
+	for _, tt := range []struct {
+		name string
+		edit func(*models.WaitlistRequest)
+		want string
+	}{
+		{"bad dates", func(r *models.WaitlistRequest) { r.From, r.To = "15/06/2037", "" }, "from:format to:format"},
+		{"ends before it starts", func(r *models.WaitlistRequest) { r.To = "2037-06-14" }, "to:invalid"},
+		{"already over", func(r *models.WaitlistRequest) { r.From, r.To = "2020-01-01", "2020-01-02" }, "to:invalid"},
+		{"too long", func(r *models.WaitlistRequest) { r.To = "2037-07-31" }, "to:max_days"},
+		{"client fields", func(r *models.WaitlistRequest) { r.ClientName, r.MeetingType = "", "phone" }, "clientName:required meetingType:one_of"},
+	} {
+		req := valid
+		tt.edit(&req)
+		w := joinWaitlist(handler, "192.0.2.50:1234", req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, w.Code, w.Body.String())
+			continue
+		}
+		var fields []string
+		for _, d := range decodeError(t, w).Details {
+			fields = append(fields, d.Field+":"+d.Code)
+		}
+		if got := strings.Join(fields, " "); got != tt.want {
+			t.Errorf("%s: details = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if w := joinWaitlist(handler, "192.0.2.50:1234", valid); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// Joining again replaces the entry rather than adding another.
+	valid.To = "2037-06-26"
+	if w := joinWaitlist(handler, "192.0.2.50:1234", valid); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var n int
+	var to, lang string
+	db.QueryRow(`SELECT COUNT(*), MAX(to_date), MAX(lang) FROM waitlist WHERE client_email = 'ana@example.com'`).Scan(&n, &to, &lang)
+	if n != 1 || to != "2037-06-26" || lang != "en" {
+		t.Errorf("Expected one entry to 2037-06-26 in en, got %d to %s in %s", n, to, lang)
+	}
+}
+
+func TestLeaveWaitlist(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	handler := newTestBookingHandler(db)
+
+	w := joinWaitlist(handler, "192.0.2.51:1234", models.WaitlistRequest{
+		From: "2037-06-15", To: "2037-06-19", MeetingType: "videollamada",
+		ClientName: "Ana", ClientEmail: "ana@example.com", Lang: "en",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Joining: %d %s", w.Code, w.Body.String())
+	}
+	var email string
+	db.QueryRow(`SELECT html FROM email_outbox WHERE template = 'waitlist_joined' AND recipient = 'ana@example.com'`).Scan(&email)
+	m := regexp.MustCompile(`leave\?token=([^"&]+)`).FindStringSubmatch(email)
+	if m == nil {
+		t.Fatalf("Expected a leave link in the email, got:\n%s", email)
+	}
+	token := m[1]
+
+	// The link asks first, in the client's language; the button leaves.
+	req := httptest.NewRequest("GET", "/scheduler/waitlist/leave?token="+url.QueryEscape(token), nil)
+	w = httptest.NewRecorder()
+	handler.LeaveWaitlist(w, req)
+	if !strings.Contains(w.Body.String(), `<form method="post"`) || !strings.Contains(w.Body.String(), "Leave the waitlist?") {
+		t.Errorf("Expected a form to leave, got:\n%s", w.Body.String())
+	}
+	var status string
+	db.QueryRow(`SELECT status FROM waitlist WHERE client_email = 'ana@example.com'`).Scan(&status)
+	if status != "waiting" {
+		t.Errorf("Expected GET to change nothing, got %s", status)
+	}
+
+	w = postActionToken(handler.LeaveWaitlist, "/scheduler/waitlist/leave", token)
+	if !strings.Contains(w.Body.String(), "You have left the waitlist") {
+		t.Errorf("Expected to leave, got:\n%s", w.Body.String())
+	}
+	db.QueryRow(`SELECT status FROM waitlist WHERE client_email = 'ana@example.com'`).Scan(&status)
+	if status != "left" {
+		t.Errorf("Expected the entry left, got %s", status)
+	}
+	w = postActionToken(handler.LeaveWaitlist, "/scheduler/waitlist/leave", token)
+	if !strings.Contains(w.Body.String(), "no longer waiting") {
+		t.Errorf("Expected leaving twice to do nothing, got:\n%s", w.Body.String())
+	}
+	w = postActionToken(handler.LeaveWaitlist, "/scheduler/waitlist/leave", token+"x")
+	if !strings.Contains(w.Body.String(), "Invalid link") {
+		t.Errorf("Expected a tampered link refused, got:\n%s", w.Body.String())
+	}
+}
+
+func TestWaitlistOfferClaimAndExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	handler := newTestBookingHandler(db)
+	do := newBookingAdminRouter(t, db)
+
+	insertBooking(t, db, "2037-06-15", "10:00", "10:30", "taken@example.com", "confirmed")
+	for _, email := range []string{"first@example.com", "second@example.com", "later@example.com"} {
+		from := "2037-06-15"
+		if email == "later@example.com" {
+			from = "2037-06-16"
+		}
+		w := joinWaitlist(handler, "192.0.2.52:1234", models.WaitlistRequest{
+			From: from, To: "2037-06-19", MeetingType: "videollamada",
+			ClientName: "Waiting", ClientEmail: email, Lang: "en",
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Joining as %s: %d %s", email, w.Code, w.Body.String())
+		}
+	}
+
+	// Cancelling the booking holds its slot for the first client waiting
+	// on that date, without telling them it was cancelled.
+	var id string
+	db.QueryRow(`SELECT id FROM bookings WHERE client_email = 'taken@example.com'`).Scan(&id)
+	if w := do("PATCH", "/scheduler/admin/bookings/"+id, `{"status":"cancelled"}`); w.Code != http.StatusOK {
+		t.Fatalf("Cancelling: %d %s", w.Code, w.Body.String())
+	}
+	held, status, token := offeredHold(t, db, "first@example.com")
+	if status != "held" || token == "" {
+		t.Fatalf("Expected a held booking and offer email for the first client, got %q %q %q", held, status, token)
+	}
+	var start string
+	db.QueryRow(`SELECT start_time FROM bookings WHERE booking_id = ?`, held).Scan(&start)
+	if start != "10:00" {
+		t.Errorf("Expected the 10:00 slot held, got %s", start)
+	}
+	var cancelEmails int
+	db.QueryRow(`SELECT COUNT(*) FROM email_outbox WHERE template = 'booking_cancellation' AND recipient = 'first@example.com'`).Scan(&cancelEmails)
+	if cancelEmails != 0 {
+		t.Error("Expected no cancellation email to the waitlisted client")
+	}
+
+	// The held slot is not free for anyone else.
+	tx, _ := db.Begin()
+	free, _ := handler.availability.IsSlotAvailable(tx, "2037-06-15", "10:00", 0)
+	tx.Rollback()
+	if free {
+		t.Error("Expected the held slot to be taken")
+	}
+
+	// The link shows the slot; posting it claims it as a pending booking.
+	req := httptest.NewRequest("GET", "/scheduler/waitlist/claim?token="+url.QueryEscape(token), nil)
+	w := httptest.NewRecorder()
+	handler.ClaimHold(w, req)
+	if !strings.Contains(w.Body.String(), `<form method="post"`) || !strings.Contains(w.Body.String(), "Book it") {
+		t.Errorf("Expected a form to claim the slot, got:\n%s", w.Body.String())
+	}
+	w = postActionToken(handler.ClaimHold, "/scheduler/waitlist/claim", token)
+	if !strings.Contains(w.Body.String(), held) {
+		t.Errorf("Expected the claim to succeed, got:\n%s", w.Body.String())
+	}
+	if _, status, _ := offeredHold(t, db, "first@example.com"); status != "pending" {
+		t.Errorf("Expected the claimed booking pending, got %s", status)
+	}
+	var emails int
+	db.QueryRow(`SELECT COUNT(*) FROM email_outbox WHERE ref = ? AND template IN ('admin_pending', 'client_pending')`, held).Scan(&emails)
+	if emails != 2 {
+		t.Errorf("Expected admin and client pending emails, got %d", emails)
+	}
+	w = postActionToken(handler.ClaimHold, "/scheduler/waitlist/claim", token)
+	if !strings.Contains(w.Body.String(), "already booked") {
+		t.Errorf("Expected a second claim to be refused, got:\n%s", w.Body.String())
+	}
+
+	// Rejecting it offers the slot to the next client, whose hold then
+	// expires unclaimed: the slot goes to nobody else on that date.
+	db.QueryRow(`SELECT id FROM bookings WHERE booking_id = ?`, held).Scan(&id)
+	if w := do("PATCH", "/scheduler/admin/bookings/"+id, `{"status":"rejected"}`); w.Code != http.StatusOK {
+		t.Fatalf("Rejecting: %d %s", w.Code, w.Body.String())
+	}
+	held, status, token = offeredHold(t, db, "second@example.com")
+	if status != "held" || token == "" {
+		t.Fatalf("Expected a hold for the second client, got %q %q", held, status)
+	}
+	db.Exec(`UPDATE bookings SET hold_expires_at = '2020-01-01 00:00:00' WHERE booking_id = ?`, held)
+	handler.expireHolds(context.Background())
+
+	if _, status, _ := offeredHold(t, db, "second@example.com"); status != "expired" {
+		t.Errorf("Expected the unclaimed hold expired, got %s", status)
+	}
+	w = postActionToken(handler.ClaimHold, "/scheduler/waitlist/claim", token)
+	if !strings.Contains(w.Body.String(), "expired") {
+		t.Errorf("Expected an expired hold to be refused, got:\n%s", w.Body.String())
+	}
+	var entries string
+	db.QueryRow(`SELECT group_concat(client_email || '=' || status, ' ') FROM (SELECT * FROM waitlist ORDER BY id)`).Scan(&entries)
+	if entries != "first@example.com=booked second@example.com=lapsed later@example.com=waiting" {
+		t.Errorf("Waitlist = %s", entries)
+	}
+	var events string
+	db.QueryRow(`SELECT group_concat(COALESCE(from_status, 'new') || '>' || to_status || ':' || actor, ' ')
+		FROM booking_events e JOIN bookings b ON b.id = e.booking_id WHERE b.booking_id = ?`, held).Scan(&events)
+	if events != "new>held:waitlist held>expired:waitlist" {
+		t.Errorf("Events = %s", events)
+	}
+}
@@ -0,0 +1,221 @@
+// Package i18n holds the API's user-facing text. Each language is one
+// catalog, locales/<tag>.json, mapping message IDs to text; supporting a new
+// language means adding a file, not changing callers.
+//
+// Messages use named placeholders ("Hola {name}") filled from key/value
+// pairs, as with slog: T(lang, "email.greeting", "name", b.ClientName).
+// A message may instead be an object of plural forms keyed by CLDR category
+// ("one", "other"), selected with N. Missing messages fall back to the
+// Spanish catalog, then to the ID itself.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the language used when the request does not ask for a
+// supported one.
+const Default = "es"
+
+//go:embed locales/*.json
+var files embed.FS
+
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+var catalogs = mustLoad()
+
+func mustLoad() map[string]map[string]message {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]message)
+	for _, e := range entries {
+		tag := strings.TrimSuffix(e.Name(), ".json")
+		b, err := files.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(b, &raw); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", e.Name(), err))
+		}
+		cat := make(map[string]message, len(raw))
+		for id, v := range raw {
+			var m message
+			if err := json.Unmarshal(v, &m.text); err != nil {
+				if err := json.Unmarshal(v, &m.plural); err != nil || m.plural["other"] == "" {
+					panic(fmt.Sprintf("i18n: %s: %s must be a string or plural forms with \"other\"", e.Name(), id))
+				}
+			}
+			cat[id] = m
+		}
+		out[tag] = cat
+	}
+	if _, ok := out[Default]; !ok {
+		panic("i18n: missing catalog for default language " + Default)
+	}
+	return out
+}
+
+// Supported lists the available languages, default first.
+func Supported() []string {
+	tags := make([]string, 0, len(catalogs))
+	for tag := range catalogs {
+		if tag != Default {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return append([]string{Default}, tags...)
+}
+
+// Match returns the supported language for a tag such as "en-US", "pt_br" or
+// "pt", or "" if there is none. An exact match wins over one on the primary
+// language.
+func Match(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return ""
+	}
+	primary, _, _ := strings.Cut(tag, "-")
+	fallback := ""
+	for _, s := range Supported() {
+		if strings.EqualFold(s, tag) {
+			return s
+		}
+		sp, _, _ := strings.Cut(s, "-")
+		if fallback == "" && strings.EqualFold(sp, primary) {
+			fallback = s
+		}
+	}
+	return fallback
+}
+
+// Negotiate picks the response language: lang (usually the request body's
+// lang field) when supported, otherwise the best match in an Accept-Language
+// header by q-value, otherwise Default.
+func Negotiate(lang, acceptLanguage string) string {
+	if m := Match(lang); m != "" {
+		return m
+	}
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if m := Match(tag); m != "" && q > bestQ {
+			best, bestQ = m, q
+		}
+	}
+	return best
+}
+
+// FromRequest negotiates with r's Accept-Language header.
+func FromRequest(r *http.Request, lang string) string {
+	return Negotiate(lang, r.Header.Get("Accept-Language"))
+}
+
+func lookup(lang, id string) (message, bool) {
+	if m, ok := catalogs[lang][id]; ok {
+		return m, true
+	}
+	m, ok := catalogs[Default][id]
+	return m, ok
+}
+
+// T returns message id in lang with its {placeholders} replaced from the
+// key/value pairs in args.
+func T(lang, id string, args ...any) string {
+	m, ok := lookup(lang, id)
+	if !ok {
+		return id
+	}
+	text := m.text
+	if m.plural != nil {
+		text = m.plural["other"]
+	}
+	return fill(text, args)
+}
+
+// N is T for messages with plural forms, choosing the form for n. The count
+// is available to the message as {n}.
+func N(lang, id string, n int, args ...any) string {
+	m, ok := lookup(lang, id)
+	if !ok {
+		return id
+	}
+	text := m.text
+	if m.plural != nil {
+		if text = m.plural[pluralCategory(lang, n)]; text == "" {
+			text = m.plural["other"]
+		}
+	}
+	return fill(text, append(args, "n", n))
+}
+
+// pluralCategory implements the CLDR cardinal rules for integers in the
+// supported languages. Portuguese treats 0 as singular.
+func pluralCategory(lang string, n int) string {
+	primary, _, _ := strings.Cut(lang, "-")
+	switch primary {
+	case "pt":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+func fill(text string, args []any) string {
+	if len(args) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// Date formats a YYYY-MM-DD date in lang's long form ("15 de junio, 2037").
+// Anything else is returned unchanged.
+func Date(lang, date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return T(lang, "date.long",
+		"day", t.Day(),
+		"month", T(lang, "date.month."+strconv.Itoa(int(t.Month()))),
+		"year", t.Year())
+}
+
+// Time formats an HH:MM time with lang's clock layout ("9:30 AM", "09:30").
+// Anything else is returned unchanged.
+func Time(lang, hhmm string) string {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return hhmm
+	}
+	return t.Format(T(lang, "time.layout"))
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+var emailPattern = regexp.MustCompile(`[^\s@<>"'(),;:]+@[^\s@<>"'(),;:]+\.[^\s@<>"'(),;:]+`)
+
+// New returns a JSON logger writing to w at the given level ("debug", "info",
+// "warn" or "error"). Every record carries the request ID found in its context
+// and has email addresses and phone numbers redacted.
+func New(w io.Writer, level string) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       ParseLevel(level),
+		ReplaceAttr: redact,
+	})
+	return slog.New(&contextHandler{Handler: h})
+}
+
+// ParseLevel maps a LOG_LEVEL value to a slog level, defaulting to info.
+func ParseLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// contextHandler adds the chi request ID of the record's context, so handlers,
+// services and background goroutines only need to pass the context along.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := chimw.GetReqID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// redact masks PII: attributes named like an email or phone field are masked
+// entirely, and any email address embedded in other string values or errors
+// (e.g. SMTP "550 <user@host>" replies) is masked in place.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	switch {
+	case key == "to" || strings.HasSuffix(key, "email"):
+		return slog.String(a.Key, RedactEmail(a.Value.String()))
+	case strings.HasSuffix(key, "phone"):
+		return slog.String(a.Key, RedactPhone(a.Value.String()))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if s := a.Value.String(); strings.Contains(s, "@") {
+			return slog.String(a.Key, emailPattern.ReplaceAllStringFunc(s, RedactEmail))
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok && strings.Contains(err.Error(), "@") {
+			return slog.String(a.Key, emailPattern.ReplaceAllStringFunc(err.Error(), RedactEmail))
+		}
+	}
+	return a
+}
+
+// RedactEmail keeps the first character of the local part and the domain:
+// "maria@example.com" becomes "m***@example.com".
+func RedactEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		if email == "" {
+			return ""
+		}
+		return "***"
+	}
+	_, n := utf8.DecodeRuneInString(email)
+	return email[:n] + "***" + email[at:]
+}
+
+// RedactPhone keeps only the last two digits: "+52 664 123 4567" becomes "***67".
+func RedactPhone(phone string) string {
+	var digits []rune
+	for _, c := range phone {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits) == 0 {
+		return ""
+	}
+	if len(digits) <= 2 {
+		return "***"
+	}
+	return "***" + string(digits[len(digits)-2:])
+}
@@ -1,16 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/config"
 	"github.com/joledev/api-scheduler/handlers"
+	"github.com/joledev/api-scheduler/logging"
+	"github.com/joledev/api-scheduler/metrics"
 	"github.com/joledev/api-scheduler/middleware"
+	"github.com/joledev/api-scheduler/migrations"
+	"github.com/joledev/api-scheduler/openapi"
+	"github.com/joledev/api-scheduler/services"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -23,122 +35,219 @@ func securityHeaders(next http.Handler) http.Handler {
 	})
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := os.Getenv("CORS_ORIGIN")
-		if origin == "" {
-			origin = "https://joledev.com"
-		}
-
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func main() {
-	// Database setup
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "/data/scheduler.db"
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+	if cfg.TurnstileSecret == "" {
+		slog.Warn("TURNSTILE_SECRET_KEY not set, CAPTCHA verification disabled")
 	}
 
-	os.MkdirAll("/data", 0755)
+	// Database setup
+	os.MkdirAll(filepath.Dir(cfg.DBPath), 0755)
 
-	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL")
+	db, err := sql.Open("sqlite3", cfg.DBPath+"?_journal_mode=WAL")
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		slog.Error("failed to open database", "err", err)
+		os.Exit(1)
 	}
 	defer db.Close()
 
-	// Migration: drop old tables if they exist
-	db.Exec(`DROP TABLE IF EXISTS availability_slots`)
-
-	// Drop old bookings table if it has the old schema (slot_id column)
-	var hasSlotID bool
-	row := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('bookings') WHERE name='slot_id'`)
-	row.Scan(&hasSlotID)
-	if hasSlotID {
-		db.Exec(`DROP TABLE IF EXISTS bookings`)
-	}
-
-	// Create new bookings table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS bookings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		booking_id TEXT UNIQUE NOT NULL,
-		date TEXT NOT NULL,
-		start_time TEXT NOT NULL,
-		end_time TEXT NOT NULL,
-		meeting_type TEXT NOT NULL,
-		client_name TEXT NOT NULL,
-		client_email TEXT NOT NULL,
-		client_phone TEXT,
-		client_company TEXT,
-		client_address TEXT,
-		client_timezone TEXT,
-		notes TEXT,
-		lang TEXT DEFAULT 'es',
-		status TEXT DEFAULT 'pending',
-		confirm_token TEXT UNIQUE,
-		reject_token TEXT UNIQUE,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`)
-	if err != nil {
-		log.Fatalf("Failed to create bookings table: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(db, os.Args[2:], os.Stdout))
+	}
+
+	// Apply pending schema migrations. Destructive ones stop startup until
+	// they are applied explicitly with `migrate -allow-destructive`.
+	if _, err := migrations.Up(context.Background(), db, migrations.Options{}); err != nil {
+		slog.Error("migrating database", "err", err)
+		os.Exit(1)
+	}
+
+	secret := []byte(cfg.SessionSecret)
+	if len(secret) == 0 {
+		slog.Warn("SCHEDULER_SESSION_SECRET not set, admin sessions will not survive a restart")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	admins := services.NewAdmins(db, secret, cfg.SessionTTL)
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdmin(admins, os.Args[2:], os.Stdin, os.Stdout))
+	}
+	if created, err := admins.Bootstrap(context.Background(), cfg.AdminPassword); err != nil {
+		slog.Error("creating initial admin account", "err", err)
+		os.Exit(1)
+	} else if created {
+		slog.Info("created admin account from SCHEDULER_ADMIN_PASSWORD", "username", "admin")
 	}
 
-	// Indexes
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_bookings_status ON bookings(status)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_bookings_date ON bookings(date)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_bookings_email_status ON bookings(client_email, status)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_bookings_confirm_token ON bookings(confirm_token)`)
-	db.Exec(`CREATE INDEX IF NOT EXISTS idx_bookings_reject_token ON bookings(reject_token)`)
+	actions := services.NewActionTokens(db, secret, cfg.ActionTokenTTL)
+	if n, err := actions.AdoptLegacy(context.Background()); err != nil {
+		slog.Error("hashing confirm/reject tokens", "err", err)
+		os.Exit(1)
+	} else if n > 0 {
+		slog.Info("hashed confirm/reject tokens of pending bookings", "bookings", n)
+	}
+
+	mailer := services.NewMailer(cfg.SMTP)
+	outbox := services.NewOutbox(db, mailer)
+	if err := outbox.Resume(context.Background()); err != nil {
+		slog.Error("resuming email outbox", "err", err)
+	}
 
 	// Handlers
-	slotHandler := handlers.NewSlotHandler(db)
-	bookingHandler := handlers.NewBookingHandler(db)
+	services.SetTimezone(cfg.Location())
+	slotHandler := handlers.NewSlotHandler(db, cfg)
+	waitlist := services.NewWaitlist(db, secret, cfg.WaitlistHoldTTL)
+	bookingHandler := handlers.NewBookingHandler(db, outbox, actions, waitlist, services.NewMeetingLinks(cfg.Meetings, secret), cfg)
+	adminHandler := handlers.NewAdminHandler(db, admins, cfg)
+
+	spec, err := openapi.Load()
+	if err != nil {
+		slog.Error("loading OpenAPI document", "err", err)
+		os.Exit(1)
+	}
+
+	cors, err := middleware.NewCORS(middleware.CORSOptions{
+		Origins:         cfg.CORSOrigins,
+		Headers:         []string{"Content-Type", "Authorization", middleware.CSRFHeader},
+		CredentialPaths: []string{"/scheduler/admin"},
+	})
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
 
 	// Router
 	r := chi.NewRouter()
-	r.Use(chimw.Logger)
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RequestLogger)
+	r.Use(metrics.Middleware)
 	r.Use(chimw.Recoverer)
 	r.Use(securityHeaders)
-	r.Use(corsMiddleware)
+	r.Use(cors.Handler(r))
+	r.NotFound(apierror.NotFoundHandler)
+	r.MethodNotAllowed(apierror.MethodNotAllowedHandler)
+
+	// Probes: /livez only proves the process serves HTTP, /readyz checks the
+	// database and (with READYZ_CHECK_SMTP=true) the mail server.
+	var smtpCheck func(context.Context) error
+	if cfg.ReadyzCheckSMTP {
+		smtpCheck = mailer.Check
+	}
+	healthHandler := handlers.NewHealthHandler(db, smtpCheck)
+	r.Get("/livez", healthHandler.Livez)
+	r.Get("/readyz", healthHandler.Readyz)
+	r.Get("/scheduler/health", healthHandler.Livez)
 
-	// Health check
-	r.Get("/scheduler/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-	})
+	r.Handle("/metrics", metrics.Handler())
+
+	// API contract; the /scheduler alias is what the ingress exposes.
+	r.Get("/openapi.json", openapi.ServeDocument)
+	r.Get("/scheduler/openapi.json", openapi.ServeDocument)
 
 	// Public routes
-	r.Get("/scheduler/slots", slotHandler.GetAvailableSlots)
-	r.Post("/scheduler/bookings", bookingHandler.CreateBooking)
+	r.With(spec.Validate("getAvailableSlots")).Get("/scheduler/slots", slotHandler.GetAvailableSlots)
+	r.With(spec.Validate("createBooking")).Post("/scheduler/bookings", bookingHandler.CreateBooking)
 	r.Get("/scheduler/bookings/{bookingId}", bookingHandler.GetBooking)
+	r.With(spec.Validate("joinWaitlist")).Post("/scheduler/waitlist", bookingHandler.JoinWaitlist)
+
+	// Claim link in the waitlist offer email and leave link in the one sent
+	// on joining, which work like the admin email links below.
+	r.Get("/scheduler/waitlist/claim", bookingHandler.ClaimHold)
+	r.Post("/scheduler/waitlist/claim", bookingHandler.ClaimHold)
+	r.Get("/scheduler/waitlist/leave", bookingHandler.LeaveWaitlist)
+	r.Post("/scheduler/waitlist/leave", bookingHandler.LeaveWaitlist)
 
-	// Token-based confirm/reject (public, no auth — links sent in admin email)
+	// Token-based confirm/reject (public, no auth — links sent in admin email).
+	// GET only shows the booking; the page's button POSTs the token.
 	r.Get("/scheduler/bookings/confirm", bookingHandler.ConfirmBooking)
+	r.Post("/scheduler/bookings/confirm", bookingHandler.ConfirmBooking)
 	r.Get("/scheduler/bookings/reject", bookingHandler.RejectBooking)
+	r.Post("/scheduler/bookings/reject", bookingHandler.RejectBooking)
 
-	// Admin routes (Basic Auth protected)
+	// Admin routes: session cookie (plus CSRF header) or Basic credentials
 	r.Route("/scheduler/admin", func(r chi.Router) {
-		r.Use(middleware.AdminAuth)
-		r.Get("/bookings", bookingHandler.GetAdminBookings)
-		r.Patch("/bookings/{id}", bookingHandler.CancelBooking)
+		r.With(spec.Validate("adminLogin")).Post("/login", adminHandler.Login)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.AdminAuth(admins))
+			r.Get("/me", adminHandler.Me)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead), spec.Validate("listAdminBookings")).
+				Get("/bookings", bookingHandler.GetAdminBookings)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead), spec.Validate("exportBookings")).
+				Get("/bookings/export", bookingHandler.ExportBookings)
+			r.With(middleware.RequireScope(services.ScopeBookingsWrite), spec.Validate("adminCreateBooking")).
+				Post("/bookings", bookingHandler.AdminCreateBooking)
+			r.With(middleware.RequireScope(services.ScopeBookingsWrite), spec.Validate("updateBooking")).
+				Patch("/bookings/{id}", bookingHandler.UpdateBooking)
+			r.With(middleware.RequireScope(services.ScopeBookingsWrite), spec.Validate("rescheduleBooking")).
+				Post("/bookings/{id}/reschedule", bookingHandler.RescheduleBooking)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead)).
+				Get("/bookings/{id}/events", bookingHandler.GetBookingEvents)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead), spec.Validate("getClientHistory")).
+				Get("/clients/bookings", bookingHandler.GetClientHistory)
+			r.With(middleware.RequireScope(services.ScopeBookingsRead), spec.Validate("getBookingStats")).
+				Get("/stats", bookingHandler.GetBookingStats)
+
+			// Managing the account itself takes a password login, never a key.
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireAccount)
+				r.Post("/logout", adminHandler.Logout)
+				r.Post("/totp/enroll", adminHandler.EnrollTOTP)
+				r.With(spec.Validate("confirmTOTP")).Post("/totp/confirm", adminHandler.ConfirmTOTP)
+				r.With(spec.Validate("disableTOTP")).Post("/totp/disable", adminHandler.DisableTOTP)
+				r.Get("/api-keys", adminHandler.ListAPIKeys)
+				r.With(spec.Validate("createAPIKey")).Post("/api-keys", adminHandler.CreateAPIKey)
+				r.Delete("/api-keys/{id}", adminHandler.RevokeAPIKey)
+			})
+		})
 	})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8082"
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Slots held for waitlisted clients go to the next one once unclaimed.
+	go bookingHandler.SweepHolds(ctx, time.Minute)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("api-scheduler listening", "port", cfg.Port)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("server stopped", "err", err)
+		os.Exit(1)
+	case <-ctx.Done():
+		stop()
 	}
 
-	log.Printf("api-scheduler listening on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	// Stop accepting requests, let in-flight ones finish (they may still
+	// enqueue emails), then wait for the outbox. Whatever misses the deadline
+	// stays in email_outbox and is resent on the next start.
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout.String())
+	healthHandler.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("draining HTTP requests", "err", err)
+	}
+	if err := outbox.Wait(shutdownCtx); err != nil {
+		slog.Warn("emails still sending at shutdown, left in outbox", "err", err)
+	}
+	slog.Info("shutdown complete")
 }
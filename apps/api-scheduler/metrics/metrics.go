@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every api-scheduler metric. It is served by Handler and can be
+// scraped directly in tests.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and chi route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// BookingTransitions counts booking status changes. New bookings are
+	// recorded with from="new".
+	BookingTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_booking_transitions_total",
+		Help: "Booking status transitions by previous and new status.",
+	}, []string{"from", "to"})
+
+	// EmailsSent counts email deliveries by template and result ("sent" or "failed").
+	EmailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_emails_total",
+		Help: "Emails by template and result.",
+	}, []string{"template", "result"})
+
+	// TurnstileFailures counts requests rejected by CAPTCHA verification.
+	TurnstileFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "scheduler_turnstile_failures_total",
+		Help: "Requests rejected by Turnstile verification.",
+	})
+
+	// RateLimited counts requests rejected by the per-IP rate limiter.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_rate_limit_rejections_total",
+		Help: "Requests rejected by the rate limiter, by endpoint.",
+	}, []string{"endpoint"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduler_db_query_duration_seconds",
+		Help:    "SQLite query latency by query name.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		BookingTransitions, EmailsSent, TurnstileFailures, RateLimited, dbQueryDuration,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records request counts and latency per chi route pattern.
+// Requests that match no route are grouped under "unmatched" so that
+// arbitrary paths cannot blow up label cardinality.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// TimeQuery starts timing the named SQLite query; call the returned func
+// when the query (including row scanning) is done.
+func TimeQuery(query string) func() {
+	start := time.Now()
+	return func() {
+		dbQueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	}
+}
+
+// EmailResult returns the EmailsSent result label for a send error.
+func EmailResult(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "sent"
+}
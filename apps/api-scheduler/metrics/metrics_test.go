@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /metrics, got %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestMiddlewareUsesRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, path := range []string{"/items/1", "/items/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	body := scrape(t)
+	if !strings.Contains(body, `http_requests_total{method="GET",route="/items/{id}",status="418"} 2`) {
+		t.Errorf("Expected two requests counted under the route pattern, got:\n%s", body)
+	}
+	if !strings.Contains(body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`) {
+		t.Errorf("Expected unknown path counted as unmatched, got:\n%s", body)
+	}
+	if !strings.Contains(body, `http_request_duration_seconds_count{method="GET",route="/items/{id}"} 2`) {
+		t.Errorf("Expected latency histogram for the route pattern, got:\n%s", body)
+	}
+}
+
+func TestTimeQuery(t *testing.T) {
+	TimeQuery("test_query")()
+
+	if body := scrape(t); !strings.Contains(body, `scheduler_db_query_duration_seconds_count{query="test_query"} 1`) {
+		t.Errorf("Expected query timing to be recorded, got:\n%s", body)
+	}
+}
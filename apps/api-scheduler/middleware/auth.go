@@ -1,26 +1,176 @@
 package middleware
 
 import (
+	"context"
 	"crypto/subtle"
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/apierror"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
 )
 
-func AdminAuth(next http.Handler) http.Handler {
+// SessionCookie holds the admin session token set by the login endpoint.
+const SessionCookie = "joledev_admin"
+
+// CSRFHeader must echo the session's CSRF token on state-changing requests
+// authenticated by the session cookie.
+const CSRFHeader = "X-CSRF-Token"
+
+type adminKey struct{}
+type sessionKey struct{}
+type apiKeyKey struct{}
+
+// Admin returns the account that authenticated the request, or nil outside
+// AdminAuth.
+func Admin(ctx context.Context) *models.AdminUser {
+	u, _ := ctx.Value(adminKey{}).(*models.AdminUser)
+	return u
+}
+
+// WithAdmin attributes ctx to u, for requests that authenticate outside
+// AdminAuth such as the login itself.
+func WithAdmin(ctx context.Context, u *models.AdminUser) context.Context {
+	return context.WithValue(ctx, adminKey{}, u)
+}
+
+// Session returns the request's admin session, or nil when it authenticated
+// with Basic credentials.
+func Session(ctx context.Context) *services.AdminSession {
+	s, _ := ctx.Value(sessionKey{}).(*services.AdminSession)
+	return s
+}
+
+// APIKey returns the key the request authenticated with, or nil for a
+// session or Basic credentials. Admin is then the key's creator.
+func APIKey(ctx context.Context) *models.APIKey {
+	k, _ := ctx.Value(apiKeyKey{}).(*models.APIKey)
+	return k
+}
+
+// AdminAuth requires an admin account, identified by the session cookie or,
+// for scripts, an API key ("Authorization: Bearer jdk_...") or HTTP Basic
+// credentials. Cookie-authenticated requests other than GET/HEAD/OPTIONS must
+// also carry the CSRF header. Basic credentials count towards the same
+// lockout as the login form, and are refused for accounts with TOTP enabled
+// since they cannot carry a one-time code. Routes limit what API keys can
+// do with RequireScope and RequireAccount.
+func AdminAuth(admins *services.Admins) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+				u, k, err := admins.AuthenticateAPIKey(ctx, strings.TrimSpace(key))
+				if err != nil {
+					WriteAuthError(w, r, "", "", err)
+					return
+				}
+				ctx = context.WithValue(ctx, apiKeyKey{}, k)
+				next.ServeHTTP(w, r.WithContext(WithAdmin(ctx, u)))
+				return
+			}
+
+			if c, err := r.Cookie(SessionCookie); err == nil {
+				s, err := admins.Session(ctx, c.Value)
+				switch {
+				case err == nil:
+					if !safeMethod(r.Method) &&
+						subtle.ConstantTimeCompare([]byte(r.Header.Get(CSRFHeader)), []byte(s.CSRFToken)) != 1 {
+						slog.WarnContext(ctx, "admin CSRF check failed", "admin", s.User.Username)
+						apierror.Write(w, r, "", apierror.New(apierror.CSRFFailed))
+						return
+					}
+					ctx = context.WithValue(ctx, sessionKey{}, s)
+					next.ServeHTTP(w, r.WithContext(WithAdmin(ctx, &s.User)))
+					return
+				case !errors.Is(err, services.ErrNoSession):
+					slog.ErrorContext(ctx, "loading admin session", "err", err)
+					apierror.Write(w, r, "", apierror.New(apierror.Internal))
+					return
+				}
+			}
+
+			// No WWW-Authenticate challenge: a browser would remember the
+			// Basic credentials and send them cross-site, bypassing CSRF.
+			user, pass, ok := r.BasicAuth()
+			if !ok {
+				apierror.Write(w, r, "", apierror.New(apierror.Unauthorized))
+				return
+			}
+			u, err := admins.Authenticate(ctx, user, pass, "")
+			if err != nil {
+				WriteAuthError(w, r, "", user, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithAdmin(ctx, u)))
+		})
+	}
+}
+
+// WriteAuthError answers a failed Authenticate: ACCOUNT_LOCKED with
+// Retry-After while locked out, TOTP_REQUIRED when only the one-time code is
+// missing, UNAUTHORIZED otherwise.
+func WriteAuthError(w http.ResponseWriter, r *http.Request, lang, username string, err error) {
+	var locked *services.LockedError
+	switch {
+	case errors.As(err, &locked):
+		secs := int(time.Until(locked.Until).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(max(secs, 1)))
+		apierror.Write(w, r, lang, apierror.New(apierror.AccountLocked))
+	case errors.Is(err, services.ErrTOTPRequired):
+		apierror.Write(w, r, lang, apierror.New(apierror.TOTPRequired))
+	case errors.Is(err, services.ErrInvalidCredentials):
+		slog.WarnContext(r.Context(), "admin authentication failed", "username", username, "ip", r.RemoteAddr)
+		apierror.Write(w, r, lang, apierror.New(apierror.Unauthorized))
+	default:
+		slog.ErrorContext(r.Context(), "authenticating admin", "err", err)
+		apierror.Write(w, r, lang, apierror.New(apierror.Internal))
+	}
+}
+
+// RequireScope refuses API keys without scope. Accounts signed in with a
+// password have every scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if k := APIKey(r.Context()); k != nil && !hasScope(k, scope) {
+				slog.WarnContext(r.Context(), "API key lacks scope", "key", k.Prefix, "scope", scope)
+				apierror.Write(w, r, "", apierror.New(apierror.InsufficientScope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAccount refuses API keys, for routes that manage the account
+// itself: its sessions, second factor and keys.
+func RequireAccount(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		password := os.Getenv("SCHEDULER_ADMIN_PASSWORD")
-		if password == "" {
-			http.Error(w, `{"success":false,"message":"Admin not configured"}`, http.StatusInternalServerError)
+		if k := APIKey(r.Context()); k != nil {
+			slog.WarnContext(r.Context(), "API key used on an account route", "key", k.Prefix)
+			apierror.Write(w, r, "", apierror.New(apierror.InsufficientScope))
 			return
 		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		user, pass, ok := r.BasicAuth()
-		if !ok || user != "admin" || subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
-			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
-			http.Error(w, `{"success":false,"message":"Unauthorized"}`, http.StatusUnauthorized)
-			return
+func hasScope(k *models.APIKey, scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
 		}
+	}
+	return false
+}
 
-		next.ServeHTTP(w, r)
-	})
+func safeMethod(m string) bool {
+	return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
 }
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joledev/api-scheduler/migrations"
+	"github.com/joledev/api-scheduler/models"
+	"github.com/joledev/api-scheduler/services"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestAdmins(t *testing.T) *services.Admins {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(context.Background(), db, migrations.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	return services.NewAdmins(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+}
+
+func TestAdminAuth(t *testing.T) {
+	ctx := context.Background()
+	admins := newTestAdmins(t)
+	u, err := admins.Create(ctx, "ana", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := admins.CreateSession(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _, err := admins.CreateAPIKey(ctx, u, "crm", []string{services.ScopeBookingsRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen string
+	h := AdminAuth(admins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = Admin(r.Context()).Username
+	}))
+
+	withCookie := func(method, csrf string) *http.Request {
+		req := httptest.NewRequest(method, "/scheduler/admin/bookings/1", nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookie, Value: s.Token})
+		if csrf != "" {
+			req.Header.Set(CSRFHeader, csrf)
+		}
+		return req
+	}
+	withBasic := func(user, pass string) *http.Request {
+		req := httptest.NewRequest(http.MethodPatch, "/scheduler/admin/bookings/1", nil)
+		req.SetBasicAuth(user, pass)
+		return req
+	}
+
+	withBearer := func(key string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/scheduler/admin/bookings", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		return req
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"no credentials", httptest.NewRequest(http.MethodGet, "/scheduler/admin/bookings", nil), 401, "UNAUTHORIZED"},
+		{"session read", withCookie(http.MethodGet, ""), 200, ""},
+		{"session write without CSRF", withCookie(http.MethodPatch, ""), 403, "CSRF_FAILED"},
+		{"session write with wrong CSRF", withCookie(http.MethodPatch, "guess"), 403, "CSRF_FAILED"},
+		{"session write with CSRF", withCookie(http.MethodPatch, s.CSRFToken), 200, ""},
+		{"basic", withBasic("ana", "correct horse battery"), 200, ""},
+		{"basic wrong password", withBasic("ana", "wrong"), 401, "UNAUTHORIZED"},
+		{"api key", withBearer(key), 200, ""},
+		{"unknown api key", withBearer("jdk_notarealkey"), 401, "UNAUTHORIZED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = ""
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				if seen != "ana" {
+					t.Errorf("handler saw admin %q, want ana", seen)
+				}
+				return
+			}
+			var resp models.ErrorResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Code != tt.code {
+				t.Errorf("code = %s, want %s", resp.Code, tt.code)
+			}
+			if w.Header().Get("WWW-Authenticate") != "" {
+				t.Error("a Basic challenge would let browsers cache credentials")
+			}
+		})
+	}
+}
+
+func TestAdminAuthBasicLockout(t *testing.T) {
+	admins := newTestAdmins(t)
+	if _, err := admins.Create(context.Background(), "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	h := AdminAuth(admins)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 6; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/scheduler/admin/me", nil)
+		req.SetBasicAuth("ana", "wrong")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status %d, Retry-After %q; want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	ctx := context.Background()
+	admins := newTestAdmins(t)
+	u, _ := admins.Create(ctx, "ana", "correct horse battery")
+	key, _, err := admins.CreateAPIKey(ctx, u, "crm", []string{services.ScopeBookingsRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	tests := []struct {
+		name   string
+		mw     func(http.Handler) http.Handler
+		basic  bool
+		status int
+	}{
+		{"key with scope", RequireScope(services.ScopeBookingsRead), false, 200},
+		{"key without scope", RequireScope(services.ScopeBookingsWrite), false, 403},
+		{"key on account route", RequireAccount, false, 403},
+		{"password without listed scope", RequireScope(services.ScopeBookingsWrite), true, 200},
+		{"password on account route", RequireAccount, true, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/scheduler/admin/bookings", nil)
+			if tt.basic {
+				req.SetBasicAuth("ana", "correct horse battery")
+			} else {
+				req.Header.Set("Authorization", "Bearer "+key)
+			}
+			w := httptest.NewRecorder()
+			AdminAuth(admins)(tt.mw(ok)).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func newCORSRouter(t *testing.T) http.Handler {
+	t.Helper()
+	cors, err := NewCORS(CORSOptions{
+		Origins:         []string{"https://joledev.com", "https://*.joledev.com", "http://localhost:*"},
+		Headers:         []string{"Content-Type", "Authorization"},
+		CredentialPaths: []string{"/scheduler/admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.Use(cors.Handler(r))
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.Get("/scheduler/slots", ok)
+	r.Post("/scheduler/bookings", ok)
+	r.Route("/scheduler/admin", func(r chi.Router) {
+		r.Get("/bookings", ok)
+		r.Patch("/bookings/{id}", ok)
+	})
+	return r
+}
+
+func preflight(path, origin, method string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	return req
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	router := newCORSRouter(t)
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://joledev.com", true},
+		{"https://www.joledev.com", true},
+		{"https://pr-12.preview.joledev.com", true},
+		{"http://localhost:4321", true},
+		{"http://joledev.com", false},
+		{"https://joledev.com.evil.com", false},
+		{"https://evil-joledev.com", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/scheduler/slots", nil)
+		req.Header.Set("Origin", tt.origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if tt.allowed && got != tt.origin {
+			t.Errorf("%s: expected origin echoed, got %q", tt.origin, got)
+		}
+		if !tt.allowed && got != "" {
+			t.Errorf("%s: expected no CORS header, got %q", tt.origin, got)
+		}
+		if w.Header().Get("Vary") != "Origin" {
+			t.Errorf("%s: expected Vary: Origin, got %q", tt.origin, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := newCORSRouter(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight("/scheduler/admin/bookings/7", "https://joledev.com", "PATCH"))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	h := w.Header()
+	if h.Get("Access-Control-Allow-Methods") != "PATCH" {
+		t.Errorf("Expected only routed methods, got %q", h.Get("Access-Control-Allow-Methods"))
+	}
+	if h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("Expected credentials allowed on admin routes")
+	}
+	if h.Get("Access-Control-Max-Age") != "7200" {
+		t.Errorf("Expected Max-Age 7200, got %q", h.Get("Access-Control-Max-Age"))
+	}
+}
+
+func TestCORSNoCredentialsOnPublicRoutes(t *testing.T) {
+	router := newCORSRouter(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight("/scheduler/bookings", "https://joledev.com", "POST"))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("Expected no credentials on public routes")
+	}
+}
+
+func TestCORSPreflightUnknownRoute(t *testing.T) {
+	router := newCORSRouter(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight("/scheduler/nope", "https://joledev.com", "GET"))
+
+	if w.Code == http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected unknown route to fall through to the router, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCORSPreflightDisallowedOrigin(t *testing.T) {
+	router := newCORSRouter(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight("/scheduler/bookings", "https://evil.com", "POST"))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", w.Code)
+	}
+}
+
+func TestNewCORSRejectsBadPatterns(t *testing.T) {
+	for _, o := range []string{"joledev.com", "https://joledev.com/", "https://a.*.joledev.com", "ftp://joledev.com", "http://localhost:abc"} {
+		if _, err := NewCORS(CORSOptions{Origins: []string{o}}); err == nil {
+			t.Errorf("Expected %q to be rejected", o)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+-- The old fixed-slot schema stored availability in its own table; slots are
+-- computed from business hours now.
+-- +migrate destructive
+-- +migrate only-if: SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'availability_slots'
+DROP TABLE availability_slots;
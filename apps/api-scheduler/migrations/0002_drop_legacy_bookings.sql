@@ -0,0 +1,5 @@
+-- Bookings from the fixed-slot schema reference availability_slots through
+-- slot_id and cannot be converted; the table is recreated by 0003.
+-- +migrate destructive
+-- +migrate only-if: SELECT COUNT(*) FROM pragma_table_info('bookings') WHERE name = 'slot_id'
+DROP TABLE bookings;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS bookings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	booking_id TEXT UNIQUE NOT NULL,
+	date TEXT NOT NULL,
+	start_time TEXT NOT NULL,
+	end_time TEXT NOT NULL,
+	meeting_type TEXT NOT NULL,
+	client_name TEXT NOT NULL,
+	client_email TEXT NOT NULL,
+	client_phone TEXT,
+	client_company TEXT,
+	client_address TEXT,
+	client_timezone TEXT,
+	notes TEXT,
+	lang TEXT DEFAULT 'es',
+	status TEXT DEFAULT 'pending',
+	confirm_token TEXT UNIQUE,
+	reject_token TEXT UNIQUE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_bookings_status ON bookings(status);
+CREATE INDEX IF NOT EXISTS idx_bookings_date ON bookings(date);
+CREATE INDEX IF NOT EXISTS idx_bookings_email_status ON bookings(client_email, status);
+CREATE INDEX IF NOT EXISTS idx_bookings_confirm_token ON bookings(confirm_token);
+CREATE INDEX IF NOT EXISTS idx_bookings_reject_token ON bookings(reject_token);
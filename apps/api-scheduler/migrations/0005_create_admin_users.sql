@@ -0,0 +1,39 @@
+-- Named admin accounts, their login sessions and the record of what each
+-- one did. Passwords are bcrypt hashes; sessions are stored by the SHA-256
+-- of their ID so a copy of the database cannot be replayed as cookies.
+CREATE TABLE IF NOT EXISTS admin_users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL COLLATE NOCASE,
+	password_hash TEXT NOT NULL,
+	failed_attempts INTEGER NOT NULL DEFAULT 0,
+	locked_until DATETIME,
+	disabled INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_login_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS admin_sessions (
+	id_hash TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+	csrf_token TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_sessions_user ON admin_sessions(user_id);
+
+-- user_id is NULL for actions taken through emailed links, which are not
+-- tied to an account; username then names the channel.
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER REFERENCES admin_users(id),
+	username TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT,
+	detail TEXT,
+	ip TEXT,
+	request_id TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created ON admin_audit_log(created_at);
@@ -0,0 +1,16 @@
+-- Optional TOTP second factor. totp_secret is set at enrollment and only
+-- enforced once totp_enabled; totp_last_step is the last accepted time step,
+-- so a code cannot be replayed within its validity window.
+ALTER TABLE admin_users ADD COLUMN totp_secret TEXT;
+ALTER TABLE admin_users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE admin_users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+-- Single-use recovery codes, stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES admin_users(id),
+	code_hash TEXT NOT NULL,
+	used_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_recovery_codes_user ON admin_recovery_codes(user_id);
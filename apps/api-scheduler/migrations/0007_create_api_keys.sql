@@ -0,0 +1,18 @@
+-- API keys for scripts. Like sessions, only the SHA-256 of the key is kept;
+-- prefix is its first characters, to tell keys apart in listings. A key
+-- acts as the admin who created it, limited to scopes (space-separated).
+CREATE TABLE IF NOT EXISTS api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT UNIQUE NOT NULL,
+	scopes TEXT NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES admin_users(id),
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME,
+	last_used_at DATETIME,
+	revoked_at DATETIME
+);
+
+-- Which key, if any, an audited action came through.
+ALTER TABLE admin_audit_log ADD COLUMN api_key_id INTEGER REFERENCES api_keys(id);
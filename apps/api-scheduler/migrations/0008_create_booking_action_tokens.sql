@@ -0,0 +1,22 @@
+-- Confirm/reject links from the admin email. Like sessions, only the
+-- SHA-256 of each token's ID is kept, and every token expires and works
+-- once. legacy marks tokens adopted from the old plaintext confirm_token and
+-- reject_token columns, which carry no signature; the server moves those
+-- over at startup, since SQLite cannot hash them here.
+CREATE TABLE IF NOT EXISTS booking_action_tokens (
+	id_hash TEXT PRIMARY KEY,
+	booking_id INTEGER NOT NULL REFERENCES bookings(id),
+	action TEXT NOT NULL CHECK (action IN ('confirm', 'reject')),
+	legacy INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_action_tokens_booking ON booking_action_tokens(booking_id);
+
+-- Links for bookings that were already decided can never be used again.
+UPDATE bookings SET confirm_token = NULL, reject_token = NULL WHERE status != 'pending';
+
+DROP INDEX IF EXISTS idx_bookings_confirm_token;
+DROP INDEX IF EXISTS idx_bookings_reject_token;
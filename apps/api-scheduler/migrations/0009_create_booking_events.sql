@@ -0,0 +1,22 @@
+-- Every status change of a booking, and internal notes added by the admin
+-- (rows with no to_status). from_status is NULL for the booking's creation.
+-- actor is the admin's username, or "client" / "email-link" for changes not
+-- made from the panel.
+CREATE TABLE IF NOT EXISTS booking_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	booking_id INTEGER NOT NULL REFERENCES bookings(id),
+	from_status TEXT,
+	to_status TEXT,
+	reason TEXT,
+	note TEXT,
+	actor TEXT NOT NULL,
+	user_id INTEGER REFERENCES admin_users(id),
+	api_key_id INTEGER REFERENCES api_keys(id),
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_events_booking ON booking_events(booking_id);
+
+-- The reason given with the latest status change; rejection and cancellation
+-- emails quote it to the client.
+ALTER TABLE bookings ADD COLUMN status_reason TEXT;
@@ -0,0 +1,6 @@
+-- The video-call link of a videollamada booking, generated when it is
+-- confirmed.
+ALTER TABLE bookings ADD COLUMN meeting_url TEXT;
+
+-- The iCalendar invitation attached to an email, if any.
+ALTER TABLE email_outbox ADD COLUMN ics TEXT;
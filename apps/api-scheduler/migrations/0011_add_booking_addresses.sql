@@ -0,0 +1,9 @@
+-- The structured address of an in-person meeting, the service area zone it
+-- falls in, and the minutes kept free around the booking for travel. Older
+-- rows have only client_address; a NULL buffer means the old fixed 2 hours.
+ALTER TABLE bookings ADD COLUMN address_street TEXT;
+ALTER TABLE bookings ADD COLUMN address_city TEXT;
+ALTER TABLE bookings ADD COLUMN address_state TEXT;
+ALTER TABLE bookings ADD COLUMN address_postal_code TEXT;
+ALTER TABLE bookings ADD COLUMN service_zone TEXT;
+ALTER TABLE bookings ADD COLUMN buffer_minutes INTEGER;
@@ -0,0 +1,35 @@
+-- Clients waiting for a slot between from_date and to_date. When a booking
+-- in that range is freed, the first waiting client whose meeting fits gets
+-- a held booking and an email with a link to claim it. Only the SHA-256 of
+-- the link's ID is kept in hold_hash. status goes from waiting to offered,
+-- then to booked when the hold is claimed or lapsed when it is not.
+CREATE TABLE IF NOT EXISTS waitlist (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	client_name TEXT NOT NULL,
+	client_email TEXT NOT NULL,
+	client_phone TEXT,
+	client_company TEXT,
+	client_address TEXT,
+	address_street TEXT,
+	address_city TEXT,
+	address_state TEXT,
+	address_postal_code TEXT,
+	service_zone TEXT,
+	buffer_minutes INTEGER NOT NULL,
+	meeting_type TEXT NOT NULL,
+	from_date TEXT NOT NULL,
+	to_date TEXT NOT NULL,
+	client_timezone TEXT,
+	notes TEXT,
+	lang TEXT NOT NULL DEFAULT 'es',
+	status TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'offered', 'booked', 'lapsed')),
+	booking_id INTEGER REFERENCES bookings(id),
+	hold_hash TEXT UNIQUE,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_status_dates ON waitlist(status, from_date, to_date);
+CREATE INDEX IF NOT EXISTS idx_waitlist_booking ON waitlist(booking_id);
+
+-- Until when a held booking keeps its slot for the waitlisted client.
+ALTER TABLE bookings ADD COLUMN hold_expires_at DATETIME;
@@ -0,0 +1,34 @@
+-- A client can leave the waitlist: status gains left, set from the link in
+-- the email sent when they join. SQLite cannot change a CHECK constraint, so
+-- the table is copied into one with the new constraint.
+CREATE TABLE waitlist_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	client_name TEXT NOT NULL,
+	client_email TEXT NOT NULL,
+	client_phone TEXT,
+	client_company TEXT,
+	client_address TEXT,
+	address_street TEXT,
+	address_city TEXT,
+	address_state TEXT,
+	address_postal_code TEXT,
+	service_zone TEXT,
+	buffer_minutes INTEGER NOT NULL,
+	meeting_type TEXT NOT NULL,
+	from_date TEXT NOT NULL,
+	to_date TEXT NOT NULL,
+	client_timezone TEXT,
+	notes TEXT,
+	lang TEXT NOT NULL DEFAULT 'es',
+	status TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'offered', 'booked', 'lapsed', 'left')),
+	booking_id INTEGER REFERENCES bookings(id),
+	hold_hash TEXT UNIQUE,
+	created_at DATETIME NOT NULL
+);
+
+INSERT INTO waitlist_new SELECT * FROM waitlist;
+DROP TABLE waitlist;
+ALTER TABLE waitlist_new RENAME TO waitlist;
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_status_dates ON waitlist(status, from_date, to_date);
+CREATE INDEX IF NOT EXISTS idx_waitlist_booking ON waitlist(booking_id);
@@ -0,0 +1,351 @@
+// Package migrations applies the embedded, numbered SQL files in this
+// directory to the database and records them in schema_migrations.
+//
+// Files are named NNNN_description.sql and may start with directives:
+//
+//	-- +migrate destructive
+//	-- +migrate only-if: SELECT COUNT(*) FROM pragma_table_info('t') WHERE name = 'c'
+//
+// A destructive migration only runs with Options.AllowDestructive and after
+// the database has been backed up. An only-if guard is evaluated inside the
+// migration's transaction; when it returns 0 the body is skipped (the version
+// is still recorded), which lets migrations adopt databases whose schema was
+// changed by hand before this package existed.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// ErrDestructive is returned when a pending migration would drop data and
+// Options.AllowDestructive is not set.
+var ErrDestructive = errors.New("destructive migration pending")
+
+type Migration struct {
+	Version     int
+	Name        string
+	SQL         string
+	Checksum    string
+	Destructive bool
+	OnlyIf      string
+}
+
+type Options struct {
+	// DryRun runs every pending migration in one transaction and rolls it
+	// back, so SQL errors surface without changing the database.
+	DryRun bool
+	// AllowDestructive permits migrations marked destructive.
+	AllowDestructive bool
+	// BackupDir receives a copy of the database before a destructive
+	// migration runs. Defaults to the database file's directory.
+	BackupDir string
+}
+
+// Result describes what happened to one pending migration.
+type Result struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// Action is "applied", "skipped" (guard returned 0) or, in a dry run,
+	// "would apply" / "would skip".
+	Action      string `json:"action"`
+	Destructive bool   `json:"destructive,omitempty"`
+	Backup      string `json:"backup,omitempty"`
+}
+
+// All returns the embedded migrations ordered by version.
+func All() ([]Migration, error) {
+	entries, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var all []Migration
+	seen := make(map[int]string)
+	for _, name := range entries {
+		m, err := parse(name)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := seen[m.Version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", prev, name, m.Version)
+		}
+		seen[m.Version] = name
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+func parse(filename string) (Migration, error) {
+	base := strings.TrimSuffix(filename, ".sql")
+	num, name, ok := strings.Cut(base, "_")
+	version, err := strconv.Atoi(num)
+	if !ok || err != nil || version <= 0 {
+		return Migration{}, fmt.Errorf("migration %s: name must look like 0001_description.sql", filename)
+	}
+
+	body, err := files.ReadFile(filename)
+	if err != nil {
+		return Migration{}, err
+	}
+	sum := sha256.Sum256(body)
+	m := Migration{Version: version, Name: name, SQL: string(body), Checksum: hex.EncodeToString(sum[:])}
+
+	for _, line := range strings.Split(m.SQL, "\n") {
+		directive, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +migrate ")
+		if !ok {
+			continue
+		}
+		switch {
+		case directive == "destructive":
+			m.Destructive = true
+		case strings.HasPrefix(directive, "only-if:"):
+			m.OnlyIf = strings.TrimSpace(strings.TrimPrefix(directive, "only-if:"))
+		default:
+			return Migration{}, fmt.Errorf("migration %s: unknown directive %q", filename, directive)
+		}
+	}
+	return m, nil
+}
+
+// Latest returns the highest embedded migration version.
+func Latest() int {
+	all, err := All()
+	if err != nil || len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+func ensureTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		skipped INTEGER NOT NULL DEFAULT 0,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// CurrentVersion returns the highest applied version, 0 for a fresh database.
+func CurrentVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var exists int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&exists)
+	if err != nil || exists == 0 {
+		return 0, err
+	}
+	var version int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// Pending returns the migrations not yet recorded in schema_migrations. It
+// fails if an applied migration's file changed since it ran.
+func Pending(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]string)
+	for rows.Next() {
+		var v int
+		var sum string
+		if err := rows.Scan(&v, &sum); err != nil {
+			return nil, err
+		}
+		applied[v] = sum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range all {
+		sum, ok := applied[m.Version]
+		if !ok {
+			pending = append(pending, m)
+			continue
+		}
+		if sum != m.Checksum {
+			return nil, fmt.Errorf("migration %04d_%s was modified after it was applied", m.Version, m.Name)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction.
+func Up(ctx context.Context, db *sql.DB, opts Options) ([]Result, error) {
+	pending, err := Pending(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return dryRun(ctx, db, pending)
+	}
+
+	var results []Result
+	for _, m := range pending {
+		res, err := apply(ctx, db, m, opts)
+		if err != nil {
+			return results, err
+		}
+		attrs := []any{"version", m.Version, "name", m.Name}
+		if res.Backup != "" {
+			attrs = append(attrs, "backup", res.Backup)
+		}
+		slog.InfoContext(ctx, "migration "+res.Action, attrs...)
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func apply(ctx context.Context, db *sql.DB, m Migration, opts Options) (Result, error) {
+	res := Result{Version: m.Version, Name: m.Name}
+
+	run, err := guard(ctx, db, m)
+	if err != nil {
+		return res, err
+	}
+	if run && m.Destructive {
+		if !opts.AllowDestructive {
+			return res, fmt.Errorf("%w: %04d_%s drops data; run `migrate -allow-destructive` to back up and apply it",
+				ErrDestructive, m.Version, m.Name)
+		}
+		if res.Backup, err = backup(ctx, db, opts.BackupDir, m.Version); err != nil {
+			return res, fmt.Errorf("backing up before %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	if err := exec(ctx, tx, m, &res); err != nil {
+		return res, err
+	}
+	if err := tx.Commit(); err != nil {
+		return res, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	return res, nil
+}
+
+// exec runs m inside tx (re-checking its guard there) and records it.
+func exec(ctx context.Context, tx *sql.Tx, m Migration, res *Result) error {
+	run := true
+	if m.OnlyIf != "" {
+		var n int
+		if err := tx.QueryRowContext(ctx, m.OnlyIf).Scan(&n); err != nil {
+			return fmt.Errorf("migration %04d_%s guard: %w", m.Version, m.Name, err)
+		}
+		run = n != 0
+	}
+
+	res.Action = "skipped"
+	if run {
+		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		res.Action = "applied"
+		res.Destructive = m.Destructive
+	}
+
+	skipped := 0
+	if !run {
+		skipped = 1
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, checksum, skipped) VALUES (?, ?, ?, ?)`,
+		m.Version, m.Name, m.Checksum, skipped)
+	return err
+}
+
+// guard evaluates m's only-if query outside a transaction, to decide
+// whether a destructive migration will actually run.
+func guard(ctx context.Context, db *sql.DB, m Migration) (bool, error) {
+	if m.OnlyIf == "" {
+		return true, nil
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, m.OnlyIf).Scan(&n); err != nil {
+		return false, fmt.Errorf("migration %04d_%s guard: %w", m.Version, m.Name, err)
+	}
+	return n != 0, nil
+}
+
+func dryRun(ctx context.Context, db *sql.DB, pending []Migration) ([]Result, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var results []Result
+	for _, m := range pending {
+		res := Result{Version: m.Version, Name: m.Name}
+		if err := exec(ctx, tx, m, &res); err != nil {
+			return results, err
+		}
+		if res.Action == "applied" {
+			res.Action = "would apply"
+		} else {
+			res.Action = "would skip"
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// backup copies the live database with VACUUM INTO, which produces a
+// consistent snapshot even while WAL writers are active.
+func backup(ctx context.Context, db *sql.DB, dir string, version int) (string, error) {
+	var file string
+	if err := db.QueryRowContext(ctx, `SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(&file); err != nil {
+		return "", err
+	}
+	if file == "" {
+		return "", errors.New("in-memory database cannot be backed up")
+	}
+	if dir == "" {
+		dir = filepath.Dir(file)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s.pre-%04d.%s.bak",
+		filepath.Base(file), version, time.Now().UTC().Format("20060102T150405Z")))
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,141 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openFileDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "scheduler.db"))
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, dir
+}
+
+func columnExists(t *testing.T, db *sql.DB, table, column string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestUpFreshDatabase(t *testing.T) {
+	db, _ := openFileDB(t)
+	ctx := context.Background()
+
+	results, err := Up(ctx, db, Options{})
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if len(results) != Latest() {
+		t.Fatalf("Expected %d results, got %+v", Latest(), results)
+	}
+	// The legacy drops have nothing to drop on a fresh database.
+	if results[0].Action != "skipped" || results[1].Action != "skipped" {
+		t.Errorf("Expected legacy drops to be skipped, got %+v", results[:2])
+	}
+	if !columnExists(t, db, "bookings", "confirm_token") {
+		t.Error("Expected bookings table to be created")
+	}
+
+	if v, _ := CurrentVersion(ctx, db); v != Latest() {
+		t.Errorf("Expected version %d, got %d", Latest(), v)
+	}
+	again, err := Up(ctx, db, Options{})
+	if err != nil || len(again) != 0 {
+		t.Errorf("Expected second Up to be a no-op, got %+v, %v", again, err)
+	}
+}
+
+func TestUpLegacyDatabaseRequiresOptIn(t *testing.T) {
+	db, dir := openFileDB(t)
+	ctx := context.Background()
+	if _, err := db.Exec(`CREATE TABLE bookings (id INTEGER PRIMARY KEY, slot_id INTEGER, client_email TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO bookings (slot_id, client_email) VALUES (1, 'old@example.com')`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Up(ctx, db, Options{})
+	if !errors.Is(err, ErrDestructive) {
+		t.Fatalf("Expected ErrDestructive, got %v", err)
+	}
+	if !columnExists(t, db, "bookings", "slot_id") {
+		t.Fatal("Legacy bookings table was dropped without opt-in")
+	}
+
+	results, err := Up(ctx, db, Options{AllowDestructive: true})
+	if err != nil {
+		t.Fatalf("Up with opt-in failed: %v", err)
+	}
+	var backup string
+	for _, res := range results {
+		if res.Name == "drop_legacy_bookings" {
+			if res.Action != "applied" || !res.Destructive {
+				t.Errorf("Expected legacy drop to be applied, got %+v", res)
+			}
+			backup = res.Backup
+		}
+	}
+	if filepath.Dir(backup) != dir {
+		t.Fatalf("Expected backup next to the database, got %q", backup)
+	}
+	if columnExists(t, db, "bookings", "slot_id") {
+		t.Error("Expected bookings to be recreated without slot_id")
+	}
+
+	saved, err := sql.Open("sqlite3", backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+	var email string
+	if err := saved.QueryRow(`SELECT client_email FROM bookings`).Scan(&email); err != nil || email != "old@example.com" {
+		t.Errorf("Expected backup to hold the legacy booking, got %q, %v", email, err)
+	}
+}
+
+func TestUpDryRunChangesNothing(t *testing.T) {
+	db, _ := openFileDB(t)
+	ctx := context.Background()
+
+	results, err := Up(ctx, db, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if len(results) != Latest() || results[2].Action != "would apply" {
+		t.Errorf("Unexpected dry run results: %+v", results)
+	}
+	if v, _ := CurrentVersion(ctx, db); v != 0 {
+		t.Errorf("Expected version 0 after dry run, got %d", v)
+	}
+	if columnExists(t, db, "bookings", "booking_id") {
+		t.Error("Dry run created the bookings table")
+	}
+}
+
+func TestPendingDetectsModifiedMigration(t *testing.T) {
+	db, _ := openFileDB(t)
+	ctx := context.Background()
+	if _, err := Up(ctx, db, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE schema_migrations SET checksum = 'x' WHERE version = 3`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Pending(ctx, db); err == nil {
+		t.Error("Expected an error for a migration changed after it was applied")
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+// AdminUser is an account allowed into /scheduler/admin. The password hash
+// never leaves the services package.
+type AdminUser struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	Disabled    bool   `json:"disabled"`
+	TOTPEnabled bool   `json:"totpEnabled"`
+	CreatedAt   string `json:"createdAt"`
+	LastLoginAt string `json:"lastLoginAt,omitempty"`
+}
+
+// AdminLoginRequest signs in. TOTPCode is required for accounts with
+// two-factor authentication and may be a recovery code instead.
+type AdminLoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	TOTPCode string `json:"totpCode"`
+}
+
+// AdminSessionResponse answers login and /me. CSRFToken must be sent back in
+// the X-CSRF-Token header on every state-changing admin request. Scopes is
+// only set for a request made with an API key; accounts have every scope.
+type AdminSessionResponse struct {
+	Success     bool     `json:"success"`
+	Username    string   `json:"username"`
+	TOTPEnabled bool     `json:"totpEnabled"`
+	CSRFToken   string   `json:"csrfToken,omitempty"`
+	ExpiresAt   string   `json:"expiresAt,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+}
+
+// TOTPEnrollResponse carries a new, not yet active TOTP secret. URI is the
+// otpauth:// provisioning URI to show as a QR code; Secret is for typing in.
+type TOTPEnrollResponse struct {
+	Success bool   `json:"success"`
+	Secret  string `json:"secret"`
+	URI     string `json:"uri"`
+}
+
+// TOTPCodeRequest confirms an enrollment or disables TOTP. Code is a
+// current one-time code; disabling also accepts a recovery code.
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TOTPRecoveryCodesResponse lists recovery codes. They are shown once and
+// each works a single time in place of a one-time code.
+type TOTPRecoveryCodesResponse struct {
+	Success       bool     `json:"success"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// APIKey describes a key for scripts. The key itself is only returned once,
+// when it is created; Prefix identifies it afterwards.
+type APIKey struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedBy  string   `json:"createdBy"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+	RevokedAt  string   `json:"revokedAt,omitempty"`
+}
+
+// CreateAPIKeyRequest mints a key. ExpiresAt is an RFC 3339 time; without it
+// the key works until revoked.
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expiresAt"`
+}
+
+// APIKeyCreatedResponse carries a new key, which is not shown again.
+type APIKeyCreatedResponse struct {
+	Success bool   `json:"success"`
+	Key     string `json:"key"`
+	APIKey  APIKey `json:"apiKey"`
+}
+
+type APIKeysResponse struct {
+	Success bool     `json:"success"`
+	APIKeys []APIKey `json:"apiKeys"`
+}
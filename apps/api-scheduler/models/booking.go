@@ -1,5 +1,12 @@
 package models
 
+import "strings"
+
+// Booking is a booking as stored. StatusReason is the reason given with the
+// latest status change; MeetingURL is the video-call link, set when a
+// videollamada booking is confirmed. BufferMinutes is kept free between the
+// booking and any other. ConfirmToken and RejectToken are the admin email
+// links, only known when the booking is created.
 type Booking struct {
 	ID             int    `json:"id"`
 	BookingID      string `json:"bookingId"`
@@ -16,24 +23,49 @@ type Booking struct {
 	Notes          string `json:"notes,omitempty"`
 	Lang           string `json:"lang"`
 	Status         string `json:"status"`
+	StatusReason   string `json:"statusReason,omitempty"`
+	MeetingURL     string `json:"meetingUrl,omitempty"`
+	BufferMinutes  int    `json:"-"`
 	ConfirmToken   string `json:"-"`
 	RejectToken    string `json:"-"`
 	CreatedAt      string `json:"createdAt,omitempty"`
 }
 
+// Address is where an in-person meeting takes place. It must be in the
+// service area; ClientAddress, when not given, is built from it.
+type Address struct {
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+}
+
+// String is the address on one line, e.g. "Av. Revolución 1234, Tijuana,
+// B.C. 22000".
+func (a Address) String() string {
+	parts := []string{}
+	for _, p := range []string{a.Street, a.City, strings.TrimSpace(a.State + " " + a.PostalCode)} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 type BookingRequest struct {
-	Date           string `json:"date"`
-	StartTime      string `json:"startTime"`
-	MeetingType    string `json:"meetingType"`
-	ClientName     string `json:"clientName"`
-	ClientEmail    string `json:"clientEmail"`
-	ClientPhone    string `json:"clientPhone"`
-	ClientCompany  string `json:"clientCompany"`
-	ClientAddress  string `json:"clientAddress"`
-	ClientTimezone string `json:"clientTimezone"`
-	Notes          string `json:"notes"`
-	Lang           string `json:"lang"`
-	TurnstileToken string `json:"turnstileToken"`
+	Date           string   `json:"date"`
+	StartTime      string   `json:"startTime"`
+	MeetingType    string   `json:"meetingType"`
+	ClientName     string   `json:"clientName"`
+	ClientEmail    string   `json:"clientEmail"`
+	ClientPhone    string   `json:"clientPhone"`
+	ClientCompany  string   `json:"clientCompany"`
+	ClientAddress  string   `json:"clientAddress"`
+	Address        *Address `json:"address,omitempty"`
+	ClientTimezone string   `json:"clientTimezone"`
+	Notes          string   `json:"notes"`
+	Lang           string   `json:"lang"`
+	TurnstileToken string   `json:"turnstileToken"`
 }
 
 type BookingResponse struct {
@@ -41,3 +73,59 @@ type BookingResponse struct {
 	BookingID string `json:"bookingId,omitempty"`
 	Message   string `json:"message"`
 }
+
+// BookingStatusUpdate changes a booking's status, adds an internal note, or
+// both. Reason is sent to the client with a rejection or cancellation; Note
+// is only for the admin.
+type BookingStatusUpdate struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+}
+
+// BookingEvent is an entry in a booking's history: a status change, or an
+// internal note when To is empty. From is empty for the booking's creation.
+type BookingEvent struct {
+	ID        int64  `json:"id"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Note      string `json:"note,omitempty"`
+	Actor     string `json:"actor"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type BookingEventsResponse struct {
+	Success bool           `json:"success"`
+	Events  []BookingEvent `json:"events"`
+}
+
+// AdminBookingRequest books on a client's behalf, for example after a phone
+// call. The booking starts confirmed and skips the CAPTCHA, the one active
+// booking per email rule and the booking limits. Override allows a time
+// outside business hours or in the past, and an in-person meeting outside
+// the service area; the slot must still be clear of other bookings.
+type AdminBookingRequest struct {
+	Date           string   `json:"date"`
+	StartTime      string   `json:"startTime"`
+	MeetingType    string   `json:"meetingType"`
+	ClientName     string   `json:"clientName"`
+	ClientEmail    string   `json:"clientEmail"`
+	ClientPhone    string   `json:"clientPhone"`
+	ClientCompany  string   `json:"clientCompany"`
+	ClientAddress  string   `json:"clientAddress"`
+	Address        *Address `json:"address,omitempty"`
+	ClientTimezone string   `json:"clientTimezone"`
+	Notes          string   `json:"notes"`
+	Lang           string   `json:"lang"`
+	Override       bool     `json:"override"`
+}
+
+// RescheduleRequest moves a pending or confirmed booking. Reason is quoted in
+// the email to the client; Override is as in AdminBookingRequest.
+type RescheduleRequest struct {
+	Date      string `json:"date"`
+	StartTime string `json:"startTime"`
+	Reason    string `json:"reason"`
+	Override  bool   `json:"override"`
+}
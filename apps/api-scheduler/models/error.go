@@ -0,0 +1,21 @@
+package models
+
+// ErrorResponse is the body of every error. Code is stable and meant for
+// programs; Message is localized for people. Details lists the invalid
+// fields of a VALIDATION_FAILED error.
+type ErrorResponse struct {
+	Success   bool         `json:"success"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// FieldError describes one invalid request field. Field is the JSON name
+// (dotted for nested fields) and Code one of required, invalid, too_long,
+// format, one_of or count.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// HealthResponse is the /readyz body. Status is "ok", "degraded" (an optional
+// component failed), "fail" (a required component failed) or "draining"
+// (shutting down).
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+type HealthCheck struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
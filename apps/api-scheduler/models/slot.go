@@ -1,36 +1,73 @@
 package models
 
-// AvailableSlot represents a computed available time slot (no DB table)
+// AvailableSlot represents a computed available time slot (no DB table).
+// Date, StartTime and EndTime are in the business time zone, and identify
+// the slot when booking it; Start and End are the same instants in UTC
+// (RFC 3339). Client is the slot in the time zone asked for, if any.
 type AvailableSlot struct {
+	Date      string     `json:"date"`
+	StartTime string     `json:"startTime"`
+	EndTime   string     `json:"endTime"`
+	Start     string     `json:"start"`
+	End       string     `json:"end"`
+	Client    *LocalSlot `json:"client,omitempty"`
+}
+
+// LocalSlot is a slot's date and times in another time zone. Near midnight
+// the date can differ from the slot's own.
+type LocalSlot struct {
 	Date      string `json:"date"`
 	StartTime string `json:"startTime"`
 	EndTime   string `json:"endTime"`
 }
 
+// AvailableSlotsResponse lists slots; Timezone is the zone of their date and
+// times, ClientTimezone that of their Client times.
 type AvailableSlotsResponse struct {
-	Slots []AvailableSlot `json:"slots"`
+	Slots          []AvailableSlot `json:"slots"`
+	Timezone       string          `json:"timezone"`
+	ClientTimezone string          `json:"clientTimezone,omitempty"`
 }
 
-// AdminBooking is a booking with full details for the admin panel
+// AdminBooking is a booking with full details for the admin panel.
+// ServiceZone is the service area zone of an in-person meeting, empty when
+// the area was not checked.
 type AdminBooking struct {
-	ID             int    `json:"id"`
-	BookingID      string `json:"bookingId"`
-	Date           string `json:"date"`
-	StartTime      string `json:"startTime"`
-	EndTime        string `json:"endTime"`
-	MeetingType    string `json:"meetingType"`
-	ClientName     string `json:"clientName"`
-	ClientEmail    string `json:"clientEmail"`
-	ClientPhone    string `json:"clientPhone,omitempty"`
-	ClientCompany  string `json:"clientCompany,omitempty"`
-	ClientAddress  string `json:"clientAddress,omitempty"`
-	ClientTimezone string `json:"clientTimezone,omitempty"`
-	Notes          string `json:"notes,omitempty"`
-	Lang           string `json:"lang"`
-	Status         string `json:"status"`
-	CreatedAt      string `json:"createdAt,omitempty"`
+	ID             int      `json:"id"`
+	BookingID      string   `json:"bookingId"`
+	Date           string   `json:"date"`
+	StartTime      string   `json:"startTime"`
+	EndTime        string   `json:"endTime"`
+	MeetingType    string   `json:"meetingType"`
+	ClientName     string   `json:"clientName"`
+	ClientEmail    string   `json:"clientEmail"`
+	ClientPhone    string   `json:"clientPhone,omitempty"`
+	ClientCompany  string   `json:"clientCompany,omitempty"`
+	ClientAddress  string   `json:"clientAddress,omitempty"`
+	Address        *Address `json:"address,omitempty"`
+	ServiceZone    string   `json:"serviceZone,omitempty"`
+	ClientTimezone string   `json:"clientTimezone,omitempty"`
+	Notes          string   `json:"notes,omitempty"`
+	Lang           string   `json:"lang"`
+	Status         string   `json:"status"`
+	StatusReason   string   `json:"statusReason,omitempty"`
+	MeetingURL     string   `json:"meetingUrl,omitempty"`
+	CreatedAt      string   `json:"createdAt,omitempty"`
 }
 
+// AdminBookingsResponse is one page of the admin listing. Total counts every
+// match, not just this page; NextCursor is empty on the last page.
 type AdminBookingsResponse struct {
+	Bookings   []AdminBooking `json:"bookings"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// ClientHistoryResponse is every booking made with one email address,
+// newest first, and how many there are in each status.
+type ClientHistoryResponse struct {
+	Email    string         `json:"email"`
+	Total    int            `json:"total"`
+	Statuses map[string]int `json:"statuses"`
 	Bookings []AdminBooking `json:"bookings"`
 }
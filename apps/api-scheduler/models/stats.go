@@ -0,0 +1,43 @@
+package models
+
+// BookingStats summarises the bookings whose meeting falls between From and
+// To. The rates count decided bookings only: confirmed (including completed
+// and no-show) against rejected. Weekdays are 0 (Sunday) to 6.
+type BookingStats struct {
+	From           string         `json:"from"`
+	To             string         `json:"to"`
+	Total          int            `json:"total"`
+	Statuses       map[string]int `json:"statuses"`
+	Weeks          []WeekStats    `json:"weeks"`
+	ConfirmRate    float64        `json:"confirmRate"`
+	RejectRate     float64        `json:"rejectRate"`
+	MedianLeadDays float64        `json:"medianLeadDays"`
+	ByHour         []HourCount    `json:"byHour"`
+	ByWeekday      []WeekdayCount `json:"byWeekday"`
+	TopSlots       []SlotCount    `json:"topSlots"`
+	GeneratedAt    string         `json:"generatedAt"`
+}
+
+// WeekStats counts the bookings of the week starting on Monday WeekStart.
+type WeekStats struct {
+	WeekStart string         `json:"weekStart"`
+	Total     int            `json:"total"`
+	Statuses  map[string]int `json:"statuses"`
+}
+
+type HourCount struct {
+	Hour  int `json:"hour"`
+	Count int `json:"count"`
+}
+
+type WeekdayCount struct {
+	Weekday int `json:"weekday"`
+	Count   int `json:"count"`
+}
+
+// SlotCount is how often a start time was requested on a weekday.
+type SlotCount struct {
+	Weekday   int    `json:"weekday"`
+	StartTime string `json:"startTime"`
+	Count     int    `json:"count"`
+}
@@ -0,0 +1,25 @@
+package models
+
+// WaitlistRequest puts a client on the waitlist for any slot from From to
+// To. The client fields are those of a BookingRequest, kept for the
+// booking made if a slot is offered and claimed.
+type WaitlistRequest struct {
+	From           string   `json:"from"`
+	To             string   `json:"to"`
+	MeetingType    string   `json:"meetingType"`
+	ClientName     string   `json:"clientName"`
+	ClientEmail    string   `json:"clientEmail"`
+	ClientPhone    string   `json:"clientPhone"`
+	ClientCompany  string   `json:"clientCompany"`
+	ClientAddress  string   `json:"clientAddress"`
+	Address        *Address `json:"address,omitempty"`
+	ClientTimezone string   `json:"clientTimezone"`
+	Notes          string   `json:"notes"`
+	Lang           string   `json:"lang"`
+	TurnstileToken string   `json:"turnstileToken"`
+}
+
+type WaitlistResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
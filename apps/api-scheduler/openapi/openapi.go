@@ -0,0 +1,176 @@
+// Package openapi embeds the API's OpenAPI 3 document, serves it at
+// /openapi.json and validates incoming requests against it.
+//
+// The validator understands the subset of JSON Schema the document uses:
+// type, required, properties, items, enum, pattern, minLength/maxLength,
+// minItems/maxItems and minimum. A pattern may carry an "x-format" hint
+// (e.g. "YYYY-MM-DD") that is shown to clients when it does not match.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+// Spec is the parsed document, indexed by operationId.
+type Spec struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+
+	operations map[string]*Operation
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *Schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*Schema `json:"properties"`
+	Items      *Schema            `json:"items"`
+	Enum       []any              `json:"enum"`
+	Pattern    string             `json:"pattern"`
+	XFormat    string             `json:"x-format"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	Minimum    *float64           `json:"minimum"`
+
+	AdditionalProperties *Schema `json:"additionalProperties"`
+
+	pattern *regexp.Regexp
+}
+
+// Load parses the embedded document, resolving references and compiling
+// patterns so that mistakes in it fail at startup.
+func Load() (*Spec, error) {
+	var s Spec
+	if err := json.Unmarshal(document, &s); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	s.operations = make(map[string]*Operation)
+	for path, item := range s.Paths {
+		for method, op := range item {
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("openapi: %s %s has no operationId", strings.ToUpper(method), path)
+			}
+			if _, dup := s.operations[op.OperationID]; dup {
+				return nil, fmt.Errorf("openapi: duplicate operationId %q", op.OperationID)
+			}
+			s.operations[op.OperationID] = op
+
+			for i, p := range op.Parameters {
+				if p.Ref != "" {
+					ref, ok := s.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+					if !ok {
+						return nil, fmt.Errorf("openapi: %s: unresolved %s", op.OperationID, p.Ref)
+					}
+					op.Parameters[i] = ref
+				}
+			}
+		}
+	}
+
+	seen := make(map[*Schema]bool)
+	var prepare func(*Schema) error
+	prepare = func(sc *Schema) error {
+		if sc == nil || seen[sc] {
+			return nil
+		}
+		seen[sc] = true
+		if sc.Ref != "" {
+			if s.schema(sc.Ref) == nil {
+				return fmt.Errorf("openapi: unresolved %s", sc.Ref)
+			}
+			return nil
+		}
+		if sc.Pattern != "" {
+			re, err := regexp.Compile(sc.Pattern)
+			if err != nil {
+				return fmt.Errorf("openapi: pattern %q: %w", sc.Pattern, err)
+			}
+			sc.pattern = re
+		}
+		for _, p := range sc.Properties {
+			if err := prepare(p); err != nil {
+				return err
+			}
+		}
+		if err := prepare(sc.Items); err != nil {
+			return err
+		}
+		return prepare(sc.AdditionalProperties)
+	}
+	for _, sc := range s.Components.Schemas {
+		if err := prepare(sc); err != nil {
+			return nil, err
+		}
+	}
+	for _, op := range s.operations {
+		for _, p := range op.Parameters {
+			if err := prepare(p.Schema); err != nil {
+				return nil, err
+			}
+		}
+		if op.RequestBody != nil {
+			for _, c := range op.RequestBody.Content {
+				if err := prepare(c.Schema); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return &s, nil
+}
+
+// Schema returns the named component schema, or nil.
+func (s *Spec) Schema(name string) *Schema {
+	return s.Components.Schemas[name]
+}
+
+// schema resolves a "#/components/schemas/..." reference.
+func (s *Spec) schema(ref string) *Schema {
+	return s.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+}
+
+func (s *Spec) resolve(sc *Schema) *Schema {
+	for sc != nil && sc.Ref != "" {
+		sc = s.schema(sc.Ref)
+	}
+	return sc
+}
+
+// ServeDocument serves the embedded document.
+func ServeDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(document)
+}
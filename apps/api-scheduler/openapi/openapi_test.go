@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+func loadSpec(t *testing.T) *Spec {
+	t.Helper()
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestModelsMatchSpec fails when a model gains, loses or retypes a JSON field
+// without the document being updated, or the other way round.
+func TestModelsMatchSpec(t *testing.T) {
+	s := loadSpec(t)
+	for name, model := range map[string]any{
+		"BookingRequest":            models.BookingRequest{},
+		"Address":                   models.Address{},
+		"BookingResponse":           models.BookingResponse{},
+		"WaitlistRequest":           models.WaitlistRequest{},
+		"WaitlistResponse":          models.WaitlistResponse{},
+		"Booking":                   models.Booking{},
+		"AdminBooking":              models.AdminBooking{},
+		"AdminBookingsResponse":     models.AdminBookingsResponse{},
+		"ClientHistoryResponse":     models.ClientHistoryResponse{},
+		"BookingStats":              models.BookingStats{},
+		"BookingStatusUpdate":       models.BookingStatusUpdate{},
+		"AdminBookingRequest":       models.AdminBookingRequest{},
+		"RescheduleRequest":         models.RescheduleRequest{},
+		"BookingEvent":              models.BookingEvent{},
+		"BookingEventsResponse":     models.BookingEventsResponse{},
+		"AdminLoginRequest":         models.AdminLoginRequest{},
+		"AdminSessionResponse":      models.AdminSessionResponse{},
+		"TOTPEnrollResponse":        models.TOTPEnrollResponse{},
+		"TOTPCodeRequest":           models.TOTPCodeRequest{},
+		"TOTPRecoveryCodesResponse": models.TOTPRecoveryCodesResponse{},
+		"APIKey":                    models.APIKey{},
+		"CreateAPIKeyRequest":       models.CreateAPIKeyRequest{},
+		"APIKeyCreatedResponse":     models.APIKeyCreatedResponse{},
+		"APIKeysResponse":           models.APIKeysResponse{},
+		"AvailableSlot":             models.AvailableSlot{},
+		"AvailableSlotsResponse":    models.AvailableSlotsResponse{},
+		"LocalSlot":                 models.LocalSlot{},
+		"HealthResponse":            models.HealthResponse{},
+		"HealthCheck":               models.HealthCheck{},
+		"ErrorResponse":             models.ErrorResponse{},
+		"FieldError":                models.FieldError{},
+	} {
+		sc := s.Schema(name)
+		if sc == nil {
+			t.Errorf("schema %s missing from openapi.json", name)
+			continue
+		}
+		compareStruct(t, s, name, reflect.TypeOf(model), sc)
+	}
+}
+
+func compareStruct(t *testing.T, s *Spec, path string, typ reflect.Type, sc *Schema) {
+	t.Helper()
+	fields := map[string]reflect.Type{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	for name, ft := range fields {
+		prop, ok := sc.Properties[name]
+		if !ok {
+			t.Errorf("%s.%s is in the model but not in the spec", path, name)
+			continue
+		}
+		compareType(t, s, path+"."+name, ft, prop)
+	}
+	for name := range sc.Properties {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("%s.%s is in the spec but not in the model", path, name)
+		}
+	}
+	for _, req := range sc.Required {
+		if _, ok := fields[req]; !ok {
+			t.Errorf("%s requires %s, which the model lacks", path, req)
+		}
+	}
+}
+
+func compareType(t *testing.T, s *Spec, path string, typ reflect.Type, sc *Schema) {
+	t.Helper()
+	sc = s.resolve(sc)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	want := map[reflect.Kind]string{
+		reflect.String:  "string",
+		reflect.Bool:    "boolean",
+		reflect.Int:     "integer",
+		reflect.Int64:   "integer",
+		reflect.Float64: "number",
+		reflect.Slice:   "array",
+		reflect.Struct:  "object",
+		reflect.Map:     "object",
+	}[typ.Kind()]
+	if sc.Type != want {
+		t.Errorf("%s: spec type %q, model %s (want %q)", path, sc.Type, typ, want)
+		return
+	}
+	switch typ.Kind() {
+	case reflect.Slice:
+		compareType(t, s, path+"[]", typ.Elem(), sc.Items)
+	case reflect.Struct:
+		compareStruct(t, s, path, typ, sc)
+	case reflect.Map:
+		if sc.AdditionalProperties != nil {
+			compareType(t, s, path+"{}", typ.Elem(), sc.AdditionalProperties)
+		}
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	s := loadSpec(t)
+	var reached string
+	h := s.Validate("createBooking")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.BookingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		reached = req.ClientName
+	}))
+
+	tests := []struct {
+		name, body string
+		status     int
+		details    string
+	}{
+		{
+			name:   "valid",
+			body:   `{"date":"2037-06-15","startTime":"09:00","meetingType":"videollamada","clientName":"Ana","clientEmail":"ana@example.com"}`,
+			status: http.StatusOK,
+		},
+		{
+			name:    "missing and malformed",
+			body:    `{"date":"15/06/2037","startTime":"09:00","meetingType":"phone","clientEmail":"ana@example.com","notes":7}`,
+			status:  http.StatusBadRequest,
+			details: "clientName:required date:format meetingType:one_of notes:invalid",
+		},
+		{
+			name:   "not JSON",
+			body:   `{"date":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:    "not an object",
+			body:    `[]`,
+			status:  http.StatusBadRequest,
+			details: "body:invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = ""
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/scheduler/bookings", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusOK {
+				if reached != "Ana" {
+					t.Error("handler did not receive the body")
+				}
+				return
+			}
+			var resp models.ErrorResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			var got []string
+			for _, d := range resp.Details {
+				got = append(got, d.Field+":"+d.Code)
+			}
+			if strings.Join(got, " ") != tt.details {
+				t.Errorf("details = %v, want %s", got, tt.details)
+			}
+		})
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	s := loadSpec(t)
+	h := s.Validate("getAvailableSlots")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scheduler/slots?from=2037-06-15&to=2037-06-20", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("valid range: status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scheduler/slots?from=tomorrow", nil))
+	var resp models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusBadRequest || len(resp.Details) != 2 ||
+		resp.Details[0].Code != "format" || resp.Details[1].Code != "required" {
+		t.Errorf("status %d, details %+v", w.Code, resp.Details)
+	}
+}
+
+func TestServeDocument(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServeDocument(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil || doc["openapi"] != "3.0.3" {
+		t.Errorf("document not served: %v", err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
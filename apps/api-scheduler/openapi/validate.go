@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/joledev/api-scheduler/apierror"
+)
+
+// maxBody bounds the bodies read for validation; handlers apply their own,
+// usually smaller, limits afterwards.
+const maxBody = 64 * 1024
+
+// Validate returns middleware that checks the query parameters and JSON body
+// of requests against the operation, answering VALIDATION_FAILED with every
+// offending field. The body is left in place for the handler to decode.
+// It panics if the operation is not in the document.
+func (s *Spec) Validate(operationID string) func(http.Handler) http.Handler {
+	op, ok := s.operations[operationID]
+	if !ok {
+		panic(fmt.Sprintf("openapi: unknown operation %q", operationID))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v := apierror.Validation()
+			lang := ""
+
+			query := r.URL.Query()
+			for _, p := range op.Parameters {
+				if p.In != "query" {
+					continue
+				}
+				value := query.Get(p.Name)
+				if value == "" {
+					if p.Required {
+						v.Required(p.Name)
+					}
+					continue
+				}
+				s.check(v, p.Name, p.Schema, value)
+			}
+
+			if op.RequestBody != nil {
+				body, e := readBody(w, r)
+				if e != nil {
+					apierror.Write(w, r, "", e)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				media, ok := op.RequestBody.Content["application/json"]
+				switch {
+				case len(bytes.TrimSpace(body)) == 0:
+					if op.RequestBody.Required {
+						apierror.Write(w, r, "", apierror.New(apierror.InvalidBody))
+						return
+					}
+				case ok:
+					var doc any
+					if err := json.Unmarshal(body, &doc); err != nil {
+						apierror.Write(w, r, "", apierror.New(apierror.InvalidBody))
+						return
+					}
+					if obj, ok := doc.(map[string]any); ok {
+						lang, _ = obj["lang"].(string)
+					}
+					s.check(v, "", media.Schema, doc)
+				}
+			}
+
+			if !v.Empty() {
+				apierror.Write(w, r, lang, v)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, *apierror.Error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, apierror.New(apierror.BodyTooLarge)
+		}
+		return nil, apierror.New(apierror.InvalidBody)
+	}
+	return body, nil
+}
+
+// check validates value against sc, adding at most one error per field.
+// name is the dotted JSON path, empty for the document root.
+func (s *Spec) check(v *apierror.Error, name string, sc *Schema, value any) {
+	sc = s.resolve(sc)
+	if sc == nil || value == nil {
+		return
+	}
+	switch sc.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			v.Invalid(orBody(name))
+			return
+		}
+		for _, req := range sc.Required {
+			if obj[req] == nil {
+				v.Required(join(name, req))
+			}
+		}
+		keys := make([]string, 0, len(sc.Properties))
+		for k := range sc.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if x, ok := obj[k]; ok {
+				s.check(v, join(name, k), sc.Properties[k], x)
+			}
+		}
+
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			v.Invalid(orBody(name))
+			return
+		}
+		lo, hi := 0, len(arr)
+		if sc.MinItems != nil {
+			lo = *sc.MinItems
+		}
+		if sc.MaxItems != nil {
+			hi = *sc.MaxItems
+		}
+		if len(arr) < lo || len(arr) > hi {
+			v.Count(name, lo, hi)
+			return
+		}
+		for i, x := range arr {
+			s.check(v, fmt.Sprintf("%s[%d]", name, i), sc.Items, x)
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.Invalid(name)
+			return
+		}
+		n := utf8.RuneCountInString(str)
+		switch {
+		case sc.MinLength != nil && n < *sc.MinLength:
+			if str == "" {
+				v.Required(name)
+			} else {
+				v.Invalid(name)
+			}
+		case sc.MaxLength != nil && n > *sc.MaxLength:
+			v.TooLong(name, *sc.MaxLength)
+		case len(sc.Enum) > 0 && !inEnum(sc.Enum, str):
+			v.OneOf(name, enumStrings(sc.Enum)...)
+		case sc.pattern != nil && !sc.pattern.MatchString(str):
+			if sc.XFormat != "" {
+				v.Format(name, sc.XFormat)
+			} else {
+				v.Invalid(name)
+			}
+		}
+
+	case "integer", "number":
+		f, ok := value.(float64)
+		if !ok || (sc.Type == "integer" && f != math.Trunc(f)) ||
+			(sc.Minimum != nil && f < *sc.Minimum) {
+			v.Invalid(name)
+		}
+
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok || (len(sc.Enum) > 0 && !inEnum(sc.Enum, b)) {
+			v.Invalid(name)
+		}
+	}
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, e := range enum {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
+
+func enumStrings(enum []any) []string {
+	out := make([]string, len(enum))
+	for i, e := range enum {
+		out[i] = fmt.Sprint(e)
+	}
+	return out
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func orBody(name string) string {
+	if name == "" {
+		return "body"
+	}
+	return name
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Booking actions that can be taken through a link in the admin email.
+const (
+	ActionConfirm = "confirm"
+	ActionReject  = "reject"
+)
+
+var (
+	ErrActionTokenInvalid = errors.New("invalid action link")
+	ErrActionTokenUsed    = errors.New("action link already used")
+	ErrActionTokenExpired = errors.New("action link expired")
+)
+
+// ActionTokens issues and redeems the confirm/reject links sent to the admin.
+//
+// A token is "<id>.<mac>" like a session token, with the MAC under a key
+// derived from the session secret so the two cannot be swapped. Only the
+// SHA-256 of the ID is stored, with the booking, the action, an expiry and
+// when it was used. Using either of a booking's tokens spends both.
+type ActionTokens struct {
+	db  *sql.DB
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewActionTokens(db *sql.DB, secret []byte, ttl time.Duration) *ActionTokens {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("booking action token"))
+	return &ActionTokens{db: db, key: m.Sum(nil), ttl: ttl, now: time.Now}
+}
+
+func (t *ActionTokens) mac(id string) string {
+	return signID(t.key, id)
+}
+
+// Issue creates a token for action on booking bookingID, inside tx so it
+// only exists if the booking does.
+func (t *ActionTokens) Issue(ctx context.Context, tx *sql.Tx, bookingID int64, action string) (string, error) {
+	id, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := t.now().UTC()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO booking_action_tokens (id_hash, booking_id, action, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		hashID(id), bookingID, action, now.Format(dbTime), now.Add(t.ttl).Format(dbTime))
+	if err != nil {
+		return "", err
+	}
+	return id + "." + t.mac(id), nil
+}
+
+// where returns the lookup for token, or false when its signature is wrong.
+// Unsigned tokens only match rows adopted from the plaintext columns.
+func (t *ActionTokens) where(token string) (string, string, bool) {
+	id, mac, signed := strings.Cut(token, ".")
+	if !signed {
+		return `id_hash = ? AND legacy = 1`, hashID(token), token != ""
+	}
+	if subtle.ConstantTimeCompare([]byte(mac), []byte(t.mac(id))) != 1 {
+		return "", "", false
+	}
+	return `id_hash = ? AND legacy = 0`, hashID(id), true
+}
+
+// Check returns the booking token would act on without using it, or why it
+// cannot be used.
+func (t *ActionTokens) Check(ctx context.Context, token, action string) (int64, error) {
+	return t.check(ctx, t.db, token, action)
+}
+
+func (t *ActionTokens) check(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, token, action string) (int64, error) {
+	where, hash, ok := t.where(token)
+	if !ok {
+		return 0, ErrActionTokenInvalid
+	}
+	var (
+		bookingID int64
+		expiresAt time.Time
+		usedAt    sql.NullTime
+	)
+	err := q.QueryRowContext(ctx,
+		`SELECT booking_id, expires_at, used_at FROM booking_action_tokens WHERE `+where+` AND action = ?`,
+		hash, action).Scan(&bookingID, &expiresAt, &usedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, ErrActionTokenInvalid
+	case err != nil:
+		return 0, err
+	case usedAt.Valid:
+		return bookingID, ErrActionTokenUsed
+	case !t.now().Before(expiresAt):
+		return bookingID, ErrActionTokenExpired
+	}
+	return bookingID, nil
+}
+
+// Use spends token inside tx, along with the booking's other tokens, and
+// returns the booking it acts on. Of two concurrent uses only one succeeds.
+func (t *ActionTokens) Use(ctx context.Context, tx *sql.Tx, token, action string) (int64, error) {
+	where, hash, ok := t.where(token)
+	if !ok {
+		return 0, ErrActionTokenInvalid
+	}
+	now := t.now().UTC().Format(dbTime)
+	var bookingID int64
+	err := tx.QueryRowContext(ctx,
+		`UPDATE booking_action_tokens SET used_at = ?
+		 WHERE `+where+` AND action = ? AND used_at IS NULL AND expires_at > ?
+		 RETURNING booking_id`,
+		now, hash, action, now).Scan(&bookingID)
+	if err == sql.ErrNoRows {
+		// Say why: unknown, used or expired.
+		if _, err := t.check(ctx, tx, token, action); err != nil {
+			return 0, err
+		}
+		return 0, ErrActionTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE booking_action_tokens SET used_at = ? WHERE booking_id = ? AND used_at IS NULL`, now, bookingID)
+	return bookingID, err
+}
+
+// AdoptLegacy moves the plaintext tokens of pending bookings made before
+// signed tokens into booking_action_tokens, hashed and expiring one TTL from
+// now, and clears the old columns. It reports how many bookings it moved.
+func (t *ActionTokens) AdoptLegacy(ctx context.Context) (int, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, COALESCE(confirm_token, ''), COALESCE(reject_token, '') FROM bookings
+		 WHERE confirm_token IS NOT NULL OR reject_token IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	type legacy struct {
+		id              int64
+		confirm, reject string
+	}
+	var found []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.confirm, &l.reject); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		found = append(found, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := t.now().UTC()
+	for _, l := range found {
+		for action, token := range map[string]string{ActionConfirm: l.confirm, ActionReject: l.reject} {
+			if token == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx,
+				`INSERT OR IGNORE INTO booking_action_tokens (id_hash, booking_id, action, legacy, created_at, expires_at)
+				 VALUES (?, ?, ?, 1, ?, ?)`,
+				hashID(token), l.id, action, now.Format(dbTime), now.Add(t.ttl).Format(dbTime)); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE bookings SET confirm_token = NULL, reject_token = NULL WHERE id = ?`, l.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(found), tx.Commit()
+}
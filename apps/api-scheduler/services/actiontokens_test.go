@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestActionTokens returns ActionTokens sharing a test database with one
+// pending booking, whose row ID is also returned.
+func newTestActionTokens(t *testing.T, now *time.Time) (*ActionTokens, *sql.DB, int64) {
+	t.Helper()
+	_, db := newTestAdmins(t, now)
+	res, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, status)
+		 VALUES ('BK-2037-001', '2037-06-15', '09:00', '09:30', 'videollamada', 'Test', 'test@example.com', 'pending')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	tokens := NewActionTokens(db, []byte("0123456789abcdef0123456789abcdef"), 24*time.Hour)
+	tokens.now = func() time.Time { return *now }
+	return tokens, db, id
+}
+
+func issue(t *testing.T, tokens *ActionTokens, db *sql.DB, id int64, action string) string {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	token, err := tokens.Issue(context.Background(), tx, id, action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func use(tokens *ActionTokens, db *sql.DB, token, action string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id, err := tokens.Use(context.Background(), tx, token, action)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func TestActionTokensSingleUse(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 10, 9, 0, 0, 0, time.UTC)
+	tokens, db, id := newTestActionTokens(t, &now)
+	confirm := issue(t, tokens, db, id, ActionConfirm)
+	reject := issue(t, tokens, db, id, ActionReject)
+
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM booking_action_tokens WHERE id_hash = ?`, confirm).Scan(&stored)
+	if stored != 0 {
+		t.Error("token stored in plaintext")
+	}
+
+	if got, err := tokens.Check(ctx, confirm, ActionConfirm); err != nil || got != id {
+		t.Fatalf("Check = %d, %v; want %d, nil", got, err, id)
+	}
+	if _, err := tokens.Check(ctx, confirm, ActionReject); !errors.Is(err, ErrActionTokenInvalid) {
+		t.Errorf("confirm token checked as reject: %v", err)
+	}
+	if got, err := use(tokens, db, confirm, ActionConfirm); err != nil || got != id {
+		t.Fatalf("Use = %d, %v; want %d, nil", got, err, id)
+	}
+	if _, err := use(tokens, db, confirm, ActionConfirm); !errors.Is(err, ErrActionTokenUsed) {
+		t.Errorf("second use: got %v, want ErrActionTokenUsed", err)
+	}
+	if _, err := use(tokens, db, reject, ActionReject); !errors.Is(err, ErrActionTokenUsed) {
+		t.Errorf("sibling token after use: got %v, want ErrActionTokenUsed", err)
+	}
+}
+
+func TestActionTokensExpire(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 10, 9, 0, 0, 0, time.UTC)
+	tokens, db, id := newTestActionTokens(t, &now)
+	confirm := issue(t, tokens, db, id, ActionConfirm)
+
+	now = now.Add(24 * time.Hour)
+	if _, err := tokens.Check(ctx, confirm, ActionConfirm); !errors.Is(err, ErrActionTokenExpired) {
+		t.Errorf("Check after TTL: got %v, want ErrActionTokenExpired", err)
+	}
+	if _, err := use(tokens, db, confirm, ActionConfirm); !errors.Is(err, ErrActionTokenExpired) {
+		t.Errorf("Use after TTL: got %v, want ErrActionTokenExpired", err)
+	}
+}
+
+func TestActionTokensRejectForgeries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 10, 9, 0, 0, 0, time.UTC)
+	tokens, db, id := newTestActionTokens(t, &now)
+	confirm := issue(t, tokens, db, id, ActionConfirm)
+
+	other := NewActionTokens(db, []byte("another secret"), 24*time.Hour)
+	if _, err := other.Check(ctx, confirm, ActionConfirm); !errors.Is(err, ErrActionTokenInvalid) {
+		t.Errorf("token accepted under another secret: %v", err)
+	}
+	for _, token := range []string{"", ".", "abc", confirm + "x", confirm[:len(confirm)-1]} {
+		if _, err := tokens.Check(ctx, token, ActionConfirm); !errors.Is(err, ErrActionTokenInvalid) {
+			t.Errorf("Check(%q) = %v, want ErrActionTokenInvalid", token, err)
+		}
+	}
+}
+
+func TestActionTokensAdoptLegacy(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 10, 9, 0, 0, 0, time.UTC)
+	tokens, db, id := newTestActionTokens(t, &now)
+	if _, err := db.Exec(`UPDATE bookings SET confirm_token = 'legacy-confirm', reject_token = 'legacy-reject' WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := tokens.AdoptLegacy(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("AdoptLegacy = %d, %v; want 1, nil", n, err)
+	}
+	var left int
+	db.QueryRow(`SELECT COUNT(*) FROM bookings WHERE confirm_token IS NOT NULL OR reject_token IS NOT NULL`).Scan(&left)
+	if left != 0 {
+		t.Errorf("%d bookings still have plaintext tokens", left)
+	}
+	if n, err := tokens.AdoptLegacy(ctx); err != nil || n != 0 {
+		t.Errorf("second AdoptLegacy = %d, %v; want 0, nil", n, err)
+	}
+
+	// Links already in inboxes keep working, once, until the TTL runs out.
+	if got, err := use(tokens, db, "legacy-confirm", ActionConfirm); err != nil || got != id {
+		t.Fatalf("legacy Use = %d, %v; want %d, nil", got, err, id)
+	}
+	if _, err := use(tokens, db, "legacy-reject", ActionReject); !errors.Is(err, ErrActionTokenUsed) {
+		t.Errorf("legacy sibling after use: got %v, want ErrActionTokenUsed", err)
+	}
+}
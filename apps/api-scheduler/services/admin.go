@@ -0,0 +1,446 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Lockout policy: after maxLoginFailures wrong passwords in a row an account
+// refuses every login, right or wrong, for lockoutDuration.
+const (
+	maxLoginFailures = 5
+	lockoutDuration  = 15 * time.Minute
+	// MinPasswordLength applies when a password is set, not when one is
+	// checked, so accounts created before a change keep working.
+	MinPasswordLength = 12
+)
+
+// dbTime is how timestamps are written, matching SQLite's CURRENT_TIMESTAMP
+// so they compare as strings. The driver reads DATETIME columns back as
+// time.Time.
+const dbTime = "2006-01-02 15:04:05"
+
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{2,64}$`)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrTOTPRequired means the password was right but the account also
+	// needs a one-time code.
+	ErrTOTPRequired = errors.New("one-time code required")
+	ErrNoSession    = errors.New("no valid session")
+	ErrUserExists   = errors.New("username already taken")
+	ErrUserNotFound = errors.New("no such admin user")
+)
+
+// LockedError is returned by Authenticate, and by the TOTP changes that
+// check a code, while an account is locked out.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return "account locked until " + e.Until.UTC().Format(time.RFC3339)
+}
+
+// dummyHash is compared against when the username does not exist, so a login
+// for an unknown user takes as long as one with a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// AdminSession is a logged-in admin. Token goes in the session cookie and is
+// only known at creation; lookups return it empty.
+type AdminSession struct {
+	Token     string
+	CSRFToken string
+	ExpiresAt time.Time
+	User      models.AdminUser
+}
+
+// AuditEntry is one row of admin_audit_log. A nil User marks an action not
+// tied to an account, such as an emailed confirm link; Actor then names it.
+// APIKey is set when User acted through one of their API keys.
+type AuditEntry struct {
+	User      *models.AdminUser
+	APIKey    *models.APIKey
+	Actor     string
+	Action    string
+	Target    string
+	Detail    string
+	IP        string
+	RequestID string
+}
+
+// Admins manages admin accounts and their sessions.
+//
+// Session tokens are "<id>.<mac>": a random ID plus an HMAC-SHA256 of it
+// under the session secret. The MAC lets forged cookies be refused without a
+// query; the database keeps only the SHA-256 of the ID, with the session's
+// expiry and CSRF token.
+type Admins struct {
+	db     *sql.DB
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewAdmins(db *sql.DB, secret []byte, ttl time.Duration) *Admins {
+	return &Admins{db: db, secret: secret, ttl: ttl, now: time.Now}
+}
+
+// ValidatePassword reports why password cannot be set, or nil.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > 72 {
+		// bcrypt ignores everything after 72 bytes.
+		return errors.New("password must be at most 72 bytes")
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(h), err
+}
+
+// Create adds an enabled account.
+func (a *Admins) Create(ctx context.Context, username, password string) (*models.AdminUser, error) {
+	if !usernameRegex.MatchString(username) {
+		return nil, fmt.Errorf("username %q must be 2-64 letters, digits, dots, dashes or underscores", username)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.db.ExecContext(ctx,
+		`INSERT INTO admin_users (username, password_hash, created_at) VALUES (?, ?, ?)`,
+		username, hash, a.now().UTC().Format(dbTime))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return a.user(ctx, `id = ?`, id)
+}
+
+// Bootstrap creates the account "admin" with password when there are no
+// accounts yet, so a deployment that only sets SCHEDULER_ADMIN_PASSWORD keeps
+// its login. It reports whether the account was created.
+func (a *Admins) Bootstrap(ctx context.Context, password string) (bool, error) {
+	if password == "" {
+		return false, nil
+	}
+	var n int
+	if err := a.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_users`).Scan(&n); err != nil || n > 0 {
+		return false, err
+	}
+	// The legacy password predates the length rule, so it is hashed as is.
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+	_, err = a.db.ExecContext(ctx,
+		`INSERT INTO admin_users (username, password_hash, created_at) VALUES ('admin', ?, ?)`,
+		hash, a.now().UTC().Format(dbTime))
+	return err == nil, err
+}
+
+// SetPassword replaces the password, clears any lockout and ends the
+// account's sessions.
+func (a *Admins) SetPassword(ctx context.Context, username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return a.update(ctx, username,
+		`UPDATE admin_users SET password_hash = ?, failed_attempts = 0, locked_until = NULL WHERE username = ?`,
+		hash, username)
+}
+
+// SetDisabled enables or disables an account. Disabling ends its sessions.
+func (a *Admins) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	return a.update(ctx, username, `UPDATE admin_users SET disabled = ? WHERE username = ?`, disabled, username)
+}
+
+func (a *Admins) update(ctx context.Context, username, query string, args ...any) error {
+	res, err := a.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	_, err = a.db.ExecContext(ctx,
+		`DELETE FROM admin_sessions WHERE user_id = (SELECT id FROM admin_users WHERE username = ?)`, username)
+	return err
+}
+
+// List returns every account ordered by username.
+func (a *Admins) List(ctx context.Context) ([]models.AdminUser, error) {
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT id, username, disabled, totp_enabled, created_at, COALESCE(last_login_at, '')
+		 FROM admin_users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.AdminUser
+	for rows.Next() {
+		var u models.AdminUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.Disabled, &u.TOTPEnabled, &u.CreatedAt, &u.LastLoginAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (a *Admins) user(ctx context.Context, where string, arg any) (*models.AdminUser, error) {
+	var u models.AdminUser
+	err := a.db.QueryRowContext(ctx,
+		`SELECT id, username, disabled, totp_enabled, created_at, COALESCE(last_login_at, '')
+		 FROM admin_users WHERE `+where, arg).Scan(&u.ID, &u.Username, &u.Disabled, &u.TOTPEnabled, &u.CreatedAt, &u.LastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	return &u, err
+}
+
+// Authenticate checks a username, password and, for accounts with TOTP
+// enabled, a one-time or recovery code, counting failures towards the
+// lockout. It returns ErrInvalidCredentials for an unknown or disabled user
+// or a wrong password or code, ErrTOTPRequired when the password was right
+// but code is empty, and a *LockedError while the account is locked.
+func (a *Admins) Authenticate(ctx context.Context, username, password, code string) (*models.AdminUser, error) {
+	var (
+		u           models.AdminUser
+		hash        string
+		lockedUntil sql.NullTime
+		totp        totpState
+	)
+	err := a.db.QueryRowContext(ctx,
+		`SELECT id, username, disabled, totp_enabled, created_at, password_hash, locked_until,
+		        COALESCE(totp_secret, ''), totp_last_step
+		 FROM admin_users WHERE username = ?`, username).Scan(
+		&u.ID, &u.Username, &u.Disabled, &u.TOTPEnabled, &u.CreatedAt, &hash, &lockedUntil,
+		&totp.secret, &totp.lastStep)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now().UTC()
+	if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+		return nil, &LockedError{Until: lockedUntil.Time}
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, a.recordFailure(ctx, &u, now, ErrInvalidCredentials)
+	}
+	if u.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+	if u.TOTPEnabled {
+		if code == "" {
+			return nil, ErrTOTPRequired
+		}
+		ok, err := a.checkSecondFactor(ctx, u.ID, totp, code, now)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, a.recordFailure(ctx, &u, now, ErrInvalidCredentials)
+		}
+	}
+
+	// Guesses made in parallel were all checked against the unlocked
+	// account read above: the one that is right must still find it unlocked.
+	res, err := a.db.ExecContext(ctx,
+		`UPDATE admin_users SET failed_attempts = 0, locked_until = NULL, last_login_at = ?
+		 WHERE id = ? AND (locked_until IS NULL OR locked_until <= ?)`,
+		now.Format(dbTime), u.ID, now.Format(dbTime))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, a.lockedError(ctx, u.ID, now)
+	}
+	u.LastLoginAt = now.Format(time.RFC3339)
+	return &u, nil
+}
+
+// recordFailure counts a wrong password or code against u, locking the
+// account when it reaches maxLoginFailures, and returns the error to report:
+// wrong, or a *LockedError if another attempt locked the account first. The
+// count is one statement, so parallel guesses cannot get past the limit.
+func (a *Admins) recordFailure(ctx context.Context, u *models.AdminUser, now time.Time, wrong error) error {
+	var failures int
+	err := a.db.QueryRowContext(ctx,
+		`UPDATE admin_users SET
+		   failed_attempts = CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END,
+		   locked_until = CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_until END
+		 WHERE id = ? AND (locked_until IS NULL OR locked_until <= ?)
+		 RETURNING failed_attempts`,
+		maxLoginFailures, maxLoginFailures, now.Add(lockoutDuration).Format(dbTime),
+		u.ID, now.Format(dbTime)).Scan(&failures)
+	if err == sql.ErrNoRows {
+		return a.lockedError(ctx, u.ID, now)
+	}
+	if err != nil {
+		return err
+	}
+	if failures == 0 {
+		slog.WarnContext(ctx, "admin account locked", "username", u.Username, "for", lockoutDuration.String())
+	}
+	return wrong
+}
+
+// checkLocked returns a *LockedError if account id is locked at now.
+func (a *Admins) checkLocked(ctx context.Context, id int64, now time.Time) error {
+	var lockedUntil sql.NullTime
+	if err := a.db.QueryRowContext(ctx,
+		`SELECT locked_until FROM admin_users WHERE id = ?`, id).Scan(&lockedUntil); err != nil {
+		return err
+	}
+	if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+		return &LockedError{Until: lockedUntil.Time}
+	}
+	return nil
+}
+
+// lockedError is the error for an attempt refused because account id was
+// locked meanwhile.
+func (a *Admins) lockedError(ctx context.Context, id int64, now time.Time) error {
+	if err := a.checkLocked(ctx, id, now); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (a *Admins) mac(id string) string {
+	return signID(a.secret, id)
+}
+
+func signID(key []byte, id string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func hashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for u.
+func (a *Admins) CreateSession(ctx context.Context, u *models.AdminUser) (*AdminSession, error) {
+	id, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := a.now().UTC()
+	s := &AdminSession{
+		Token:     id + "." + a.mac(id),
+		CSRFToken: csrf,
+		ExpiresAt: now.Add(a.ttl).Truncate(time.Second),
+		User:      *u,
+	}
+	// Expired sessions are cleared here rather than by a background job.
+	if _, err := a.db.ExecContext(ctx, `DELETE FROM admin_sessions WHERE expires_at <= ?`, now.Format(dbTime)); err != nil {
+		return nil, err
+	}
+	_, err = a.db.ExecContext(ctx,
+		`INSERT INTO admin_sessions (id_hash, user_id, csrf_token, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		hashID(id), u.ID, csrf, now.Format(dbTime), s.ExpiresAt.Format(dbTime))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Session returns the live session for token, or ErrNoSession if the token is
+// forged, expired, logged out or belongs to a disabled account.
+func (a *Admins) Session(ctx context.Context, token string) (*AdminSession, error) {
+	id, mac, ok := strings.Cut(token, ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(mac), []byte(a.mac(id))) != 1 {
+		return nil, ErrNoSession
+	}
+
+	var s AdminSession
+	err := a.db.QueryRowContext(ctx,
+		`SELECT s.csrf_token, s.expires_at, u.id, u.username, u.totp_enabled, u.created_at, COALESCE(u.last_login_at, '')
+		 FROM admin_sessions s JOIN admin_users u ON u.id = s.user_id
+		 WHERE s.id_hash = ? AND s.expires_at > ? AND u.disabled = 0`,
+		hashID(id), a.now().UTC().Format(dbTime)).Scan(
+		&s.CSRFToken, &s.ExpiresAt, &s.User.ID, &s.User.Username, &s.User.TOTPEnabled, &s.User.CreatedAt, &s.User.LastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeleteSession logs token out. Unknown tokens are not an error.
+func (a *Admins) DeleteSession(ctx context.Context, token string) error {
+	id, _, _ := strings.Cut(token, ".")
+	_, err := a.db.ExecContext(ctx, `DELETE FROM admin_sessions WHERE id_hash = ?`, hashID(id))
+	return err
+}
+
+// Audit records e in admin_audit_log. Failures are logged, not returned:
+// the action it describes has already happened.
+func Audit(ctx context.Context, db *sql.DB, e AuditEntry) {
+	var userID, keyID any
+	actor := e.Actor
+	if e.User != nil {
+		userID, actor = e.User.ID, e.User.Username
+	}
+	if e.APIKey != nil {
+		keyID = e.APIKey.ID
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO admin_audit_log (user_id, username, action, target, detail, ip, request_id, api_key_id)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, actor, e.Action, e.Target, e.Detail, e.IP, e.RequestID, keyID)
+	if err != nil {
+		slog.ErrorContext(ctx, "writing audit log", "action", e.Action, "actor", actor, "err", err)
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joledev/api-scheduler/migrations"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestAdmins returns an Admins on a migrated in-memory database whose
+// clock is *now.
+func newTestAdmins(t *testing.T, now *time.Time) (*Admins, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrations.Up(context.Background(), db, migrations.Options{}); err != nil {
+		t.Fatalf("Failed to migrate test db: %v", err)
+	}
+	a := NewAdmins(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	a.now = func() time.Time { return *now }
+	return a, db
+}
+
+func TestAuthenticateLocksOutAfterRepeatedFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 15, 9, 0, 0, 0, time.UTC)
+	a, _ := newTestAdmins(t, &now)
+	if _, err := a.Create(ctx, "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxLoginFailures; i++ {
+		if _, err := a.Authenticate(ctx, "ana", "wrong password", ""); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: got %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+
+	// Locked: even the right password is refused.
+	_, err := a.Authenticate(ctx, "ana", "correct horse battery", "")
+	var locked *LockedError
+	if !errors.As(err, &locked) || !locked.Until.Equal(now.Add(lockoutDuration)) {
+		t.Fatalf("got %v, want lockout until %v", err, now.Add(lockoutDuration))
+	}
+
+	now = now.Add(lockoutDuration)
+	u, err := a.Authenticate(ctx, "ANA", "correct horse battery", "")
+	if err != nil {
+		t.Fatalf("after lockout: %v", err)
+	}
+	if u.Username != "ana" || u.LastLoginAt == "" {
+		t.Errorf("got %+v", u)
+	}
+}
+
+func TestAuthenticateRejectsUnknownAndDisabledUsers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	a, _ := newTestAdmins(t, &now)
+	if _, err := a.Create(ctx, "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(ctx, "bob", "correct horse battery", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user: got %v", err)
+	}
+	if err := a.SetDisabled(ctx, "ana", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("disabled user: got %v", err)
+	}
+}
+
+func TestCreateValidatesAccounts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	a, _ := newTestAdmins(t, &now)
+	if _, err := a.Create(ctx, "ana", "short"); err == nil {
+		t.Error("expected short password to be refused")
+	}
+	if _, err := a.Create(ctx, "ana maría", "correct horse battery"); err == nil {
+		t.Error("expected username with a space to be refused")
+	}
+	if _, err := a.Create(ctx, "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Create(ctx, "Ana", "correct horse battery"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("case-insensitive duplicate: got %v", err)
+	}
+}
+
+func TestBootstrapOnlyWhenEmpty(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	a, _ := newTestAdmins(t, &now)
+
+	if created, err := a.Bootstrap(ctx, "legacy"); err != nil || !created {
+		t.Fatalf("first bootstrap: created=%v err=%v", created, err)
+	}
+	if _, err := a.Authenticate(ctx, "admin", "legacy", ""); err != nil {
+		t.Errorf("bootstrapped account: %v", err)
+	}
+	if created, err := a.Bootstrap(ctx, "other"); err != nil || created {
+		t.Errorf("second bootstrap: created=%v err=%v", created, err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 15, 9, 0, 0, 0, time.UTC)
+	a, db := newTestAdmins(t, &now)
+	u, err := a.Create(ctx, "ana", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := a.CreateSession(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := a.Session(ctx, s.Token)
+	if err != nil || got.User.Username != "ana" || got.CSRFToken != s.CSRFToken {
+		t.Fatalf("Session = %+v, %v", got, err)
+	}
+
+	var stored string
+	db.QueryRow(`SELECT id_hash FROM admin_sessions`).Scan(&stored)
+	if stored == "" || stored == s.Token {
+		t.Errorf("expected the session ID to be stored hashed, got %q", stored)
+	}
+
+	forged := s.Token[:len(s.Token)-2] + "xx"
+	if _, err := a.Session(ctx, forged); !errors.Is(err, ErrNoSession) {
+		t.Errorf("forged token: got %v", err)
+	}
+	other := NewAdmins(db, []byte("another secret of thirty-two bytes"), time.Hour)
+	if _, err := other.Session(ctx, s.Token); !errors.Is(err, ErrNoSession) {
+		t.Errorf("token under another secret: got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := a.Session(ctx, s.Token); !errors.Is(err, ErrNoSession) {
+		t.Errorf("expired session: got %v", err)
+	}
+
+	s, _ = a.CreateSession(ctx, u)
+	if err := a.SetPassword(ctx, "ana", "a brand new password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Session(ctx, s.Token); !errors.Is(err, ErrNoSession) {
+		t.Errorf("session after password change: got %v", err)
+	}
+
+	s, _ = a.CreateSession(ctx, u)
+	if err := a.DeleteSession(ctx, s.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Session(ctx, s.Token); !errors.Is(err, ErrNoSession) {
+		t.Errorf("session after logout: got %v", err)
+	}
+}
+
+func TestAuthenticateLocksOutParallelGuesses(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 15, 9, 0, 0, 0, time.UTC)
+	a, _ := newTestAdmins(t, &now)
+	if _, err := a.Create(ctx, "ana", "correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The guesses all read the account before any of them is counted; only
+	// maxLoginFailures may be answered as wrong, the rest as locked.
+	const guesses = 4 * maxLoginFailures
+	errs := make(chan error, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := a.Authenticate(ctx, "ana", "wrong password", "")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	wrong, locked := 0, 0
+	for err := range errs {
+		var l *LockedError
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			wrong++
+		case errors.As(err, &l):
+			locked++
+		default:
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if wrong != maxLoginFailures || locked != guesses-maxLoginFailures {
+		t.Errorf("got %d wrong and %d locked, want %d and %d", wrong, locked, maxLoginFailures, guesses-maxLoginFailures)
+	}
+	var l *LockedError
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", ""); !errors.As(err, &l) {
+		t.Errorf("got %v, want lockout", err)
+	}
+}
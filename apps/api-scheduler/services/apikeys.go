@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+// Scopes an API key can be limited to. Accounts signed in with a password
+// have all of them.
+const (
+	ScopeBookingsRead  = "bookings:read"
+	ScopeBookingsWrite = "bookings:write"
+	ScopeQuotesRead    = "quotes:read"
+)
+
+// Scopes lists every scope, in the order they are documented.
+var Scopes = []string{ScopeBookingsRead, ScopeBookingsWrite, ScopeQuotesRead}
+
+// apiKeyPrefix starts every key, so a leaked one is easy to recognise in
+// logs and secret scanners.
+const apiKeyPrefix = "jdk_"
+
+var ErrAPIKeyNotFound = errors.New("no such API key, or already revoked")
+
+// ValidScope reports whether s is one of Scopes.
+func ValidScope(s string) bool {
+	for _, v := range Scopes {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey mints a key acting as creator with the given scopes. A zero
+// expiresAt means the key does not expire. The returned key is not stored
+// and cannot be shown again.
+func (a *Admins) CreateAPIKey(ctx context.Context, creator *models.AdminUser, name string, scopes []string, expiresAt time.Time) (string, *models.APIKey, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + secret
+	now := a.now().UTC()
+	k := &models.APIKey{
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Scopes:    scopes,
+		CreatedBy: creator.Username,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	var expires any
+	if !expiresAt.IsZero() {
+		expires = expiresAt.UTC().Format(dbTime)
+		k.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	res, err := a.db.ExecContext(ctx,
+		`INSERT INTO api_keys (name, prefix, key_hash, scopes, user_id, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		name, k.Prefix, hashID(key), strings.Join(scopes, " "), creator.ID, now.Format(dbTime), expires)
+	if err != nil {
+		return "", nil, err
+	}
+	k.ID, _ = res.LastInsertId()
+	return key, k, nil
+}
+
+// AuthenticateAPIKey returns the key and the account it acts as, recording
+// the use. Unknown, revoked and expired keys, and keys of disabled accounts,
+// give ErrInvalidCredentials.
+func (a *Admins) AuthenticateAPIKey(ctx context.Context, key string) (*models.AdminUser, *models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	now := a.now().UTC()
+	var (
+		u       models.AdminUser
+		k       models.APIKey
+		scopes  string
+		created time.Time
+		expires sql.NullTime
+	)
+	err := a.db.QueryRowContext(ctx,
+		`SELECT k.id, k.name, k.prefix, k.scopes, k.created_at, k.expires_at,
+		        u.id, u.username, u.totp_enabled, u.created_at
+		 FROM api_keys k JOIN admin_users u ON u.id = k.user_id
+		 WHERE k.key_hash = ? AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > ?)
+		   AND u.disabled = 0`,
+		hashID(key), now.Format(dbTime)).Scan(
+		&k.ID, &k.Name, &k.Prefix, &scopes, &created, &expires,
+		&u.ID, &u.Username, &u.TOTPEnabled, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	k.Scopes = strings.Fields(scopes)
+	k.CreatedBy = u.Username
+	k.CreatedAt = created.UTC().Format(time.RFC3339)
+	if expires.Valid {
+		k.ExpiresAt = expires.Time.UTC().Format(time.RFC3339)
+	}
+	k.LastUsedAt = now.Format(time.RFC3339)
+
+	if _, err := a.db.ExecContext(ctx,
+		`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now.Format(dbTime), k.ID); err != nil {
+		return nil, nil, err
+	}
+	return &u, &k, nil
+}
+
+// APIKeys lists every key, newest first, including revoked and expired ones.
+func (a *Admins) APIKeys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT k.id, k.name, k.prefix, k.scopes, u.username, k.created_at, k.expires_at, k.last_used_at, k.revoked_at
+		 FROM api_keys k JOIN admin_users u ON u.id = k.user_id
+		 ORDER BY k.created_at DESC, k.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var (
+			k                      models.APIKey
+			scopes                 string
+			created                time.Time
+			expires, used, revoked sql.NullTime
+		)
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.CreatedBy, &created, &expires, &used, &revoked); err != nil {
+			return nil, err
+		}
+		k.Scopes = strings.Fields(scopes)
+		k.CreatedAt = created.UTC().Format(time.RFC3339)
+		k.ExpiresAt = formatNullTime(expires)
+		k.LastUsedAt = formatNullTime(used)
+		k.RevokedAt = formatNullTime(revoked)
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey stops key id from working. Revoked keys stay listed.
+func (a *Admins) RevokeAPIKey(ctx context.Context, id int64) error {
+	res, err := a.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`,
+		a.now().UTC().Format(dbTime), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func formatNullTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 15, 9, 0, 0, 0, time.UTC)
+	a, db := newTestAdmins(t, &now)
+	u, err := a.Create(ctx, "ana", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, k, err := a.CreateAPIKey(ctx, u, "crm-sync", []string{ScopeBookingsRead}, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, k.Prefix) || len(key) < 40 {
+		t.Fatalf("key %q with prefix %q", key, k.Prefix)
+	}
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE key_hash = ?`, key).Scan(&stored)
+	if stored != 0 {
+		t.Error("the key is stored in plain text")
+	}
+
+	now = now.Add(time.Hour)
+	got, gotKey, err := a.AuthenticateAPIKey(ctx, key)
+	if err != nil || got.Username != "ana" || len(gotKey.Scopes) != 1 || gotKey.Scopes[0] != ScopeBookingsRead {
+		t.Fatalf("AuthenticateAPIKey = %+v, %+v, %v", got, gotKey, err)
+	}
+	keys, err := a.APIKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt != now.Format(time.RFC3339) || keys[0].CreatedBy != "ana" {
+		t.Fatalf("APIKeys = %+v, %v", keys, err)
+	}
+
+	if _, _, err := a.AuthenticateAPIKey(ctx, key+"x"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong key: got %v", err)
+	}
+
+	a.SetDisabled(ctx, "ana", true)
+	if _, _, err := a.AuthenticateAPIKey(ctx, key); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("key of a disabled account: got %v", err)
+	}
+	a.SetDisabled(ctx, "ana", false)
+
+	now = now.Add(24 * time.Hour)
+	if _, _, err := a.AuthenticateAPIKey(ctx, key); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expired key: got %v", err)
+	}
+
+	key, k, _ = a.CreateAPIKey(ctx, u, "dashboard", []string{ScopeQuotesRead}, time.Time{})
+	if err := a.RevokeAPIKey(ctx, k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.AuthenticateAPIKey(ctx, key); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("revoked key: got %v", err)
+	}
+	if err := a.RevokeAPIKey(ctx, k.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("revoking twice: got %v", err)
+	}
+	if keys, _ := a.APIKeys(ctx); len(keys) != 2 || keys[0].RevokedAt == "" {
+		t.Errorf("APIKeys after revoking = %+v", keys)
+	}
+}
@@ -3,176 +3,404 @@ package services
 import (
 	"database/sql"
 	"fmt"
-	"math"
 	"time"
 
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/metrics"
 	"github.com/joledev/api-scheduler/models"
 )
 
-var tijuanaTZ *time.Location
+// Business hours, as wall-clock times in the business time zone, Monday to
+// Friday: slots of slotLength start every slotLength from opening, the last
+// one ending at closing.
+const (
+	opening    = 9 * time.Hour
+	closing    = 16 * time.Hour
+	slotLength = 30 * time.Minute
+)
 
-func init() {
-	var err error
-	tijuanaTZ, err = time.LoadLocation("America/Tijuana")
-	if err != nil {
-		// Fallback: America/Tijuana is UTC-8 (PST) / UTC-7 (PDT), same as LA
-		tijuanaTZ, _ = time.LoadLocation("America/Los_Angeles")
-	}
+const (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04"
+)
+
+// Availability works out which slots can be booked. Bookings store their
+// date and times as wall-clock values in the business time zone; they are
+// turned into instants here, so buffers, "now" and the ends of days are
+// compared as absolute times and DST changes are the time package's problem.
+type Availability struct {
+	loc    *time.Location
+	limits config.BookingLimits
+	now    func() time.Time
+}
+
+// NewAvailability returns the availability of business hours in loc under
+// limits.
+func NewAvailability(loc *time.Location, limits config.BookingLimits) *Availability {
+	return &Availability{loc: loc, limits: limits, now: time.Now}
+}
+
+// RangeError is returned by Slots for a range longer than MaxRangeDays.
+type RangeError struct {
+	MaxDays int
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("range longer than %d days", e.MaxDays)
+}
+
+// Location returns the business time zone.
+func (a *Availability) Location() *time.Location {
+	return a.loc
+}
+
+// Today returns the current date in the business time zone.
+func (a *Availability) Today() string {
+	return a.now().In(a.loc).Format(dateLayout)
 }
 
-// GetAvailableSlots computes available 30-min slots for the given date range.
-// Business hours: Mon-Fri 9:00-16:00 America/Tijuana, every 30 min.
-// Slots blocked by existing bookings (pending or confirmed) with a 2h buffer.
-func GetAvailableSlots(db *sql.DB, fromDate, toDate string) ([]models.AvailableSlot, error) {
-	from, err := time.Parse("2006-01-02", fromDate)
+// Slots computes the available slots from fromDate to toDate, inclusive.
+// Slots that break the booking limits are left out, as are slots near
+// existing bookings (pending or confirmed): a slot must start at least the
+// booking's buffer away from it, which is the travel buffer of its zone for
+// an in-person meeting and DefaultBuffer otherwise. The slot itself is
+// assumed to need DefaultBuffer. A range over MaxRangeDays is a *RangeError.
+func (a *Availability) Slots(db *sql.DB, fromDate, toDate string) ([]models.AvailableSlot, error) {
+	from, err := time.ParseInLocation(dateLayout, fromDate, a.loc)
 	if err != nil {
 		return nil, err
 	}
-	to, err := time.Parse("2006-01-02", toDate)
+	to, err := time.ParseInLocation(dateLayout, toDate, a.loc)
 	if err != nil {
 		return nil, err
 	}
-
-	// Get all bookings (pending + confirmed) in the date range
-	rows, err := db.Query(
-		`SELECT date, start_time FROM bookings
-		 WHERE status IN ('pending', 'confirmed')
-		 AND date >= ? AND date <= ?`,
-		fromDate, toDate)
-	if err != nil {
+	if err := a.checkRange(from, to); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	// Map: date -> list of booked start times in minutes since midnight
-	bookedByDate := make(map[string][]int)
-	for rows.Next() {
-		var date, startTime string
-		if err := rows.Scan(&date, &startTime); err != nil {
-			continue
-		}
-		mins := timeToMinutes(startTime)
-		if mins >= 0 {
-			bookedByDate[date] = append(bookedByDate[date], mins)
-		}
+	// Only days from today to the horizon can have slots.
+	now := a.now()
+	if today := midnight(now.In(a.loc)); from.Before(today) {
+		from = today
+	}
+	if last := a.lastDay(now); !last.IsZero() && to.After(last) {
+		to = last
+	}
+	if to.Before(from) {
+		return nil, nil
 	}
 
-	now := time.Now().In(tijuanaTZ)
-	todayStr := now.Format("2006-01-02")
+	bookings, err := a.activeBookings(db, "list_active_bookings_in_range", from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	rules := a.rules(now, bookings)
 
 	var result []models.AvailableSlot
-
-	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
-		weekday := d.Weekday()
-		if weekday == time.Saturday || weekday == time.Sunday {
-			continue
-		}
-
-		dateStr := d.Format("2006-01-02")
-		booked := bookedByDate[dateStr]
-
-		// Generate slots from 9:00 to 15:30 (last slot starts at 15:30, ends at 16:00)
-		for mins := 540; mins <= 930; mins += 30 { // 540 = 9*60, 930 = 15*60+30
-			// If today, skip slots whose start time <= current time
-			if dateStr == todayStr {
-				currentMins := now.Hour()*60 + now.Minute()
-				if mins <= currentMins {
-					continue
-				}
-			}
-
-			// Check 2h buffer against all booked slots
-			blocked := false
-			for _, bMins := range booked {
-				if math.Abs(float64(mins-bMins)) < 120 {
-					blocked = true
-					break
-				}
-			}
-			if blocked {
+	for day := from; !day.After(to); day = nextDay(day) {
+		for _, start := range a.daySlots(day) {
+			if !rules.allow(start, DefaultBuffer) {
 				continue
 			}
-
-			endMins := mins + 30
+			end := start.Add(slotLength)
 			result = append(result, models.AvailableSlot{
-				Date:      dateStr,
-				StartTime: minutesToTime(mins),
-				EndTime:   minutesToTime(endMins),
+				Date:      start.Format(dateLayout),
+				StartTime: start.Format("15:04"),
+				EndTime:   end.In(a.loc).Format("15:04"),
+				Start:     start.UTC().Format(time.RFC3339),
+				End:       end.UTC().Format(time.RFC3339),
 			})
 		}
 	}
-
 	return result, nil
 }
 
-// IsSlotAvailable checks if a specific slot on a specific date is available.
+// CheckRange returns a *RangeError when the dates from fromDate to toDate
+// span more than MaxRangeDays, as Slots would.
+func (a *Availability) CheckRange(fromDate, toDate string) error {
+	from, err := time.ParseInLocation(dateLayout, fromDate, a.loc)
+	if err != nil {
+		return err
+	}
+	to, err := time.ParseInLocation(dateLayout, toDate, a.loc)
+	if err != nil {
+		return err
+	}
+	return a.checkRange(from, to)
+}
+
+func (a *Availability) checkRange(from, to time.Time) error {
+	if n := a.limits.MaxRangeDays; n > 0 && to.After(from.AddDate(0, 0, n-1)) {
+		return &RangeError{MaxDays: n}
+	}
+	return nil
+}
+
+// IsSlotAvailable checks if a specific slot on a specific date is available
+// for a booking that needs buffer around it (see Slots).
 // Used inside transactions to re-verify before inserting.
-func IsSlotAvailable(tx *sql.Tx, date, startTime string) (bool, error) {
-	slotMins := timeToMinutes(startTime)
-	if slotMins < 0 {
+func (a *Availability) IsSlotAvailable(tx *sql.Tx, date, startTime string, buffer time.Duration) (bool, error) {
+	return a.IsSlotAvailableExcept(tx, date, startTime, buffer, 0)
+}
+
+// IsSlotAvailableExcept is IsSlotAvailable ignoring booking exceptID (the
+// row ID), so a booking being moved does not block the slots around itself.
+func (a *Availability) IsSlotAvailableExcept(tx *sql.Tx, date, startTime string, buffer time.Duration, exceptID int64) (bool, error) {
+	start, ok := a.instant(date, startTime)
+	if !ok || !a.inBusinessHours(start) {
 		return false, nil
 	}
+	day := midnight(start)
+	bookings, err := a.activeBookings(tx, "list_active_bookings_on_date", day, day, exceptID)
+	if err != nil {
+		return false, err
+	}
+	return a.rules(a.now(), bookings).allow(start, buffer), nil
+}
 
-	// Check it's a valid business hours slot
-	if slotMins < 540 || slotMins > 930 || slotMins%30 != 0 {
+// IsSlotFreeForAdmin is IsSlotAvailableExcept for a booking an admin makes:
+// the booking limits (notice, horizon and caps) do not apply, and with
+// anyTime neither do business hours nor being in the future. The slot must
+// still be clear of every other active booking.
+func (a *Availability) IsSlotFreeForAdmin(tx *sql.Tx, date, startTime string, buffer time.Duration, exceptID int64, anyTime bool) (bool, error) {
+	start, ok := a.instant(date, startTime)
+	if !ok || !anyTime && (!a.inBusinessHours(start) || !start.After(a.now())) {
 		return false, nil
 	}
-
-	// Check weekday
-	d, err := time.Parse("2006-01-02", date)
+	day := midnight(start)
+	bookings, err := a.activeBookings(tx, "list_active_bookings_on_date", day, day, exceptID)
 	if err != nil {
 		return false, err
 	}
-	if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
-		return false, nil
+	return !tooClose(start, buffer, bookings), nil
+}
+
+// rules are the booking limits as of now, with the active bookings they are
+// checked against.
+type rules struct {
+	a        *Availability
+	now      time.Time
+	earliest time.Time // first instant MinNotice allows
+	last     time.Time // start of the last date within the horizon, or zero
+	bookings []booked
+	perDay   map[string]int // active bookings by date
+	perWeek  map[string]int // and by the date of their week's Monday
+}
+
+func (a *Availability) rules(now time.Time, bookings []booked) *rules {
+	r := &rules{
+		a:        a,
+		now:      now,
+		earliest: a.addBusinessTime(now, a.limits.MinNotice),
+		last:     a.lastDay(now),
+		bookings: bookings,
+		perDay:   make(map[string]int),
+		perWeek:  make(map[string]int),
+	}
+	for _, b := range bookings {
+		r.perDay[b.date]++
+		r.perWeek[weekStart(b.start).Format(dateLayout)]++
+	}
+	return r
+}
+
+// allow reports whether a slot of business hours starting at start, needing
+// buffer around it, can be booked: it is neither too soon nor too far ahead,
+// its day and week are not full and no booking is too close.
+func (r *rules) allow(start time.Time, buffer time.Duration) bool {
+	limits := r.a.limits
+	switch {
+	case !start.After(r.now) || start.Before(r.earliest):
+		return false
+	case !r.last.IsZero() && midnight(start).After(r.last):
+		return false
+	case limits.DailyCap > 0 && r.perDay[start.Format(dateLayout)] >= limits.DailyCap:
+		return false
+	case limits.WeeklyCap > 0 && r.perWeek[weekStart(start).Format(dateLayout)] >= limits.WeeklyCap:
+		return false
+	}
+	return !tooClose(start, buffer, r.bookings)
+}
+
+// lastDay returns the start of the last date that can be booked as of now,
+// or the zero time with no horizon.
+func (a *Availability) lastDay(now time.Time) time.Time {
+	if a.limits.MaxHorizonDays == 0 {
+		return time.Time{}
 	}
+	return midnight(now.In(a.loc)).AddDate(0, 0, a.limits.MaxHorizonDays)
+}
 
-	// Check not in the past
-	now := time.Now().In(tijuanaTZ)
-	todayStr := now.Format("2006-01-02")
-	if date == todayStr {
-		currentMins := now.Hour()*60 + now.Minute()
-		if slotMins <= currentMins {
-			return false, nil
+// addBusinessTime returns the instant d of business hours after t, so that
+// 12h of notice asked for at 15:00 on a Friday ends on Tuesday at 13:00.
+func (a *Availability) addBusinessTime(t time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return t
+	}
+	for day := midnight(t.In(a.loc)); ; day = nextDay(day) {
+		if wd := day.Weekday(); wd == time.Saturday || wd == time.Sunday {
+			continue
 		}
-	} else if date < todayStr {
-		return false, nil
+		open, shut := wallClock(day, opening), wallClock(day, closing)
+		if t.Before(open) {
+			t = open
+		}
+		if !t.Before(shut) {
+			continue
+		}
+		if left := shut.Sub(t); d > left {
+			d -= left
+			continue
+		}
+		return t.Add(d)
 	}
+}
 
-	// Check 2h buffer against existing bookings
-	rows, err := tx.Query(
-		`SELECT start_time FROM bookings
-		 WHERE status IN ('pending', 'confirmed') AND date = ?`, date)
+// EndTime returns the wall-clock time a slot starting at date/startTime
+// ends, in HH:MM. It is "00:00" for one starting at 23:30.
+func (a *Availability) EndTime(date, startTime string) string {
+	start, err := time.ParseInLocation(dateTimeLayout, date+" "+startTime, a.loc)
 	if err != nil {
-		return false, err
+		return startTime
+	}
+	return start.Add(slotLength).Format("15:04")
+}
+
+// daySlots returns the start of every slot of business hours on day's date.
+// A wall-clock time that day skips, when clocks spring forward, has no slot.
+func (a *Availability) daySlots(day time.Time) []time.Time {
+	if wd := day.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return nil
+	}
+	var starts []time.Time
+	for off := opening; off+slotLength <= closing; off += slotLength {
+		t := wallClock(day, off)
+		if clockOffset(t) == off {
+			starts = append(starts, t)
+		}
+	}
+	return starts
+}
+
+// clockOffset returns the time of day t shows, as a duration since 00:00.
+func clockOffset(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// wallClock returns the time off after midnight on day's date, as shown by
+// a clock in day's location.
+func wallClock(day time.Time, off time.Duration) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, int(off/time.Hour), int(off%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+// inBusinessHours reports whether a slot can start at t.
+func (a *Availability) inBusinessHours(t time.Time) bool {
+	t = t.In(a.loc)
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	off := clockOffset(t)
+	return t.Second() == 0 && off >= opening && off+slotLength <= closing && (off-opening)%slotLength == 0
+}
+
+// instant returns the instant of a date and HH:MM time in the business zone.
+// ok is false for malformed values and for wall-clock times the zone skips.
+func (a *Availability) instant(date, clock string) (t time.Time, ok bool) {
+	t, err := time.ParseInLocation(dateTimeLayout, date+" "+clock, a.loc)
+	if err != nil || t.Format(dateTimeLayout) != date+" "+clock {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// activeBookings lists the active bookings that can bear on slots dated from
+// the date of first to that of last, except the one with row ID exceptID:
+// those from the day before, whose buffers can reach past midnight, to the
+// day after, and those in the same weeks, which count towards WeeklyCap.
+// Held bookings are active until their hold expires.
+func (a *Availability) activeBookings(q querier, metric string, first, last time.Time, exceptID int64) ([]booked, error) {
+	from, to := first.AddDate(0, 0, -1), last.AddDate(0, 0, 1)
+	if a.limits.WeeklyCap > 0 {
+		if monday := weekStart(first); monday.Before(from) {
+			from = monday
+		}
+		if sunday := weekStart(last).AddDate(0, 0, 6); sunday.After(to) {
+			to = sunday
+		}
+	}
+	defer metrics.TimeQuery(metric)()
+	rows, err := q.Query(
+		`SELECT date, start_time, COALESCE(buffer_minutes, ?) FROM bookings
+		 WHERE (status IN ('pending', 'confirmed') OR (status = 'held' AND hold_expires_at > ?))
+		 AND date >= ? AND date <= ? AND id != ?`,
+		defaultBufferMins, a.now().UTC().Format(dbTime), from.Format(dateLayout), to.Format(dateLayout), exceptID)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
+	var bookings []booked
 	for rows.Next() {
-		var bookedStart string
-		if err := rows.Scan(&bookedStart); err != nil {
+		var date, startTime string
+		var mins int
+		if err := rows.Scan(&date, &startTime, &mins); err != nil {
 			continue
 		}
-		bMins := timeToMinutes(bookedStart)
-		if math.Abs(float64(slotMins-bMins)) < 120 {
-			return false, nil
+		start, err := time.ParseInLocation(dateTimeLayout, date+" "+startTime, a.loc)
+		if err != nil {
+			continue
 		}
+		bookings = append(bookings, booked{date: date, start: start, buffer: time.Duration(mins) * time.Minute})
 	}
+	return bookings, rows.Err()
+}
 
-	return true, nil
+// midnight returns the start of t's date, in t's location.
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
 }
 
-func timeToMinutes(t string) int {
-	if len(t) < 5 {
-		return -1
-	}
-	h := int(t[0]-'0')*10 + int(t[1]-'0')
-	m := int(t[3]-'0')*10 + int(t[4]-'0')
-	return h*60 + m
+// weekStart returns the start of the Monday of t's week.
+func weekStart(t time.Time) time.Time {
+	return midnight(t).AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
+
+// nextDay returns the start of the date after day's. Adding 24 hours would
+// not do on days that are 23 or 25 hours long.
+func nextDay(day time.Time) time.Time {
+	return midnight(day).AddDate(0, 0, 1)
+}
+
+var defaultBufferMins = int(DefaultBuffer / time.Minute)
+
+// booked is an existing booking: its date, when it starts and the buffer
+// it needs.
+type booked struct {
+	date   string
+	start  time.Time
+	buffer time.Duration
 }
 
-func minutesToTime(mins int) string {
-	h := mins / 60
-	m := mins % 60
-	return fmt.Sprintf("%02d:%02d", h, m)
+// tooClose reports whether a slot starting at start and needing buffer
+// around it starts within the larger of the two buffers of any of bookings.
+// The larger one wins so that a videollamada cannot be squeezed into the
+// travel time of an in-person meeting, nor the reverse.
+func tooClose(start time.Time, buffer time.Duration, bookings []booked) bool {
+	for _, b := range bookings {
+		d := start.Sub(b.start)
+		if d < 0 {
+			d = -d
+		}
+		if d < max(buffer, b.buffer) {
+			return true
+		}
+	}
+	return false
 }
@@ -2,52 +2,31 @@ package services
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/joledev/api-scheduler/config"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func TestTimeToMinutes(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected int
-	}{
-		{"00:00", 0},
-		{"09:00", 540},
-		{"09:30", 570},
-		{"15:30", 930},
-		{"16:00", 960},
-		{"23:59", 1439},
-		{"bad", -1},
-		{"", -1},
-	}
-
-	for _, tt := range tests {
-		got := timeToMinutes(tt.input)
-		if got != tt.expected {
-			t.Errorf("timeToMinutes(%q) = %d, want %d", tt.input, got, tt.expected)
-		}
-	}
-}
-
-func TestMinutesToTime(t *testing.T) {
-	tests := []struct {
-		input    int
-		expected string
-	}{
-		{0, "00:00"},
-		{540, "09:00"},
-		{570, "09:30"},
-		{930, "15:30"},
-		{960, "16:00"},
+// testAvailability returns the availability of business hours in zone as
+// of now, an RFC 3339 instant.
+func testAvailability(t *testing.T, zone, now string) *Availability {
+	t.Helper()
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	for _, tt := range tests {
-		got := minutesToTime(tt.input)
-		if got != tt.expected {
-			t.Errorf("minutesToTime(%d) = %q, want %q", tt.input, got, tt.expected)
-		}
+	at, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		t.Fatal(err)
 	}
+	a := NewAvailability(loc, config.BookingLimits{})
+	a.now = func() time.Time { return at }
+	return a
 }
 
 func setupTestDB(t *testing.T) *sql.DB {
@@ -75,6 +54,8 @@ func setupTestDB(t *testing.T) *sql.DB {
 		status TEXT DEFAULT 'pending',
 		confirm_token TEXT UNIQUE,
 		reject_token TEXT UNIQUE,
+		buffer_minutes INTEGER,
+		hold_expires_at DATETIME,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`)
 	if err != nil {
@@ -84,13 +65,12 @@ func setupTestDB(t *testing.T) *sql.DB {
 	return db
 }
 
-func TestGetAvailableSlots_WeekdaysOnly(t *testing.T) {
+func TestSlots_WeekdaysOnly(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	// 2027-01-09 = Saturday? No, let me pick a known date range
 	// 2026-06-13 = Saturday, 2026-06-14 = Sunday, 2026-06-15 = Monday
-	slots, err := GetAvailableSlots(db, "2026-06-13", "2026-06-14")
+	slots, err := testAvailability(t, "America/Tijuana", "2026-01-01T00:00:00Z").Slots(db, "2026-06-13", "2026-06-14")
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -100,12 +80,12 @@ func TestGetAvailableSlots_WeekdaysOnly(t *testing.T) {
 	}
 }
 
-func TestGetAvailableSlots_MondaySlotCount(t *testing.T) {
+func TestSlots_MondaySlotCount(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	// 2026-06-15 = Monday, far future so no "past" filtering
-	slots, err := GetAvailableSlots(db, "2026-06-15", "2026-06-15")
+	// 2026-06-15 = Monday, after "now" so no "past" filtering
+	slots, err := testAvailability(t, "America/Tijuana", "2026-01-01T00:00:00Z").Slots(db, "2026-06-15", "2026-06-15")
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -126,7 +106,7 @@ func TestGetAvailableSlots_MondaySlotCount(t *testing.T) {
 	}
 }
 
-func TestGetAvailableSlots_BufferBlocking(t *testing.T) {
+func TestSlots_BufferBlocking(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
@@ -140,7 +120,7 @@ func TestGetAvailableSlots_BufferBlocking(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	slots, err := GetAvailableSlots(db, "2026-06-15", "2026-06-15")
+	slots, err := testAvailability(t, "America/Tijuana", "2026-01-01T00:00:00Z").Slots(db, "2026-06-15", "2026-06-15")
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -179,3 +159,435 @@ func TestGetAvailableSlots_BufferBlocking(t *testing.T) {
 		t.Error("Expected 14:00 to be available (exactly 2h after 12:00)")
 	}
 }
+
+func TestSlots_TravelBuffer(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// An in-person meeting in Ensenada keeps 4h free around it.
+	_, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+		 client_name, client_email, status, buffer_minutes)
+		 VALUES ('BK-TEST', '2026-06-15', '11:00', '11:30', 'presencial',
+		 'Test', 'test@test.com', 'confirmed', 240)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := testAvailability(t, "America/Tijuana", "2026-01-01T00:00:00Z").Slots(db, "2026-06-15", "2026-06-15")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, slot := range slots {
+		got = append(got, slot.StartTime)
+	}
+	if strings.Join(got, " ") != "15:00 15:30" {
+		t.Errorf("Expected only 15:00 and 15:30 (4h after 11:00), got %v", got)
+	}
+}
+
+func TestSlots_HeldUntilExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// A slot held for a waitlisted client until 10:00 UTC, and one whose
+	// hold already lapsed.
+	_, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+		 client_name, client_email, status, hold_expires_at)
+		 VALUES ('BK-HELD', '2037-06-15', '09:00', '09:30', 'videollamada', 'Test', 'a@test.com', 'held', '2037-01-01 10:00:00'),
+		        ('BK-LAPSED', '2037-06-15', '15:00', '15:30', 'videollamada', 'Test', 'b@test.com', 'held', '2037-01-01 08:00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := testAvailability(t, "America/Tijuana", "2037-01-01T09:00:00Z").Slots(db, "2037-06-15", "2037-06-15")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := map[string]bool{}
+	for _, slot := range slots {
+		got[slot.StartTime] = true
+	}
+	if got["09:00"] || got["10:30"] {
+		t.Errorf("Expected the held 09:00 and its buffer to be blocked, got %v", got)
+	}
+	if !got["15:00"] || !got["13:00"] {
+		t.Errorf("Expected the lapsed hold at 15:00 not to block, got %v", got)
+	}
+
+	slots, err = testAvailability(t, "America/Tijuana", "2037-01-01T10:00:00Z").Slots(db, "2037-06-15", "2037-06-15")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(slots) == 0 || slots[0].StartTime != "09:00" {
+		t.Errorf("Expected 09:00 free once its hold expired, got %v", slots)
+	}
+}
+
+func TestIsSlotAvailable_LargerBufferWins(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// A videollamada at 12:00 on Monday 2037-06-15, with the default buffer.
+	_, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+		 client_name, client_email, status)
+		 VALUES ('BK-TEST', '2037-06-15', '12:00', '12:30', 'videollamada',
+		 'Test', 'test@test.com', 'confirmed')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	a := testAvailability(t, "America/Tijuana", "2037-01-01T00:00:00Z")
+
+	tests := []struct {
+		start  string
+		buffer time.Duration
+		want   bool
+	}{
+		{"10:00", DefaultBuffer, true},
+		{"10:00", 3 * time.Hour, false},
+		{"09:00", 3 * time.Hour, true},
+		{"14:30", 3 * time.Hour, false},
+		{"15:00", 3 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		got, err := a.IsSlotAvailable(tx, "2037-06-15", tt.start, tt.buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("IsSlotAvailable(%s, buffer %s) = %v, want %v", tt.start, tt.buffer, got, tt.want)
+		}
+	}
+}
+
+// TestAvailabilityAcrossDSTAndMidnight checks slots and buffers on the days
+// clocks change and around midnight. Tijuana changes on Sunday mornings, so
+// the buffers across a change use Cairo, which changes around midnight
+// before or after a Friday.
+func TestAvailabilityAcrossDSTAndMidnight(t *testing.T) {
+	type booking struct {
+		date, start string
+		buffer      time.Duration
+	}
+	tests := []struct {
+		name     string
+		zone     string
+		now      string
+		bookings []booking
+		date     string
+		today    string
+		// want maps slot start times to their UTC instant, or to "" when the
+		// slot must not be available.
+		want map[string]string
+	}{
+		{
+			name: "PST before spring forward", zone: "America/Tijuana", now: "2026-01-01T00:00:00Z",
+			date: "2026-03-06",
+			want: map[string]string{"09:00": "2026-03-06T17:00:00Z", "15:30": "2026-03-06T23:30:00Z"},
+		},
+		{
+			name: "spring forward Sunday", zone: "America/Tijuana", now: "2026-01-01T00:00:00Z",
+			date: "2026-03-08",
+			want: map[string]string{"02:30": "", "09:00": "", "15:30": ""},
+		},
+		{
+			name: "PDT after spring forward", zone: "America/Tijuana", now: "2026-01-01T00:00:00Z",
+			date: "2026-03-09",
+			want: map[string]string{"09:00": "2026-03-09T16:00:00Z", "15:30": "2026-03-09T22:30:00Z"},
+		},
+		{
+			name: "PDT before fall back", zone: "America/Tijuana", now: "2026-01-01T00:00:00Z",
+			date: "2026-10-30",
+			want: map[string]string{"09:00": "2026-10-30T16:00:00Z"},
+		},
+		{
+			name: "fall back Sunday", zone: "America/Tijuana", now: "2026-01-01T00:00:00Z",
+			date: "2026-11-01",
+			want: map[string]string{"01:30": "", "09:00": ""},
+		},
+		{
+			name: "PST after fall back", zone: "America/Tijuana", now: "2026-01-01T00:00:00Z",
+			date: "2026-11-02",
+			want: map[string]string{"09:00": "2026-11-02T17:00:00Z"},
+		},
+		{
+			// 15:30 EET to 09:00 EEST is 16.5 hours, not 17.5.
+			name: "buffer across spring forward", zone: "Africa/Cairo", now: "2026-01-01T00:00:00Z",
+			bookings: []booking{{"2026-04-23", "15:30", 17 * time.Hour}},
+			date:     "2026-04-24",
+			want:     map[string]string{"09:00": "", "09:30": "2026-04-24T06:30:00Z"},
+		},
+		{
+			// 15:30 EEST to 09:30 EET is 19 hours, not 18.
+			name: "buffer across fall back", zone: "Africa/Cairo", now: "2026-01-01T00:00:00Z",
+			bookings: []booking{{"2026-10-29", "15:30", 19 * time.Hour}},
+			date:     "2026-10-30",
+			want:     map[string]string{"09:00": "", "09:30": "2026-10-30T07:30:00Z"},
+		},
+		{
+			name: "buffer from the day before", zone: "America/Tijuana", now: "2037-01-01T00:00:00Z",
+			bookings: []booking{{"2037-06-15", "15:30", 18 * time.Hour}},
+			date:     "2037-06-16",
+			want:     map[string]string{"09:00": "", "09:30": "2037-06-16T16:30:00Z"},
+		},
+		{
+			name: "buffer from the day after", zone: "America/Tijuana", now: "2037-01-01T00:00:00Z",
+			bookings: []booking{{"2037-06-16", "09:00", 18 * time.Hour}},
+			date:     "2037-06-15",
+			want:     map[string]string{"15:00": "2037-06-15T22:00:00Z", "15:30": ""},
+		},
+		{
+			// 23:50 on Monday in Tijuana is already Tuesday in UTC.
+			name: "late evening is still today", zone: "America/Tijuana", now: "2037-06-16T06:50:00Z",
+			date: "2037-06-15", today: "2037-06-15",
+			want: map[string]string{"09:00": "", "15:30": ""},
+		},
+		{
+			name: "next morning after late evening", zone: "America/Tijuana", now: "2037-06-16T06:50:00Z",
+			date: "2037-06-16", today: "2037-06-15",
+			want: map[string]string{"09:00": "2037-06-16T16:00:00Z"},
+		},
+		{
+			name: "just after midnight", zone: "America/Tijuana", now: "2037-06-15T07:01:00Z",
+			date: "2037-06-15", today: "2037-06-15",
+			want: map[string]string{"09:00": "2037-06-15T16:00:00Z"},
+		},
+		{
+			name: "slot starting now", zone: "America/Tijuana", now: "2037-06-15T16:00:00Z",
+			date: "2037-06-15",
+			want: map[string]string{"09:00": "", "09:30": "2037-06-15T16:30:00Z"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer db.Close()
+			for i, b := range tt.bookings {
+				_, err := db.Exec(
+					`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+					 client_name, client_email, status, buffer_minutes)
+					 VALUES (?, ?, ?, '', 'presencial', 'Test', 'test@test.com', 'confirmed', ?)`,
+					fmt.Sprintf("BK-TEST-%d", i), b.date, b.start, int(b.buffer/time.Minute))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			a := testAvailability(t, tt.zone, tt.now)
+			if tt.today != "" && a.Today() != tt.today {
+				t.Errorf("Today() = %s, want %s", a.Today(), tt.today)
+			}
+
+			slots, err := a.Slots(db, tt.date, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, s := range slots {
+				got[s.StartTime] = s.Start
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			for start, want := range tt.want {
+				if got[start] != want {
+					t.Errorf("slot %s starts at %q, want %q", start, got[start], want)
+				}
+				free, err := a.IsSlotAvailable(tx, tt.date, start, DefaultBuffer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if free != (want != "") {
+					t.Errorf("IsSlotAvailable(%s) = %v, want %v", start, free, want != "")
+				}
+			}
+		})
+	}
+}
+
+func TestBookingLimits(t *testing.T) {
+	type booking struct{ date, start, status string }
+	// Monday 2037-06-15, 15:00 in Tijuana.
+	const monday = "2037-06-15T22:00:00Z"
+	notice := config.BookingLimits{MinNotice: 12 * time.Hour}
+	tests := []struct {
+		name     string
+		limits   config.BookingLimits
+		now      string
+		bookings []booking
+		date     string
+		want     map[string]bool
+	}{
+		{
+			// One hour on Monday, seven on Tuesday and four on Wednesday.
+			name: "notice counts business hours", limits: notice, now: monday,
+			date: "2037-06-17", want: map[string]bool{"12:30": false, "13:00": true},
+		},
+		{
+			name: "no slot within the notice", limits: notice, now: monday,
+			date: "2037-06-16", want: map[string]bool{"09:00": false, "15:30": false},
+		},
+		{
+			name: "notice skips the weekend", limits: notice, now: "2037-06-19T22:00:00Z",
+			date: "2037-06-23", want: map[string]bool{"12:30": false, "13:00": true},
+		},
+		{
+			name: "notice from before opening", limits: notice, now: "2037-06-15T07:00:00Z",
+			date: "2037-06-16", want: map[string]bool{"13:30": false, "14:00": true},
+		},
+		{
+			name: "last day of the horizon", limits: config.BookingLimits{MaxHorizonDays: 60}, now: monday,
+			date: "2037-08-14", want: map[string]bool{"09:00": true, "15:30": true},
+		},
+		{
+			name: "past the horizon", limits: config.BookingLimits{MaxHorizonDays: 60}, now: monday,
+			date: "2037-08-17", want: map[string]bool{"09:00": false},
+		},
+		{
+			name: "full day", limits: config.BookingLimits{DailyCap: 1}, now: monday,
+			bookings: []booking{{"2037-06-16", "09:00", "pending"}},
+			date:     "2037-06-16", want: map[string]bool{"12:00": false, "15:30": false},
+		},
+		{
+			name: "cancelled bookings do not count", limits: config.BookingLimits{DailyCap: 1}, now: monday,
+			bookings: []booking{{"2037-06-16", "09:00", "cancelled"}},
+			date:     "2037-06-16", want: map[string]bool{"09:00": true, "15:30": true},
+		},
+		{
+			name: "full week", limits: config.BookingLimits{WeeklyCap: 2}, now: monday,
+			bookings: []booking{{"2037-06-22", "09:00", "confirmed"}, {"2037-06-23", "09:00", "pending"}},
+			date:     "2037-06-26", want: map[string]bool{"12:00": false},
+		},
+		{
+			name: "next week", limits: config.BookingLimits{WeeklyCap: 2}, now: monday,
+			bookings: []booking{{"2037-06-22", "09:00", "confirmed"}, {"2037-06-23", "09:00", "pending"}},
+			date:     "2037-06-29", want: map[string]bool{"09:00": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer db.Close()
+			for i, b := range tt.bookings {
+				_, err := db.Exec(
+					`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type,
+					 client_name, client_email, status)
+					 VALUES (?, ?, ?, '', 'videollamada', 'Test', 'test@test.com', ?)`,
+					fmt.Sprintf("BK-TEST-%d", i), b.date, b.start, b.status)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			a := testAvailability(t, "America/Tijuana", tt.now)
+			a.limits = tt.limits
+
+			slots, err := a.Slots(db, tt.date, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offered := make(map[string]bool)
+			for _, s := range slots {
+				offered[s.StartTime] = true
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			for start, want := range tt.want {
+				if offered[start] != want {
+					t.Errorf("slot %s offered = %v, want %v", start, offered[start], want)
+				}
+				free, err := a.IsSlotAvailable(tx, tt.date, start, DefaultBuffer)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if free != want {
+					t.Errorf("IsSlotAvailable(%s) = %v, want %v", start, free, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsSlotFreeForAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	if _, err := db.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, status)
+		 VALUES ('BK-TEST', '2037-06-16', '09:00', '09:30', 'videollamada', 'Test', 'test@test.com', 'confirmed')`); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	// Monday 09:00: Tuesday is full, too soon and past the horizon for a
+	// client, none of which stops the admin.
+	a := testAvailability(t, "America/Tijuana", "2037-06-15T16:00:00Z")
+	a.limits = config.BookingLimits{MinNotice: 12 * time.Hour, MaxHorizonDays: 1, DailyCap: 1}
+	if free, _ := a.IsSlotAvailable(tx, "2037-06-17", "13:00", DefaultBuffer); free {
+		t.Error("Expected the limits to refuse a client")
+	}
+
+	for _, tt := range []struct {
+		date, start string
+		anyTime     bool
+		want        bool
+	}{
+		{"2037-06-17", "13:00", false, true},
+		{"2037-06-16", "13:00", false, true},
+		{"2037-06-16", "10:00", false, false},
+		{"2037-06-16", "10:00", true, false},
+		{"2037-06-16", "19:00", false, false},
+		{"2037-06-16", "19:00", true, true},
+		{"2037-06-15", "08:00", false, false},
+		{"2037-06-15", "08:00", true, true},
+		{"2037-06-20", "10:00", false, false},
+	} {
+		free, err := a.IsSlotFreeForAdmin(tx, tt.date, tt.start, DefaultBuffer, 0, tt.anyTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if free != tt.want {
+			t.Errorf("IsSlotFreeForAdmin(%s %s, anyTime %v) = %v, want %v", tt.date, tt.start, tt.anyTime, free, tt.want)
+		}
+	}
+}
+
+func TestSlotsRange(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	a := testAvailability(t, "America/Tijuana", "2037-06-15T22:00:00Z")
+	a.limits = config.BookingLimits{MaxHorizonDays: 60, MaxRangeDays: 31}
+
+	var rangeErr *RangeError
+	if _, err := a.Slots(db, "2037-07-01", "2037-08-01"); !errors.As(err, &rangeErr) || rangeErr.MaxDays != 31 {
+		t.Errorf("32 days: err = %v, want a RangeError of 31 days", err)
+	}
+	if _, err := a.Slots(db, "2037-07-01", "2037-07-31"); err != nil {
+		t.Errorf("31 days: %v", err)
+	}
+
+	// Past days and days beyond the horizon are skipped, not walked.
+	slots, err := a.Slots(db, "2037-06-01", "2037-06-16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) == 0 || slots[0].Date != "2037-06-15" || slots[0].StartTime != "15:30" {
+		t.Errorf("first slot = %v, want 2037-06-15 15:30", slots)
+	}
+	if slots, err := a.Slots(db, "2037-08-10", "2037-09-09"); err != nil || slots[len(slots)-1].Date != "2037-08-14" {
+		t.Errorf("last slot = %v (err %v), want on 2037-08-14", slots[len(slots)-1], err)
+	}
+}
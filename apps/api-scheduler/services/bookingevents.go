@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+// Booking statuses.
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+	StatusNoShow    = "no_show"
+	StatusHeld      = "held"
+	StatusExpired   = "expired"
+)
+
+// Statuses lists every booking status, in the order they are documented.
+var Statuses = []string{StatusPending, StatusConfirmed, StatusRejected, StatusCancelled, StatusCompleted, StatusNoShow, StatusHeld, StatusExpired}
+
+// transitions lists the statuses a booking can move to from each status.
+// A held booking keeps a freed slot for a waitlisted client, who claims it
+// (pending) or lets it expire. Rejected, cancelled, completed, no-show and
+// expired bookings are final.
+var transitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusRejected, StatusCancelled},
+	StatusConfirmed: {StatusCancelled, StatusCompleted, StatusNoShow},
+	StatusHeld:      {StatusPending, StatusExpired, StatusCancelled},
+}
+
+// ValidStatus reports whether s is one of Statuses.
+func ValidStatus(s string) bool {
+	for _, v := range Statuses {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTransition reports whether a booking in status from may move to to.
+func CanTransition(from, to string) bool {
+	for _, v := range transitions[from] {
+		if to == v {
+			return true
+		}
+	}
+	return false
+}
+
+// BookingEvent is one row of booking_events: a status change, or an
+// internal note when To is empty. A nil User marks a change not made from
+// the admin panel; Actor then names who made it ("client", "email-link",
+// "waitlist").
+type BookingEvent struct {
+	BookingID int64
+	From      string
+	To        string
+	Reason    string
+	Note      string
+	User      *models.AdminUser
+	APIKey    *models.APIKey
+	Actor     string
+}
+
+// RecordBookingEvent stores e inside tx, so it is kept exactly when the
+// change it describes is.
+func RecordBookingEvent(ctx context.Context, tx *sql.Tx, e BookingEvent) error {
+	var userID, keyID any
+	actor := e.Actor
+	if e.User != nil {
+		userID, actor = e.User.ID, e.User.Username
+	}
+	if e.APIKey != nil {
+		keyID = e.APIKey.ID
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO booking_events (booking_id, from_status, to_status, reason, note, actor, user_id, api_key_id, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.BookingID, nullString(e.From), nullString(e.To), nullString(e.Reason), nullString(e.Note),
+		actor, userID, keyID, time.Now().UTC().Format(dbTime))
+	return err
+}
+
+// BookingEvents lists the events of booking bookingID (the row ID), oldest
+// first.
+func BookingEvents(ctx context.Context, db *sql.DB, bookingID int64) ([]models.BookingEvent, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, COALESCE(from_status, ''), COALESCE(to_status, ''), COALESCE(reason, ''), COALESCE(note, ''),
+		        actor, created_at
+		 FROM booking_events WHERE booking_id = ? ORDER BY id`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.BookingEvent{}
+	for rows.Next() {
+		var (
+			e       models.BookingEvent
+			created time.Time
+		)
+		if err := rows.Scan(&e.ID, &e.From, &e.To, &e.Reason, &e.Note, &e.Actor, &created); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = created.UTC().Format(time.RFC3339)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,34 @@
+package services
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusPending, StatusConfirmed, true},
+		{StatusPending, StatusRejected, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusCompleted, false},
+		{StatusPending, StatusNoShow, false},
+		{StatusConfirmed, StatusCompleted, true},
+		{StatusConfirmed, StatusNoShow, true},
+		{StatusConfirmed, StatusCancelled, true},
+		{StatusConfirmed, StatusRejected, false},
+		{StatusConfirmed, StatusPending, false},
+		{StatusCancelled, StatusCancelled, false},
+		{StatusRejected, StatusConfirmed, false},
+		{StatusCompleted, StatusNoShow, false},
+		{StatusNoShow, StatusCompleted, false},
+		{StatusHeld, StatusPending, true},
+		{StatusHeld, StatusExpired, true},
+		{StatusHeld, StatusConfirmed, false},
+		{StatusExpired, StatusPending, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
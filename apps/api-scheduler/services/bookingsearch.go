@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/joledev/api-scheduler/metrics"
+	"github.com/joledev/api-scheduler/models"
+)
+
+// BookingSorts lists the orders SearchBookings can sort by; a leading "-"
+// reverses one.
+var BookingSorts = []string{"date", "-date", "created", "-created", "name", "-name"}
+
+// sortKeys is the SQL expression each sort orders by; the row ID breaks
+// ties, so every row has a distinct position a cursor can point at. The
+// expressions have no declared type, so they scan as the stored text.
+var sortKeys = map[string]string{
+	"date":    "date || ' ' || start_time",
+	"created": "CAST(created_at AS TEXT)",
+	"name":    "lower(client_name)",
+}
+
+var ErrInvalidCursor = errors.New("invalid or mismatched cursor")
+
+// BookingQuery selects bookings for the admin listing. Empty fields do not
+// filter; Limit 0 returns every match.
+type BookingQuery struct {
+	From, To    string   // dates, inclusive
+	Statuses    []string // any of
+	MeetingType string
+	Email       string // exact, ignoring case
+	Text        string // substring of the ID, client name, email, phone, company or notes
+	Sort        string // one of BookingSorts, "date" if empty
+	Limit       int
+	Cursor      string // NextCursor of the previous page
+}
+
+// cursor is the position of the last row of a page, in the order it was
+// sorted by.
+type cursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int    `json:"id"`
+}
+
+// ValidBookingSort reports whether s is one of BookingSorts.
+func ValidBookingSort(s string) bool {
+	for _, v := range BookingSorts {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// adminBookingColumns are scanned by scanAdminBooking.
+const adminBookingColumns = `id, booking_id, date, start_time, end_time, meeting_type,
+	client_name, client_email, COALESCE(client_phone, ''), COALESCE(client_company, ''),
+	COALESCE(client_address, ''), COALESCE(client_timezone, ''), COALESCE(notes, ''), lang,
+	status, COALESCE(status_reason, ''), COALESCE(meeting_url, ''), created_at,
+	COALESCE(address_street, ''), COALESCE(address_city, ''), COALESCE(address_state, ''),
+	COALESCE(address_postal_code, ''), COALESCE(service_zone, '')`
+
+func scanAdminBooking(rows *sql.Rows, b *models.AdminBooking, extra ...any) error {
+	var a models.Address
+	err := rows.Scan(append([]any{
+		&b.ID, &b.BookingID, &b.Date, &b.StartTime, &b.EndTime, &b.MeetingType,
+		&b.ClientName, &b.ClientEmail, &b.ClientPhone, &b.ClientCompany, &b.ClientAddress,
+		&b.ClientTimezone, &b.Notes, &b.Lang, &b.Status, &b.StatusReason, &b.MeetingURL, &b.CreatedAt,
+		&a.Street, &a.City, &a.State, &a.PostalCode, &b.ServiceZone,
+	}, extra...)...)
+	b.Address = nil
+	if a != (models.Address{}) {
+		b.Address = &a
+	}
+	return err
+}
+
+// order returns q's sort (defaulted), the SQL expression it sorts by, the
+// direction and the comparison that selects rows after a cursor.
+func (q BookingQuery) order() (sort, key, dir, cmp string) {
+	sort = q.Sort
+	if sort == "" {
+		sort = "date"
+	}
+	key = sortKeys[strings.TrimPrefix(sort, "-")]
+	if strings.HasPrefix(sort, "-") {
+		return sort, key, "DESC", "<"
+	}
+	return sort, key, "ASC", ">"
+}
+
+// where returns the WHERE clause ("" if none) and arguments of q's filters.
+func (q BookingQuery) where() (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	if q.From != "" {
+		where, args = append(where, "date >= ?"), append(args, q.From)
+	}
+	if q.To != "" {
+		where, args = append(where, "date <= ?"), append(args, q.To)
+	}
+	if len(q.Statuses) > 0 {
+		where = append(where, "status IN (?"+strings.Repeat(", ?", len(q.Statuses)-1)+")")
+		for _, s := range q.Statuses {
+			args = append(args, s)
+		}
+	}
+	if q.MeetingType != "" {
+		where, args = append(where, "meeting_type = ?"), append(args, q.MeetingType)
+	}
+	if q.Email != "" {
+		where, args = append(where, "lower(client_email) = lower(?)"), append(args, q.Email)
+	}
+	if q.Text != "" {
+		like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q.Text) + "%"
+		where = append(where, `(booking_id LIKE ? ESCAPE '\' OR client_name LIKE ? ESCAPE '\'
+		 OR client_email LIKE ? ESCAPE '\' OR client_phone LIKE ? ESCAPE '\'
+		 OR client_company LIKE ? ESCAPE '\' OR notes LIKE ? ESCAPE '\')`)
+		args = append(args, like, like, like, like, like, like)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// SearchBookings returns the page of bookings matching q, how many match in
+// total, and the cursor of the next page ("" on the last one). A cursor
+// from another sort order gives ErrInvalidCursor.
+func SearchBookings(ctx context.Context, db *sql.DB, q BookingQuery) ([]models.AdminBooking, int, string, error) {
+	sort, key, dir, cmp := q.order()
+	if key == "" {
+		return nil, 0, "", errors.New("unknown sort " + sort)
+	}
+	filter, args := q.where()
+
+	done := metrics.TimeQuery("count_bookings")
+	var total int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM bookings"+filter, args...).Scan(&total)
+	done()
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.Sort != sort {
+			return nil, 0, "", ErrInvalidCursor
+		}
+		page := "(" + key + ", id) " + cmp + " (?, ?)"
+		if filter == "" {
+			filter = " WHERE " + page
+		} else {
+			filter += " AND " + page
+		}
+		args = append(args, c.Key, c.ID)
+	}
+	limit := ""
+	if q.Limit > 0 {
+		// One more than asked tells whether there is a next page.
+		limit = " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	defer metrics.TimeQuery("list_bookings")()
+	rows, err := db.QueryContext(ctx,
+		"SELECT "+adminBookingColumns+", "+key+" FROM bookings"+filter+
+			" ORDER BY "+key+" "+dir+", id "+dir+limit, args...)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer rows.Close()
+
+	bookings := []models.AdminBooking{}
+	var rowKey, lastKey string
+	for rows.Next() {
+		var b models.AdminBooking
+		if err := scanAdminBooking(rows, &b, &rowKey); err != nil {
+			return nil, 0, "", err
+		}
+		if q.Limit > 0 && len(bookings) == q.Limit {
+			last := bookings[len(bookings)-1]
+			return bookings, total, encodeCursor(cursor{Sort: sort, Key: lastKey, ID: last.ID}), nil
+		}
+		bookings = append(bookings, b)
+		lastKey = rowKey
+	}
+	return bookings, total, "", rows.Err()
+}
+
+// EachBooking calls fn with every booking matching q, in q's order, reading
+// them one at a time. Limit and Cursor are ignored. It stops at the first
+// error fn returns.
+func EachBooking(ctx context.Context, db *sql.DB, q BookingQuery, fn func(*models.AdminBooking) error) error {
+	sort, key, dir, _ := q.order()
+	if key == "" {
+		return errors.New("unknown sort " + sort)
+	}
+	filter, args := q.where()
+
+	defer metrics.TimeQuery("export_bookings")()
+	rows, err := db.QueryContext(ctx,
+		"SELECT "+adminBookingColumns+" FROM bookings"+filter+" ORDER BY "+key+" "+dir+", id "+dir, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var b models.AdminBooking
+	for rows.Next() {
+		if err := scanAdminBooking(rows, &b); err != nil {
+			return err
+		}
+		if err := fn(&b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
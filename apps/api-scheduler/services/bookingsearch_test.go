@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+// seedSearch inserts seven bookings on consecutive days: odd ones confirmed
+// and presencial, names alternating case so the name sort must ignore it,
+// and two sharing a start time so ties are broken by ID.
+func seedSearch(t *testing.T) func(BookingQuery) ([]string, int, string, error) {
+	t.Helper()
+	now := time.Date(2037, 6, 1, 9, 0, 0, 0, time.UTC)
+	_, db := newTestAdmins(t, &now)
+	for i := 1; i <= 7; i++ {
+		status, meeting := "pending", "videollamada"
+		if i%2 == 1 {
+			status, meeting = "confirmed", "presencial"
+		}
+		name := fmt.Sprintf("client %d", 8-i)
+		if i%2 == 0 {
+			name = strings.ToUpper(name)
+		}
+		date := fmt.Sprintf("2037-06-%02d", 14+i)
+		if i == 7 {
+			date = "2037-06-20" // same day and time as booking 6
+		}
+		if _, err := db.Exec(
+			`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, notes, status, created_at)
+			 VALUES (?, ?, '09:00', '09:30', ?, ?, ?, ?, ?, ?)`,
+			fmt.Sprintf("BK-2037-%03d", i), date, meeting, name, fmt.Sprintf("c%d@example.com", i%3),
+			fmt.Sprintf("note %d%%", i), status, now.Add(time.Duration(-i)*time.Hour).Format(dbTime)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func(q BookingQuery) ([]string, int, string, error) {
+		bookings, total, next, err := SearchBookings(context.Background(), db, q)
+		var ids []string
+		for _, b := range bookings {
+			ids = append(ids, strings.TrimPrefix(b.BookingID, "BK-2037-"))
+		}
+		return ids, total, next, err
+	}
+}
+
+func TestSearchBookingsPages(t *testing.T) {
+	search := seedSearch(t)
+	for sort, want := range map[string]string{
+		"":         "001 002 003 004 005 006 007",
+		"-date":    "007 006 005 004 003 002 001",
+		"created":  "007 006 005 004 003 002 001",
+		"-created": "001 002 003 004 005 006 007",
+		"name":     "007 006 005 004 003 002 001",
+		"-name":    "001 002 003 004 005 006 007",
+	} {
+		var got []string
+		q := BookingQuery{Sort: sort, Limit: 3}
+		for page := 0; ; page++ {
+			ids, total, next, err := search(q)
+			if err != nil {
+				t.Fatalf("sort %q page %d: %v", sort, page, err)
+			}
+			if total != 7 {
+				t.Errorf("sort %q page %d: total %d, want 7", sort, page, total)
+			}
+			got = append(got, ids...)
+			if next == "" {
+				break
+			}
+			if page > 3 {
+				t.Fatalf("sort %q: cursor never ends", sort)
+			}
+			q.Cursor = next
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("sort %q: got %v, want %s", sort, got, want)
+		}
+	}
+}
+
+func TestSearchBookingsFilters(t *testing.T) {
+	search := seedSearch(t)
+	for _, tt := range []struct {
+		q    BookingQuery
+		want string
+	}{
+		{BookingQuery{Statuses: []string{"confirmed"}}, "001 003 005 007"},
+		{BookingQuery{Statuses: []string{"confirmed", "pending"}, From: "2037-06-17", To: "2037-06-18"}, "003 004"},
+		{BookingQuery{MeetingType: "videollamada"}, "002 004 006"},
+		{BookingQuery{Email: "C1@Example.com"}, "001 004 007"},
+		{BookingQuery{Text: "CLIENT 2"}, "006"},
+		{BookingQuery{Text: "3%"}, "003"},
+		{BookingQuery{Text: "_"}, ""},
+		{BookingQuery{Email: "c2@example.com", Statuses: []string{"confirmed"}}, "005"},
+	} {
+		ids, total, next, err := search(tt.q)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.q, err)
+		}
+		if got := strings.Join(ids, " "); got != tt.want || total != len(ids) || next != "" {
+			t.Errorf("%+v: got %q (total %d, next %q), want %q", tt.q, got, total, next, tt.want)
+		}
+	}
+}
+
+func TestSearchBookingsRejectsForeignCursor(t *testing.T) {
+	search := seedSearch(t)
+	_, _, next, err := search(BookingQuery{Sort: "date", Limit: 2})
+	if err != nil || next == "" {
+		t.Fatalf("first page: next %q, %v", next, err)
+	}
+	for _, q := range []BookingQuery{
+		{Sort: "name", Cursor: next},
+		{Cursor: "not-a-cursor"},
+		{Cursor: next + "x"},
+	} {
+		if _, _, _, err := search(q); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%+v: got %v, want ErrInvalidCursor", q, err)
+		}
+	}
+}
+
+func TestEachBookingClearsAddress(t *testing.T) {
+	now := time.Date(2037, 6, 1, 9, 0, 0, 0, time.UTC)
+	_, db := newTestAdmins(t, &now)
+	for i, city := range []string{"Tijuana", ""} {
+		if _, err := db.Exec(
+			`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, address_city, status)
+			 VALUES (?, '2037-06-15', '09:00', '09:30', 'presencial', 'Test', 'test@example.com', NULLIF(?, ''), 'confirmed')`,
+			fmt.Sprintf("BK-2037-%03d", i+1), city); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	err := EachBooking(context.Background(), db, BookingQuery{}, func(b *models.AdminBooking) error {
+		city := "-"
+		if b.Address != nil {
+			city = b.Address.City
+		}
+		got = append(got, city)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != "Tijuana -" {
+		t.Errorf("Expected only the first booking to have an address, got %v", got)
+	}
+}
@@ -1,45 +1,75 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net"
 	"net/smtp"
-	"os"
+	"net/textproto"
 	"strings"
+	"time"
 
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/i18n"
+	"github.com/joledev/api-scheduler/metrics"
 	"github.com/joledev/api-scheduler/models"
 )
 
-func sendEmail(to, subject, html string) error {
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
-	user := os.Getenv("SMTP_USER")
-	pass := os.Getenv("SMTP_PASS")
-	from := os.Getenv("SMTP_FROM")
+// smtpTimeout bounds a whole SMTP delivery so a stalled server cannot hold
+// up shutdown.
+const smtpTimeout = 30 * time.Second
 
-	if host == "" || user == "" || pass == "" {
-		return fmt.Errorf("SMTP not configured (SMTP_HOST, SMTP_USER, SMTP_PASS required)")
+// Mailer delivers email over implicit-TLS SMTP (port 465).
+type Mailer struct {
+	cfg config.SMTP
+}
+
+func NewMailer(cfg config.SMTP) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Send delivers e and records the outcome under its template name in the
+// emails metric. With SMTP disabled the email is logged and dropped.
+func (m *Mailer) Send(ctx context.Context, e Email) error {
+	if m.cfg.Disabled {
+		slog.WarnContext(ctx, "SMTP disabled, dropping email", "template", e.Template, "ref", e.Ref, "to", e.To)
+		return nil
 	}
-	if port == "" {
-		port = "465"
+	err := m.deliver(e.To, e.Subject, message(e))
+	metrics.EmailsSent.WithLabelValues(e.Template, metrics.EmailResult(err)).Inc()
+	if err != nil {
+		return err
 	}
-	if from == "" {
-		from = user
+	slog.InfoContext(ctx, "email sent", "template", e.Template, "ref", e.Ref, "to", e.To)
+	return nil
+}
+
+func (m *Mailer) deliver(to, subject, body string) error {
+	host, port, user, pass := m.cfg.Host, m.cfg.Port, m.cfg.User, m.cfg.Pass
+	from := m.cfg.Sender()
+
+	if host == "" || user == "" || pass == "" {
+		return fmt.Errorf("SMTP not configured (SMTP_HOST, SMTP_USER, SMTP_PASS required)")
 	}
 
-	// Build MIME message
 	msg := "From: " + from + "\r\n" +
 		"To: " + to + "\r\n" +
 		"Subject: " + subject + "\r\n" +
-		"MIME-Version: 1.0\r\n" +
-		"Content-Type: text/html; charset=UTF-8\r\n" +
-		"\r\n" + html
+		"MIME-Version: 1.0\r\n" + body
 
 	// Port 465 uses implicit TLS (SMTPS)
-	conn, err := tls.Dial("tcp", host+":"+port, &tls.Config{ServerName: host})
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", host+":"+port, &tls.Config{ServerName: host})
 	if err != nil {
 		return fmt.Errorf("SMTP TLS connection failed: %w", err)
 	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
 
 	client, err := smtp.NewClient(conn, host)
 	if err != nil {
@@ -70,93 +100,125 @@ func sendEmail(to, subject, html string) error {
 	return client.Quit()
 }
 
-func getAPIBaseURL() string {
-	url := os.Getenv("API_BASE_URL")
-	if url == "" {
-		url = "http://localhost:8082"
+// message renders the MIME body of e, headers included: the HTML alone, or
+// with a calendar invitation a multipart/mixed of the HTML and the .ics.
+func message(e Email) string {
+	if e.ICS == "" {
+		return "Content-Type: text/html; charset=UTF-8\r\n\r\n" + e.HTML
 	}
-	return strings.TrimRight(url, "/")
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+	io.WriteString(part, e.HTML)
+	part, _ = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/calendar; charset=UTF-8; method=PUBLISH"},
+		"Content-Disposition":       {`attachment; filename="invite.ics"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	enc := base64.NewEncoder(base64.StdEncoding, &lineWriter{w: part})
+	io.WriteString(enc, e.ICS)
+	enc.Close()
+	mw.Close()
+	return "Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n" + buf.String()
 }
 
-func formatDate(date, lang string) string {
-	parts := strings.Split(date, "-")
-	if len(parts) != 3 {
-		return date
-	}
+// lineWriter breaks base64 output into the 76-character lines MIME allows.
+type lineWriter struct {
+	w   io.Writer
+	col int
+}
 
-	months := map[string]map[string]string{
-		"01": {"es": "enero", "en": "January"},
-		"02": {"es": "febrero", "en": "February"},
-		"03": {"es": "marzo", "en": "March"},
-		"04": {"es": "abril", "en": "April"},
-		"05": {"es": "mayo", "en": "May"},
-		"06": {"es": "junio", "en": "June"},
-		"07": {"es": "julio", "en": "July"},
-		"08": {"es": "agosto", "en": "August"},
-		"09": {"es": "septiembre", "en": "September"},
-		"10": {"es": "octubre", "en": "October"},
-		"11": {"es": "noviembre", "en": "November"},
-		"12": {"es": "diciembre", "en": "December"},
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := min(76-l.col, len(p))
+		if _, err := l.w.Write(p[:chunk]); err != nil {
+			return 0, err
+		}
+		p, l.col = p[chunk:], l.col+chunk
+		if l.col == 76 {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return 0, err
+			}
+			l.col = 0
+		}
 	}
+	return n, nil
+}
 
-	month := months[parts[1]][lang]
-	day := strings.TrimLeft(parts[2], "0")
-
-	if lang == "en" {
-		return fmt.Sprintf("%s %s, %s", month, day, parts[0])
-	}
-	return fmt.Sprintf("%s de %s, %s", day, month, parts[0])
+// timeRange formats the booking's start and end times for lang.
+func timeRange(lang string, b *models.Booking) string {
+	return i18n.T(lang, "time.range", "start", i18n.Time(lang, b.StartTime), "end", i18n.Time(lang, b.EndTime))
 }
 
-func formatTime(t string) string {
-	parts := strings.Split(t, ":")
-	if len(parts) != 2 {
-		return t
+// clientTimes formats the booking's date and time range for the client: in
+// their time zone, named after the times, when they gave one other than
+// the business zone; otherwise as stored.
+func clientTimes(lang string, b *models.Booking) (date, times string) {
+	date, times = i18n.Date(lang, b.Date), timeRange(lang, b)
+	if b.ClientTimezone == "" || b.ClientTimezone == businessTZ.String() {
+		return date, times
+	}
+	loc, err := ClientLocation(b.ClientTimezone)
+	if err != nil {
+		return date, times
 	}
-	hour := parts[0]
-	min := parts[1]
-
-	h := 0
-	fmt.Sscanf(hour, "%d", &h)
-
-	if h == 0 {
-		return fmt.Sprintf("12:%s AM", min)
-	} else if h < 12 {
-		return fmt.Sprintf("%d:%s AM", h, min)
-	} else if h == 12 {
-		return fmt.Sprintf("12:%s PM", min)
+	start, end, err := bookingTimes(b)
+	if err != nil {
+		return date, times
 	}
-	return fmt.Sprintf("%d:%s PM", h-12, min)
+	start, end = start.In(loc), end.In(loc)
+	times = i18n.T(lang, "time.range", "start", i18n.Time(lang, start.Format("15:04")), "end", i18n.Time(lang, end.Format("15:04")))
+	return i18n.Date(lang, start.Format("2006-01-02")), i18n.T(lang, "time.zone", "time", times, "zone", b.ClientTimezone)
 }
 
-func meetingTypeLabel(mt, lang string) string {
-	if mt == "presencial" {
-		if lang == "en" {
-			return "In-person"
-		}
-		return "Presencial"
+// clientEmail renders the client-facing emails, which share a greeting and
+// sign-off around their paragraphs.
+func clientEmail(lang, name string, paragraphs ...string) string {
+	var sb strings.Builder
+	sb.WriteString("<p>" + i18n.T(lang, "email.greeting", "name", name) + "</p>\n")
+	for _, p := range paragraphs {
+		sb.WriteString("<p>" + p + "</p>\n")
 	}
-	if lang == "en" {
-		return "Video call"
-	}
-	return "Videollamada"
+	sb.WriteString("<p>" + i18n.T(lang, "email.signoff") + "</p>")
+	return sb.String()
 }
 
-// SendAdminPendingNotification sends an email to the admin when a new booking request comes in.
-// Includes Confirm and Reject buttons with secure token links.
-func SendAdminPendingNotification(b *models.Booking) error {
-	contactEmail := os.Getenv("CONTACT_EMAIL")
-	if contactEmail == "" {
-		contactEmail = "contacto@joledev.com"
+// bookingDetails is the date/time/type paragraph of the client emails.
+func bookingDetails(lang string, b *models.Booking) string {
+	date, times := clientTimes(lang, b)
+	return i18n.T(lang, "email.details",
+		"date", date,
+		"time", times,
+		"type", i18n.T(lang, "meeting_type."+b.MeetingType))
+}
+
+// reason is the paragraph quoting the admin's reason for a change, if one
+// was given.
+func reason(lang, text string) []string {
+	if text == "" {
+		return nil
 	}
+	return []string{i18n.T(lang, "email.reason", "reason", html.EscapeString(text))}
+}
 
-	baseURL := getAPIBaseURL()
+// scheduleLink is the "pick another time" link for lang.
+func scheduleLink(lang string) []any {
+	url := i18n.T(lang, "email.schedule_url")
+	return []any{"url", url, "url_label", strings.TrimPrefix(url, "https://")}
+}
+
+// AdminPendingEmail renders the admin notice for a new booking request, sent
+// to contactEmail. Includes Confirm and Reject buttons with secure token
+// links under baseURL.
+func AdminPendingEmail(b *models.Booking, contactEmail, baseURL string) Email {
 	confirmURL := fmt.Sprintf("%s/scheduler/bookings/confirm?token=%s", baseURL, b.ConfirmToken)
 	rejectURL := fmt.Sprintf("%s/scheduler/bookings/reject?token=%s", baseURL, b.RejectToken)
 
-	dateStr := formatDate(b.Date, "es")
-	timeStr := fmt.Sprintf("%s - %s", formatTime(b.StartTime), formatTime(b.EndTime))
-	mtLabel := meetingTypeLabel(b.MeetingType, "es")
+	// The admin inbox is always in Spanish.
+	dateStr := i18n.Date("es", b.Date)
+	timeStr := timeRange("es", b)
+	mtLabel := i18n.T("es", "meeting_type."+b.MeetingType)
 
 	addressLine := ""
 	if b.MeetingType == "presencial" && b.ClientAddress != "" {
@@ -194,163 +256,134 @@ func SendAdminPendingNotification(b *models.Booking) error {
 		b.ClientCompany, mtLabel, dateStr, timeStr, tzLine, addressLine, notesLine,
 		confirmURL, rejectURL)
 
-	return sendEmail(contactEmail, subject, html)
+	return Email{Template: "admin_pending", Ref: b.BookingID, To: contactEmail, Subject: subject, HTML: html}
 }
 
-// SendClientPendingNotification notifies the client that their request was received and is pending.
-func SendClientPendingNotification(b *models.Booking) error {
+// ClientPendingEmail tells the client their request was received and is pending.
+func ClientPendingEmail(b *models.Booking) Email {
 	lang := b.Lang
-	if lang == "" {
-		lang = "es"
-	}
-
-	dateStr := formatDate(b.Date, lang)
-	timeStr := fmt.Sprintf("%s - %s", formatTime(b.StartTime), formatTime(b.EndTime))
-	mtLabel := meetingTypeLabel(b.MeetingType, lang)
-
-	var subject, html string
-
-	if lang == "en" {
-		subject = fmt.Sprintf("Meeting request received - JoleDev - %s", b.BookingID)
-		html = fmt.Sprintf(`<p>Hi %s,</p>
-<p>Your meeting request has been received and is <strong>pending confirmation</strong>.</p>
-<p>📅 <strong>Date:</strong> %s<br>
-🕐 <strong>Time:</strong> %s<br>
-📍 <strong>Type:</strong> %s</p>
-<p>I'll review your request and you'll receive another email once it's confirmed or if there's any issue.</p>
-<p>Best regards,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr, mtLabel)
-	} else {
-		subject = fmt.Sprintf("Solicitud de reunión recibida - JoleDev - %s", b.BookingID)
-		html = fmt.Sprintf(`<p>Hola %s,</p>
-<p>Tu solicitud de reunión ha sido recibida y está <strong>pendiente de confirmación</strong>.</p>
-<p>📅 <strong>Fecha:</strong> %s<br>
-🕐 <strong>Hora:</strong> %s<br>
-📍 <strong>Tipo:</strong> %s</p>
-<p>Revisaré tu solicitud y recibirás otro correo cuando sea confirmada o si hay algún inconveniente.</p>
-<p>Saludos,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr, mtLabel)
-	}
-
-	return sendEmail(b.ClientEmail, subject, html)
+	html := clientEmail(lang, b.ClientName,
+		i18n.T(lang, "email.client_pending.intro"),
+		bookingDetails(lang, b),
+		i18n.T(lang, "email.client_pending.next"))
+	subject := i18n.T(lang, "email.client_pending.subject", "id", b.BookingID)
+	return Email{Template: "client_pending", Ref: b.BookingID, To: b.ClientEmail, Subject: subject, HTML: html}
 }
 
-// SendBookingConfirmation sends a confirmation email to the client when the admin approves.
-func SendBookingConfirmation(b *models.Booking) error {
+// BookingConfirmationEmail tells the client the admin approved the booking,
+// with the video-call link if it has one and the meeting as an .ics
+// attachment.
+func BookingConfirmationEmail(b *models.Booking) Email {
 	lang := b.Lang
-	if lang == "" {
-		lang = "es"
+	location := []string{i18n.T(lang, "email.booking_confirmation.online")}
+	if b.MeetingURL != "" {
+		location = []string{i18n.T(lang, "email.booking_confirmation.video_link", "url", html.EscapeString(b.MeetingURL))}
 	}
-
-	dateStr := formatDate(b.Date, lang)
-	timeStr := fmt.Sprintf("%s - %s", formatTime(b.StartTime), formatTime(b.EndTime))
-	mtLabel := meetingTypeLabel(b.MeetingType, lang)
-
-	var subject, html string
-
-	if lang == "en" {
-		subject = fmt.Sprintf("Meeting confirmed - JoleDev - %s", b.BookingID)
-		locationLine := ""
-		if b.MeetingType == "presencial" && b.ClientAddress != "" {
-			locationLine = fmt.Sprintf(`<p>📍 <strong>Address:</strong> %s</p>
-<p>I'll be at your office at the indicated time.</p>`, b.ClientAddress)
-		} else {
-			locationLine = `<p>I'll send you the video call link by email before the meeting.</p>`
-		}
-
-		html = fmt.Sprintf(`<p>Hi %s,</p>
-<p>Your meeting has been <strong style="color:#22c55e">confirmed</strong>!</p>
-<p>📅 <strong>Date:</strong> %s<br>
-🕐 <strong>Time:</strong> %s<br>
-📍 <strong>Type:</strong> %s</p>
-%s
-<p>If you need to reschedule, contact me at contacto@joledev.com.</p>
-<p>Best regards,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr, mtLabel, locationLine)
-	} else {
-		subject = fmt.Sprintf("Reunión confirmada - JoleDev - %s", b.BookingID)
-		locationLine := ""
-		if b.MeetingType == "presencial" && b.ClientAddress != "" {
-			locationLine = fmt.Sprintf(`<p>📌 <strong>Dirección:</strong> %s</p>
-<p>Me presentaré en tu oficina a la hora indicada.</p>`, b.ClientAddress)
-		} else {
-			locationLine = `<p>Te enviaré el link de la videollamada por email antes de la reunión.</p>`
+	if b.MeetingType == "presencial" && b.ClientAddress != "" {
+		location = []string{
+			i18n.T(lang, "email.booking_confirmation.address", "address", b.ClientAddress),
+			i18n.T(lang, "email.booking_confirmation.in_person"),
 		}
-
-		html = fmt.Sprintf(`<p>Hola %s,</p>
-<p>Tu reunión ha sido <strong style="color:#22c55e">confirmada</strong>!</p>
-<p>📅 <strong>Fecha:</strong> %s<br>
-🕐 <strong>Hora:</strong> %s<br>
-📍 <strong>Tipo:</strong> %s</p>
-%s
-<p>Si necesitas reprogramar, contáctame a contacto@joledev.com.</p>
-<p>Saludos,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr, mtLabel, locationLine)
 	}
+	paragraphs := []string{i18n.T(lang, "email.booking_confirmation.intro"), bookingDetails(lang, b)}
+	paragraphs = append(paragraphs, location...)
+	ics := BookingICS(b)
+	if ics != "" {
+		paragraphs = append(paragraphs, i18n.T(lang, "email.booking_confirmation.calendar"))
+	}
+	paragraphs = append(paragraphs, i18n.T(lang, "email.booking_confirmation.reschedule"))
 
-	return sendEmail(b.ClientEmail, subject, html)
+	html := clientEmail(lang, b.ClientName, paragraphs...)
+	subject := i18n.T(lang, "email.booking_confirmation.subject", "id", b.BookingID)
+	return Email{Template: "booking_confirmation", Ref: b.BookingID, To: b.ClientEmail, Subject: subject, HTML: html, ICS: ics}
 }
 
-// SendBookingRejection notifies the client that their booking was not approved.
-func SendBookingRejection(b *models.Booking) error {
+// BookingRejectionEmail tells the client their booking was not approved.
+func BookingRejectionEmail(b *models.Booking) Email {
 	lang := b.Lang
-	if lang == "" {
-		lang = "es"
-	}
-
-	dateStr := formatDate(b.Date, lang)
-	timeStr := fmt.Sprintf("%s - %s", formatTime(b.StartTime), formatTime(b.EndTime))
-
-	var subject, html string
-
-	if lang == "en" {
-		subject = fmt.Sprintf("Meeting request not available - JoleDev - %s", b.BookingID)
-		html = fmt.Sprintf(`<p>Hi %s,</p>
-<p>Unfortunately, I wasn't able to confirm your meeting scheduled for <strong>%s</strong> at <strong>%s</strong>.</p>
-<p>This could be due to a scheduling conflict. Please feel free to select a different time at <a href="https://joledev.com/en/schedule">joledev.com/en/schedule</a>.</p>
-<p>Sorry for the inconvenience!</p>
-<p>Best regards,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr)
-	} else {
-		subject = fmt.Sprintf("Solicitud de reunión no disponible - JoleDev - %s", b.BookingID)
-		html = fmt.Sprintf(`<p>Hola %s,</p>
-<p>Lamentablemente no pude confirmar tu reunión programada para el <strong>%s</strong> a las <strong>%s</strong>.</p>
-<p>Esto puede deberse a un conflicto de horario. Por favor selecciona otro horario en <a href="https://joledev.com/es/agendar">joledev.com/es/agendar</a>.</p>
-<p>Disculpa las molestias.</p>
-<p>Saludos,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr)
-	}
+	date, times := clientTimes(lang, b)
+	paragraphs := []string{i18n.T(lang, "email.booking_rejection.body", "date", date, "time", times)}
+	paragraphs = append(paragraphs, reason(lang, b.StatusReason)...)
+	paragraphs = append(paragraphs,
+		i18n.T(lang, "email.booking_rejection.retry", scheduleLink(lang)...),
+		i18n.T(lang, "email.booking_rejection.apology"))
+	html := clientEmail(lang, b.ClientName, paragraphs...)
+	subject := i18n.T(lang, "email.booking_rejection.subject", "id", b.BookingID)
+	return Email{Template: "booking_rejection", Ref: b.BookingID, To: b.ClientEmail, Subject: subject, HTML: html}
+}
 
-	return sendEmail(b.ClientEmail, subject, html)
+// BookingCancellationEmail tells the client their booking was cancelled.
+func BookingCancellationEmail(b *models.Booking) Email {
+	lang := b.Lang
+	date, times := clientTimes(lang, b)
+	paragraphs := []string{i18n.T(lang, "email.booking_cancellation.body", "date", date, "time", times)}
+	paragraphs = append(paragraphs, reason(lang, b.StatusReason)...)
+	paragraphs = append(paragraphs, i18n.T(lang, "email.booking_cancellation.retry", scheduleLink(lang)...))
+	html := clientEmail(lang, b.ClientName, paragraphs...)
+	subject := i18n.T(lang, "email.booking_cancellation.subject", "id", b.BookingID)
+	return Email{Template: "booking_cancellation", Ref: b.BookingID, To: b.ClientEmail, Subject: subject, HTML: html}
 }
 
-// SendBookingCancellation notifies the client that their booking was cancelled.
-func SendBookingCancellation(b *models.Booking) error {
+// BookingRescheduledEmail tells the client their booking moved from old to
+// the date and time now in b, quoting why if given.
+func BookingRescheduledEmail(b, old *models.Booking, why string) Email {
 	lang := b.Lang
-	if lang == "" {
-		lang = "es"
+	date, times := clientTimes(lang, old)
+	paragraphs := []string{
+		i18n.T(lang, "email.booking_rescheduled.intro", "date", date, "time", times),
+		bookingDetails(lang, b),
 	}
+	paragraphs = append(paragraphs, reason(lang, why)...)
+	paragraphs = append(paragraphs, i18n.T(lang, "email.booking_confirmation.reschedule"))
+
+	html := clientEmail(lang, b.ClientName, paragraphs...)
+	subject := i18n.T(lang, "email.booking_rescheduled.subject", "id", b.BookingID)
+	return Email{Template: "booking_rescheduled", Ref: b.BookingID, To: b.ClientEmail, Subject: subject, HTML: html}
+}
 
-	dateStr := formatDate(b.Date, lang)
-	timeStr := fmt.Sprintf("%s - %s", formatTime(b.StartTime), formatTime(b.EndTime))
-
-	var subject, html string
-
-	if lang == "en" {
-		subject = fmt.Sprintf("Meeting cancelled - JoleDev - %s", b.BookingID)
-		html = fmt.Sprintf(`<p>Hi %s,</p>
-<p>Your meeting scheduled for <strong>%s</strong> at <strong>%s</strong> has been cancelled.</p>
-<p>If you'd like to reschedule, visit <a href="https://joledev.com/en/schedule">joledev.com/en/schedule</a>.</p>
-<p>Best regards,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr)
-	} else {
-		subject = fmt.Sprintf("Reunión cancelada - JoleDev - %s", b.BookingID)
-		html = fmt.Sprintf(`<p>Hola %s,</p>
-<p>Tu reunión programada para el <strong>%s</strong> a las <strong>%s</strong> ha sido cancelada.</p>
-<p>Si deseas reagendar, visita <a href="https://joledev.com/es/agendar">joledev.com/es/agendar</a>.</p>
-<p>Saludos,<br>Joel López Verdugo<br>JoleDev</p>`,
-			b.ClientName, dateStr, timeStr)
+// clientMoment formats instant t for the client of b, like clientTimes: in
+// their time zone, named, when they gave one other than the business zone.
+func clientMoment(lang string, b *models.Booking, t time.Time) (date, clock string) {
+	loc, zone := businessTZ, ""
+	if b.ClientTimezone != "" && b.ClientTimezone != businessTZ.String() {
+		if l, err := ClientLocation(b.ClientTimezone); err == nil {
+			loc, zone = l, b.ClientTimezone
+		}
 	}
+	t = t.In(loc)
+	date, clock = i18n.Date(lang, t.Format(dateLayout)), i18n.Time(lang, t.Format("15:04"))
+	if zone != "" {
+		clock = i18n.T(lang, "time.zone", "time", clock, "zone", zone)
+	}
+	return date, clock
+}
 
-	return sendEmail(b.ClientEmail, subject, html)
+// WaitlistJoinedEmail tells client e they are on the waitlist, with the link
+// under baseURL that takes them off it.
+func WaitlistJoinedEmail(e WaitlistEntry, token, baseURL string) Email {
+	lang := e.Lang
+	leaveURL := fmt.Sprintf("%s/scheduler/waitlist/leave?token=%s", baseURL, token)
+	body := clientEmail(lang, e.ClientName,
+		i18n.T(lang, "email.waitlist_joined.intro",
+			"type", i18n.T(lang, "meeting_type."+e.MeetingType),
+			"from", i18n.Date(lang, e.From), "to", i18n.Date(lang, e.To)),
+		i18n.T(lang, "email.waitlist_joined.leave", "url", html.EscapeString(leaveURL)))
+	subject := i18n.T(lang, "email.waitlist_joined.subject")
+	return Email{Template: "waitlist_joined", To: e.ClientEmail, Subject: subject, HTML: body}
+}
+
+// WaitlistOfferEmail offers a waitlisted client held booking b, a slot
+// another booking freed, with the link under baseURL that claims it until
+// expires.
+func WaitlistOfferEmail(b *models.Booking, token, baseURL string, expires time.Time) Email {
+	lang := b.Lang
+	claimURL := fmt.Sprintf("%s/scheduler/waitlist/claim?token=%s", baseURL, token)
+	date, clock := clientMoment(lang, b, expires)
+	body := clientEmail(lang, b.ClientName,
+		i18n.T(lang, "email.waitlist_offer.intro"),
+		bookingDetails(lang, b),
+		i18n.T(lang, "email.waitlist_offer.claim", "url", html.EscapeString(claimURL), "date", date, "time", clock),
+		i18n.T(lang, "email.waitlist_offer.ignore"))
+	subject := i18n.T(lang, "email.waitlist_offer.subject", "id", b.BookingID)
+	return Email{Template: "waitlist_offer", Ref: b.BookingID, To: b.ClientEmail, Subject: subject, HTML: body}
 }
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+func TestClientEmailsFollowBookingLang(t *testing.T) {
+	b := &models.Booking{
+		BookingID:     "BK-2037-001",
+		Date:          "2037-06-15",
+		StartTime:     "14:00",
+		EndTime:       "14:30",
+		MeetingType:   "presencial",
+		ClientName:    "Ana",
+		ClientEmail:   "ana@example.com",
+		ClientAddress: "Av. Revolución 1000",
+	}
+	tests := []struct {
+		lang    string
+		subject string
+		want    []string
+	}{
+		{"es", "Reunión confirmada - JoleDev - BK-2037-001",
+			[]string{"Hola Ana,", "15 de junio, 2037", "2:00 PM - 2:30 PM", "Presencial", "Av. Revolución 1000"}},
+		{"en", "Meeting confirmed - JoleDev - BK-2037-001",
+			[]string{"Hi Ana,", "June 15, 2037", "2:00 PM - 2:30 PM", "In-person"}},
+		{"pt-BR", "Reunião confirmada - JoleDev - BK-2037-001",
+			[]string{"Olá Ana,", "15 de junho de 2037", "14:00 - 14:30", "Estarei no seu escritório"}},
+		// Rows created before the lang column was filled in.
+		{"", "Reunión confirmada - JoleDev - BK-2037-001", []string{"Hola Ana,"}},
+	}
+	for _, tt := range tests {
+		b.Lang = tt.lang
+		e := BookingConfirmationEmail(b)
+		if e.Subject != tt.subject {
+			t.Errorf("%q: subject = %q, want %q", tt.lang, e.Subject, tt.subject)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(e.HTML, s) {
+				t.Errorf("%q: body lacks %q:\n%s", tt.lang, s, e.HTML)
+			}
+		}
+	}
+}
+
+func TestClientEmailsUseClientTimezone(t *testing.T) {
+	b := &models.Booking{
+		BookingID: "BK-2037-001", Date: "2037-06-15", StartTime: "15:30", EndTime: "16:00",
+		MeetingType: "videollamada", ClientName: "Ana", ClientEmail: "ana@example.com", Lang: "en",
+		ClientTimezone: "Asia/Tokyo",
+	}
+	// 15:30 PDT is 07:30 the next day in Tokyo.
+	e := BookingConfirmationEmail(b)
+	if want := "June 16, 2037"; !strings.Contains(e.HTML, want) {
+		t.Errorf("body lacks %q:\n%s", want, e.HTML)
+	}
+	if want := "7:30 AM - 8:00 AM (Asia/Tokyo)"; !strings.Contains(e.HTML, want) {
+		t.Errorf("body lacks %q:\n%s", want, e.HTML)
+	}
+
+	for _, tz := range []string{"", "America/Tijuana", "Not/AZone"} {
+		b.ClientTimezone = tz
+		if e := BookingCancellationEmail(b); !strings.Contains(e.HTML, "June 15, 2037") || !strings.Contains(e.HTML, "3:30 PM - 4:00 PM") ||
+			strings.Contains(e.HTML, "(") {
+			t.Errorf("timezone %q: expected Tijuana times:\n%s", tz, e.HTML)
+		}
+	}
+}
+
+func TestConfirmationCarriesMeetingLinkAndInvite(t *testing.T) {
+	b := &models.Booking{
+		BookingID:   "BK-2037-002",
+		Date:        "2037-06-15",
+		StartTime:   "10:00",
+		EndTime:     "10:30",
+		MeetingType: "videollamada",
+		ClientName:  "Ana",
+		ClientEmail: "ana@example.com",
+		MeetingURL:  "https://meet.example.com/room?a=1&b=2",
+		Lang:        "en",
+	}
+	e := BookingConfirmationEmail(b)
+	if !strings.Contains(e.HTML, `<a href="https://meet.example.com/room?a=1&amp;b=2">`) {
+		t.Errorf("body lacks the escaped link:\n%s", e.HTML)
+	}
+	if strings.Contains(e.HTML, "I'll send you the video call link") {
+		t.Error("body still promises to send the link later")
+	}
+
+	msg := message(e)
+	header, body, _ := strings.Cut(msg, "\r\n\r\n")
+	_, params, err := mime.ParseMediaType(strings.TrimPrefix(header, "Content-Type: "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	var types []string
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, p.Header.Get("Content-Type"))
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "text/calendar") {
+			raw, _ := io.ReadAll(p)
+			ics, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+			if err != nil || string(ics) != e.ICS {
+				t.Errorf("attachment does not decode to the invite: %v", err)
+			}
+		}
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/html") || !strings.HasPrefix(types[1], "text/calendar") {
+		t.Errorf("parts = %q", types)
+	}
+
+	if plain := message(BookingRejectionEmail(b)); !strings.HasPrefix(plain, "Content-Type: text/html") {
+		t.Errorf("email without an invite is not plain HTML: %.60q", plain)
+	}
+}
+
+func TestBookingICS(t *testing.T) {
+	b := &models.Booking{
+		BookingID:     "BK-2037-003",
+		Date:          "2037-01-15", // PST, UTC-8
+		StartTime:     "09:30",
+		EndTime:       "10:00",
+		MeetingType:   "presencial",
+		ClientAddress: "Blvd. Agua Caliente 10, Col. Hipódromo; Tijuana, B.C. — oficina 4, segundo piso, junto al estacionamiento",
+		Lang:          "es",
+	}
+	ics := BookingICS(b)
+	for _, want := range []string{
+		"UID:BK-2037-003@joledev.com\r\n",
+		"DTSTART:20370115T173000Z\r\n",
+		"DTEND:20370115T180000Z\r\n",
+		"SUMMARY:Reunión con JoleDev (Presencial)\r\n",
+		`LOCATION:Blvd. Agua Caliente 10\, Col. Hipódromo\; Tijuana\, B.C. —`,
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("invite lacks %q:\n%s", want, ics)
+		}
+	}
+	if !strings.HasSuffix(ics, "END:VCALENDAR\r\n") {
+		t.Error("invite does not end with END:VCALENDAR")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 || !utf8.ValidString(line) {
+			t.Errorf("line not folded at 75 bytes on a character boundary: %q", line)
+		}
+	}
+	if unfolded := strings.ReplaceAll(ics, "\r\n ", ""); !strings.Contains(unfolded, "junto al estacionamiento\r\n") {
+		t.Errorf("unfolded location is cut:\n%s", unfolded)
+	}
+
+	b.Date = "2037-06-15" // PDT, UTC-7
+	if !strings.Contains(BookingICS(b), "DTSTART:20370615T163000Z\r\n") {
+		t.Error("summer start not shifted by 7 hours")
+	}
+}
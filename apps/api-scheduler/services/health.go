@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/smtp"
+
+	"github.com/joledev/api-scheduler/migrations"
+)
+
+// CheckDBWritable verifies the database accepts writes by creating and
+// filling a scratch table inside a transaction that is always rolled back.
+// A read-only file or a full disk fails here while a plain ping succeeds.
+func CheckDBWritable(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS _readyz_probe (id INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO _readyz_probe (id) VALUES (1)`)
+	return err
+}
+
+// CheckSchema verifies every embedded migration has been applied, so a pod
+// running newer code against an unmigrated database is kept out of rotation.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	current, err := migrations.CurrentVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if latest := migrations.Latest(); current != latest {
+		return fmt.Errorf("schema at migration %d, want %d", current, latest)
+	}
+	return nil
+}
+
+// Check connects to the SMTP server and authenticates without sending
+// anything, so wrong credentials surface before the first email fails.
+func (m *Mailer) Check(ctx context.Context) error {
+	if m.cfg.Disabled {
+		return fmt.Errorf("SMTP disabled")
+	}
+	host, port, user, pass := m.cfg.Host, m.cfg.Port, m.cfg.User, m.cfg.Pass
+	if host == "" || user == "" || pass == "" {
+		return fmt.Errorf("SMTP not configured (SMTP_HOST, SMTP_USER, SMTP_PASS required)")
+	}
+
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{}, Config: &tls.Config{ServerName: host}}
+	conn, err := dialer.DialContext(ctx, "tcp", host+":"+port)
+	if err != nil {
+		return fmt.Errorf("SMTP TLS connection failed: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP client failed: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.Auth(smtp.PlainAuth("", user, pass, host)); err != nil {
+		return fmt.Errorf("SMTP auth failed: %w", err)
+	}
+	return client.Quit()
+}
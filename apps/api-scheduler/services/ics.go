@@ -0,0 +1,89 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/i18n"
+	"github.com/joledev/api-scheduler/models"
+)
+
+const icsTime = "20060102T150405Z"
+
+// BookingICS renders the booking as an iCalendar event (RFC 5545) for the
+// confirmation email. Times are in UTC, so no time zone has to be defined;
+// the UID stays the same for a booking, so importing a newer copy updates
+// the event instead of adding another.
+func BookingICS(b *models.Booking) string {
+	start, end, err := bookingTimes(b)
+	if err != nil {
+		return ""
+	}
+	lang := b.Lang
+	location := b.MeetingURL
+	if b.MeetingType == "presencial" {
+		location = b.ClientAddress
+	}
+	description := i18n.T(lang, "ics.description", "id", b.BookingID)
+	if b.MeetingURL != "" {
+		description += "\n" + b.MeetingURL
+	}
+
+	var sb strings.Builder
+	line := func(name, value string) {
+		fold(&sb, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//JoleDev//Scheduler//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("BEGIN", "VEVENT")
+	line("UID", b.BookingID+"@joledev.com")
+	line("DTSTAMP", time.Now().UTC().Format(icsTime))
+	line("DTSTART", start.UTC().Format(icsTime))
+	line("DTEND", end.UTC().Format(icsTime))
+	line("SUMMARY", icsText(i18n.T(lang, "ics.summary", "type", i18n.T(lang, "meeting_type."+b.MeetingType))))
+	line("DESCRIPTION", icsText(description))
+	if location != "" {
+		line("LOCATION", icsText(location))
+	}
+	if b.MeetingURL != "" {
+		line("URL", b.MeetingURL)
+	}
+	line("STATUS", "CONFIRMED")
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+	return sb.String()
+}
+
+// bookingTimes returns when the booking starts and ends, in the business
+// time zone. A booking ending at midnight ends the next day.
+func bookingTimes(b *models.Booking) (start, end time.Time, err error) {
+	start, err = time.ParseInLocation(dateTimeLayout, b.Date+" "+b.StartTime, businessTZ)
+	if err != nil {
+		return
+	}
+	end, err = time.ParseInLocation(dateTimeLayout, b.Date+" "+b.EndTime, businessTZ)
+	if err == nil && !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// icsText escapes a TEXT value.
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace
+
+// fold writes a content line, breaking it so no line is over 75 bytes
+// (without splitting a UTF-8 sequence) with CRLF and a leading space.
+func fold(sb *strings.Builder, line string) {
+	for max := 75; len(line) > max; max = 74 {
+		n := max
+		for n > 0 && line[n]&0xC0 == 0x80 {
+			n--
+		}
+		sb.WriteString(line[:n] + "\r\n ")
+		line = line[n:]
+	}
+	sb.WriteString(line + "\r\n")
+}
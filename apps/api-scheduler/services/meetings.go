@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/models"
+)
+
+var meetingWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// MeetingLinks creates the video-call link of a booking.
+type MeetingLinks interface {
+	Link(ctx context.Context, b *models.Booking) (string, error)
+}
+
+// NewMeetingLinks returns the provider chosen in cfg, or nil for "none".
+// secret keys the Jitsi room names.
+func NewMeetingLinks(cfg config.Meetings, secret []byte) MeetingLinks {
+	switch cfg.Provider {
+	case "jitsi":
+		m := hmac.New(sha256.New, secret)
+		m.Write([]byte("meeting room"))
+		return &JitsiLinks{base: strings.TrimRight(cfg.JitsiURL, "/"), key: m.Sum(nil)}
+	case "webhook":
+		return &WebhookLinks{url: cfg.WebhookURL, secret: []byte(cfg.WebhookSecret)}
+	}
+	return nil
+}
+
+// JitsiLinks names a room after the booking ID plus a MAC of it, so the
+// link needs no API call, is the same every time it is made for a booking,
+// and cannot be guessed from the ID alone.
+type JitsiLinks struct {
+	base string
+	key  []byte
+}
+
+func (j *JitsiLinks) Link(_ context.Context, b *models.Booking) (string, error) {
+	m := hmac.New(sha256.New, j.key)
+	m.Write([]byte(b.BookingID))
+	room := "JoleDev-" + b.BookingID + "-" + hex.EncodeToString(m.Sum(nil))[:16]
+	return j.base + "/" + url.PathEscape(room), nil
+}
+
+// WebhookLinks asks an external service for the link. It POSTs
+//
+//	{"bookingId", "start", "end", "clientName", "clientEmail", "lang"}
+//
+// (start and end in RFC 3339) and expects {"url": "https://..."} back.
+// With a secret, X-Signature carries "sha256=" and the hex HMAC of the body.
+type WebhookLinks struct {
+	url    string
+	secret []byte
+}
+
+func (wh *WebhookLinks) Link(ctx context.Context, b *models.Booking) (string, error) {
+	start, end, err := bookingTimes(b)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]string{
+		"bookingId":   b.BookingID,
+		"start":       start.Format(time.RFC3339),
+		"end":         end.Format(time.RFC3339),
+		"clientName":  b.ClientName,
+		"clientEmail": b.ClientEmail,
+		"lang":        b.Lang,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(wh.secret) > 0 {
+		m := hmac.New(sha256.New, wh.secret)
+		m.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(m.Sum(nil)))
+	}
+
+	resp, err := meetingWebhookClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("meeting webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("meeting webhook: status %d", resp.StatusCode)
+	}
+	var result struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result); err != nil {
+		return "", fmt.Errorf("meeting webhook: %w", err)
+	}
+	if u, err := url.Parse(result.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("meeting webhook: %q is not an http(s) URL", result.URL)
+	}
+	return result.URL, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/models"
+)
+
+func TestJitsiLinks(t *testing.T) {
+	cfg := config.Meetings{Provider: "jitsi", JitsiURL: "https://meet.example.com/"}
+	links := NewMeetingLinks(cfg, []byte("secret"))
+	b := &models.Booking{BookingID: "BK-2037-001"}
+
+	first, err := links.Link(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first, "https://meet.example.com/JoleDev-BK-2037-001-") {
+		t.Errorf("link = %s", first)
+	}
+	if again, _ := links.Link(context.Background(), b); again != first {
+		t.Errorf("link changed: %s, then %s", first, again)
+	}
+	if other, _ := links.Link(context.Background(), &models.Booking{BookingID: "BK-2037-002"}); other == first {
+		t.Error("two bookings share a room")
+	}
+	if guessed, _ := NewMeetingLinks(cfg, []byte("another secret")).Link(context.Background(), b); guessed == first {
+		t.Error("room name does not depend on the secret")
+	}
+
+	if NewMeetingLinks(config.Meetings{Provider: "none"}, nil) != nil {
+		t.Error(`provider "none" returned links`)
+	}
+}
+
+func TestWebhookLinks(t *testing.T) {
+	reply := `{"url":"https://video.example.com/r/123"}`
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		m := hmac.New(sha256.New, []byte("hook-secret"))
+		m.Write(body)
+		if r.Header.Get("X-Signature") != "sha256="+hex.EncodeToString(m.Sum(nil)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &got)
+		io.WriteString(w, reply)
+	}))
+	defer srv.Close()
+
+	links := NewMeetingLinks(config.Meetings{Provider: "webhook", WebhookURL: srv.URL, WebhookSecret: "hook-secret"}, nil)
+	b := &models.Booking{BookingID: "BK-2037-001", Date: "2037-06-15", StartTime: "10:00", EndTime: "10:30",
+		ClientName: "Ana", ClientEmail: "ana@example.com", Lang: "es"}
+	link, err := links.Link(context.Background(), b)
+	if err != nil || link != "https://video.example.com/r/123" {
+		t.Fatalf("link %q, %v", link, err)
+	}
+	if got["bookingId"] != "BK-2037-001" || got["start"] != "2037-06-15T10:00:00-07:00" || got["end"] != "2037-06-15T10:30:00-07:00" {
+		t.Errorf("webhook got %v", got)
+	}
+
+	reply = `{"url":"javascript:alert(1)"}`
+	if _, err := links.Link(context.Background(), b); err == nil {
+		t.Error("accepted a non-http link")
+	}
+	unsigned := NewMeetingLinks(config.Meetings{Provider: "webhook", WebhookURL: srv.URL}, nil)
+	if _, err := unsigned.Link(context.Background(), b); err == nil {
+		t.Error("accepted an error status")
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joledev/api-scheduler/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupOutboxDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE email_outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		template TEXT NOT NULL,
+		ref TEXT,
+		recipient TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		html TEXT NOT NULL,
+		ics TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create email_outbox table: %v", err)
+	}
+	return db
+}
+
+func countOutbox(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM email_outbox`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestOutboxDeletesSentEmails(t *testing.T) {
+	db := setupOutboxDB(t)
+	defer db.Close()
+
+	var mu sync.Mutex
+	var sent []string
+	outbox := NewOutbox(db, NewMailer(config.SMTP{}))
+	outbox.send = func(ctx context.Context, e Email) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, e.Template)
+		return nil
+	}
+
+	outbox.Enqueue(context.Background(),
+		Email{Template: "first", To: "a@example.com"},
+		Email{Template: "second", To: "b@example.com"})
+	if err := outbox.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	if len(sent) != 2 || sent[0] != "first" || sent[1] != "second" {
+		t.Errorf("Expected both emails sent in order, got %v", sent)
+	}
+	if n := countOutbox(t, db); n != 0 {
+		t.Errorf("Expected outbox to be empty after delivery, got %d rows", n)
+	}
+}
+
+func TestOutboxKeepsUnsentEmailsForResume(t *testing.T) {
+	db := setupOutboxDB(t)
+	defer db.Close()
+
+	release := make(chan struct{})
+	outbox := NewOutbox(db, NewMailer(config.SMTP{}))
+	outbox.send = func(ctx context.Context, e Email) error {
+		<-release
+		return nil
+	}
+
+	outbox.Enqueue(context.Background(), Email{Template: "slow", To: "a@example.com"})
+
+	// Shutdown deadline passes while the email is still sending.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := outbox.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if n := countOutbox(t, db); n != 1 {
+		t.Fatalf("Expected the unsent email to stay persisted, got %d rows", n)
+	}
+	close(release)
+	outbox.Wait(context.Background())
+
+	// A new process picks up anything left behind.
+	db.Exec(`INSERT INTO email_outbox (template, recipient, subject, html) VALUES ('left', 'c@example.com', 's', 'h')`)
+	resumed := NewOutbox(db, NewMailer(config.SMTP{}))
+	var got []string
+	resumed.send = func(ctx context.Context, e Email) error {
+		got = append(got, e.Template)
+		return nil
+	}
+	if err := resumed.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	resumed.Wait(context.Background())
+	if len(got) != 1 || got[0] != "left" {
+		t.Errorf("Expected the leftover email to be resent, got %v", got)
+	}
+	if n := countOutbox(t, db); n != 0 {
+		t.Errorf("Expected outbox to be empty after resume, got %d rows", n)
+	}
+}
+
+func TestOutboxRecordsFailures(t *testing.T) {
+	db := setupOutboxDB(t)
+	defer db.Close()
+
+	outbox := NewOutbox(db, NewMailer(config.SMTP{}))
+	outbox.send = func(ctx context.Context, e Email) error {
+		return errors.New("smtp down")
+	}
+	outbox.Enqueue(context.Background(), Email{Template: "failing", To: "a@example.com"})
+	outbox.Wait(context.Background())
+
+	var attempts int
+	var lastError string
+	db.QueryRow(`SELECT attempts, last_error FROM email_outbox`).Scan(&attempts, &lastError)
+	if attempts != 1 || lastError != "smtp down" {
+		t.Errorf("Expected one recorded failure, got attempts=%d last_error=%q", attempts, lastError)
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/models"
+)
+
+// DefaultBuffer is kept free between a booking and the next when the
+// booking has no travel buffer of its own: videollamadas, in-person
+// meetings with no service area configured, and bookings made before
+// buffers were stored.
+const DefaultBuffer = 2 * time.Hour
+
+// FindZone returns the zone of area that serves addr, or nil when the
+// address is outside it. The postal code decides when it matches a zone;
+// otherwise the city is compared ignoring case, accents and extra spaces.
+func FindZone(area config.ServiceArea, addr models.Address) *config.Zone {
+	if pc := strings.TrimSpace(addr.PostalCode); pc != "" {
+		for i, z := range area.Zones {
+			for _, p := range z.PostalPrefixes {
+				if strings.HasPrefix(pc, p) {
+					return &area.Zones[i]
+				}
+			}
+		}
+	}
+	city := foldName(addr.City)
+	if city == "" {
+		return nil
+	}
+	for i, z := range area.Zones {
+		for _, c := range z.Cities {
+			if foldName(c) == city {
+				return &area.Zones[i]
+			}
+		}
+	}
+	return nil
+}
+
+// accents maps the accented letters of Spanish and Portuguese place names,
+// already lowercased, to plain ones.
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "é", "e", "ê", "e", "í", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ú", "u", "ü", "u", "ñ", "n", "ç", "c",
+)
+
+// foldName lowercases s, strips accents and collapses whitespace, so
+// "  Playas de  ROSARITO" and "playas de rosarito" compare equal.
+func foldName(s string) string {
+	return accents.Replace(strings.ToLower(strings.Join(strings.Fields(s), " ")))
+}
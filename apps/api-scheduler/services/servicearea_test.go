@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/joledev/api-scheduler/config"
+	"github.com/joledev/api-scheduler/models"
+)
+
+func TestFindZone(t *testing.T) {
+	area := config.Defaults().ServiceArea
+	tests := []struct {
+		addr models.Address
+		want string
+	}{
+		{models.Address{City: "Tijuana", PostalCode: "22010"}, "tijuana"},
+		{models.Address{City: "  playas de   ROSARITO "}, "rosarito"},
+		{models.Address{City: "Ensenada"}, "ensenada"},
+		// The postal code wins over the city when it matches a zone.
+		{models.Address{City: "Tijuana", PostalCode: "22800"}, "ensenada"},
+		// An unknown postal code falls back to the city.
+		{models.Address{City: "Tijuana", PostalCode: "99999"}, "tijuana"},
+		{models.Address{City: "Mexicali", PostalCode: "21000"}, ""},
+		{models.Address{City: "San José del Cabo"}, ""},
+		{models.Address{}, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if z := FindZone(area, tt.addr); z != nil {
+			got = z.Name
+		}
+		if got != tt.want {
+			t.Errorf("FindZone(%+v) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+
+	area.Zones = append(area.Zones, config.Zone{Name: "cabos", Cities: []string{"San Jose del Cabo"}})
+	if z := FindZone(area, models.Address{City: "San José del Cabo"}); z == nil || z.Name != "cabos" {
+		t.Errorf("Expected accents to be ignored, got %+v", z)
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/joledev/api-scheduler/metrics"
+	"github.com/joledev/api-scheduler/models"
+)
+
+// topSlots is how many of the most requested weekday/time slots are listed.
+const topSlots = 10
+
+// Stats computes the admin booking statistics and keeps each result for a
+// short TTL, so a dashboard polling it does not rescan the table each time.
+type Stats struct {
+	db  *sql.DB
+	ttl time.Duration
+	now func() time.Time
+
+	mu     sync.Mutex
+	cached map[string]cachedStats
+}
+
+type cachedStats struct {
+	stats   *models.BookingStats
+	expires time.Time
+}
+
+func NewStats(db *sql.DB, ttl time.Duration) *Stats {
+	return &Stats{db: db, ttl: ttl, now: time.Now, cached: map[string]cachedStats{}}
+}
+
+// Bookings returns the statistics of the bookings whose meeting is between
+// the dates from and to, inclusive. The lock is held while computing, so
+// concurrent requests for the same range run the queries once.
+func (s *Stats) Bookings(ctx context.Context, from, to string) (*models.BookingStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key := from + "/" + to
+	if c, ok := s.cached[key]; ok && now.Before(c.expires) {
+		return c.stats, nil
+	}
+	done := metrics.TimeQuery("booking_stats")
+	stats, err := bookingStats(ctx, s.db, from, to)
+	done()
+	if err != nil {
+		return nil, err
+	}
+	stats.GeneratedAt = now.UTC().Format(time.RFC3339)
+	for k, c := range s.cached {
+		if !now.Before(c.expires) {
+			delete(s.cached, k)
+		}
+	}
+	s.cached[key] = cachedStats{stats: stats, expires: now.Add(s.ttl)}
+	return stats, nil
+}
+
+func bookingStats(ctx context.Context, db *sql.DB, from, to string) (*models.BookingStats, error) {
+	st := &models.BookingStats{
+		From: from, To: to, Statuses: map[string]int{},
+		Weeks: []models.WeekStats{}, ByHour: []models.HourCount{},
+		ByWeekday: []models.WeekdayCount{}, TopSlots: []models.SlotCount{},
+	}
+
+	// Weeks start on Monday: %w is 0 on Sunday.
+	err := eachRow(ctx, db,
+		`SELECT date(date, '-' || ((CAST(strftime('%w', date) AS INTEGER) + 6) % 7) || ' days') AS week, status, COUNT(*)
+		 FROM bookings WHERE date BETWEEN ? AND ? GROUP BY week, status ORDER BY week`,
+		[]any{from, to}, func(rows *sql.Rows) error {
+			var week, status string
+			var n int
+			if err := rows.Scan(&week, &status, &n); err != nil {
+				return err
+			}
+			if len(st.Weeks) == 0 || st.Weeks[len(st.Weeks)-1].WeekStart != week {
+				st.Weeks = append(st.Weeks, models.WeekStats{WeekStart: week, Statuses: map[string]int{}})
+			}
+			wk := &st.Weeks[len(st.Weeks)-1]
+			wk.Statuses[status] += n
+			wk.Total += n
+			st.Statuses[status] += n
+			st.Total += n
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := st.Statuses[StatusConfirmed] + st.Statuses[StatusCompleted] + st.Statuses[StatusNoShow]
+	if decided := accepted + st.Statuses[StatusRejected]; decided > 0 {
+		st.ConfirmRate = round(float64(accepted)/float64(decided), 3)
+		st.RejectRate = round(float64(st.Statuses[StatusRejected])/float64(decided), 3)
+	}
+
+	// The median takes the middle row, or the average of the middle two.
+	var median sql.NullFloat64
+	err = db.QueryRowContext(ctx,
+		`WITH leads AS (
+		   SELECT julianday(date || ' ' || start_time) - julianday(created_at) AS days
+		   FROM bookings WHERE date BETWEEN ? AND ? AND created_at IS NOT NULL
+		 )
+		 SELECT AVG(days) FROM (
+		   SELECT days FROM leads ORDER BY days
+		   LIMIT 2 - (SELECT COUNT(*) FROM leads) % 2 OFFSET ((SELECT COUNT(*) FROM leads) - 1) / 2
+		 )`, from, to).Scan(&median)
+	if err != nil {
+		return nil, err
+	}
+	st.MedianLeadDays = round(median.Float64, 1)
+
+	err = eachRow(ctx, db,
+		`SELECT CAST(substr(start_time, 1, 2) AS INTEGER) AS hour, COUNT(*)
+		 FROM bookings WHERE date BETWEEN ? AND ? GROUP BY hour ORDER BY hour`,
+		[]any{from, to}, func(rows *sql.Rows) error {
+			var c models.HourCount
+			if err := rows.Scan(&c.Hour, &c.Count); err != nil {
+				return err
+			}
+			st.ByHour = append(st.ByHour, c)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(ctx, db,
+		`SELECT CAST(strftime('%w', date) AS INTEGER) AS weekday, COUNT(*)
+		 FROM bookings WHERE date BETWEEN ? AND ? GROUP BY weekday ORDER BY weekday`,
+		[]any{from, to}, func(rows *sql.Rows) error {
+			var c models.WeekdayCount
+			if err := rows.Scan(&c.Weekday, &c.Count); err != nil {
+				return err
+			}
+			st.ByWeekday = append(st.ByWeekday, c)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = eachRow(ctx, db,
+		`SELECT CAST(strftime('%w', date) AS INTEGER) AS weekday, start_time, COUNT(*) AS n
+		 FROM bookings WHERE date BETWEEN ? AND ?
+		 GROUP BY weekday, start_time ORDER BY n DESC, weekday, start_time LIMIT ?`,
+		[]any{from, to, topSlots}, func(rows *sql.Rows) error {
+			var c models.SlotCount
+			if err := rows.Scan(&c.Weekday, &c.StartTime, &c.Count); err != nil {
+				return err
+			}
+			st.TopSlots = append(st.TopSlots, c)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// eachRow runs query and calls scan for every row.
+func eachRow(ctx context.Context, db *sql.DB, query string, args []any, scan func(*sql.Rows) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func round(x float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(x*p) / p
+}
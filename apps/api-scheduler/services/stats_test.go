@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStatsBookings(t *testing.T) {
+	now := time.Date(2037, 6, 25, 12, 0, 0, 0, time.UTC)
+	_, db := newTestAdmins(t, &now)
+	insert := func(id, date, start, status, created string) {
+		t.Helper()
+		if _, err := db.Exec(
+			`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, status, created_at)
+			 VALUES (?, ?, ?, ?, 'videollamada', 'Test', 'test@example.com', ?, ?)`,
+			id, date, start, start, status, created); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Leads of 5, 1, 10, 2, 3 and 4 days; the last booking is out of range.
+	insert("BK-1", "2037-06-15", "09:00", StatusConfirmed, "2037-06-10 09:00:00")
+	insert("BK-2", "2037-06-15", "10:00", StatusRejected, "2037-06-14 10:00:00")
+	insert("BK-3", "2037-06-21", "09:00", StatusCompleted, "2037-06-11 09:00:00") // a Sunday
+	insert("BK-4", "2037-06-22", "09:00", StatusPending, "2037-06-20 09:00:00")
+	insert("BK-5", "2037-06-22", "09:00", StatusCancelled, "2037-06-19 09:00:00")
+	insert("BK-6", "2037-06-24", "14:00", StatusNoShow, "2037-06-20 14:00:00")
+	insert("BK-7", "2037-07-01", "11:00", StatusConfirmed, "2037-06-20 14:00:00")
+
+	stats := NewStats(db, 5*time.Minute)
+	stats.now = func() time.Time { return now }
+	st, err := stats.Bookings(context.Background(), "2037-06-01", "2037-06-30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Total != 6 || st.Statuses[StatusConfirmed] != 1 || st.Statuses[StatusPending] != 1 {
+		t.Errorf("total %d, statuses %v", st.Total, st.Statuses)
+	}
+	if got := fmt.Sprint(st.Weeks); got != "[{2037-06-15 3 map[completed:1 confirmed:1 rejected:1]} {2037-06-22 3 map[cancelled:1 no_show:1 pending:1]}]" {
+		t.Errorf("weeks = %s", got)
+	}
+	if st.ConfirmRate != 0.75 || st.RejectRate != 0.25 {
+		t.Errorf("confirm rate %v, reject rate %v", st.ConfirmRate, st.RejectRate)
+	}
+	if st.MedianLeadDays != 3.5 {
+		t.Errorf("median lead %v days, want 3.5", st.MedianLeadDays)
+	}
+	if got := fmt.Sprint(st.ByHour); got != "[{9 4} {10 1} {14 1}]" {
+		t.Errorf("by hour = %s", got)
+	}
+	if got := fmt.Sprint(st.ByWeekday); got != "[{0 1} {1 4} {3 1}]" {
+		t.Errorf("by weekday = %s", got)
+	}
+	if got := fmt.Sprint(st.TopSlots); got != "[{1 09:00 3} {0 09:00 1} {1 10:00 1} {3 14:00 1}]" {
+		t.Errorf("top slots = %s", got)
+	}
+	if st.GeneratedAt != "2037-06-25T12:00:00Z" {
+		t.Errorf("generated at %s", st.GeneratedAt)
+	}
+
+	// A new booking shows up once the cached result expires.
+	insert("BK-8", "2037-06-16", "09:00", StatusPending, "2037-06-15 09:00:00")
+	if st, _ := stats.Bookings(context.Background(), "2037-06-01", "2037-06-30"); st.Total != 6 {
+		t.Errorf("within the TTL: total %d, want the cached 6", st.Total)
+	}
+	now = now.Add(5 * time.Minute)
+	if st, _ := stats.Bookings(context.Background(), "2037-06-01", "2037-06-30"); st.Total != 7 {
+		t.Errorf("after the TTL: total %d, want 7", st.Total)
+	}
+
+	empty, err := stats.Bookings(context.Background(), "2038-01-01", "2038-01-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Total != 0 || empty.MedianLeadDays != 0 || empty.ConfirmRate != 0 || empty.Weeks == nil || empty.TopSlots == nil {
+		t.Errorf("empty range = %+v", empty)
+	}
+}
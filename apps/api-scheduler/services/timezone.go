@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+// businessTZ is the zone of the dates and times stored with bookings, used
+// when they are turned into instants for emails, invitations and meeting
+// links. main sets it from the configuration with SetTimezone.
+var businessTZ = defaultTimezone()
+
+func defaultTimezone() *time.Location {
+	loc, err := time.LoadLocation("America/Tijuana")
+	if err != nil {
+		// Fallback: America/Tijuana is UTC-8 (PST) / UTC-7 (PDT), same as LA
+		loc, _ = time.LoadLocation("America/Los_Angeles")
+	}
+	return loc
+}
+
+// SetTimezone sets the business time zone. Call it once at startup, before
+// serving requests.
+func SetTimezone(loc *time.Location) {
+	businessTZ = loc
+}
+
+// ClientLocation loads the IANA time zone a client sent, such as
+// "America/New_York". It refuses "Local", which would be the server's zone,
+// and the empty name, which time.LoadLocation takes as UTC.
+func ClientLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" || len(name) > 64 {
+		return nil, errors.New("not an IANA time zone name")
+	}
+	return time.LoadLocation(name)
+}
+
+// LocalizeSlots sets each slot's Client times to its instants in loc.
+func LocalizeSlots(slots []models.AvailableSlot, loc *time.Location) error {
+	for i := range slots {
+		start, err := time.Parse(time.RFC3339, slots[i].Start)
+		if err != nil {
+			return err
+		}
+		end, err := time.Parse(time.RFC3339, slots[i].End)
+		if err != nil {
+			return err
+		}
+		start, end = start.In(loc), end.In(loc)
+		slots[i].Client = &models.LocalSlot{
+			Date:      start.Format("2006-01-02"),
+			StartTime: start.Format("15:04"),
+			EndTime:   end.Format("15:04"),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+// TOTP parameters (RFC 6238): HMAC-SHA1, 6 digits, 30-second steps, and one
+// step of clock drift accepted either way. These are what every
+// authenticator app assumes when the URI does not say otherwise.
+const (
+	totpIssuer        = "JoleDev Scheduler"
+	totpDigits        = 6
+	totpPeriod        = 30
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidCode     = errors.New("invalid one-time code")
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode is the HOTP value (RFC 4226) of secret at counter step.
+func totpCode(secret []byte, step int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	m := hmac.New(sha1.New, secret)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, v%mod)
+}
+
+// matchTOTP returns the time step code is valid for at now, allowing
+// totpSkew steps of drift. Steps at or before lastStep are refused so a code
+// works only once.
+func matchTOTP(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(totpCode(key, step, totpDigits))) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// provisioningURI is the otpauth:// URI authenticator apps scan from a QR
+// code.
+func provisioningURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	q := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	// Some apps show a literal "+" for spaces in the issuer.
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// normalizeRecoveryCode lets recovery codes be typed in any case, with or
+// without the dash and spaces.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+type totpState struct {
+	secret   string
+	lastStep int64
+}
+
+func (a *Admins) totpState(ctx context.Context, userID int64) (totpState, bool, error) {
+	var (
+		st      totpState
+		enabled bool
+	)
+	err := a.db.QueryRowContext(ctx,
+		`SELECT COALESCE(totp_secret, ''), totp_last_step, totp_enabled FROM admin_users WHERE id = ?`,
+		userID).Scan(&st.secret, &st.lastStep, &enabled)
+	if err == sql.ErrNoRows {
+		return st, false, ErrUserNotFound
+	}
+	return st, enabled, err
+}
+
+// checkSecondFactor accepts a current one-time code or an unused recovery
+// code for the user, consuming it.
+func (a *Admins) checkSecondFactor(ctx context.Context, userID int64, st totpState, code string, now time.Time) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := matchTOTP(st.secret, code, now, st.lastStep); ok {
+		// The WHERE clause makes the step check atomic with concurrent logins.
+		res, err := a.db.ExecContext(ctx,
+			`UPDATE admin_users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, _ := res.RowsAffected()
+		return n == 1, nil
+	}
+
+	res, err := a.db.ExecContext(ctx,
+		`UPDATE admin_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		now.Format(dbTime), userID, hashID(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// EnrollTOTP gives u a new TOTP secret and returns it with its provisioning
+// URI. It takes effect only after ConfirmTOTP, so an abandoned enrollment
+// cannot lock the account out; enrolling again replaces the secret.
+func (a *Admins) EnrollTOTP(ctx context.Context, u *models.AdminUser) (secret, uri string, err error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+	secret = b32.EncodeToString(key)
+	res, err := a.db.ExecContext(ctx,
+		`UPDATE admin_users SET totp_secret = ?, totp_last_step = 0 WHERE id = ? AND totp_enabled = 0`,
+		secret, u.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", "", ErrTOTPEnabled
+	}
+	return secret, provisioningURI(u.Username, secret), nil
+}
+
+// ConfirmTOTP enables TOTP for u once code proves the authenticator app was
+// set up, and returns a fresh set of recovery codes. A wrong code counts
+// towards the lockout like a wrong password.
+func (a *Admins) ConfirmTOTP(ctx context.Context, u *models.AdminUser, code string) ([]string, error) {
+	now := a.now().UTC()
+	if err := a.checkLocked(ctx, u.ID, now); err != nil {
+		return nil, err
+	}
+	st, enabled, err := a.totpState(ctx, u.ID)
+	switch {
+	case err != nil:
+		return nil, err
+	case enabled:
+		return nil, ErrTOTPEnabled
+	case st.secret == "":
+		return nil, ErrTOTPNotEnrolled
+	}
+	step, ok := matchTOTP(st.secret, strings.TrimSpace(code), now, st.lastStep)
+	if !ok {
+		return nil, a.recordFailure(ctx, u, now, ErrInvalidCode)
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE admin_users SET totp_enabled = 1, totp_last_step = ? WHERE id = ?`, step, u.ID); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM admin_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(b32.EncodeToString(b))
+		codes[i] = c[:4] + "-" + c[4:]
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO admin_recovery_codes (user_id, code_hash) VALUES (?, ?)`,
+			userID, hashID(normalizeRecoveryCode(c))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns TOTP off for u after checking a one-time or recovery
+// code, so a stolen session alone cannot remove the second factor. Wrong
+// codes count towards the lockout, so neither can it guess the code.
+func (a *Admins) DisableTOTP(ctx context.Context, u *models.AdminUser, code string) error {
+	now := a.now().UTC()
+	if err := a.checkLocked(ctx, u.ID, now); err != nil {
+		return err
+	}
+	st, enabled, err := a.totpState(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTOTPNotEnrolled
+	}
+	ok, err := a.checkSecondFactor(ctx, u.ID, st, code, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return a.recordFailure(ctx, u, now, ErrInvalidCode)
+	}
+	return a.clearTOTP(ctx, u.ID)
+}
+
+// ResetTOTP turns TOTP off without a code, for an admin who lost their
+// device; it is only reachable from the admin command.
+func (a *Admins) ResetTOTP(ctx context.Context, username string) error {
+	u, err := a.user(ctx, `username = ?`, username)
+	if err != nil {
+		return err
+	}
+	return a.clearTOTP(ctx, u.ID)
+}
+
+func (a *Admins) clearTOTP(ctx context.Context, userID int64) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE admin_users SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0 WHERE id = ?`,
+		userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM admin_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
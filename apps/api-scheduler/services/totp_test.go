@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTOTPCodeRFC6238 checks the SHA-1 test vectors from RFC 6238 appendix B.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	for _, tt := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		if got := totpCode(secret, tt.unix/totpPeriod, 8); got != tt.want {
+			t.Errorf("T=%d: got %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := b32.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	code := totpCode([]byte("12345678901234567890"), step, totpDigits)
+
+	if got, ok := matchTOTP(secret, code, now, 0); !ok || got != step {
+		t.Errorf("current code: step %d, ok %v", got, ok)
+	}
+	if _, ok := matchTOTP(secret, code, now.Add(totpPeriod*time.Second), 0); !ok {
+		t.Error("code from the previous step should be accepted")
+	}
+	if _, ok := matchTOTP(secret, code, now.Add(2*totpPeriod*time.Second), 0); ok {
+		t.Error("code two steps old should be refused")
+	}
+	if _, ok := matchTOTP(secret, code, now, step); ok {
+		t.Error("replayed code should be refused")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	u, err := url.Parse(provisioningURI("ana", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/JoleDev Scheduler:ana" ||
+		q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "JoleDev Scheduler" ||
+		q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected URI %s", u)
+	}
+}
+
+// codeAt is the one-time code an authenticator app would show at now.
+func codeAt(t *testing.T, secret string, now time.Time) string {
+	t.Helper()
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, now.Unix()/totpPeriod, totpDigits)
+}
+
+func TestTOTPEnrollmentAndLogin(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 15, 9, 0, 0, 0, time.UTC)
+	a, _ := newTestAdmins(t, &now)
+	u, err := a.Create(ctx, "ana", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, uri, err := a.EnrollTOTP(ctx, u)
+	if err != nil || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("EnrollTOTP = %q, %q, %v", secret, uri, err)
+	}
+	// Enrollment alone does not change the login.
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", ""); err != nil {
+		t.Fatalf("login before confirming: %v", err)
+	}
+
+	if _, err := a.ConfirmTOTP(ctx, u, "000000"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("confirm with wrong code: got %v", err)
+	}
+	codes, err := a.ConfirmTOTP(ctx, u, codeAt(t, secret, now))
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("ConfirmTOTP = %v, %v", codes, err)
+	}
+	if _, _, err := a.EnrollTOTP(ctx, u); !errors.Is(err, ErrTOTPEnabled) {
+		t.Errorf("enrolling again: got %v", err)
+	}
+
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", ""); !errors.Is(err, ErrTOTPRequired) {
+		t.Errorf("login without code: got %v", err)
+	}
+	// The confirming code was consumed.
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", codeAt(t, secret, now)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("replayed code: got %v", err)
+	}
+
+	now = now.Add(totpPeriod * time.Second)
+	got, err := a.Authenticate(ctx, "ana", "correct horse battery", codeAt(t, secret, now))
+	if err != nil || !got.TOTPEnabled {
+		t.Fatalf("login with code: %+v, %v", got, err)
+	}
+
+	recovery := strings.ToUpper(codes[0])
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", recovery); err != nil {
+		t.Errorf("login with recovery code: %v", err)
+	}
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", recovery); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("reused recovery code: got %v", err)
+	}
+
+	if err := a.DisableTOTP(ctx, u, codes[1]); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", ""); err != nil {
+		t.Errorf("login after disabling: %v", err)
+	}
+}
+
+func TestWrongTOTPCodesCountTowardsLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 15, 9, 0, 0, 0, time.UTC)
+	a, _ := newTestAdmins(t, &now)
+	u, _ := a.Create(ctx, "ana", "correct horse battery")
+	secret, _, _ := a.EnrollTOTP(ctx, u)
+	if _, err := a.ConfirmTOTP(ctx, u, codeAt(t, secret, now)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxLoginFailures; i++ {
+		a.Authenticate(ctx, "ana", "correct horse battery", "000000")
+	}
+	now = now.Add(totpPeriod * time.Second)
+	var locked *LockedError
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", codeAt(t, secret, now)); !errors.As(err, &locked) {
+		t.Errorf("got %v, want lockout", err)
+	}
+}
+
+func TestDisablingTOTPWithWrongCodesLocksOut(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 15, 9, 0, 0, 0, time.UTC)
+	a, _ := newTestAdmins(t, &now)
+	u, _ := a.Create(ctx, "ana", "correct horse battery")
+	secret, _, _ := a.EnrollTOTP(ctx, u)
+	if _, err := a.ConfirmTOTP(ctx, u, codeAt(t, secret, now)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stolen session cannot guess its way to turning TOTP off.
+	for i := 0; i < maxLoginFailures; i++ {
+		if err := a.DisableTOTP(ctx, u, "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d: got %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+	now = now.Add(totpPeriod * time.Second)
+	var locked *LockedError
+	if err := a.DisableTOTP(ctx, u, codeAt(t, secret, now)); !errors.As(err, &locked) {
+		t.Errorf("got %v, want lockout", err)
+	}
+	if _, err := a.Authenticate(ctx, "ana", "correct horse battery", codeAt(t, secret, now)); !errors.As(err, &locked) {
+		t.Errorf("login: got %v, want lockout", err)
+	}
+
+	now = now.Add(lockoutDuration)
+	if err := a.DisableTOTP(ctx, u, codeAt(t, secret, now)); err != nil {
+		t.Errorf("after lockout: %v", err)
+	}
+}
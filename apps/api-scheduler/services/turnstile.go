@@ -2,22 +2,39 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
 	"time"
 )
 
 var turnstileClient = &http.Client{Timeout: 10 * time.Second}
 
-func VerifyTurnstile(token, remoteIP string) error {
-	secret := os.Getenv("TURNSTILE_SECRET_KEY")
+// Verify errors, so handlers can tell a missing token from a rejected one.
+var (
+	ErrCaptchaRequired = errors.New("CAPTCHA verification required")
+	ErrCaptchaFailed   = errors.New("CAPTCHA verification failed")
+)
+
+// Turnstile verifies Cloudflare Turnstile CAPTCHA tokens.
+type Turnstile struct {
+	secret string
+}
+
+// NewTurnstile returns a verifier for secret. An empty secret accepts every
+// request, for development without Cloudflare keys.
+func NewTurnstile(secret string) *Turnstile {
+	return &Turnstile{secret: secret}
+}
+
+func (t *Turnstile) Verify(token, remoteIP string) error {
+	secret := t.secret
 	if secret == "" {
 		return nil // Skip in dev (no key configured)
 	}
 	if token == "" {
-		return fmt.Errorf("CAPTCHA verification required")
+		return ErrCaptchaRequired
 	}
 	resp, err := turnstileClient.PostForm(
 		"https://challenges.cloudflare.com/turnstile/v0/siteverify",
@@ -28,14 +45,14 @@ func VerifyTurnstile(token, remoteIP string) error {
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("CAPTCHA verification failed")
+		return fmt.Errorf("%w: %v", ErrCaptchaFailed, err)
 	}
 	defer resp.Body.Close()
 	var result struct {
 		Success bool `json:"success"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || !result.Success {
-		return fmt.Errorf("CAPTCHA verification failed")
+		return ErrCaptchaFailed
 	}
 	return nil
 }
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joledev/api-scheduler/models"
+)
+
+var (
+	ErrHoldInvalid  = errors.New("invalid hold link")
+	ErrHoldClaimed  = errors.New("hold already claimed")
+	ErrHoldExpired  = errors.New("hold expired")
+	ErrLeaveInvalid = errors.New("invalid waitlist link")
+)
+
+// WaitlistEntry is a client waiting for any slot from From to To, dates in
+// the business time zone, with the details their booking would have.
+// Buffer is kept free around that booking, as for one made directly.
+type WaitlistEntry struct {
+	ID            int64
+	ClientName    string
+	ClientEmail   string
+	ClientPhone   string
+	ClientCompany string
+	ClientAddress string
+	Address       models.Address
+	Zone          string
+	Buffer        time.Duration
+	MeetingType   string
+	From          string
+	To            string
+	Timezone      string
+	Notes         string
+	Lang          string
+}
+
+// Waitlist keeps clients waiting for a freed slot and the holds offered to
+// them.
+//
+// A freed slot is held for the first waiting client it suits as a booking
+// in status held, which blocks the slot until its hold_expires_at. The
+// client is sent a hold link, "<id>.<mac>" like an action token but under
+// its own key, to claim it; only the SHA-256 of the ID is stored.
+//
+// The link to leave the waitlist signs the entry's row ID instead, under a
+// third key: it holds nothing, so there is nothing to store.
+type Waitlist struct {
+	db       *sql.DB
+	key      []byte
+	leaveKey []byte
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+func NewWaitlist(db *sql.DB, secret []byte, ttl time.Duration) *Waitlist {
+	return &Waitlist{
+		db: db, key: deriveKey(secret, "waitlist hold token"), leaveKey: deriveKey(secret, "waitlist leave token"),
+		ttl: ttl, now: time.Now,
+	}
+}
+
+func deriveKey(secret []byte, purpose string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(purpose))
+	return m.Sum(nil)
+}
+
+// Join adds e to the end of the waitlist. A client already waiting has
+// their entry replaced by e instead, keeping their place.
+func (wl *Waitlist) Join(ctx context.Context, e WaitlistEntry) (int64, error) {
+	tx, err := wl.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	args := []any{
+		e.ClientName, e.ClientEmail, nullString(e.ClientPhone), nullString(e.ClientCompany), nullString(e.ClientAddress),
+		nullString(e.Address.Street), nullString(e.Address.City), nullString(e.Address.State), nullString(e.Address.PostalCode),
+		nullString(e.Zone), int(e.Buffer / time.Minute), e.MeetingType, e.From, e.To,
+		nullString(e.Timezone), nullString(e.Notes), e.Lang,
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM waitlist WHERE client_email = ? AND status = 'waiting'`, e.ClientEmail).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO waitlist (client_name, client_email, client_phone, client_company, client_address,
+			 address_street, address_city, address_state, address_postal_code,
+			 service_zone, buffer_minutes, meeting_type, from_date, to_date,
+			 client_timezone, notes, lang, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			append(args, wl.now().UTC().Format(dbTime))...)
+		if err != nil {
+			return 0, err
+		}
+		id, _ = res.LastInsertId()
+	case err != nil:
+		return 0, err
+	default:
+		_, err = tx.ExecContext(ctx,
+			`UPDATE waitlist SET client_name = ?, client_email = ?, client_phone = ?, client_company = ?, client_address = ?,
+			 address_street = ?, address_city = ?, address_state = ?, address_postal_code = ?,
+			 service_zone = ?, buffer_minutes = ?, meeting_type = ?, from_date = ?, to_date = ?,
+			 client_timezone = ?, notes = ?, lang = ?
+			 WHERE id = ?`,
+			append(args, id)...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// LeaveToken returns the token of the link that takes entry id off the
+// waitlist. Replacing the entry keeps it valid.
+func (wl *Waitlist) LeaveToken(id int64) string {
+	s := strconv.FormatInt(id, 10)
+	return s + "." + signID(wl.leaveKey, s)
+}
+
+// entry returns the entry a leave token is for, or false when its signature
+// is wrong.
+func (wl *Waitlist) entry(token string) (int64, bool) {
+	s, mac, ok := strings.Cut(token, ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(mac), []byte(signID(wl.leaveKey, s))) != 1 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil
+}
+
+// CheckLeave returns the language of the entry a leave token is for and
+// whether it is still waiting, without changing it.
+func (wl *Waitlist) CheckLeave(ctx context.Context, token string) (lang string, waiting bool, err error) {
+	id, ok := wl.entry(token)
+	if !ok {
+		return "", false, ErrLeaveInvalid
+	}
+	var status string
+	err = wl.db.QueryRowContext(ctx, `SELECT lang, status FROM waitlist WHERE id = ?`, id).Scan(&lang, &status)
+	if err == sql.ErrNoRows {
+		return "", false, ErrLeaveInvalid
+	}
+	return lang, status == "waiting", err
+}
+
+// Leave takes the entry a leave token is for off the waitlist and returns
+// its language, and whether it left: an entry no longer waiting, because it
+// was already offered a slot or left, is left as it is.
+func (wl *Waitlist) Leave(ctx context.Context, token string) (lang string, left bool, err error) {
+	id, ok := wl.entry(token)
+	if !ok {
+		return "", false, ErrLeaveInvalid
+	}
+	err = wl.db.QueryRowContext(ctx,
+		`UPDATE waitlist SET status = 'left' WHERE id = ? AND status = 'waiting' RETURNING lang`, id).Scan(&lang)
+	if err == sql.ErrNoRows {
+		lang, _, err = wl.CheckLeave(ctx, token)
+		return lang, false, err
+	}
+	return lang, err == nil, err
+}
+
+// Candidates lists the clients waiting for a slot on date, first come
+// first.
+func (wl *Waitlist) Candidates(ctx context.Context, tx *sql.Tx, date string) ([]WaitlistEntry, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, client_name, client_email, COALESCE(client_phone, ''), COALESCE(client_company, ''),
+		        COALESCE(client_address, ''), COALESCE(address_street, ''), COALESCE(address_city, ''),
+		        COALESCE(address_state, ''), COALESCE(address_postal_code, ''), COALESCE(service_zone, ''),
+		        buffer_minutes, meeting_type, from_date, to_date, COALESCE(client_timezone, ''),
+		        COALESCE(notes, ''), lang
+		 FROM waitlist WHERE status = 'waiting' AND from_date <= ? AND to_date >= ?
+		 ORDER BY created_at, id`, date, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []WaitlistEntry
+	for rows.Next() {
+		var (
+			e    WaitlistEntry
+			mins int
+		)
+		if err := rows.Scan(&e.ID, &e.ClientName, &e.ClientEmail, &e.ClientPhone, &e.ClientCompany,
+			&e.ClientAddress, &e.Address.Street, &e.Address.City, &e.Address.State, &e.Address.PostalCode,
+			&e.Zone, &mins, &e.MeetingType, &e.From, &e.To, &e.Timezone, &e.Notes, &e.Lang); err != nil {
+			return nil, err
+		}
+		e.Buffer = time.Duration(mins) * time.Minute
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Hold offers held booking bookingID (the row ID) to waiting entry entryID,
+// inside tx, and returns the link token and when the hold expires.
+func (wl *Waitlist) Hold(ctx context.Context, tx *sql.Tx, entryID, bookingID int64) (string, time.Time, error) {
+	id, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := wl.now().UTC().Add(wl.ttl).Truncate(time.Second)
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE bookings SET hold_expires_at = ? WHERE id = ? AND status = 'held'`,
+		expires.Format(dbTime), bookingID); err != nil {
+		return "", time.Time{}, err
+	}
+	res, err := tx.ExecContext(ctx,
+		`UPDATE waitlist SET status = 'offered', booking_id = ?, hold_hash = ? WHERE id = ? AND status = 'waiting'`,
+		bookingID, hashID(id), entryID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return "", time.Time{}, errors.New("waitlist entry is not waiting")
+	}
+	return id + "." + signID(wl.key, id), expires, nil
+}
+
+// hash returns the stored hash of token's ID, or false when its signature
+// is wrong.
+func (wl *Waitlist) hash(token string) (string, bool) {
+	id, mac, ok := strings.Cut(token, ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(mac), []byte(signID(wl.key, id))) != 1 {
+		return "", false
+	}
+	return hashID(id), true
+}
+
+// Check returns the held booking token would claim without claiming it, or
+// why it cannot be claimed; the booking is known unless ErrHoldInvalid.
+func (wl *Waitlist) Check(ctx context.Context, token string) (int64, error) {
+	return wl.check(ctx, wl.db, token)
+}
+
+func (wl *Waitlist) check(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, token string) (int64, error) {
+	hash, ok := wl.hash(token)
+	if !ok {
+		return 0, ErrHoldInvalid
+	}
+	var (
+		bookingID int64
+		entry     string
+		status    string
+		expiresAt sql.NullTime
+	)
+	err := q.QueryRowContext(ctx,
+		`SELECT w.booking_id, w.status, b.status, b.hold_expires_at
+		 FROM waitlist w JOIN bookings b ON b.id = w.booking_id WHERE w.hold_hash = ?`,
+		hash).Scan(&bookingID, &entry, &status, &expiresAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, ErrHoldInvalid
+	case err != nil:
+		return 0, err
+	case entry == "booked":
+		return bookingID, ErrHoldClaimed
+	case entry != "offered" || status != StatusHeld || !expiresAt.Valid || !wl.now().Before(expiresAt.Time):
+		return bookingID, ErrHoldExpired
+	}
+	return bookingID, nil
+}
+
+// Claim spends token inside tx and returns the held booking it claims,
+// which the caller moves on to pending. Of two concurrent claims only one
+// succeeds. Like Check, it returns the booking with ErrHoldClaimed and
+// ErrHoldExpired.
+func (wl *Waitlist) Claim(ctx context.Context, tx *sql.Tx, token string) (int64, error) {
+	hash, ok := wl.hash(token)
+	if !ok {
+		return 0, ErrHoldInvalid
+	}
+	var bookingID int64
+	err := tx.QueryRowContext(ctx,
+		`UPDATE waitlist SET status = 'booked'
+		 WHERE hold_hash = ? AND status = 'offered'
+		 AND booking_id IN (SELECT id FROM bookings WHERE status = 'held' AND hold_expires_at > ?)
+		 RETURNING booking_id`,
+		hash, wl.now().UTC().Format(dbTime)).Scan(&bookingID)
+	if err == sql.ErrNoRows {
+		// Say why: unknown, claimed or expired.
+		if id, err := wl.check(ctx, tx, token); err != nil {
+			return id, err
+		}
+		return 0, ErrHoldInvalid
+	}
+	return bookingID, err
+}
+
+// Lapse ends the offer of held booking bookingID, inside tx, when it
+// expires or is cancelled. The client is not offered another slot.
+func (wl *Waitlist) Lapse(ctx context.Context, tx *sql.Tx, bookingID int64) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE waitlist SET status = 'lapsed' WHERE booking_id = ? AND status = 'offered'`, bookingID)
+	return err
+}
+
+// Expire moves the held bookings whose hold has run out to expired, inside
+// tx, lapsing their offers, and returns their row IDs.
+func (wl *Waitlist) Expire(ctx context.Context, tx *sql.Tx) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx,
+		`UPDATE bookings SET status = 'expired' WHERE status = 'held' AND hold_expires_at <= ? RETURNING id`,
+		wl.now().UTC().Format(dbTime))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := wl.Lapse(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
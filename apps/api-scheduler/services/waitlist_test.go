@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestWaitlist returns a Waitlist on a migrated test database whose
+// clock is *now, with holds lasting an hour.
+func newTestWaitlist(t *testing.T, now *time.Time) (*Waitlist, *sql.DB) {
+	t.Helper()
+	_, db := newTestAdmins(t, now)
+	wl := NewWaitlist(db, []byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	wl.now = func() time.Time { return *now }
+	return wl, db
+}
+
+func join(t *testing.T, wl *Waitlist, email, from, to string) int64 {
+	t.Helper()
+	id, err := wl.Join(context.Background(), WaitlistEntry{
+		ClientName: "Test", ClientEmail: email, MeetingType: "videollamada",
+		Buffer: DefaultBuffer, From: from, To: to, Lang: "es",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// hold offers a new held booking to entry and returns the token and the
+// booking's row ID.
+func hold(t *testing.T, wl *Waitlist, db *sql.DB, entry int64, bookingID string) (string, int64) {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(
+		`INSERT INTO bookings (booking_id, date, start_time, end_time, meeting_type, client_name, client_email, status)
+		 VALUES (?, '2037-06-15', '09:00', '09:30', 'videollamada', 'Test', 'test@example.com', 'held')`, bookingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	token, _, err := wl.Hold(context.Background(), tx, entry, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return token, id
+}
+
+func claim(wl *Waitlist, db *sql.DB, token string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id, err := wl.Claim(context.Background(), tx, token)
+	if err != nil {
+		return id, err
+	}
+	return id, tx.Commit()
+}
+
+func TestWaitlistCandidates(t *testing.T) {
+	now := time.Date(2037, 6, 1, 9, 0, 0, 0, time.UTC)
+	wl, db := newTestWaitlist(t, &now)
+
+	first := join(t, wl, "first@example.com", "2037-06-15", "2037-06-19")
+	now = now.Add(time.Minute)
+	join(t, wl, "other@example.com", "2037-06-16", "2037-06-19")
+	now = now.Add(time.Minute)
+	last := join(t, wl, "last@example.com", "2037-06-01", "2037-06-15")
+	// Joining again keeps the first client's place.
+	now = now.Add(time.Minute)
+	if again := join(t, wl, "first@example.com", "2037-06-10", "2037-06-20"); again != first {
+		t.Errorf("Expected the entry replaced, got a new one %d", again)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	entries, err := wl.Candidates(context.Background(), tx, "2037-06-15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != first || entries[1].ID != last {
+		t.Fatalf("Expected first then last, got %+v", entries)
+	}
+	if e := entries[0]; e.From != "2037-06-10" || e.To != "2037-06-20" || e.Buffer != DefaultBuffer {
+		t.Errorf("Expected the replaced entry, got %+v", e)
+	}
+}
+
+func TestWaitlistHoldClaimedOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 1, 9, 0, 0, 0, time.UTC)
+	wl, db := newTestWaitlist(t, &now)
+	token, bookingID := hold(t, wl, db, join(t, wl, "a@example.com", "2037-06-15", "2037-06-15"), "BK-2037-001")
+
+	if id, err := wl.Check(ctx, token); err != nil || id != bookingID {
+		t.Fatalf("Check = %d, %v", id, err)
+	}
+	if _, err := wl.Check(ctx, token+"x"); !errors.Is(err, ErrHoldInvalid) {
+		t.Errorf("Expected a tampered token to be invalid, got %v", err)
+	}
+	other := NewWaitlist(db, []byte("another secret, another key 1234"), time.Hour)
+	if _, err := other.Check(ctx, token); !errors.Is(err, ErrHoldInvalid) {
+		t.Errorf("Expected a token signed with another key to be invalid, got %v", err)
+	}
+
+	if id, err := claim(wl, db, token); err != nil || id != bookingID {
+		t.Fatalf("Claim = %d, %v", id, err)
+	}
+	if _, err := claim(wl, db, token); !errors.Is(err, ErrHoldClaimed) {
+		t.Errorf("Expected a second claim to fail, got %v", err)
+	}
+}
+
+func TestWaitlistHoldExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 1, 9, 0, 0, 0, time.UTC)
+	wl, db := newTestWaitlist(t, &now)
+	entry := join(t, wl, "a@example.com", "2037-06-15", "2037-06-15")
+	token, bookingID := hold(t, wl, db, entry, "BK-2037-001")
+	_, kept := hold(t, wl, db, join(t, wl, "b@example.com", "2037-06-15", "2037-06-15"), "BK-2037-002")
+	db.Exec(`UPDATE bookings SET hold_expires_at = ? WHERE id = ?`, "2037-06-01 11:00:00", kept)
+
+	now = now.Add(time.Hour)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := wl.Expire(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != bookingID {
+		t.Errorf("Expected only the first hold expired, got %v", ids)
+	}
+
+	if _, err := claim(wl, db, token); !errors.Is(err, ErrHoldExpired) {
+		t.Errorf("Expected an expired hold, got %v", err)
+	}
+	var booking, entryStatus string
+	db.QueryRow(`SELECT status FROM bookings WHERE id = ?`, bookingID).Scan(&booking)
+	db.QueryRow(`SELECT status FROM waitlist WHERE id = ?`, entry).Scan(&entryStatus)
+	if booking != StatusExpired || entryStatus != "lapsed" {
+		t.Errorf("Expected booking expired and entry lapsed, got %s and %s", booking, entryStatus)
+	}
+}
+
+func TestWaitlistLeave(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2037, 6, 1, 9, 0, 0, 0, time.UTC)
+	wl, db := newTestWaitlist(t, &now)
+	entry := join(t, wl, "a@example.com", "2037-06-15", "2037-06-19")
+	token := wl.LeaveToken(entry)
+
+	// The signature must match the entry ID it comes with.
+	_, mac, _ := strings.Cut(token, ".")
+	other := strconv.FormatInt(entry+1, 10) + "." + mac
+	for _, bad := range []string{"", "nonsense", token + "x", other} {
+		if _, _, err := wl.Leave(ctx, bad); !errors.Is(err, ErrLeaveInvalid) {
+			t.Errorf("Leave(%q) = %v, want ErrLeaveInvalid", bad, err)
+		}
+	}
+	if lang, waiting, err := wl.CheckLeave(ctx, token); err != nil || !waiting || lang != "es" {
+		t.Fatalf("CheckLeave = %q, %v, %v", lang, waiting, err)
+	}
+	if _, left, err := wl.Leave(ctx, token); err != nil || !left {
+		t.Fatalf("Leave = %v, %v", left, err)
+	}
+	if _, left, err := wl.Leave(ctx, token); err != nil || left {
+		t.Errorf("Leaving twice = %v, %v; want nothing to do", left, err)
+	}
+
+	// Joining again starts a new entry, with its own link.
+	if again := join(t, wl, "a@example.com", "2037-06-15", "2037-06-19"); again == entry {
+		t.Error("Expected a new entry after leaving")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	entries, err := wl.Candidates(ctx, tx, "2037-06-15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID == entry {
+		t.Errorf("Expected only the new entry waiting, got %+v", entries)
+	}
+}